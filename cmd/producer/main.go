@@ -7,6 +7,7 @@ import (
 	"github.com/couchbase/eventing/audit"
 	"github.com/couchbase/eventing/common"
 	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/notification"
 	"github.com/couchbase/eventing/supervisor"
 	"github.com/couchbase/eventing/util"
 	"gopkg.in/couchbase/gocb.v1"
@@ -21,6 +22,8 @@ func main() {
 
 	audit.Init(flags.restPort)
 
+	notification.Manager = notification.NewManager(flags.restPort, flags.uuid)
+
 	adminPort := supervisor.AdminPortConfig{
 		DebuggerPort: flags.debugPort,
 		HTTPPort:     flags.adminHTTPPort,
@@ -105,5 +108,17 @@ func main() {
 		}
 	}(s)
 
+	// For replaying dead letter entries
+	go func(s *supervisor.SuperSupervisor) {
+		cancelCh := make(chan struct{})
+		for {
+			err := metakv.RunObserveChildren(common.MetakvDeadLetterReplayPath, s.DeadLetterReplayCallback, cancelCh)
+			if err != nil {
+				logging.Errorf("Eventing::main metakv observe error for dead letter replay, err: %v. Retrying.", err)
+				time.Sleep(2 * time.Second)
+			}
+		}
+	}(s)
+
 	s.HandleSupCmdMsg()
 }
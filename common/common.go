@@ -1,8 +1,11 @@
 package common
 
 import (
+	"encoding/json"
 	"errors"
 	"net"
+	"strconv"
+	"time"
 
 	"github.com/couchbase/eventing/dcp"
 )
@@ -10,13 +13,16 @@ import (
 type DcpStreamBoundary string
 
 const (
-	DcpEverything = DcpStreamBoundary("everything")
-	DcpFromNow    = DcpStreamBoundary("from_now")
-	DcpFromPrior  = DcpStreamBoundary("from_prior")
+	DcpEverything             = DcpStreamBoundary("everything")
+	DcpFromNow                = DcpStreamBoundary("from_now")
+	DcpFromPrior              = DcpStreamBoundary("from_prior")
+	DcpFromSeqnos             = DcpStreamBoundary("from_seqnos")
+	DcpFromCheckpointSnapshot = DcpStreamBoundary("from_checkpoint_snapshot")
 )
 
 var MetakvMaxRetries int64 = 60
 var LanguageCompatibility = []string{"6.0.0", "6.5.0"}
+var EventFilterOps = []string{"eq", "ne", "exists", "not_exists"}
 
 type ChangeType string
 type StatsData map[string]uint64
@@ -62,6 +68,9 @@ const (
 	MetakvTempAppsPath    = MetakvEventingPath + "tempApps/"
 	MetakvCredentialsPath = MetakvEventingPath + "credentials/"
 	MetakvConfigPath      = MetakvEventingPath + "settings/config"
+
+	// MetakvDeadLetterReplayPath is updated with dead letter entries that need to be replayed
+	MetakvDeadLetterReplayPath = MetakvEventingPath + "deadLetterReplay/"
 )
 
 type DebuggerInstance struct {
@@ -86,16 +95,70 @@ type Application struct {
 }
 
 type DepCfg struct {
-	Buckets        []Bucket `json:"buckets"`
-	Curl           []Curl   `json:"curl"`
-	MetadataBucket string   `json:"metadata_bucket"`
-	SourceBucket   string   `json:"source_bucket"`
+	Buckets          []Bucket    `json:"buckets"`
+	Curl             []Curl      `json:"curl"`
+	DeadLetter       *DeadLetter `json:"dead_letter,omitempty"`
+	MetadataBucket   string      `json:"metadata_bucket"`
+	SourceBucket     string      `json:"source_bucket"`
+	SourceScope      string      `json:"source_scope,omitempty"`
+	SourceCollection string      `json:"source_collection,omitempty"`
 }
 
 type Bucket struct {
-	Alias      string `json:"alias"`
-	BucketName string `json:"bucket_name"`
-	Access     string `json:"access"`
+	Alias          string `json:"alias"`
+	BucketName     string `json:"bucket_name"`
+	ScopeName      string `json:"scope_name,omitempty"`
+	CollectionName string `json:"collection_name,omitempty"`
+	Access         string `json:"access"`
+}
+
+// Keyspace returns the keyspace the binding refers to
+func (b *Bucket) Keyspace() Keyspace {
+	return NewKeyspace(b.BucketName, b.ScopeName, b.CollectionName)
+}
+
+// SourceKeyspace returns the keyspace the function listens to
+func (d *DepCfg) SourceKeyspace() Keyspace {
+	return NewKeyspace(d.SourceBucket, d.SourceScope, d.SourceCollection)
+}
+
+const (
+	DefaultScope      = "_default"
+	DefaultCollection = "_default"
+)
+
+// Keyspace is a collection of a bucket. Bucket names may contain dots, so the scope and collection
+// are always given apart from the bucket rather than parsed out of a dotted name.
+type Keyspace struct {
+	BucketName     string
+	ScopeName      string
+	CollectionName string
+}
+
+// NewKeyspace returns the keyspace of a collection, an empty scope or collection standing for the
+// default one
+func NewKeyspace(bucketName, scopeName, collectionName string) Keyspace {
+	if scopeName == "" {
+		scopeName = DefaultScope
+	}
+	if collectionName == "" {
+		collectionName = DefaultCollection
+	}
+	return Keyspace{BucketName: bucketName, ScopeName: scopeName, CollectionName: collectionName}
+}
+
+func (k Keyspace) IsDefaultCollection() bool {
+	return k.ScopeName == DefaultScope && k.CollectionName == DefaultCollection
+}
+
+// String returns the default collection as its bucket name, as N1QL names it, and other collections
+// as `bucket`.`scope`.`collection`. Backquotes can't be part of bucket, scope or collection names,
+// so no two keyspaces are written the same.
+func (k Keyspace) String() string {
+	if k.IsDefaultCollection() {
+		return k.BucketName
+	}
+	return "`" + k.BucketName + "`.`" + k.ScopeName + "`.`" + k.CollectionName + "`"
 }
 
 type Curl struct {
@@ -107,6 +170,77 @@ type Curl struct {
 	BearerKey              string `json:"bearer_key"`
 	AllowCookies           bool   `json:"allow_cookies"`
 	ValidateSSLCertificate bool   `json:"validate_ssl_certificate"`
+	MaxRequestsPerSec      int    `json:"max_requests_per_sec,omitempty"`
+	MaxConcurrent          int    `json:"max_concurrent,omitempty"`
+	TimeoutMs              int    `json:"timeout_ms,omitempty"`
+}
+
+// DeadLetter binding names the bucket where mutations that failed in the handler are parked
+type DeadLetter struct {
+	BucketName string `json:"bucket_name"`
+}
+
+// EventFilter drops source bucket mutations before they are sent to the handler. A mutation
+// is sent only if it matches every condition that is set.
+type EventFilter struct {
+	KeyPrefix string                `json:"key_prefix,omitempty"`
+	KeyRegex  string                `json:"key_regex,omitempty"`
+	Predicate *EventFilterPredicate `json:"predicate,omitempty"`
+}
+
+// EventFilterPredicate compares the field at Path, a '.' separated list of object keys or
+// array indexes, of the document body with Value
+type EventFilterPredicate struct {
+	Path  string      `json:"path"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Schedule pauses and resumes a deployed function at set times, either with Pause and Resume
+// cron expressions or with Windows during which the function runs and outside which it is paused
+type Schedule struct {
+	Timezone string           `json:"timezone,omitempty"`
+	Pause    string           `json:"pause,omitempty"`
+	Resume   string           `json:"resume,omitempty"`
+	Windows  []ScheduleWindow `json:"windows,omitempty"`
+}
+
+// ScheduleWindow runs from Start to End, both as HH:MM, on each of Days or on every day if Days
+// is empty. A window whose End is not after its Start ends on the following day.
+type ScheduleWindow struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+// ScheduleTransition is a pause or resume of a function driven by its schedule
+type ScheduleTransition struct {
+	Action string    `json:"action"`
+	At     time.Time `json:"at"`
+}
+
+const (
+	SchedulePause  = "pause"
+	ScheduleResume = "resume"
+)
+
+// CheckpointSnapshot captures the last seq no processed by a function on each vbucket, to be
+// replayed from with the from_checkpoint_snapshot stream boundary
+type CheckpointSnapshot struct {
+	Timestamp string            `json:"timestamp"`
+	SeqNos    map[uint16]uint64 `json:"seqnos"`
+}
+
+// DeadLetterEntry captures a single failed handler invocation
+type DeadLetterEntry struct {
+	ID        uint64 `json:"id"`
+	AppName   string `json:"appname"`
+	Key       string `json:"key"`
+	Vbucket   uint16 `json:"vb"`
+	SeqNo     uint64 `json:"seq"`
+	Event     string `json:"event"`
+	Exception string `json:"exception"`
+	Timestamp string `json:"timestamp"`
 }
 
 type Credential struct {
@@ -130,6 +264,7 @@ type EventingProducer interface {
 	CleanupUDSs()
 	ClearEventStats()
 	DcpFeedBoundary() string
+	DcpFeedStats() map[string]interface{}
 	GetAppCode() string
 	GetAppLog(sz int64) []string
 	GetDcpEventsRemainingToProcess() uint64
@@ -168,6 +303,7 @@ type EventingProducer interface {
 	RebalanceStatus() bool
 	RebalanceTaskProgress() *RebalanceProgress
 	RemoveConsumerToken(workerName string)
+	ReplayDeadLetters(entries []*DeadLetterEntry)
 	SignalBootstrapFinish()
 	SignalStartDebugger(token string) error
 	SignalStopDebugger() error
@@ -199,6 +335,7 @@ type EventingConsumer interface {
 	CloseAllRunningDcpFeeds()
 	ConsumerName() string
 	DcpEventsRemainingToProcess() uint64
+	DcpFeedStats() map[string]interface{}
 	EventingNodeUUIDs() []string
 	EventsProcessedPSec() *EventProcessingStats
 	GetEventProcessingStats() map[string]uint64
@@ -219,6 +356,7 @@ type EventingConsumer interface {
 	RebalanceStatus() bool
 	RebalanceTaskProgress() *RebalanceProgress
 	RemoveSupervisorToken() error
+	ReplayDeadLetters(entries []*DeadLetterEntry)
 	ResetBootstrapDone()
 	Serve()
 	SetConnHandle(net.Conn)
@@ -231,6 +369,8 @@ type EventingConsumer interface {
 	SignalFeedbackConnected()
 	SignalStopDebugger() error
 	SpawnCompilationWorker(appCode, appContent, appName, eventingPort string, handlerHeaders, handlerFooters []string) (*CompileStatus, error)
+	SpawnTestWorker(appCode, appContent, appName, eventingPort string, handlerHeaders, handlerFooters []string,
+		executionTimeout int, events []TestEvent) ([]*TestEventResult, error)
 	Stop(context string)
 	String() string
 	TimerDebugStats() map[int]map[string]interface{}
@@ -257,6 +397,7 @@ type EventingSuperSup interface {
 	ClearEventStats()
 	CleanupProducer(appName string, skipMetaCleanup bool, updateMetakv bool) error
 	DcpFeedBoundary(fnName string) (string, error)
+	DcpFeedStats(appName string) (map[string]interface{}, error)
 	DeployedAppList() []string
 	GetEventProcessingStats(appName string) map[string]uint64
 	GetAppCode(appName string) string
@@ -280,6 +421,7 @@ type EventingSuperSup interface {
 	KillAllConsumers()
 	NotifyPrepareTopologyChange(ejectNodes, keepNodes []string)
 	PlannerStats(appName string) []*PlannerNodeVbMapping
+	PlanVbPlacement(strategy, bucketName string) ([]*PlannerNodeVbMapping, error)
 	RebalanceStatus() bool
 	RebalanceTaskProgress(appName string) (*RebalanceProgress, error)
 	UnwatchBucket(bucketName string)
@@ -297,6 +439,7 @@ type EventingSuperSup interface {
 }
 
 type EventingServiceMgr interface {
+	ApplyScheduledTransition(functionName, action string) error
 	UpdateBucketGraphFromMetakv(functionName string) error
 }
 type Config map[string]interface{}
@@ -343,12 +486,48 @@ type CompileStatus struct {
 	Line           int    `json:"line_number"`
 }
 
+const (
+	TestEventMutation = "mutation"
+	TestEventDeletion = "deletion"
+)
+
+// TestEvent is a synthetic mutation or deletion sent to a handler under test
+type TestEvent struct {
+	Type  string          `json:"type"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Meta  TestEventMeta   `json:"meta"`
+}
+
+type TestEventMeta struct {
+	Cas        string `json:"cas"`
+	Expiration uint32 `json:"expiration"`
+	Flags      uint32 `json:"flags"`
+	Expired    bool   `json:"expired"`
+}
+
+// TestEventResult captures what the handler did while processing a test event
+type TestEventResult struct {
+	Key           string            `json:"key"`
+	Type          string            `json:"type"`
+	Success       bool              `json:"success"`
+	Exception     string            `json:"exception,omitempty"`
+	Logs          []string          `json:"logs"`
+	KVWrites      []json.RawMessage `json:"kv_writes"`
+	CurlCalls     []json.RawMessage `json:"curl_calls"`
+	Timers        []json.RawMessage `json:"timers"`
+	Notifications []json.RawMessage `json:"notifications"`
+}
+
 // PlannerNodeVbMapping captures the vbucket distribution across all
 // eventing nodes as per planner
 type PlannerNodeVbMapping struct {
 	Hostname string `json:"host_name"`
 	StartVb  int    `json:"start_vb"`
 	VbsCount int    `json:"vb_count"`
+
+	// Only set when the vbuckets owned by the node aren't a contiguous range
+	Vbuckets []uint16 `json:"vbuckets,omitempty"`
 }
 
 type HandlerConfig struct {
@@ -358,7 +537,11 @@ type HandlerConfig struct {
 	CheckpointInterval       int
 	IdleCheckpointInterval   int
 	CleanupTimers            bool
+	CoalesceWindow           int
+	CompressionPassthrough   bool
 	CPPWorkerThrCount        int
+	DeadLetterBucket         string
+	EventFilter              *EventFilter
 	ExecuteTimerRoutineCount int
 	ExecutionTimeout         int
 	FeedbackBatchSize        int
@@ -366,20 +549,28 @@ type HandlerConfig struct {
 	FeedbackReadBufferSize   int
 	HandlerHeaders           []string
 	HandlerFooters           []string
+	IdempotencyJournal       bool
 	LcbInstCapacity          int
 	N1qlConsistency          string
+	Ordering                 string
+	PlacementStrategy        string
 	LogLevel                 string
+	ShadowCopy               bool
 	SocketWriteBatchSize     int
 	SocketTimeout            int
 	SourceBucket             string
+	SourceKeyspace           Keyspace
 	StatsLogInterval         int
 	StreamBoundary           DcpStreamBoundary
+	StreamSeqNos             map[uint16]uint64
 	TimerContextSize         int64
 	TimerStorageRoutineCount int
 	TimerStorageChanSize     int
 	TimerQueueMemCap         uint64
 	TimerQueueSize           uint64
 	UndeployRoutineCount     int
+	UpdateBatchSize          int
+	UpdateBatchWindow        int
 	UsingTimer               bool
 	WorkerCount              int
 	WorkerQueueCap           int64
@@ -432,11 +623,68 @@ func StreamBoundary(boundary string) DcpStreamBoundary {
 		return DcpFromNow
 	case "from_prior":
 		return DcpFromPrior
+	case "from_seqnos":
+		return DcpFromSeqnos
+	case "from_checkpoint_snapshot":
+		return DcpFromCheckpointSnapshot
 	default:
 		return DcpStreamBoundary("")
 	}
 }
 
+// ParseEventFilter reads the event_filter setting of a function
+func ParseEventFilter(val interface{}) (*EventFilter, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter EventFilter
+	if err = json.Unmarshal(data, &filter); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+// ParseSchedule reads the schedule setting of a function
+func ParseSchedule(val interface{}) (*Schedule, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule Schedule
+	if err = json.Unmarshal(data, &schedule); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ParseStreamSeqNos reads the dcp_stream_seqnos setting of a function, a map of vbucket to the
+// seq no its stream starts from
+func ParseStreamSeqNos(val interface{}) (map[uint16]uint64, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	seqNos := make(map[uint16]uint64)
+	if err = json.Unmarshal(data, &seqNos); err != nil {
+		return nil, err
+	}
+	return seqNos, nil
+}
+
+// DeadLetterCounterKey returns the key of the counter used to allocate dead letter entry ids
+func DeadLetterCounterKey(appName string) string {
+	return "eventing::dlq::" + appName + "::counter"
+}
+
+// DeadLetterEntryKey returns the key under which a dead letter entry is stored
+func DeadLetterEntryKey(appName string, id uint64) string {
+	return "eventing::dlq::" + appName + "::" + strconv.FormatUint(id, 10)
+}
+
 func NewInsight() *Insight {
 	return &Insight{Lines: make(map[int]InsightLine)}
 }
@@ -101,6 +101,57 @@ var gocbConnectMetaBucketCallback = func(args ...interface{}) error {
 	return nil
 }
 
+var gocbConnectDeadLetterBucketCallback = func(args ...interface{}) error {
+	logPrefix := "Consumer::gocbConnectDeadLetterBucketCallback"
+
+	c := args[0].(*Consumer)
+
+	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+		logging.Tracef("%s [%s:%s:%d] Exiting as worker is terminating",
+			logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return nil
+	}
+
+	kvNodes := c.getKvNodes()
+
+	connStr := "couchbase://"
+	for index, kvNode := range kvNodes {
+		if index != 0 {
+			connStr = connStr + ","
+		}
+		connStr = connStr + kvNode
+	}
+
+	if util.IsIPv6() {
+		connStr += "?ipv6=allow"
+	}
+	cluster, err := gocb.Connect(connStr)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Connect to cluster %rm failed, err: %v",
+			logPrefix, c.workerName, c.producer.LenRunningConsumers(), connStr, err)
+		return err
+	}
+
+	err = cluster.Authenticate(&util.DynamicAuthenticator{Caller: logPrefix})
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to authenticate to the cluster %rm, err: %v",
+			logPrefix, c.workerName, c.producer.LenRunningConsumers(), connStr, err)
+		return err
+	}
+
+	c.gocbDeadLetterBucket, err = cluster.OpenBucket(c.deadLetterBucket, "")
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to connect to dead letter bucket %s, err: %v",
+			logPrefix, c.workerName, c.producer.LenRunningConsumers(), c.deadLetterBucket, err)
+		return err
+	}
+
+	logging.Infof("%s [%s:%d] Successfully connected to dead letter bucket %s connStr: %rs",
+		logPrefix, c.workerName, c.producer.LenRunningConsumers(), c.deadLetterBucket, connStr)
+
+	return nil
+}
+
 var commonConnectBucketOpCallback = func(args ...interface{}) error {
 	logPrefix := "Consumer::commonConnectBucketOpCallback"
 
@@ -143,6 +143,10 @@ func (c *Consumer) updateCheckpointInfo(vbKey string, vb uint16, vbBlob *vbucket
 		return err
 	}
 
+	if c.idempotencyJournal {
+		c.pruneJournal(vb, vbBlob.LastSeqNoProcessed)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,169 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/dcp/transport/client"
+)
+
+// With a coalesce window, mutations of a key are buffered for the window from the first of them,
+// and only the newest is sent to the handler. The seq nos of the older ones are sent as filtered,
+// so the workers acknowledge them, while the checkpoint of a vbucket is kept below the mutations
+// still buffered.
+
+type coalescedMutation struct {
+	event    *memcached.DcpEvent
+	deadline time.Time
+}
+
+type mutationCoalescer struct {
+	sync.Mutex
+	window  time.Duration
+	pending map[uint16]map[string]*coalescedMutation // per vbucket and key
+	queue   []*coalescedMutation                     // in the order of deadlines
+	count   int
+}
+
+func newMutationCoalescer(window time.Duration) *mutationCoalescer {
+	return &mutationCoalescer{
+		window:  window,
+		pending: make(map[uint16]map[string]*coalescedMutation),
+	}
+}
+
+// coalesceMutation buffers a mutation, in place of the mutation of its key buffered so far
+func (c *Consumer) coalesceMutation(e *memcached.DcpEvent) {
+	c.coalescer.Lock()
+	vbPending, ok := c.coalescer.pending[e.VBucket]
+	if !ok {
+		vbPending = make(map[string]*coalescedMutation)
+		c.coalescer.pending[e.VBucket] = vbPending
+	}
+
+	key := string(e.Key)
+	if mutation, ok := vbPending[key]; ok {
+		superseded := mutation.event
+		mutation.event = e
+		c.coalescer.Unlock()
+
+		c.dcpMutationCoalescedCounter++
+		c.sendFilteredSeqNo(superseded)
+		return
+	}
+
+	mutation := &coalescedMutation{event: e, deadline: time.Now().Add(c.coalescer.window)}
+	vbPending[key] = mutation
+	c.coalescer.queue = append(c.coalescer.queue, mutation)
+	c.coalescer.count++
+	overflow := c.coalescer.count > coalesceBufferCap
+	c.coalescer.Unlock()
+
+	if overflow {
+		c.flushCoalescedMutations(true)
+	}
+}
+
+// flushCoalescedMutations sends the buffered mutations whose window is over, or the oldest one
+// when the buffer is over its cap
+func (c *Consumer) flushCoalescedMutations(overflow bool) {
+	now := time.Now()
+
+	for {
+		c.coalescer.Lock()
+		if len(c.coalescer.queue) == 0 {
+			c.coalescer.Unlock()
+			return
+		}
+
+		mutation := c.coalescer.queue[0]
+		if !overflow && mutation.deadline.After(now) {
+			c.coalescer.Unlock()
+			return
+		}
+		c.coalescer.queue = c.coalescer.queue[1:]
+
+		e := mutation.event
+		vbPending := c.coalescer.pending[e.VBucket]
+		if vbPending[string(e.Key)] != mutation {
+			// Already sent
+			c.coalescer.Unlock()
+			continue
+		}
+		c.coalescer.Unlock()
+
+		c.sendCoalescedMutation(mutation)
+
+		if overflow {
+			return
+		}
+	}
+}
+
+// flushCoalescedKey sends the mutation buffered for a key, so a deletion of the key stays behind it
+func (c *Consumer) flushCoalescedKey(e *memcached.DcpEvent) {
+	c.coalescer.Lock()
+	mutation, ok := c.coalescer.pending[e.VBucket][string(e.Key)]
+	c.coalescer.Unlock()
+
+	if ok {
+		c.sendCoalescedMutation(mutation)
+	}
+}
+
+// flushCoalescedVb sends the mutations buffered for a vbucket, when its stream ends
+func (c *Consumer) flushCoalescedVb(vb uint16) {
+	c.coalescer.Lock()
+	var mutations []*coalescedMutation
+	for _, mutation := range c.coalescer.queue {
+		if vbPending := c.coalescer.pending[vb]; vbPending[string(mutation.event.Key)] == mutation {
+			mutations = append(mutations, mutation)
+		}
+	}
+	c.coalescer.Unlock()
+
+	for _, mutation := range mutations {
+		c.sendCoalescedMutation(mutation)
+	}
+}
+
+// sendCoalescedMutation sends a buffered mutation, and only then stops holding back the checkpoint
+// of its vbucket with it, so the checkpoint can't move past a mutation that wasn't sent yet. Only
+// the dcp events routine buffers and sends mutations, so the mutation can't be superseded meanwhile.
+func (c *Consumer) sendCoalescedMutation(mutation *coalescedMutation) {
+	c.dcpMutationCounter++
+	c.sendEvent(mutation.event)
+
+	c.coalescer.Lock()
+	c.removeCoalescedMutation(mutation)
+	c.coalescer.Unlock()
+}
+
+// Caller must hold the lock. The entry in the queue is skipped when it comes up.
+func (c *Consumer) removeCoalescedMutation(mutation *coalescedMutation) {
+	e := mutation.event
+	vbPending := c.coalescer.pending[e.VBucket]
+	if vbPending[string(e.Key)] != mutation {
+		return
+	}
+
+	delete(vbPending, string(e.Key))
+	if len(vbPending) == 0 {
+		delete(c.coalescer.pending, e.VBucket)
+	}
+	c.coalescer.count--
+}
+
+// coalescedCheckpointSeqNo returns the seq no a vbucket can be checkpointed at, which stays below
+// the mutations still buffered
+func (c *Consumer) coalescedCheckpointSeqNo(vb uint16, seqNo uint64) uint64 {
+	c.coalescer.Lock()
+	defer c.coalescer.Unlock()
+
+	for _, mutation := range c.coalescer.pending[vb] {
+		if mutation.event.Seqno <= seqNo {
+			seqNo = mutation.event.Seqno - 1
+		}
+	}
+	return seqNo
+}
@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// With dcp_compression, values are snappy compressed on the stream. They are inflated only when
+// the consumer has to read them. With dcp_compression_passthrough, other mutations are sent to
+// the cpp worker compressed, and inflated there.
+
+// inflateValue replaces the compressed value of an event by its inflated value. Returns false if
+// the value can't be inflated
+func (c *Consumer) inflateValue(e *memcached.DcpEvent) bool {
+	logPrefix := "Consumer::inflateValue"
+
+	if e.Datatype&dcpDatatypeSnappy == 0 {
+		return true
+	}
+
+	value, err := util.SnappyDecode(e.Value)
+	if err != nil {
+		c.dcpInflateErrCounter++
+		logging.Errorf("%s [%s:%s:%d] vb: %d seqNo: %d key: %ru failed to inflate value, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, e.Seqno, string(e.Key), err)
+		return false
+	}
+
+	c.dcpInflatedCounter++
+	c.countBytesSaved(len(e.Value), len(value))
+	e.Value = value
+	e.Datatype &^= dcpDatatypeSnappy
+	return true
+}
+
+// canPassCompressed tells if a mutation can be sent to the cpp worker without the consumer reading
+// its value. Xattrs, body predicates of the event filter, shadow copies and batches all need it
+func (c *Consumer) canPassCompressed(e *memcached.DcpEvent) bool {
+	return c.compressionPassthrough &&
+		e.Datatype == dcpDatatypeJSON|dcpDatatypeSnappy &&
+		(c.eventFilter == nil || c.eventFilter.predicate == nil) &&
+		!c.shadowCopy &&
+		c.updateBatcher == nil
+}
+
+// prepareMutationValue inflates the value of a compressed mutation, unless it's passed to the cpp
+// worker compressed. Returns false if the value can't be inflated
+func (c *Consumer) prepareMutationValue(e *memcached.DcpEvent) bool {
+	if e.Datatype&dcpDatatypeSnappy == 0 {
+		return true
+	}
+
+	if !c.canPassCompressed(e) {
+		return c.inflateValue(e)
+	}
+
+	if inflatedLen, err := util.SnappyDecodedLen(e.Value); err == nil {
+		c.countBytesSaved(len(e.Value), inflatedLen)
+	}
+	c.dcpPassthroughCounter++
+	return true
+}
+
+func (c *Consumer) countBytesSaved(compressedLen, inflatedLen int) {
+	if inflatedLen > compressedLen {
+		c.dcpCompressionBytesSaved += uint64(inflatedLen - compressedLen)
+	}
+}
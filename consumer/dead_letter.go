@@ -0,0 +1,139 @@
+package consumer
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/couchbase/eventing/common"
+	mcd "github.com/couchbase/eventing/dcp/transport"
+	"github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+	"gopkg.in/couchbase/gocb.v1"
+)
+
+// processDeadLetters persists the entries reported by cpp workers for failed handler
+// invocations into the dead letter bucket of the function
+func (c *Consumer) processDeadLetters() {
+	logPrefix := "Consumer::processDeadLetters"
+
+	for {
+		select {
+		case entry := <-c.deadLetterCh:
+			if err := c.writeDeadLetter(entry); err != nil {
+				atomic.AddUint64(&c.deadLetterWriteErrCounter, 1)
+				logging.Errorf("%s [%s:%s:%d] vb: %d seqNo: %d failed to write dead letter for key: %ru, err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), entry.Vbucket, entry.SeqNo, entry.Key, err)
+				continue
+			}
+			atomic.AddUint64(&c.deadLetterWriteCounter, 1)
+
+		case <-c.stopConsumerCh:
+			logging.Infof("%s [%s:%s:%d] Exiting dead letter routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
+
+func (c *Consumer) writeDeadLetter(entry *common.DeadLetterEntry) error {
+	id, _, err := c.gocbDeadLetterBucket.Counter(common.DeadLetterCounterKey(c.app.AppName), 1, 1, 0)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = id
+	_, err = c.gocbDeadLetterBucket.Insert(common.DeadLetterEntryKey(c.app.AppName, id), entry, 0)
+	return err
+}
+
+func (c *Consumer) restoreDeadLetter(entry *common.DeadLetterEntry) {
+	logPrefix := "Consumer::restoreDeadLetter"
+
+	_, err := c.gocbDeadLetterBucket.Insert(common.DeadLetterEntryKey(c.app.AppName, entry.ID), entry, 0)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] vb: %d failed to restore dead letter entry: %d, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), entry.Vbucket, entry.ID, err)
+	}
+}
+
+// ReplayDeadLetters sends the entries that belong to vbuckets owned by this consumer
+// to the handler again. The current version of the document is sent, or a deletion
+// if the document no longer exists in the source keyspace. Events are handed to the dcp
+// events loop, which sends them along with the events of the source bucket.
+func (c *Consumer) ReplayDeadLetters(entries []*common.DeadLetterEntry) {
+	logPrefix := "Consumer::ReplayDeadLetters"
+
+	if c.gocbDeadLetterBucket == nil {
+		logging.Infof("%s [%s:%s:%d] Dead letter bucket not configured, skipping replay",
+			logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return
+	}
+
+	// Documents are read from the source collection, the default one has no id in the dcp config
+	var collectionID uint32
+	if cid, ok := c.dcpConfig["collectionID"].(uint32); ok {
+		collectionID = cid
+	}
+
+	vbsOwned := make(map[uint16]struct{})
+	for _, vb := range c.getCurrentlyOwnedVbs() {
+		vbsOwned[vb] = struct{}{}
+	}
+
+	for _, entry := range entries {
+		if _, ok := vbsOwned[entry.Vbucket]; !ok {
+			continue
+		}
+
+		// Removing the entry claims it, so a replay request observed more than once
+		// doesn't send the same event to the handler again
+		_, err := c.gocbDeadLetterBucket.Remove(common.DeadLetterEntryKey(c.app.AppName, entry.ID), 0)
+		if err == gocb.ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			logging.Errorf("%s [%s:%s:%d] vb: %d failed to remove dead letter entry: %d, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), entry.Vbucket, entry.ID, err)
+			continue
+		}
+
+		e := &memcached.DcpEvent{
+			Key:          []byte(entry.Key),
+			VBucket:      entry.Vbucket,
+			Seqno:        entry.SeqNo,
+			Opcode:       mcd.DCP_DELETION,
+			CollectionID: collectionID,
+		}
+
+		if entry.Event == "mutation" {
+			c.cbBucketRWMutex.RLock()
+			value, flags, cas, err := c.cbBucket.GetsRawCollection(entry.Key, collectionID)
+			c.cbBucketRWMutex.RUnlock()
+
+			switch {
+			case err == nil && json.Valid(value):
+				e.Opcode = mcd.DCP_MUTATION
+				e.Value = value
+				e.Cas = cas
+				e.Flags = uint32(flags)
+			case err == nil:
+				logging.Errorf("%s [%s:%s:%d] vb: %d key: %ru isn't a JSON document, keeping dead letter entry: %d",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), entry.Vbucket, entry.Key, entry.ID)
+				c.restoreDeadLetter(entry)
+				continue
+			case !mcd.IsNotFound(err):
+				logging.Errorf("%s [%s:%s:%d] vb: %d failed to fetch key: %ru for replay, err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), entry.Vbucket, entry.Key, err)
+				c.restoreDeadLetter(entry)
+				continue
+			}
+		}
+
+		select {
+		case c.deadLetterReplayCh <- e:
+		case <-c.stopConsumerCh:
+			c.restoreDeadLetter(entry)
+			return
+		}
+	}
+}
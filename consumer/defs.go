@@ -3,6 +3,7 @@ package consumer
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"hash/crc32"
 	"net"
 	"os/exec"
@@ -26,6 +27,7 @@ const (
 
 const (
 	dcpDatatypeJSON      = uint8(1)
+	dcpDatatypeSnappy    = uint8(2)
 	dcpDatatypeJSONXattr = uint8(5)
 	includeXATTRs        = uint32(4)
 )
@@ -57,6 +59,49 @@ const (
 	socketWriteTimerInterval = time.Duration(100) * time.Millisecond
 
 	updateCPPStatsTickInterval = time.Duration(1000) * time.Millisecond
+
+	// Buffer size of dead letter entries waiting to be written to dead letter bucket
+	deadLetterChanSize = 1000
+
+	// Journals left behind, e.g. by a vbucket that isn't streamed anymore, expire after this
+	journalEntryExpiry = uint32(7 * 24 * 60 * 60)
+
+	// Interval at which acknowledged events are written to the idempotency journal
+	journalFlushInterval = time.Second
+
+	// Buffer size of notifications published by handler waiting to be written to their topics
+	notificationChanSize = 1000
+
+	// Cap on mutations buffered under a coalesce window, past which the oldest is sent early
+	coalesceBufferCap = 100 * 1000
+
+	// Interval for sending the buffered mutations whose coalesce window is over
+	coalesceFlushInterval = time.Duration(10) * time.Millisecond
+
+	// Cap on the size of a batch of mutations, past which it's sent before it's full
+	updateBatchMemCap = 1024 * 1024
+
+	// Interval for sending the batches of mutations whose batch window is over
+	updateBatchFlushInterval = time.Duration(10) * time.Millisecond
+
+	// Ordering under which events of a key are held while an earlier one is in flight
+	orderingStrictPerKey = "strict_per_key"
+
+	// Interval for writing the buffered shadow copies, and the cap on shadow copies buffered past
+	// which they're written early
+	shadowCopyFlushInterval = time.Duration(100) * time.Millisecond
+	shadowCopyBufferCap     = 10 * 1000
+
+	// Interval for checking if the events of an ending stream are processed, and for warning
+	// about those it still waits on, under the strict_per_key ordering
+	orderingDrainInterval     = time.Duration(100) * time.Millisecond
+	orderingDrainWarnInterval = time.Duration(60) * time.Second
+
+	// Time allowed for a test worker to come up, on top of the execution timeout of each test event
+	testWorkerStartupTimeout = time.Duration(30) * time.Second
+
+	// Upper bound on the time taken by the test events of one request, whatever their count
+	testEventsMaxTimeout = time.Duration(5) * time.Minute
 )
 
 const (
@@ -97,6 +142,29 @@ type dcpMetadata struct {
 	Flag    uint32 `json:"flags"`
 	Vbucket uint16 `json:"vb"`
 	SeqNo   uint64 `json:"seq"`
+	Replay  bool   `json:"replay,omitempty"`
+
+	Keyspace *dcpKeyspace `json:"keyspace,omitempty"` // Set when the source is a collection
+}
+
+type dcpKeyspace struct {
+	BucketName     string `json:"bucket_name"`
+	ScopeName      string `json:"scope_name"`
+	CollectionName string `json:"collection_name"`
+	CollectionID   uint32 `json:"collection_id"`
+}
+
+// Notification published by the handler via publishNotification()
+type publishedNotification struct {
+	Topic string          `json:"topic"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Passed to OnRollback() of the handler when a vbucket is streamed again from its rollback seq no
+type rollbackInfo struct {
+	Vbucket          uint16 `json:"vb"`
+	RollbackSeqNo    uint64 `json:"rollback_seq_no"`
+	RolledBackSeqNos uint64 `json:"rolled_back_seqnos"`
 }
 
 type vbSeqNo struct {
@@ -110,6 +178,7 @@ type Consumer struct {
 	n1qlPrepareAll bool
 	app            *common.AppConfig
 	bucket         string // source bucket
+	keyspace       common.Keyspace
 	builderPool    *sync.Pool
 	breakpadOn     bool
 	uuid           string
@@ -131,6 +200,7 @@ type Consumer struct {
 	workerQueueMemCap int64
 
 	cppThrPartitionMap    map[int][]uint16
+	partitionThrMap       map[int16]int
 	cppWorkerThrCount     int // No. of worker threads per CPP worker process
 	crcTable              *crc32.Table
 	debugConn             net.Conn // Interface to support communication between Go and C++ worker spawned for debugging
@@ -146,13 +216,20 @@ type Consumer struct {
 	cbBucketRWMutex               *sync.RWMutex
 	checkpointInterval            time.Duration
 	cleanupTimers                 bool
+	coalescer                     *mutationCoalescer // Set when coalesce window is configured
 	compileInfo                   *common.CompileStatus
+	compressionPassthrough        bool // Snappy compressed mutations are inflated by cpp workers
+	testResultCh                  chan []*common.TestEventResult
 	controlRoutineWg              *sync.WaitGroup
 	dcpEventsRemaining            uint64
 	dcpFeedsClosed                bool
 	dcpFeedVbMap                  map[*couchbase.DcpFeed][]uint16 // Access controlled by default lock
 	debuggerPort                  string
+	deadLetterBucket              string
+	deadLetterCh                  chan *common.DeadLetterEntry
+	deadLetterReplayCh            chan *cb.DcpEvent // Replayed events, sent from the dcp events loop
 	ejectNodesUUIDs               []string
+	eventFilter                   *eventFilter
 	eventingAdminPort             string
 	eventingDir                   string
 	eventingSSLPort               string
@@ -165,6 +242,7 @@ type Consumer struct {
 	filterVbEventsRWMutex         *sync.RWMutex
 	filterDataCh                  chan *vbSeqNo
 	gocbBucket                    *gocb.Bucket
+	gocbDeadLetterBucket          *gocb.Bucket
 	gocbMetaBucket                *gocb.Bucket
 	idleCheckpointInterval        time.Duration
 	index                         int
@@ -172,24 +250,40 @@ type Consumer struct {
 	inflightDcpStreamsRWMutex     *sync.RWMutex
 	ipcType                       string // ipc mechanism used to communicate with cpp workers - af_inet/af_unix
 	isBootstrapping               bool
+	idempotencyJournal            bool
 	isRebalanceOngoing            bool
 	isTerminateRunning            uint32                        // To signify if Consumer::Stop is running
 	kvHostDcpFeedMap              map[string]*couchbase.DcpFeed // Access controlled by hostDcpFeedRWMutex
 	hostDcpFeedRWMutex            *sync.RWMutex
-	kvNodes                       []string // Access controlled by kvNodesRWMutex
+	journal                       map[uint16]map[uint64]struct{} // Access controlled by journalMutex
+	journalInflight               map[uint16]map[int][]uint64    // vb => worker thread => seq nos in the order sent, access controlled by journalMutex
+	journalMutex                  *sync.Mutex
+	journalPending                map[uint16][]uint64            // Access controlled by journalMutex
+	journalTracked                map[uint16]map[uint64]struct{} // Seq nos of journalInflight and journalPending, access controlled by journalMutex
+	journalWriteMutex             *sync.Mutex                    // Serialises writes to journal documents
+	kvNodes                       []string                       // Access controlled by kvNodesRWMutex
 	kvNodesRWMutex                *sync.RWMutex
 	kvVbMap                       map[uint16]string // Access controlled by default lock
 	logLevel                      string
 	numVbuckets                   int
+	ordering                      *keyOrdering // Set under the strict_per_key ordering
+	notificationCh                chan *publishedNotification
 	nsServerPort                  string
 	reqStreamCh                   chan *streamRequestInfo
 	resetBootstrapDone            bool
+	shadowCopy                    bool
+	shadowCopies                  map[string]*shadowCopy // Access controlled by shadowCopyRWMutex
+	shadowCopiesFlushing          map[string]*shadowCopy // Access controlled by shadowCopyRWMutex
+	shadowCopyRWMutex             *sync.RWMutex
+	shadowCopyFlushMutex          *sync.Mutex // Serialises writes of shadow copies
+	shadowCopyFlushCh             chan struct{}
 	statsTickDuration             time.Duration
 	streamReqRWMutex              *sync.RWMutex
 	stoppingConsumer              bool
 	isPausing                     bool
 	superSup                      common.EventingSuperSup
 	timerContextSize              int64
+	updateBatcher                 *updateBatcher // Set when update batch size is configured
 	usingTimer                    bool
 	vbDcpEventsRemaining          map[int]int64 // Access controlled by statsRWMutex
 	vbDcpFeedMap                  map[uint16]*couchbase.DcpFeed
@@ -240,6 +334,7 @@ type Consumer struct {
 	socketTimeout time.Duration
 
 	dcpStreamBoundary common.DcpStreamBoundary
+	dcpStreamSeqNos   map[uint16]uint64 // Start seq nos for from_seqnos and from_checkpoint_snapshot boundaries
 
 	// Map that needed to short circuits failover log to dcp stream request routine
 	vbFlogChan chan *vbFlogEntry
@@ -330,13 +425,53 @@ type Consumer struct {
 	dcpMutationCounter           uint64
 	dcpExpiryCounter             uint64
 	dcpXattrParseError           uint64
+	dcpMutationCoalescedCounter  uint64
+	updateBatchCounter           uint64
 	errorParsingTimerResponses   uint64
 	timerMessagesProcessedPSec   int
 	suppressedDCPDeletionCounter uint64
 	suppressedDCPMutationCounter uint64
+	filteredDCPMutationCounter   uint64
 	sentEventsSize               int64
 	numSentEvents                int64
 
+	// snappy compression related stats
+	dcpInflatedCounter       uint64
+	dcpPassthroughCounter    uint64
+	dcpInflateErrCounter     uint64
+	dcpCompressionBytesSaved uint64
+
+	// DCP rollback related stats
+	dcpRollbackCounter     uint64
+	dcpRolledBackSeqNos    uint64
+	dcpRollbackNotifyCount uint64
+
+	// pre-image related stats
+	preImageFromStreamCounter     uint64
+	preImageFromShadowCopyCounter uint64
+	shadowCopyErrCounter          uint64
+
+	// dead letter queue related stats
+	deadLetterWriteCounter    uint64
+	deadLetterWriteErrCounter uint64
+	deadLetterReplayCounter   uint64
+
+	// idempotency journal related stats
+	journalWriteCounter    uint64
+	journalWriteErrCounter uint64
+	journalSkipCounter     uint64
+	journalPruneCounter    uint64
+
+	// strict_per_key ordering related stats
+	orderingHeldCounter      uint64
+	orderingHeldEvents       int64
+	orderingHeldSize         int64
+	orderingReorderedCounter uint64
+
+	// notification related stats
+	notificationPublishCounter    uint64
+	notificationPublishErrCounter uint64
+
 	// metastore related timer stats
 	metastoreDeleteCounter      uint64
 	metastoreDeleteErrCounter   uint64
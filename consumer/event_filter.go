@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/eventing/common"
+	cb "github.com/couchbase/eventing/dcp/transport/client"
+)
+
+type eventFilter struct {
+	keyPrefix []byte
+	keyRegex  *regexp.Regexp
+	predicate *common.EventFilterPredicate
+	path      []string
+}
+
+func newEventFilter(config *common.EventFilter) (*eventFilter, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	f := &eventFilter{
+		keyPrefix: []byte(config.KeyPrefix),
+		predicate: config.Predicate,
+	}
+
+	if config.KeyRegex != "" {
+		keyRegex, err := regexp.Compile(config.KeyRegex)
+		if err != nil {
+			return nil, err
+		}
+		f.keyRegex = keyRegex
+	}
+
+	if f.predicate != nil {
+		f.path = strings.Split(f.predicate.Path, ".")
+	}
+	return f, nil
+}
+
+// matches reports whether the mutation has to be sent to the handler
+func (f *eventFilter) matches(key, value []byte) bool {
+	if !bytes.HasPrefix(key, f.keyPrefix) {
+		return false
+	}
+
+	if f.keyRegex != nil && !f.keyRegex.Match(key) {
+		return false
+	}
+
+	if f.predicate == nil {
+		return true
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return false
+	}
+
+	field, found := lookupPath(doc, f.path)
+	switch f.predicate.Op {
+	case "eq":
+		return found && reflect.DeepEqual(field, f.predicate.Value)
+	case "ne":
+		return !found || !reflect.DeepEqual(field, f.predicate.Value)
+	case "exists":
+		return found
+	case "not_exists":
+		return !found
+	}
+	return false
+}
+
+func lookupPath(doc interface{}, path []string) (interface{}, bool) {
+	for _, elem := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			val, ok := node[elem]
+			if !ok {
+				return nil, false
+			}
+			doc = val
+
+		case []interface{}:
+			index, err := strconv.Atoi(elem)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			doc = node[index]
+
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// filterMutation reports whether the mutation is dropped by the event filter of the function.
+// The seq no of a dropped mutation is still sent to the cpp worker, behind the events sent
+// before it, so that the checkpoint moves past it.
+func (c *Consumer) filterMutation(e *cb.DcpEvent) bool {
+	if c.eventFilter == nil || c.eventFilter.matches(e.Key, e.Value) {
+		return false
+	}
+
+	c.filteredDCPMutationCounter++
+	c.sendFilteredSeqNo(e)
+	return true
+}
@@ -2,6 +2,8 @@ package consumer
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -14,6 +16,7 @@ import (
 	"unsafe"
 
 	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/dcp"
 	mcd "github.com/couchbase/eventing/dcp/transport"
 	"github.com/couchbase/eventing/logging"
 	"github.com/couchbase/eventing/parser"
@@ -21,6 +24,8 @@ import (
 	"github.com/google/flatbuffers/go"
 )
 
+var errTestWorkerTimeout = errors.New("timed out waiting for test results")
+
 // ClearEventStats flushes event processing stats
 func (c *Consumer) ClearEventStats() {
 	c.msgProcessedRWMutex.Lock()
@@ -81,6 +86,54 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 		stats["dcp_mutation_sent_to_worker"] = c.dcpMutationCounter
 	}
 
+	if c.dcpMutationCoalescedCounter > 0 {
+		stats["dcp_mutation_coalesced"] = c.dcpMutationCoalescedCounter
+	}
+
+	if c.updateBatchCounter > 0 {
+		stats["dcp_mutation_batches_sent_to_worker"] = c.updateBatchCounter
+	}
+
+	if c.dcpInflatedCounter > 0 {
+		stats["dcp_snappy_inflated"] = c.dcpInflatedCounter
+	}
+
+	if c.dcpPassthroughCounter > 0 {
+		stats["dcp_snappy_passed_to_worker"] = c.dcpPassthroughCounter
+	}
+
+	if c.dcpInflateErrCounter > 0 {
+		stats["dcp_snappy_inflate_err_counter"] = c.dcpInflateErrCounter
+	}
+
+	if c.dcpCompressionBytesSaved > 0 {
+		stats["dcp_snappy_bytes_saved"] = c.dcpCompressionBytesSaved
+	}
+
+	if c.dcpRollbackCounter > 0 {
+		stats["dcp_rollback_counter"] = c.dcpRollbackCounter
+	}
+
+	if c.dcpRolledBackSeqNos > 0 {
+		stats["dcp_rolled_back_seqnos"] = c.dcpRolledBackSeqNos
+	}
+
+	if c.dcpRollbackNotifyCount > 0 {
+		stats["dcp_rollback_sent_to_worker"] = c.dcpRollbackNotifyCount
+	}
+
+	if c.preImageFromStreamCounter > 0 {
+		stats["dcp_pre_image_from_stream"] = c.preImageFromStreamCounter
+	}
+
+	if c.preImageFromShadowCopyCounter > 0 {
+		stats["dcp_pre_image_from_shadow_copy"] = c.preImageFromShadowCopyCounter
+	}
+
+	if c.shadowCopyErrCounter > 0 {
+		stats["shadow_copy_err_counter"] = c.shadowCopyErrCounter
+	}
+
 	if c.dcpExpiryCounter > 0 {
 		stats["dcp_expiry_sent_to_worker"] = c.dcpExpiryCounter
 	}
@@ -89,6 +142,54 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 		stats["dcp_xattr_parse_error_counter"] = c.dcpXattrParseError
 	}
 
+	if c.deadLetterWriteCounter > 0 {
+		stats["dead_letter_write_counter"] = c.deadLetterWriteCounter
+	}
+
+	if c.deadLetterWriteErrCounter > 0 {
+		stats["dead_letter_write_err_counter"] = c.deadLetterWriteErrCounter
+	}
+
+	if c.deadLetterReplayCounter > 0 {
+		stats["dead_letter_replay_counter"] = c.deadLetterReplayCounter
+	}
+
+	if c.journalWriteCounter > 0 {
+		stats["journal_write_counter"] = c.journalWriteCounter
+	}
+
+	if c.journalWriteErrCounter > 0 {
+		stats["journal_write_err_counter"] = c.journalWriteErrCounter
+	}
+
+	if c.journalSkipCounter > 0 {
+		stats["journal_skip_counter"] = c.journalSkipCounter
+	}
+
+	if c.journalPruneCounter > 0 {
+		stats["journal_prune_counter"] = c.journalPruneCounter
+	}
+
+	if c.orderingHeldCounter > 0 {
+		stats["ordering_held_counter"] = c.orderingHeldCounter
+	}
+
+	if held := atomic.LoadInt64(&c.orderingHeldEvents); held > 0 {
+		stats["ordering_held_events"] = uint64(held)
+	}
+
+	if c.orderingReorderedCounter > 0 {
+		stats["ordering_reordered_counter"] = c.orderingReorderedCounter
+	}
+
+	if c.notificationPublishCounter > 0 {
+		stats["notification_publish_counter"] = c.notificationPublishCounter
+	}
+
+	if c.notificationPublishErrCounter > 0 {
+		stats["notification_publish_err_counter"] = c.notificationPublishErrCounter
+	}
+
 	if c.suppressedDCPDeletionCounter > 0 {
 		stats["dcp_deletion_suppressed_counter"] = c.suppressedDCPDeletionCounter
 	}
@@ -97,6 +198,10 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 		stats["dcp_mutation_suppressed_counter"] = c.suppressedDCPMutationCounter
 	}
 
+	if c.filteredDCPMutationCounter > 0 {
+		stats["dcp_mutations_filtered"] = c.filteredDCPMutationCounter
+	}
+
 	if c.dcpCloseStreamCounter > 0 {
 		stats["dcp_stream_close_counter"] = c.dcpCloseStreamCounter
 	}
@@ -406,27 +511,166 @@ func (c *Consumer) SpawnCompilationWorker(appCode, appContent, appName, eventing
 			Description: fmt.Sprintf("%v", err)}, nil
 	}
 
+	c.initConsumer(appName)
+	listener, pid, err := c.spawnValidationWorker(appName, "validate")
+	if err != nil {
+		return nil, err
+	}
+
+	c.sendWorkerThrCount(1, false)
+	logging.Infof("%s [%s:%s:%d] Handler headers %v", logPrefix, c.workerName, c.tcpPort, *pid, c.handlerHeaders)
+	logging.Infof("%s [%s:%s:%d] Handler footers %v", logPrefix, c.workerName, c.tcpPort, *pid, c.handlerFooters)
+
+	c.handlerHeaders = handlerHeaders
+	c.handlerFooters = handlerFooters
+	// Framing bare minimum V8 worker init payload
+	payload, pBuilder := c.makeV8InitPayload(appName, c.debuggerPort, util.Localhost(), "", eventingPort, "",
+		appContent, 5, 10, 10*1000, true, 1024)
+
+	c.sendInitV8Worker(payload, false, pBuilder)
+
+	c.sendCompileRequest(appCode)
+
+	go c.readMessageLoop()
+
+	for c.compileInfo == nil {
+		time.Sleep(1 * time.Second)
+	}
+
+	c.conn.Close()
+	listener.Close()
+
+	err = util.KillProcess(*pid)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Unable to kill C++ worker spawned for compilation, err: %v",
+			logPrefix, c.workerName, c.tcpPort, *pid, err)
+	}
+
+	logging.Infof("%s [%s:%s:%d] compilation status %#v",
+		logPrefix, c.workerName, c.tcpPort, *pid, c.compileInfo)
+
+	return c.compileInfo, nil
+}
+
+// SpawnTestWorker runs the handler against synthetic events in a CPP worker outside of
+// the supervision tree. Bucket writes, cURL calls, timers and notifications are captured
+// by the worker instead of taking effect, and no DCP stream or checkpoint is involved.
+func (c *Consumer) SpawnTestWorker(appCode, appContent, appName, eventingPort string, handlerHeaders, handlerFooters []string,
+	executionTimeout int, events []common.TestEvent) ([]*common.TestEventResult, error) {
+	logPrefix := "Consumer::SpawnTestWorker"
+
+	testEvents := make([]map[string]interface{}, 0, len(events))
+	for index, event := range events {
+		meta := dcpMetadata{
+			Cas:    event.Meta.Cas,
+			DocID:  event.Key,
+			Expiry: event.Meta.Expiration,
+			Flag:   event.Meta.Flags,
+			SeqNo:  uint64(index + 1),
+		}
+		if meta.Cas == "" {
+			meta.Cas = "0"
+		}
+		if c.numVbuckets > 0 {
+			meta.Vbucket = util.VbucketByKey([]byte(event.Key), c.numVbuckets)
+		}
+
+		testEvent := map[string]interface{}{
+			"type": event.Type,
+			"meta": meta,
+		}
+		if event.Type == common.TestEventMutation {
+			testEvent["value"] = event.Value
+		} else {
+			options := map[string]interface{}{"expired": event.Meta.Expired}
+			if len(event.Value) > 0 {
+				options["pre_image"] = event.Value
+			}
+			testEvent["options"] = options
+		}
+		testEvents = append(testEvents, testEvent)
+	}
+
+	encodedEvents, err := json.Marshal(testEvents)
+	if err != nil {
+		logging.Errorf("%s [%s] Failed to marshal test events, err: %v", logPrefix, appName, err)
+		return nil, err
+	}
+
+	c.initConsumer(appName)
+	c.testResultCh = make(chan []*common.TestEventResult, 1)
+	listener, pid, err := c.spawnValidationWorker(appName, "test")
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		c.conn.Close()
+		listener.Close()
+
+		err := util.KillProcess(*pid)
+		if err != nil {
+			logging.Errorf("%s [%s:%s:%d] Unable to kill C++ worker spawned for testing, err: %v",
+				logPrefix, c.workerName, c.tcpPort, *pid, err)
+		}
+	}()
+
+	c.sendWorkerThrCount(1, false)
+
+	c.handlerHeaders = handlerHeaders
+	c.handlerFooters = handlerFooters
+	payload, pBuilder := c.makeV8InitPayload(appName, c.debuggerPort, util.Localhost(), "", eventingPort, "",
+		appContent, 5, executionTimeout, 10*1000, false, 1024)
+
+	c.sendInitV8Worker(payload, false, pBuilder)
+	c.sendLoadV8Worker(appCode, false)
+	c.sendTestEvents(string(encodedEvents))
+
+	go c.readMessageLoop()
+
+	timeout := time.Duration(len(events)*executionTimeout) * time.Second
+	if timeout > testEventsMaxTimeout {
+		timeout = testEventsMaxTimeout
+	}
+	timeout += testWorkerStartupTimeout
+	select {
+	case results := <-c.testResultCh:
+		logging.Infof("%s [%s:%s:%d] Ran %d test events",
+			logPrefix, c.workerName, c.tcpPort, *pid, len(results))
+		return results, nil
+
+	case <-time.After(timeout):
+		logging.Errorf("%s [%s:%s:%d] Timed out waiting for test results after %v",
+			logPrefix, c.workerName, c.tcpPort, *pid, timeout)
+		return nil, errTestWorkerTimeout
+	}
+}
+
+// spawnValidationWorker brings up a CPP worker outside of the supervision tree, for compiling
+// or testing user supplied handler code. It returns once the worker has connected.
+func (c *Consumer) spawnValidationWorker(appName, tag string) (net.Listener, *int, error) {
+	logPrefix := "Consumer::spawnValidationWorker"
+
 	listener, err := net.Listen("tcp", net.JoinHostPort(util.Localhost(), "0"))
 	if err != nil {
-		logging.Errorf("%s [%s:%s:%d] Compilation worker: Failed to listen on tcp port, err: %v",
+		logging.Errorf("%s [%s:%s:%d] Validation worker: Failed to listen on tcp port, err: %v",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	connectedCh := make(chan struct{}, 1)
-	c.initConsumer(appName)
 
 	go func(listener net.Listener, connectedCh chan struct{}) {
 
 		var err error
 		c.conn, err = listener.Accept()
 		if err != nil {
-			logging.Errorf("%s [%s:%s:%d] Compilation worker: Error on accept, err: %v",
+			logging.Errorf("%s [%s:%s:%d] Validation worker: Error on accept, err: %v",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
 			return
 		}
 
-		logging.Infof("%s [%s:%s:%d] Compilation worker: got connection: %rs",
+		logging.Infof("%s [%s:%s:%d] Validation worker: got connection: %rs",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), c.conn)
 
 		connectedCh <- struct{}{}
@@ -438,7 +682,7 @@ func (c *Consumer) SpawnCompilationWorker(appCode, appContent, appName, eventing
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
 	}
 
-	var pid int
+	pid := new(int)
 	go func() {
 		user, key := util.LocalKey()
 		cmd := exec.Command(
@@ -457,7 +701,7 @@ func (c *Consumer) SpawnCompilationWorker(appCode, appContent, appName, eventing
 			"user_prefix",
 			c.nsServerPort,
 			strconv.Itoa(c.numVbuckets),
-			"validate") // this parameter is not read, for tagging
+			tag) // this parameter is not read, for tagging
 
 		cmd.Env = append(os.Environ(),
 			fmt.Sprintf("CBEVT_CALLBACK_USR=%s", user),
@@ -488,13 +732,13 @@ func (c *Consumer) SpawnCompilationWorker(appCode, appContent, appName, eventing
 
 		err = cmd.Start()
 		if err != nil {
-			logging.Errorf("%s [%s:%s:%d] Failed to spawn compilation worker, err: %v",
+			logging.Errorf("%s [%s:%s:%d] Failed to spawn validation worker, err: %v",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
 			return
 		}
-		pid = cmd.Process.Pid
-		logging.Infof("%s [%s:%s:%d] compilation worker launched",
-			logPrefix, c.workerName, c.tcpPort, pid)
+		*pid = cmd.Process.Pid
+		logging.Infof("%s [%s:%s:%d] validation worker launched",
+			logPrefix, c.workerName, c.tcpPort, *pid)
 
 		bufErr := bufio.NewReader(errPipe)
 		go func(bufErr *bufio.Reader) {
@@ -528,46 +772,13 @@ func (c *Consumer) SpawnCompilationWorker(appCode, appContent, appName, eventing
 
 		err = cmd.Wait()
 
-		logging.Infof("%s [%s:%s:%d] compilation worker exited with status %v",
-			logPrefix, c.workerName, c.tcpPort, pid, err)
+		logging.Infof("%s [%s:%s:%d] validation worker exited with status %v",
+			logPrefix, c.workerName, c.tcpPort, *pid, err)
 
 	}()
 	<-connectedCh
 	c.sockReader = bufio.NewReader(c.conn)
-
-	c.sendWorkerThrCount(1, false)
-	logging.Infof("%s [%s:%s:%d] Handler headers %v", logPrefix, c.workerName, c.tcpPort, pid, c.handlerHeaders)
-	logging.Infof("%s [%s:%s:%d] Handler footers %v", logPrefix, c.workerName, c.tcpPort, pid, c.handlerFooters)
-
-	c.handlerHeaders = handlerHeaders
-	c.handlerFooters = handlerFooters
-	// Framing bare minimum V8 worker init payload
-	payload, pBuilder := c.makeV8InitPayload(appName, c.debuggerPort, util.Localhost(), "", eventingPort, "",
-		appContent, 5, 10, 10*1000, true, 1024)
-
-	c.sendInitV8Worker(payload, false, pBuilder)
-
-	c.sendCompileRequest(appCode)
-
-	go c.readMessageLoop()
-
-	for c.compileInfo == nil {
-		time.Sleep(1 * time.Second)
-	}
-
-	c.conn.Close()
-	listener.Close()
-
-	err = util.KillProcess(pid)
-	if err != nil {
-		logging.Errorf("%s [%s:%s:%d] Unable to kill C++ worker spawned for compilation, err: %v",
-			logPrefix, c.workerName, c.tcpPort, pid, err)
-	}
-
-	logging.Infof("%s [%s:%s:%d] compilation status %#v",
-		logPrefix, c.workerName, c.tcpPort, pid, c.compileInfo)
-
-	return c.compileInfo, nil
+	return listener, pid, nil
 }
 
 func (c *Consumer) initConsumer(appName string) {
@@ -689,6 +900,35 @@ func (c *Consumer) VbSeqnoStats() map[int]map[string]interface{} {
 	return seqnoStats
 }
 
+// DcpFeedStats returns flow control and other stats of the DCP connections of the consumer, to tell
+// whether Data service nodes or V8 workers hold events back
+func (c *Consumer) DcpFeedStats() map[string]interface{} {
+	logPrefix := "Consumer::DcpFeedStats"
+
+	kvHostDcpFeedMap := make(map[string]*couchbase.DcpFeed)
+
+	c.hostDcpFeedRWMutex.RLock()
+	for kvHost, dcpFeed := range c.kvHostDcpFeedMap {
+		kvHostDcpFeedMap[kvHost] = dcpFeed
+	}
+	c.hostDcpFeedRWMutex.RUnlock()
+
+	feedStats := make(map[string]interface{})
+	for kvHost, dcpFeed := range kvHostDcpFeedMap {
+		stats, err := dcpFeed.GetStats()
+		if err != nil {
+			logging.Errorf("%s [%s:%s:%d] kvHost: %rs failed to get dcp feed stats, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), kvHost, err)
+			continue
+		}
+		for name, s := range stats {
+			feedStats[name] = s
+		}
+	}
+
+	return feedStats
+}
+
 // Index returns the index of consumer among all consumers designated
 // for specific handler on an eventing node
 func (c *Consumer) Index() int {
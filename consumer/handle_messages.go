@@ -168,6 +168,31 @@ func (c *Consumer) SendAssignedVbs() {
 	c.sendMessage(m)
 	logging.Infof("%s [%s:%s:%d] Sending assigned vbuckets map: %v",
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), vbuckets)
+
+	c.sendCurlLimitShare(len(vbuckets))
+}
+
+// sendCurlLimitShare tells the worker the share of the cURL binding limits it enforces,
+// which is the fraction of vbuckets assigned to it, as each of its events is one of theirs
+func (c *Consumer) sendCurlLimitShare(numVbs int) {
+	logPrefix := "Consumer::sendCurlLimitShare"
+
+	if c.numVbuckets == 0 {
+		return
+	}
+
+	share := strconv.FormatFloat(float64(numVbs)/float64(c.numVbuckets), 'f', -1, 64)
+	header, hBuilder := c.makeHeader(appWorkerSetting, curlLimitShare, 0, share)
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+	c.sendMessage(m)
+	logging.Infof("%s [%s:%s:%d] Sending share of cURL binding limits: %s",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), share)
 }
 
 func (c *Consumer) sendDebuggerStart() {
@@ -263,6 +288,28 @@ func (c *Consumer) sendCompileRequest(appCode string) {
 	c.sendMessage(m)
 }
 
+func (c *Consumer) sendTestEvents(events string) {
+	header, hBuilder := c.makeV8TestEventsHeader(events)
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["v8_test_events"]; !ok {
+		c.v8WorkerMessagesProcessed["v8_test_events"] = 0
+	}
+	c.v8WorkerMessagesProcessed["v8_test_events"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		sendToDebugger: false,
+		prioritize:     true,
+		headerBuilder:  hBuilder,
+	}
+
+	c.sendMessage(m)
+}
+
 func (c *Consumer) sendLoadV8Worker(appCode string, sendToDebugger bool) {
 
 	header, hBuilder := c.makeV8LoadOpcodeHeader(appCode)
@@ -419,6 +466,16 @@ func (c *Consumer) sendGetLcbExceptionStats(sendToDebugger bool) {
 }
 
 func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
+	c.sendDcpEventWithMetadata(e, sendToDebugger, false)
+}
+
+// sendReplayedDcpEvent sends an event from the dead letter queue. Such events carry the seq no of
+// the original mutation, so they must not move the checkpoint of the vbucket
+func (c *Consumer) sendReplayedDcpEvent(e *memcached.DcpEvent) {
+	c.sendDcpEventWithMetadata(e, false, true)
+}
+
+func (c *Consumer) sendDcpEventWithMetadata(e *memcached.DcpEvent, sendToDebugger, replay bool) {
 	m := dcpMetadata{
 		Cas:     strconv.FormatUint(e.Cas, 10),
 		DocID:   string(e.Key),
@@ -426,6 +483,15 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 		Flag:    e.Flags,
 		Vbucket: e.VBucket,
 		SeqNo:   e.Seqno,
+		Replay:  replay,
+	}
+	if !c.keyspace.IsDefaultCollection() {
+		m.Keyspace = &dcpKeyspace{
+			BucketName:     c.keyspace.BucketName,
+			ScopeName:      c.keyspace.ScopeName,
+			CollectionName: c.keyspace.CollectionName,
+			CollectionID:   e.CollectionID,
+		}
 	}
 
 	metadata, err := json.Marshal(&m)
@@ -438,15 +504,33 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 
 	partition := int16(util.VbucketByKey(e.Key, cppWorkerPartitionCount))
 
+	if c.idempotencyJournal && !sendToDebugger && !replay {
+		c.trackJournalEvent(e)
+	}
+
+	if c.updateBatcher != nil {
+		if e.Opcode == mcd.DCP_MUTATION && !sendToDebugger && !replay {
+			c.batchMutation(e, string(metadata), partition)
+			return
+		}
+		c.flushUpdateBatch(partition)
+	}
+
 	var dcpHeader, payload []byte
 	var hBuilder, pBuilder *flatbuffers.Builder
-	if e.Opcode == mcd.DCP_MUTATION {
+	if e.Opcode == mcd.DCP_MUTATION && e.Datatype&dcpDatatypeSnappy != 0 {
+		dcpHeader, hBuilder = c.makeDcpCompressedMutationHeader(partition, string(metadata))
+		payload, pBuilder = c.makeDcpPayload(e.Key, e.Value)
+	} else if e.Opcode == mcd.DCP_MUTATION {
 		dcpHeader, hBuilder = c.makeDcpMutationHeader(partition, string(metadata))
 		payload, pBuilder = c.makeDcpPayload(e.Key, e.Value)
 	} else if e.Opcode == mcd.DCP_DELETION || e.Opcode == mcd.DCP_EXPIRATION {
 		optionMap := map[string]interface{}{
 			"expired": e.Opcode == mcd.DCP_EXPIRATION,
 		}
+		if len(e.OldValue) > 0 {
+			optionMap["pre_image"] = json.RawMessage(e.OldValue)
+		}
 		options, err := json.Marshal(&optionMap)
 		if err != nil {
 			logging.Errorf("CRHM[%s:%s:%s:%d] key: %v failed to marshal options for delete",
@@ -468,7 +552,7 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 		headerBuilder:  hBuilder,
 		payloadBuilder: pBuilder,
 	}
-	if !sendToDebugger {
+	if !sendToDebugger && !replay {
 		c.vbProcessingStats.updateVbStat(e.VBucket, "last_sent_seq_no", e.Seqno)
 	}
 	c.sentEventsSize += int64(len(dcpHeader) + len(payload))
@@ -476,6 +560,68 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 	c.sendMessage(msg)
 }
 
+// sendRollback lets the cpp worker call OnRollback() of the handler, if it defines one. Events are
+// partitioned by key, so OnRollback() isn't ordered with the events of the vbucket on other threads
+func (c *Consumer) sendRollback(info *rollbackInfo) {
+	metadata, err := json.Marshal(info)
+	if err != nil {
+		logging.Errorf("CRHM[%s:%s:%s:%d] vb: %d failed to marshal rollback info",
+			c.app.AppName, c.workerName, c.tcpPort, c.Pid(), info.Vbucket)
+		return
+	}
+
+	header, hBuilder := c.makeDcpRollbackHeader(int16(info.Vbucket), string(metadata))
+
+	msg := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		sendToDebugger: false,
+		prioritize:     false,
+		headerBuilder:  hBuilder,
+	}
+
+	c.dcpRollbackNotifyCount++
+	c.sendMessage(msg)
+}
+
+func (c *Consumer) sendFilteredSeqNo(e *memcached.DcpEvent) {
+	data := vbSeqNo{
+		SeqNo:   e.Seqno,
+		Vbucket: e.VBucket,
+	}
+
+	metadata, err := json.Marshal(&data)
+	if err != nil {
+		logging.Errorf("CRHM[%s:%s:%s:%d] vb: %d failed to marshal filtered seq no",
+			c.app.AppName, c.workerName, c.tcpPort, c.Pid(), e.VBucket)
+		return
+	}
+
+	// Same partition as the events of the key, to be queued behind them
+	partition := int16(util.VbucketByKey(e.Key, cppWorkerPartitionCount))
+	if c.updateBatcher != nil {
+		c.flushUpdateBatch(partition)
+	}
+	header, hBuilder := c.makeFilteredSeqNoHeader(partition, string(metadata))
+
+	msg := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		sendToDebugger: false,
+		prioritize:     false,
+		headerBuilder:  hBuilder,
+	}
+
+	if c.ordering != nil {
+		c.trackFilteredSeqNo(e)
+	}
+
+	c.vbProcessingStats.updateVbStat(e.VBucket, "last_sent_seq_no", e.Seqno)
+	c.sendMessage(msg)
+}
+
 func (c *Consumer) sendVbFilterData(vb uint16, seqNo uint64, skipAck bool) {
 	logPrefix := "Consumer::sendVbFilterData"
 
@@ -495,6 +641,10 @@ func (c *Consumer) sendVbFilterData(vb uint16, seqNo uint64, skipAck bool) {
 		return
 	}
 
+	if c.updateBatcher != nil {
+		c.flushUpdateBatches(true)
+	}
+
 	filterHeader, hBuilder := c.makeVbFilterHeader(int16(vb), string(metadata))
 
 	msg := &msgToTransmit{
@@ -514,6 +664,10 @@ func (c *Consumer) sendVbFilterData(vb uint16, seqNo uint64, skipAck bool) {
 func (c *Consumer) sendPauseConsumer() {
 	logPrefix := "Consumer::sendPauseConsumer"
 
+	if c.updateBatcher != nil {
+		c.flushUpdateBatches(true)
+	}
+
 	pauseHeader, hBuilder := c.makePauseConsumerHeader()
 	msg := &msgToTransmit{
 		msg: &message{
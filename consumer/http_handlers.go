@@ -188,6 +188,8 @@ func (c *Consumer) VbProcessingStats() map[uint16]map[string]interface{} {
 		nextDocIDTimer := c.vbProcessingStats.getVbStat(vbno, "next_doc_id_timer_to_process").(string)
 		nextCronTimer := c.vbProcessingStats.getVbStat(vbno, "next_cron_timer_to_process").(string)
 		plasmaLastSeqNoPersist := c.vbProcessingStats.getVbStat(vbno, "plasma_last_seq_no_persisted").(uint64)
+		rollbackCounter := c.vbProcessingStats.getVbStat(vbno, "rollback_counter").(uint64)
+		rolledBackSeqNos := c.vbProcessingStats.getVbStat(vbno, "rolled_back_seqnos").(uint64)
 
 		vbstats[vbno]["assigned_worker"] = assignedWorker
 		vbstats[vbno]["current_vb_owner"] = owner
@@ -200,6 +202,8 @@ func (c *Consumer) VbProcessingStats() map[uint16]map[string]interface{} {
 		vbstats[vbno]["next_doc_id_timer_to_process"] = nextDocIDTimer
 		vbstats[vbno]["next_cron_timer_to_process"] = nextCronTimer
 		vbstats[vbno]["plasma_last_seq_no_persisted"] = plasmaLastSeqNoPersist
+		vbstats[vbno]["rollback_counter"] = rollbackCounter
+		vbstats[vbno]["rolled_back_seqnos"] = rolledBackSeqNos
 	}
 
 	return vbstats
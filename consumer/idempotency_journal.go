@@ -0,0 +1,318 @@
+package consumer
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+	"gopkg.in/couchbase/gocb.v1"
+)
+
+// The idempotency journal records, per vbucket in the metadata bucket, the events the handler
+// finished processing. A vbucket is streamed again from its last checkpoint after a crash or a
+// change of owner, and journaled events are then skipped instead of running their side effects
+// a second time. An event is journaled once a worker thread acknowledges it: each thread
+// acknowledges the last seq no it processed of a vbucket, and processes the events sent to it in
+// order, so an acknowledgement covers every event of the vbucket sent earlier to the same thread.
+// Acknowledged events are written in batches every journalFlushInterval, off the dcp events loop.
+// An event processed during a crash, or less than journalFlushInterval before it, is processed
+// again, but no event is lost. The journal of a vbucket is read once each time it's streamed, and
+// seq nos are removed from it once the checkpoint of the vbucket covers them.
+
+type journalDoc struct {
+	SeqNos []uint64 `json:"seqnos"`
+}
+
+func (c *Consumer) journalKey(vb uint16) common.Key {
+	functionInstanceID := strconv.Itoa(int(c.app.FunctionID)) + "-" + c.app.FunctionInstanceID
+	return c.producer.AddMetadataPrefix(fmt.Sprintf("%s::journal::%d", functionInstanceID, vb))
+}
+
+// journaledSeqNos returns the journal of a vbucket, read from the metadata bucket the first time
+// it's needed since the vbucket was streamed. Caller must hold journalMutex
+func (c *Consumer) journaledSeqNos(vb uint16) (map[uint64]struct{}, error) {
+	if seqNos, ok := c.journal[vb]; ok {
+		return seqNos, nil
+	}
+
+	var doc journalDoc
+	_, err := c.gocbMetaBucket.Get(c.journalKey(vb).Raw(), &doc)
+	if err != nil && err != gocb.ErrKeyNotFound {
+		return nil, err
+	}
+
+	seqNos := make(map[uint64]struct{}, len(doc.SeqNos))
+	for _, seqNo := range doc.SeqNos {
+		seqNos[seqNo] = struct{}{}
+	}
+	c.journal[vb] = seqNos
+	return seqNos, nil
+}
+
+// resetJournal drops the journal of a vbucket kept in memory, so it's read again from the
+// metadata bucket with what a previous owner of the vbucket wrote to it
+func (c *Consumer) resetJournal(vb uint16) {
+	c.journalMutex.Lock()
+	defer c.journalMutex.Unlock()
+	delete(c.journal, vb)
+	delete(c.journalInflight, vb)
+
+	// Seq nos still pending are written by the next flush
+	delete(c.journalTracked, vb)
+	for _, seqNo := range c.journalPending[vb] {
+		c.trackJournalSeqNo(vb, seqNo)
+	}
+}
+
+// Caller must hold journalMutex
+func (c *Consumer) trackJournalSeqNo(vb uint16, seqNo uint64) {
+	tracked, ok := c.journalTracked[vb]
+	if !ok {
+		tracked = make(map[uint64]struct{})
+		c.journalTracked[vb] = tracked
+	}
+	tracked[seqNo] = struct{}{}
+}
+
+// Caller must hold journalMutex
+func (c *Consumer) untrackJournalSeqNos(vb uint16, seqNos []uint64) {
+	tracked := c.journalTracked[vb]
+	for _, seqNo := range seqNos {
+		delete(tracked, seqNo)
+	}
+	if len(tracked) == 0 {
+		delete(c.journalTracked, vb)
+	}
+}
+
+// isJournaled tells if an event was processed by the handler before, or is still in flight to
+// it. Events are sent when the journal can't be read, as skipping them would lose their side
+// effects altogether.
+func (c *Consumer) isJournaled(e *memcached.DcpEvent) bool {
+	logPrefix := "Consumer::isJournaled"
+
+	c.journalMutex.Lock()
+	defer c.journalMutex.Unlock()
+
+	seqNos, err := c.journaledSeqNos(e.VBucket)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] vb: %d seqNo: %d failed to read journal, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, e.Seqno, err)
+		return false
+	}
+
+	_, journaled := seqNos[e.Seqno]
+	if _, tracked := c.journalTracked[e.VBucket][e.Seqno]; !journaled && !tracked {
+		return false
+	}
+
+	atomic.AddUint64(&c.journalSkipCounter, 1)
+	logging.Tracef("%s [%s:%s:%d] vb: %d seqNo: %d key: %ru already processed, skipping",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, e.Seqno, string(e.Key))
+	return true
+}
+
+// trackJournalEvent keeps an event in flight until a worker thread acknowledges it. Called in
+// the order events are sent to the worker threads
+func (c *Consumer) trackJournalEvent(e *memcached.DcpEvent) {
+	thread := c.cppWorkerThread(int16(util.VbucketByKey(e.Key, cppWorkerPartitionCount)))
+
+	c.journalMutex.Lock()
+	defer c.journalMutex.Unlock()
+
+	inflight, ok := c.journalInflight[e.VBucket]
+	if !ok {
+		inflight = make(map[int][]uint64)
+		c.journalInflight[e.VBucket] = inflight
+	}
+	inflight[thread] = append(inflight[thread], e.Seqno)
+	c.trackJournalSeqNo(e.VBucket, e.Seqno)
+}
+
+// ackJournalEvents moves the events an acknowledgement of a thread covers to the seq nos
+// waiting to be written to the journal. Those are the events of the thread sent up to the
+// acknowledged seq no or, without it in flight, e.g. for a filtered one, those sent before the
+// first one above it.
+func (c *Consumer) ackJournalEvents(vb uint16, seqNo uint64, thread int) {
+	c.journalMutex.Lock()
+	defer c.journalMutex.Unlock()
+
+	inflight := c.journalInflight[vb][thread]
+	covered := -1
+	for i, inflightSeqNo := range inflight {
+		if inflightSeqNo == seqNo {
+			covered = i + 1
+			break
+		}
+	}
+	if covered < 0 {
+		covered = 0
+		for covered < len(inflight) && inflight[covered] <= seqNo {
+			covered++
+		}
+	}
+	if covered == 0 {
+		return
+	}
+
+	c.journalPending[vb] = append(c.journalPending[vb], inflight[:covered]...)
+	if covered == len(inflight) {
+		delete(c.journalInflight[vb], thread)
+		if len(c.journalInflight[vb]) == 0 {
+			delete(c.journalInflight, vb)
+		}
+	} else {
+		c.journalInflight[vb][thread] = inflight[covered:]
+	}
+}
+
+// processJournal writes the acknowledged seq nos to the journals of their vbuckets
+func (c *Consumer) processJournal() {
+	logPrefix := "Consumer::processJournal"
+
+	journalFlushTicker := time.NewTicker(journalFlushInterval)
+	defer journalFlushTicker.Stop()
+
+	for {
+		select {
+		case <-journalFlushTicker.C:
+			c.flushJournal()
+
+		case <-c.stopConsumerCh:
+			logging.Infof("%s [%s:%s:%d] Exiting idempotency journal routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
+
+func (c *Consumer) flushJournal() {
+	logPrefix := "Consumer::flushJournal"
+
+	c.journalWriteMutex.Lock()
+	defer c.journalWriteMutex.Unlock()
+
+	// Seq nos stay pending until written, so that isJournaled finds them meanwhile. Acks only
+	// append to them, and pruneJournal waits for the flush
+	c.journalMutex.Lock()
+	pending := make(map[uint16][]uint64, len(c.journalPending))
+	for vb, seqNos := range c.journalPending {
+		pending[vb] = append([]uint64(nil), seqNos...)
+	}
+	c.journalMutex.Unlock()
+
+	for vb, seqNos := range pending {
+		key := c.journalKey(vb).Raw()
+		_, err := c.gocbMetaBucket.MutateIn(key, 0, journalEntryExpiry).
+			ArrayAppendMulti("seqnos", seqNos, false).
+			Execute()
+		if err == gocb.ErrKeyNotFound {
+			_, err = c.gocbMetaBucket.Insert(key, &journalDoc{SeqNos: seqNos}, journalEntryExpiry)
+		}
+
+		c.journalMutex.Lock()
+		if remaining := c.journalPending[vb][len(seqNos):]; len(remaining) == 0 {
+			delete(c.journalPending, vb)
+		} else {
+			c.journalPending[vb] = remaining
+		}
+		c.untrackJournalSeqNos(vb, seqNos)
+
+		if err != nil {
+			// Processed again if their vbucket is streamed from an earlier checkpoint
+			c.journalMutex.Unlock()
+			atomic.AddUint64(&c.journalWriteErrCounter, uint64(len(seqNos)))
+			logging.Errorf("%s [%s:%s:%d] vb: %d failed to write %d journal entries, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, len(seqNos), err)
+			continue
+		}
+
+		if journaled, ok := c.journal[vb]; ok {
+			for _, seqNo := range seqNos {
+				journaled[seqNo] = struct{}{}
+			}
+		}
+		c.journalMutex.Unlock()
+		atomic.AddUint64(&c.journalWriteCounter, uint64(len(seqNos)))
+	}
+}
+
+// pruneJournal removes the seq nos of a vbucket its checkpoint has caught up with
+func (c *Consumer) pruneJournal(vb uint16, checkpointSeqNo uint64) {
+	logPrefix := "Consumer::pruneJournal"
+
+	c.journalWriteMutex.Lock()
+	defer c.journalWriteMutex.Unlock()
+
+	c.journalMutex.Lock()
+
+	// Seq nos the checkpoint covers are no longer streamed, so they needn't be written either
+	pending := c.journalPending[vb][:0]
+	for _, seqNo := range c.journalPending[vb] {
+		if seqNo > checkpointSeqNo {
+			pending = append(pending, seqNo)
+		} else {
+			c.untrackJournalSeqNos(vb, []uint64{seqNo})
+		}
+	}
+	if len(pending) == 0 {
+		delete(c.journalPending, vb)
+	} else {
+		c.journalPending[vb] = pending
+	}
+
+	seqNos, err := c.journaledSeqNos(vb)
+	if err != nil {
+		c.journalMutex.Unlock()
+		logging.Errorf("%s [%s:%s:%d] vb: %d failed to read journal, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		return
+	}
+
+	var pruned uint64
+	keep := make([]uint64, 0, len(seqNos))
+	for seqNo := range seqNos {
+		if seqNo <= checkpointSeqNo {
+			pruned++
+		} else {
+			keep = append(keep, seqNo)
+		}
+	}
+	c.journalMutex.Unlock()
+
+	if pruned == 0 {
+		return
+	}
+	sort.Slice(keep, func(i, j int) bool { return keep[i] < keep[j] })
+
+	key := c.journalKey(vb).Raw()
+	if len(keep) == 0 {
+		_, err = c.gocbMetaBucket.Remove(key, 0)
+		if err == gocb.ErrKeyNotFound {
+			err = nil
+		}
+	} else {
+		_, err = c.gocbMetaBucket.Upsert(key, &journalDoc{SeqNos: keep}, journalEntryExpiry)
+	}
+	if err != nil {
+		// Pruned on a later checkpoint, or left to expire
+		logging.Errorf("%s [%s:%s:%d] vb: %d failed to prune journal, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		return
+	}
+
+	c.journalMutex.Lock()
+	for seqNo := range seqNos {
+		if seqNo <= checkpointSeqNo {
+			delete(seqNos, seqNo)
+		}
+	}
+	c.journalMutex.Unlock()
+	atomic.AddUint64(&c.journalPruneCounter, pruned)
+}
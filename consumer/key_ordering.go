@@ -0,0 +1,346 @@
+package consumer
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// With the strict_per_key ordering, a key has at most one event in flight to the cpp workers.
+// Later events of the key are held until the worker acknowledges the one in flight over the
+// feedback channel, and only then sent. Each worker thread acknowledges the last seq no it
+// processed of a vbucket, and processes the events sent to it in order, so an acknowledgement
+// covers every event of the vbucket sent earlier to the same thread. Checkpoints stay below the
+// events in flight and held, so a consumer respawned after its worker died streams them again in
+// order. A vbucket whose stream ends is handed over to its next owner only once all its events
+// were sent and processed, however long that takes, so they can't be overtaken there either.
+// Acknowledgements arrive on the worker response routine, so the events they release, and the
+// vbuckets drained before their hand over, are sent from the dcp events loop.
+
+type inflightEvent struct {
+	key   string // empty for filtered seq nos, which don't hold back their key
+	seqNo uint64
+}
+
+type heldEvent struct {
+	event  *memcached.DcpEvent
+	size   int64
+	sentAt int64 // events sent when it was held
+}
+
+// vbInflight indexes the events of a vbucket in flight by the worker thread they were sent to.
+// seqNos holds their seq nos, and those of released events not sent yet, so the lowest one is
+// at hand for checkpoints. Seq nos acknowledged are removed from it lazily
+type vbInflight struct {
+	threads map[int][]*inflightEvent // in the order sent
+	count   int
+	seqNos  seqNoHeap
+	acked   map[uint64]struct{}
+}
+
+type seqNoHeap []uint64
+
+func (h seqNoHeap) Len() int            { return len(h) }
+func (h seqNoHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h seqNoHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *seqNoHeap) Push(x interface{}) { *h = append(*h, x.(uint64)) }
+func (h *seqNoHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type keyOrdering struct {
+	sync.Mutex
+	inflight     map[uint16]*vbInflight
+	inflightKeys map[string]struct{}     // keys with an event in flight, or released and not sent yet
+	held         map[string][]*heldEvent // per key, in the order read
+	heldVbs      map[uint16]int          // count of events held or released, not sent yet, per vbucket
+	released     []*heldEvent            // released by acknowledgements, not sent yet
+	releasedCh   chan struct{}           // notifies the dcp events loop of released events
+	drainedCh    chan *vbSeqNo           // vbuckets to close, once their events are processed
+}
+
+func newKeyOrdering() *keyOrdering {
+	return &keyOrdering{
+		inflight:     make(map[uint16]*vbInflight),
+		inflightKeys: make(map[string]struct{}),
+		held:         make(map[string][]*heldEvent),
+		heldVbs:      make(map[uint16]int),
+		releasedCh:   make(chan struct{}, 1),
+		drainedCh:    make(chan *vbSeqNo),
+	}
+}
+
+func (c *Consumer) orderingThread(key []byte) int {
+	return c.cppWorkerThread(int16(util.VbucketByKey(key, cppWorkerPartitionCount)))
+}
+
+// Caller must hold the ordering lock
+func (o *keyOrdering) vbInflight(vb uint16) *vbInflight {
+	inflight, ok := o.inflight[vb]
+	if !ok {
+		inflight = &vbInflight{
+			threads: make(map[int][]*inflightEvent),
+			acked:   make(map[uint64]struct{}),
+		}
+		o.inflight[vb] = inflight
+	}
+	return inflight
+}
+
+// holdEvent returns true if an earlier event of the key is in flight, in which case the event is
+// held. Otherwise the event is tracked as in flight and should be sent. Held events count
+// against worker_queue_cap and worker_queue_mem_cap like the events sent
+func (c *Consumer) holdEvent(e *memcached.DcpEvent) bool {
+	thread := c.orderingThread(e.Key)
+
+	c.ordering.Lock()
+	defer c.ordering.Unlock()
+
+	key := string(e.Key)
+	if _, ok := c.ordering.inflightKeys[key]; ok {
+		held := &heldEvent{event: e, size: int64(len(e.Key) + len(e.Value)), sentAt: c.numSentEvents}
+		c.ordering.held[key] = append(c.ordering.held[key], held)
+		c.ordering.heldVbs[e.VBucket]++
+		atomic.AddUint64(&c.orderingHeldCounter, 1)
+		atomic.AddInt64(&c.orderingHeldEvents, 1)
+		atomic.AddInt64(&c.orderingHeldSize, held.size)
+		return true
+	}
+
+	c.ordering.inflightKeys[key] = struct{}{}
+	inflight := c.ordering.vbInflight(e.VBucket)
+	inflight.threads[thread] = append(inflight.threads[thread], &inflightEvent{key: key, seqNo: e.Seqno})
+	inflight.count++
+	heap.Push(&inflight.seqNos, e.Seqno)
+	return false
+}
+
+// trackFilteredSeqNo keeps filtered seq nos in flight, as workers acknowledge them like events
+func (c *Consumer) trackFilteredSeqNo(e *memcached.DcpEvent) {
+	thread := c.orderingThread(e.Key)
+
+	c.ordering.Lock()
+	defer c.ordering.Unlock()
+
+	inflight := c.ordering.vbInflight(e.VBucket)
+	inflight.threads[thread] = append(inflight.threads[thread], &inflightEvent{seqNo: e.Seqno})
+	inflight.count++
+	heap.Push(&inflight.seqNos, e.Seqno)
+}
+
+// ackOrderedEvents releases the events held behind the events an acknowledgement of a thread
+// covers, and returns the seq no the vbucket can be checkpointed at, which stays below its events
+// in flight and held. Released events are left for the dcp events loop to send.
+func (c *Consumer) ackOrderedEvents(vb uint16, seqNo uint64, thread int) uint64 {
+	c.ordering.Lock()
+
+	inflight, ok := c.ordering.inflight[vb]
+	if !ok {
+		c.ordering.Unlock()
+		return seqNo
+	}
+
+	// Events sent to the thread up to the acknowledged one are processed. Seq nos that weren't
+	// tracked cover the events of the thread sent before the first one above them
+	events := inflight.threads[thread]
+	covered := -1
+	for i, evt := range events {
+		if evt.seqNo == seqNo {
+			covered = i + 1
+			break
+		}
+	}
+	if covered < 0 {
+		covered = 0
+		for covered < len(events) && events[covered].seqNo <= seqNo {
+			covered++
+		}
+	}
+
+	var released []*heldEvent
+	for _, evt := range events[:covered] {
+		inflight.acked[evt.seqNo] = struct{}{}
+		if evt.key == "" {
+			continue
+		}
+
+		// The key stays in flight until its released event is sent
+		held := c.ordering.held[evt.key]
+		if len(held) == 0 {
+			delete(c.ordering.inflightKeys, evt.key)
+			continue
+		}
+		if len(held) == 1 {
+			delete(c.ordering.held, evt.key)
+		} else {
+			c.ordering.held[evt.key] = held[1:]
+		}
+		released = append(released, held[0])
+		heap.Push(&inflight.seqNos, held[0].event.Seqno)
+	}
+
+	inflight.count -= covered
+	if covered == len(events) {
+		delete(inflight.threads, thread)
+	} else {
+		inflight.threads[thread] = events[covered:]
+	}
+
+	for inflight.seqNos.Len() > 0 {
+		if _, ok := inflight.acked[inflight.seqNos[0]]; !ok {
+			break
+		}
+		delete(inflight.acked, heap.Pop(&inflight.seqNos).(uint64))
+	}
+
+	checkpointSeqNo := seqNo
+	if inflight.seqNos.Len() > 0 && inflight.seqNos[0] <= checkpointSeqNo {
+		checkpointSeqNo = inflight.seqNos[0] - 1
+	}
+	if inflight.seqNos.Len() == 0 {
+		delete(c.ordering.inflight, vb)
+	}
+
+	c.ordering.released = append(c.ordering.released, released...)
+	c.ordering.Unlock()
+
+	if len(released) > 0 {
+		select {
+		case c.ordering.releasedCh <- struct{}{}:
+		default:
+		}
+	}
+	return checkpointSeqNo
+}
+
+// sendReleasedEvents sends the events released by acknowledgements so far, from the dcp events
+// loop. They're tracked in flight as they're sent, so that they keep the order of the events
+// sent to their worker thread
+func (c *Consumer) sendReleasedEvents() {
+	c.ordering.Lock()
+	released := c.ordering.released
+	c.ordering.released = nil
+	c.ordering.Unlock()
+
+	for _, held := range released {
+		e := held.event
+		thread := c.orderingThread(e.Key)
+
+		c.ordering.Lock()
+		inflight := c.ordering.vbInflight(e.VBucket)
+		inflight.threads[thread] = append(inflight.threads[thread], &inflightEvent{key: string(e.Key), seqNo: e.Seqno})
+		inflight.count++
+		c.ordering.heldVbs[e.VBucket]--
+		if c.ordering.heldVbs[e.VBucket] == 0 {
+			delete(c.ordering.heldVbs, e.VBucket)
+		}
+		c.ordering.Unlock()
+
+		atomic.AddInt64(&c.orderingHeldEvents, -1)
+		atomic.AddInt64(&c.orderingHeldSize, -held.size)
+		if c.numSentEvents > held.sentAt {
+			atomic.AddUint64(&c.orderingReorderedCounter, 1)
+		}
+		c.sendDcpEvent(e, false)
+	}
+}
+
+// closeOrderedVb hands a vbucket to the dcp events loop to send the filter closing its stream,
+// once its events held are sent and all its events sent are processed. It doesn't give up on
+// them, as the next owner could otherwise overtake them
+func (c *Consumer) closeOrderedVb(vb uint16, lastSentSeqNo uint64) {
+	logPrefix := "Consumer::closeOrderedVb"
+
+	warnAt := time.Now().Add(orderingDrainWarnInterval)
+	for {
+		inflight, held := c.orderedPendingCount(vb)
+		if inflight == 0 && held == 0 {
+			break
+		}
+
+		if time.Now().After(warnAt) {
+			logging.Warnf("%s [%s:%s:%d] vb: %d waiting on %d events in flight and %d held before handing over",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, inflight, held)
+			warnAt = time.Now().Add(orderingDrainWarnInterval)
+		}
+
+		select {
+		case <-time.After(orderingDrainInterval):
+		case <-c.stopConsumerCh:
+			return
+		}
+	}
+
+	select {
+	case c.ordering.drainedCh <- &vbSeqNo{Vbucket: vb, SeqNo: lastSentSeqNo}:
+	case <-c.stopConsumerCh:
+	}
+}
+
+// closeDrainedVb sends the filter closing the stream of a vbucket handed over by closeOrderedVb
+func (c *Consumer) closeDrainedVb(drained *vbSeqNo) {
+	c.resetOrderedVb(drained.Vbucket)
+	c.sendVbFilterData(drained.Vbucket, drained.SeqNo, false)
+}
+
+func (c *Consumer) orderedPendingCount(vb uint16) (int, int) {
+	c.ordering.Lock()
+	defer c.ordering.Unlock()
+
+	var inflight int
+	if vbInflight, ok := c.ordering.inflight[vb]; ok {
+		inflight = vbInflight.count
+	}
+	return inflight, c.ordering.heldVbs[vb]
+}
+
+// resetOrderedVb forgets the events of a vbucket in flight and held, when its stream is closed
+// or requested again. Held events are streamed again, as checkpoints stay below them
+func (c *Consumer) resetOrderedVb(vb uint16) {
+	c.ordering.Lock()
+	defer c.ordering.Unlock()
+
+	if inflight, ok := c.ordering.inflight[vb]; ok {
+		for _, events := range inflight.threads {
+			for _, evt := range events {
+				if evt.key != "" {
+					delete(c.ordering.inflightKeys, evt.key)
+				}
+			}
+		}
+		delete(c.ordering.inflight, vb)
+	}
+
+	released := c.ordering.released[:0]
+	for _, held := range c.ordering.released {
+		if held.event.VBucket != vb {
+			released = append(released, held)
+			continue
+		}
+		delete(c.ordering.inflightKeys, string(held.event.Key))
+		atomic.AddInt64(&c.orderingHeldEvents, -1)
+		atomic.AddInt64(&c.orderingHeldSize, -held.size)
+	}
+	c.ordering.released = released
+
+	for key, held := range c.ordering.held {
+		if held[0].event.VBucket != vb {
+			continue
+		}
+		for _, evt := range held {
+			atomic.AddInt64(&c.orderingHeldEvents, -1)
+			atomic.AddInt64(&c.orderingHeldSize, -evt.size)
+		}
+		delete(c.ordering.held, key)
+		delete(c.ordering.inflightKeys, key)
+	}
+	delete(c.ordering.heldVbs, vb)
+}
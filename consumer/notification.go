@@ -0,0 +1,37 @@
+package consumer
+
+import (
+	"sync/atomic"
+
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/notification"
+)
+
+// processNotifications publishes notifications reported by cpp workers to their topics.
+// Publishing to a full Persistent topic blocks, so it's kept off the response path.
+func (c *Consumer) processNotifications() {
+	logPrefix := "Consumer::processNotifications"
+
+	for {
+		select {
+		case n := <-c.notificationCh:
+			if notification.Manager == nil {
+				atomic.AddUint64(&c.notificationPublishErrCounter, 1)
+				continue
+			}
+
+			if err := notification.Manager.Publish(n.Topic, n.Value); err != nil {
+				atomic.AddUint64(&c.notificationPublishErrCounter, 1)
+				logging.Errorf("%s [%s:%s:%d] Failed to publish notification to topic: %s, err: %v %s",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), n.Topic, err.Code(), err.Details())
+				continue
+			}
+			atomic.AddUint64(&c.notificationPublishCounter, 1)
+
+		case <-c.stopConsumerCh:
+			logging.Infof("%s [%s:%s:%d] Exiting notification routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
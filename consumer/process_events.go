@@ -26,10 +26,33 @@ func (c *Consumer) processDCPEvents() {
 
 	functionInstanceID := strconv.Itoa(int(c.app.FunctionID)) + "-" + c.app.FunctionInstanceID
 
+	var coalesceFlushCh <-chan time.Time
+	if c.coalescer != nil {
+		coalesceFlushTicker := time.NewTicker(coalesceFlushInterval)
+		defer coalesceFlushTicker.Stop()
+		coalesceFlushCh = coalesceFlushTicker.C
+	}
+
+	var updateBatchFlushCh <-chan time.Time
+	if c.updateBatcher != nil {
+		updateBatchFlushTicker := time.NewTicker(updateBatchFlushInterval)
+		defer updateBatchFlushTicker.Stop()
+		updateBatchFlushCh = updateBatchFlushTicker.C
+	}
+
+	var orderingReleasedCh <-chan struct{}
+	var orderingDrainedCh <-chan *vbSeqNo
+	if c.ordering != nil {
+		orderingReleasedCh = c.ordering.releasedCh
+		orderingDrainedCh = c.ordering.drainedCh
+	}
+
 	for {
 		if c.cppQueueSizes != nil {
-			if c.workerQueueCap < (c.numSentEvents-c.cppQueueSizes.NumProcessedEvents) ||
-				c.workerQueueMemCap < (c.sentEventsSize-c.cppQueueSizes.ProcessedEventsSize) {
+			// Events held under the strict_per_key ordering are queued too
+			heldEvents, heldSize := atomic.LoadInt64(&c.orderingHeldEvents), atomic.LoadInt64(&c.orderingHeldSize)
+			if c.workerQueueCap < (c.numSentEvents+heldEvents-c.cppQueueSizes.NumProcessedEvents) ||
+				c.workerQueueMemCap < (c.sentEventsSize+heldSize-c.cppQueueSizes.ProcessedEventsSize) {
 				logging.Debugf("%s [%s:%s:%d] Throttling, cpp queue sizes: %+v, num sent event: %d, events size: %d",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), c.cppQueueSizes, c.numSentEvents, c.sentEventsSize)
 
@@ -85,28 +108,43 @@ func (c *Consumer) processDCPEvents() {
 				logging.Tracef("%s [%s:%s:%d] Got DCP_MUTATION for key: %ru datatype: %v",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key), e.Datatype)
 
+				if !c.prepareMutationValue(e) {
+					c.sendFilteredSeqNo(e)
+					continue
+				}
+
+				if c.shadowCopy {
+					c.writeShadowCopy(e)
+				}
+
 				switch e.Datatype {
-				case dcpDatatypeJSON:
-					c.dcpMutationCounter++
-					c.sendEvent(e)
+				case dcpDatatypeJSON, dcpDatatypeJSON | dcpDatatypeSnappy:
+					if c.filterMutation(e) {
+						continue
+					}
+					c.sendMutation(e)
 				case dcpDatatypeJSONXattr:
 					xattrLen := binary.BigEndian.Uint32(e.Value[0:4])
 					if c.app.SrcMutationEnabled {
 						if isRecursive, err := c.isRecursiveDCPEvent(e, functionInstanceID); err == nil && isRecursive == true {
 							c.suppressedDCPMutationCounter++
 						} else {
+							e.Value = e.Value[xattrLen+4:]
+							if c.filterMutation(e) {
+								continue
+							}
 							logging.Tracef("%s [%s:%s:%d] No IntraHandlerRecursion, sending key: %ru to be processed by JS handlers",
 								logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key))
-							c.dcpMutationCounter++
-							e.Value = e.Value[xattrLen+4:]
-							c.sendEvent(e)
+							c.sendMutation(e)
 						}
 					} else {
+						e.Value = e.Value[xattrLen+4:]
+						if c.filterMutation(e) {
+							continue
+						}
 						logging.Tracef("%s [%s:%s:%d] Sending key: %ru to be processed by JS handlers",
 							logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key))
-						c.dcpMutationCounter++
-						e.Value = e.Value[xattrLen+4:]
-						c.sendEvent(e)
+						c.sendMutation(e)
 					}
 				}
 
@@ -119,6 +157,10 @@ func (c *Consumer) processDCPEvents() {
 				}
 				c.filterVbEventsRWMutex.RUnlock()
 
+				if c.coalescer != nil {
+					c.flushCoalescedKey(e)
+				}
+
 				if c.processAndSendDcpDelOrExpMessage(e, functionInstanceID, true) {
 					c.dcpDeletionCounter++
 				} else {
@@ -134,9 +176,27 @@ func (c *Consumer) processDCPEvents() {
 				}
 				c.filterVbEventsRWMutex.RUnlock()
 
+				if c.coalescer != nil {
+					c.flushCoalescedKey(e)
+				}
+
 				c.processAndSendDcpDelOrExpMessage(e, functionInstanceID, false)
 				c.dcpExpiryCounter++
 
+			case mcd.DCP_SYSTEM_EVENT, mcd.DCP_SEQNO_ADVANCED:
+
+				c.filterVbEventsRWMutex.RLock()
+				if _, ok := c.filterVbEvents[e.VBucket]; ok {
+					c.filterVbEventsRWMutex.RUnlock()
+					continue
+				}
+				c.filterVbEventsRWMutex.RUnlock()
+
+				// Seq nos of a collection aware stream not carrying an item of the source collection,
+				// acknowledged like filtered mutations so the checkpoint moves past them
+				c.vbProcessingStats.updateVbStat(e.VBucket, "last_read_seq_no", e.Seqno)
+				c.sendFilteredSeqNo(e)
+
 			case mcd.DCP_STREAMREQ:
 
 				logging.Infof("%s [%s:%s:%d] vb: %d got STREAMREQ status: %v",
@@ -186,6 +246,13 @@ func (c *Consumer) processDCPEvents() {
 
 					c.vbProcessingStats.updateVbStat(e.VBucket, "vb_uuid", vbuuid)
 
+					if c.idempotencyJournal {
+						c.resetJournal(e.VBucket)
+					}
+					if c.ordering != nil {
+						c.resetOrderedVb(e.VBucket)
+					}
+
 					// Update metadata with latest vbuuid and rollback seq no
 					vbBlob.AssignedWorker = c.ConsumerName()
 					vbBlob.CurrentVBOwner = c.HostPortAddr()
@@ -301,11 +368,20 @@ func (c *Consumer) processDCPEvents() {
 				lastReadSeqNo := c.vbProcessingStats.getVbStat(e.VBucket, "last_read_seq_no").(uint64)
 				c.vbProcessingStats.updateVbStat(e.VBucket, "seq_no_at_stream_end", lastReadSeqNo)
 				c.vbProcessingStats.updateVbStat(e.VBucket, "timestamp", time.Now().Format(time.RFC3339))
+
+				if c.coalescer != nil {
+					c.flushCoalescedVb(e.VBucket)
+				}
+				if c.shadowCopy {
+					c.flushVbShadowCopies(e.VBucket)
+				}
 				lastSentSeqNo := c.vbProcessingStats.getVbStat(e.VBucket, "last_sent_seq_no").(uint64)
 
 				if lastSentSeqNo == 0 {
 					logging.Infof("STREAMEND without streaming any mutation last_read_seqno: %d last_sent_seqno: %d", lastReadSeqNo, lastSentSeqNo)
 					c.handleStreamEnd(e.VBucket, lastReadSeqNo)
+				} else if c.ordering != nil {
+					go c.closeOrderedVb(e.VBucket, lastSentSeqNo)
 				} else {
 					c.sendVbFilterData(e.VBucket, lastSentSeqNo, false)
 				}
@@ -313,6 +389,22 @@ func (c *Consumer) processDCPEvents() {
 			default:
 			}
 
+		case <-coalesceFlushCh:
+			c.flushCoalescedMutations(false)
+
+		case <-updateBatchFlushCh:
+			c.flushUpdateBatches(false)
+
+		case e := <-c.deadLetterReplayCh:
+			c.sendReplayedDcpEvent(e)
+			atomic.AddUint64(&c.deadLetterReplayCounter, 1)
+
+		case <-orderingReleasedCh:
+			c.sendReleasedEvents()
+
+		case drained := <-orderingDrainedCh:
+			c.closeDrainedVb(drained)
+
 		case <-c.stopConsumerCh:
 			logging.Infof("%s [%s:%s:%d] Exiting processDCPEvents routine",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
@@ -530,6 +622,19 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 				}
 				c.vbProcessingStats.updateVbStat(vb, "start_seq_no", start)
 				c.vbProcessingStats.updateVbStat(vb, "timestamp", time.Now().Format(time.RFC3339))
+
+			case common.DcpFromSeqnos, common.DcpFromCheckpointSnapshot:
+				start = c.streamStartSeqNo(vb, vbSeqnos)
+				logging.Infof("%s [%s:%s:%d] vb: %d Sending streamRequestInfo size: %d start seq no: %d",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, len(c.reqStreamCh), start)
+
+				c.reqStreamCh <- &streamRequestInfo{
+					vb:         vb,
+					vbBlob:     &vbBlob,
+					startSeqNo: start,
+				}
+				c.vbProcessingStats.updateVbStat(vb, "start_seq_no", start)
+				c.vbProcessingStats.updateVbStat(vb, "timestamp", time.Now().Format(time.RFC3339))
 			}
 		} else {
 			logging.Infof("%s [%s:%s:%d] vb: %d checkpoint blob prexisted, UUID: %s assigned worker: %s",
@@ -577,6 +682,15 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 							startSeqNo: vbBlob.LastSeqNoProcessed,
 						}
 						c.vbProcessingStats.updateVbStat(vb, "start_seq_no", vbBlob.LastSeqNoProcessed)
+
+					case common.DcpFromSeqnos, common.DcpFromCheckpointSnapshot:
+						start = c.streamStartSeqNo(vb, vbSeqnos)
+						c.reqStreamCh <- &streamRequestInfo{
+							vb:         vb,
+							vbBlob:     &vbBlob,
+							startSeqNo: start,
+						}
+						c.vbProcessingStats.updateVbStat(vb, "start_seq_no", start)
 					}
 				} else {
 					c.reqStreamCh <- &streamRequestInfo{
@@ -601,6 +715,16 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 	return nil
 }
 
+// streamStartSeqNo returns the seq no from which the stream of a vbucket is replayed. Vbuckets
+// missing from the seq no map, or ahead of the bucket, start from now.
+func (c *Consumer) streamStartSeqNo(vb uint16, vbSeqnos []uint64) uint64 {
+	highSeqNo := vbSeqnos[int(vb)]
+	if seqNo, ok := c.dcpStreamSeqNos[vb]; ok && seqNo < highSeqNo {
+		return seqNo
+	}
+	return highSeqNo
+}
+
 func (c *Consumer) addToAggChan(dcpFeed *couchbase.DcpFeed) {
 	logPrefix := "Consumer::addToAggChan"
 
@@ -998,7 +1122,7 @@ func (c *Consumer) handleFailoverLog() {
 
 				if flog, ok := flogs[vbFlog.vb]; ok {
 					vbuuid, startSeqNo, err = flog.FetchLogForSeqNo(vbBlob.LastSeqNoProcessed)
-					if err != nil {
+					if err != nil && vbFlog.statusCode != mcd.ROLLBACK {
 						c.Lock()
 						c.vbsRemainingToRestream = append(c.vbsRemainingToRestream, vbFlog.vb)
 						c.Unlock()
@@ -1008,8 +1132,16 @@ func (c *Consumer) handleFailoverLog() {
 				}
 
 				if vbFlog.statusCode == mcd.ROLLBACK {
+					// Stream from the rollback seq no, on the branch of the failover log it belongs to
+					vbuuid = rollbackVbuuid(flogs[vbFlog.vb], vbBlob.VBuuid, vbFlog.seqNo)
+
 					logging.Infof("%s [%s:%s:%d] vb: %d rollback requested by DCP. Retrying DCP stream start vbuuid: %d startSeq: %d flog startSeqNo: %d",
-						logPrefix, c.workerName, c.tcpPort, c.Pid(), vbFlog.vb, vbBlob.VBuuid, vbFlog.seqNo, startSeqNo)
+						logPrefix, c.workerName, c.tcpPort, c.Pid(), vbFlog.vb, vbuuid, vbFlog.seqNo, startSeqNo)
+
+					lastSeqNo := vbBlob.LastSeqNoProcessed
+					if seqNo, ok := c.vbProcessingStats.getVbStat(vbFlog.vb, "last_processed_seq_no").(uint64); ok && seqNo > lastSeqNo {
+						lastSeqNo = seqNo
+					}
 
 					// update in-memory stats to reflect rollback seqno so that periodicCheckPoint picks up the latest data
 					c.vbProcessingStats.updateVbStat(vbFlog.vb, "last_processed_seq_no", vbFlog.seqNo)
@@ -1040,6 +1172,7 @@ func (c *Consumer) handleFailoverLog() {
 					// for stream in later case, unless we maintain another data structure to
 					// maintain that information
 					c.sendVbFilterData(vbFlog.vb, vbFlog.seqNo, true)
+					c.recordRollback(vbFlog.vb, lastSeqNo, vbFlog.seqNo)
 					streamInfo := &streamRequestInfo{
 						vb:         vbFlog.vb,
 						vbBlob:     &vbBlob,
@@ -1131,11 +1264,43 @@ func (c *Consumer) cppWorkerThrPartitionMap() {
 	}
 
 	c.cppThrPartitionMap = util.VbucketDistribution(partitions, c.cppWorkerThrCount)
+
+	c.partitionThrMap = make(map[int16]int)
+	for thr, thrPartitions := range c.cppThrPartitionMap {
+		for _, partition := range thrPartitions {
+			c.partitionThrMap[int16(partition)] = thr
+		}
+	}
+}
+
+// cppWorkerThread returns the cpp worker thread events of a partition are processed on
+func (c *Consumer) cppWorkerThread(partition int16) int {
+	return c.partitionThrMap[partition]
+}
+
+// sendMutation sends a mutation to the handler, or buffers it under a coalesce window
+func (c *Consumer) sendMutation(e *cb.DcpEvent) {
+	if c.coalescer != nil {
+		c.coalesceMutation(e)
+		return
+	}
+
+	c.dcpMutationCounter++
+	c.sendEvent(e)
 }
 
 func (c *Consumer) sendEvent(e *cb.DcpEvent) error {
 	logPrefix := "Consumer::processTrappedEvent"
 
+	if c.idempotencyJournal && c.isJournaled(e) {
+		c.sendFilteredSeqNo(e)
+		return nil
+	}
+
+	if c.ordering != nil && c.holdEvent(e) {
+		return nil
+	}
+
 	if !c.producer.IsTrapEvent() {
 		c.sendDcpEvent(e, false)
 		return nil
@@ -1351,6 +1516,11 @@ func (c *Consumer) handleStreamEnd(vBucket uint16, last_processed_seqno uint64)
 func (c *Consumer) processAndSendDcpDelOrExpMessage(e *cb.DcpEvent, functionInstanceID string, checkRecursiveEvent bool) bool {
 	logPrefix := "Consumer::processAndSendDcpMessage"
 	c.vbProcessingStats.updateVbStat(e.VBucket, "last_read_seq_no", e.Seqno)
+	// The handler still gets a deletion whose value can't be inflated, without its pre-image
+	if !c.inflateValue(e) {
+		e.Value, e.Datatype = nil, 0
+	}
+	c.attachPreImage(e)
 	switch e.Datatype {
 	case dcpDatatypeJSONXattr:
 		xattrLen := binary.BigEndian.Uint32(e.Value[0:4])
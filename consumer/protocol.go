@@ -41,6 +41,7 @@ const (
 	filterOpcode int8 = iota
 	vbFilter
 	processedSeqNo
+	filteredSeqNo
 )
 
 const (
@@ -58,12 +59,16 @@ const (
 	v8WorkerLcbExceptions
 	v8WorkerCurlLatencyStats
 	v8WorkerInsight
+	v8WorkerTestEvents
 )
 
 const (
 	dcpOpcode int8 = iota
 	dcpDeletion
 	dcpMutation
+	dcpMutationBatch
+	dcpCompressedMutation
+	dcpRollback
 )
 
 const (
@@ -74,6 +79,7 @@ const (
 	timerContextSize
 	vbMap
 	workerThreadMemQuota
+	curlLimitShare
 )
 
 // message and opcode types for interpreting messages from C++ To Go
@@ -84,6 +90,8 @@ const (
 	bucketOpsResponse
 	bucketOpsFilterAck
 	pauseAck
+	deadLetterResponse
+	notificationResponse
 )
 
 const (
@@ -100,6 +108,7 @@ const (
 	lcbExceptions
 	curlLatencyStats
 	insight
+	testResult
 )
 
 const (
@@ -114,6 +123,14 @@ const (
 	bucketOpsFilterAckOpCode int8 = iota
 )
 
+const (
+	deadLetterEntry int8 = iota
+)
+
+const (
+	notificationPublish int8 = iota
+)
+
 type message struct {
 	Header  []byte
 	Payload []byte
@@ -127,6 +144,18 @@ func (c *Consumer) makeDcpMutationHeader(partition int16, mutationMeta string) (
 	return c.makeDcpHeader(dcpMutation, partition, mutationMeta)
 }
 
+func (c *Consumer) makeDcpCompressedMutationHeader(partition int16, mutationMeta string) ([]byte, *flatbuffers.Builder) {
+	return c.makeDcpHeader(dcpCompressedMutation, partition, mutationMeta)
+}
+
+func (c *Consumer) makeDcpRollbackHeader(partition int16, rollbackMeta string) ([]byte, *flatbuffers.Builder) {
+	return c.makeDcpHeader(dcpRollback, partition, rollbackMeta)
+}
+
+func (c *Consumer) makeDcpMutationBatchHeader(partition int16) ([]byte, *flatbuffers.Builder) {
+	return c.makeDcpHeader(dcpMutationBatch, partition, "")
+}
+
 func (c *Consumer) makeDcpDeletionHeader(partition int16, deletionMeta string) ([]byte, *flatbuffers.Builder) {
 	return c.makeDcpHeader(dcpDeletion, partition, deletionMeta)
 }
@@ -150,6 +179,10 @@ func (c *Consumer) makeProcessedSeqNoHeader(partition int16, meta string) ([]byt
 	return c.filterEventHeader(processedSeqNo, partition, meta)
 }
 
+func (c *Consumer) makeFilteredSeqNoHeader(partition int16, meta string) ([]byte, *flatbuffers.Builder) {
+	return c.filterEventHeader(filteredSeqNo, partition, meta)
+}
+
 func (c *Consumer) makeV8DebuggerStartHeader() ([]byte, *flatbuffers.Builder) {
 	return c.makeV8DebuggerHeader(startDebug, "")
 }
@@ -170,6 +203,10 @@ func (c *Consumer) makeV8CompileOpcodeHeader(appCode string) ([]byte, *flatbuffe
 	return c.makeV8EventHeader(v8WorkerCompile, appCode)
 }
 
+func (c *Consumer) makeV8TestEventsHeader(events string) ([]byte, *flatbuffers.Builder) {
+	return c.makeV8EventHeader(v8WorkerTestEvents, events)
+}
+
 func (c *Consumer) makeV8LoadOpcodeHeader(appCode string) ([]byte, *flatbuffers.Builder) {
 	return c.makeV8EventHeader(v8WorkerLoad, appCode)
 }
@@ -305,6 +342,37 @@ func (c *Consumer) makeDcpPayload(key, value []byte) (encodedPayload []byte, bui
 	return
 }
 
+func (c *Consumer) makeDcpBatchPayload(mutations []*batchedMutation) (encodedPayload []byte, builder *flatbuffers.Builder) {
+	builder = c.getBuilder()
+
+	positions := make([]flatbuffers.UOffsetT, 0, len(mutations))
+	for _, mutation := range mutations {
+		keyPos := builder.CreateByteString(mutation.key)
+		valPos := builder.CreateByteString(mutation.value)
+		metaPos := builder.CreateString(mutation.metadata)
+
+		payload.MutationStart(builder)
+		payload.MutationAddKey(builder, keyPos)
+		payload.MutationAddValue(builder, valPos)
+		payload.MutationAddMetadata(builder, metaPos)
+		positions = append(positions, payload.MutationEnd(builder))
+	}
+
+	payload.PayloadStartMutationsVector(builder, len(positions))
+	for i := len(positions) - 1; i >= 0; i-- {
+		builder.PrependUOffsetT(positions[i])
+	}
+	mutationsPos := builder.EndVector(len(positions))
+
+	payload.PayloadStart(builder)
+	payload.PayloadAddMutations(builder, mutationsPos)
+	payloadPos := payload.PayloadEnd(builder)
+	builder.Finish(payloadPos)
+
+	encodedPayload = builder.FinishedBytes()
+	return
+}
+
 func (c *Consumer) makeV8InitPayload(appName, debuggerPort, currHost, eventingDir, eventingPort,
 	eventingSSLPort, depCfg string, capacity, executionTimeout, checkpointInterval int,
 	skipLcbBootstrap bool, timerContextSize int64) (encodedPayload []byte, builder *flatbuffers.Builder) {
@@ -466,6 +534,18 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal compilation stats, msg: %v err: %v",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
 			}
+		case testResult:
+			var results []*common.TestEventResult
+			err := json.Unmarshal([]byte(msg), &results)
+			if err != nil {
+				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal test results, msg: %ru err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+				results = []*common.TestEventResult{}
+			}
+			select {
+			case c.testResultCh <- results:
+			default:
+			}
 		case queueSize:
 			c.workerRespMainLoopTs.Store(time.Now())
 
@@ -488,13 +568,13 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 
 	case bucketOpsResponse:
 		data := strings.Split(msg, "::")
-		if len(data) != 2 {
+		if len(data) != 3 {
 			logging.Errorf("%s [%s:%s:%d] Invalid bucket ops message received: %s",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
 			return
 		}
 
-		vbStr, seqNoStr := data[0], data[1]
+		vbStr, seqNoStr, threadStr := data[0], data[1], data[2]
 		vb, err := strconv.ParseUint(vbStr, 10, 16)
 		if err != nil {
 			logging.Errorf("%s [%s:%s:%d] Failed to convert vbStr: %s to uint64, msg: %s err: %v",
@@ -507,6 +587,23 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), seqNoStr, msg, err)
 			return
 		}
+		thread, err := strconv.Atoi(threadStr)
+		if err != nil {
+			logging.Errorf("%s [%s:%s:%d] Failed to convert threadStr: %s to int, msg: %s err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), threadStr, msg, err)
+			return
+		}
+		if c.idempotencyJournal {
+			c.ackJournalEvents(uint16(vb), seqNo, thread)
+		}
+		if c.ordering != nil {
+			seqNo = c.ackOrderedEvents(uint16(vb), seqNo, thread)
+		}
+
+		if c.coalescer != nil {
+			seqNo = c.coalescedCheckpointSeqNo(uint16(vb), seqNo)
+		}
+
 		prevSeqNo := c.vbProcessingStats.getVbStat(uint16(vb), "last_processed_seq_no").(uint64)
 		if seqNo > prevSeqNo {
 			c.vbProcessingStats.updateVbStat(uint16(vb), "last_processed_seq_no", seqNo)
@@ -540,6 +637,34 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 		for _, ack := range acks {
 			c.filterDataCh <- &ack
 		}
+
+	case deadLetterResponse:
+		entry := &common.DeadLetterEntry{}
+		if err := json.Unmarshal([]byte(msg), entry); err != nil {
+			logging.Errorf("%s [%s:%s:%d] Failed to unmarshal dead letter entry, msg: %ru err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+			return
+		}
+		entry.AppName = c.app.AppName
+		entry.Timestamp = time.Now().UTC().Format(time.RFC3339)
+
+		select {
+		case c.deadLetterCh <- entry:
+		case <-c.stopConsumerCh:
+		}
+
+	case notificationResponse:
+		n := &publishedNotification{}
+		if err := json.Unmarshal([]byte(msg), n); err != nil {
+			logging.Errorf("%s [%s:%s:%d] Failed to unmarshal notification, msg: %ru err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+			return
+		}
+
+		select {
+		case c.notificationCh <- n:
+		case <-c.stopConsumerCh:
+		}
 	default:
 		logging.Infof("%s [%s:%s:%d] Unknown message %s",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"fmt"
+
+	"github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+)
+
+// A stream request answered with ROLLBACK carries the seq no KV wants the vbucket to be streamed
+// from. The vbucket is streamed again from there, with the vbuuid of the failover log entry that
+// seq no belongs to, instead of going through the coarse restream from the last checkpoint.
+
+// rollbackVbuuid returns the vbuuid to stream a vbucket from its rollback seq no. The stored vbuuid
+// is used when the failover log can't tell
+func rollbackVbuuid(flog memcached.FailoverLog, storedVbuuid, rollbackSeqNo uint64) uint64 {
+	if len(flog) == 0 {
+		return storedVbuuid
+	}
+
+	vbuuid, _, err := flog.FetchLogForSeqNo(rollbackSeqNo)
+	if err != nil {
+		return storedVbuuid
+	}
+	return vbuuid
+}
+
+// recordRollback updates the rollback stats of a vbucket, writes it to the app log and notifies the
+// handler. lastSeqNo is the last seq no processed before the rollback
+func (c *Consumer) recordRollback(vb uint16, lastSeqNo, rollbackSeqNo uint64) {
+	logPrefix := "Consumer::recordRollback"
+
+	// Seq nos aren't contiguous per vbucket, so this isn't a count of events
+	var rolledBack uint64
+	if lastSeqNo > rollbackSeqNo {
+		rolledBack = lastSeqNo - rollbackSeqNo
+	}
+
+	if count, ok := c.vbProcessingStats.getVbStat(vb, "rollback_counter").(uint64); ok {
+		c.vbProcessingStats.updateVbStat(vb, "rollback_counter", count+1)
+	}
+	if count, ok := c.vbProcessingStats.getVbStat(vb, "rolled_back_seqnos").(uint64); ok {
+		c.vbProcessingStats.updateVbStat(vb, "rolled_back_seqnos", count+rolledBack)
+	}
+	c.dcpRollbackCounter++
+	c.dcpRolledBackSeqNos += rolledBack
+
+	logging.Infof("%s [%s:%s:%d] vb: %d rolled back %d seq nos, last processed seq no: %d rollback seq no: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, rolledBack, lastSeqNo, rollbackSeqNo)
+	c.producer.WriteAppLog(fmt.Sprintf("vb: %d rolled back from seq no: %d to seq no: %d",
+		vb, lastSeqNo, rollbackSeqNo))
+
+	c.sendRollback(&rollbackInfo{
+		Vbucket:          vb,
+		RollbackSeqNo:    rollbackSeqNo,
+		RolledBackSeqNos: rolledBack,
+	})
+}
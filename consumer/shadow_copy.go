@@ -0,0 +1,225 @@
+package consumer
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+	"gopkg.in/couchbase/gocb.v1"
+)
+
+// OnDelete gets the last known body of a document as the pre_image option. It's taken from the
+// deletion or expiration itself when the stream carries the body. Otherwise, with shadow copies
+// enabled, the body of each mutation is kept in the metadata bucket until the document is gone.
+// Shadow copies, and their removals, are buffered per document and written in the background, so
+// the dcp events routine doesn't wait on the metadata bucket for each mutation, and a document
+// mutated again before its shadow copy is written only has its newest body written. Copies being
+// written are kept apart until they are, so a deletion finds them without waiting on the write,
+// and the copies of a vbucket are written before it's handed over to its next owner.
+
+type shadowCopy struct {
+	Key  string          `json:"key"`
+	Body json.RawMessage `json:"body"`
+
+	vb      uint16
+	removed bool // the document is gone or its body isn't JSON, so its copy is removed
+}
+
+// Document keys are hashed, as the metadata prefix would push long ones over the key length limit
+func (c *Consumer) shadowCopyKey(key []byte) common.Key {
+	functionInstanceID := strconv.Itoa(int(c.app.FunctionID)) + "-" + c.app.FunctionInstanceID
+	sum := sha1.Sum(key)
+	return c.producer.AddMetadataPrefix(fmt.Sprintf("%s::shadow::%s", functionInstanceID, hex.EncodeToString(sum[:])))
+}
+
+// documentBody returns the JSON body of a DCP event, without its xattrs
+func documentBody(e *memcached.DcpEvent) []byte {
+	switch e.Datatype {
+	case dcpDatatypeJSON:
+		return e.Value
+	case dcpDatatypeJSONXattr:
+		if len(e.Value) < 4 {
+			return nil
+		}
+		xattrLen := binary.BigEndian.Uint32(e.Value[0:4])
+		if int(xattrLen)+4 > len(e.Value) {
+			return nil
+		}
+		return e.Value[xattrLen+4:]
+	}
+	return nil
+}
+
+// writeShadowCopy buffers the body of a mutation, including mutations the handler doesn't see, as
+// they still change the document. A mutation without a JSON body removes the copy of an older one
+func (c *Consumer) writeShadowCopy(e *memcached.DcpEvent) {
+	entry := &shadowCopy{Key: string(e.Key), vb: e.VBucket}
+	if body := documentBody(e); len(body) > 0 {
+		entry.Body = json.RawMessage(body)
+	} else {
+		entry.removed = true
+	}
+	c.bufferShadowCopy(entry)
+}
+
+func (c *Consumer) bufferShadowCopy(entry *shadowCopy) {
+	c.shadowCopyRWMutex.Lock()
+	c.shadowCopies[entry.Key] = entry
+	full := len(c.shadowCopies) >= shadowCopyBufferCap
+	c.shadowCopyRWMutex.Unlock()
+
+	if full {
+		select {
+		case c.shadowCopyFlushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// processShadowCopies writes the buffered shadow copies every shadowCopyFlushInterval, or once the
+// buffer is full
+func (c *Consumer) processShadowCopies() {
+	logPrefix := "Consumer::processShadowCopies"
+
+	ticker := time.NewTicker(shadowCopyFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.flushShadowCopies()
+
+		case <-c.shadowCopyFlushCh:
+			c.flushShadowCopies()
+
+		case <-c.stopConsumerCh:
+			c.flushShadowCopies()
+			logging.Infof("%s [%s:%s:%d] Exiting shadow copy routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
+
+// flushShadowCopies writes the buffered shadow copies
+func (c *Consumer) flushShadowCopies() {
+	c.shadowCopyFlushMutex.Lock()
+	defer c.shadowCopyFlushMutex.Unlock()
+
+	c.shadowCopyRWMutex.Lock()
+	c.shadowCopiesFlushing = c.shadowCopies
+	c.shadowCopies = make(map[string]*shadowCopy)
+	c.shadowCopyRWMutex.Unlock()
+
+	c.writeFlushingShadowCopies()
+}
+
+// flushVbShadowCopies writes the buffered shadow copies of a vbucket whose stream ended, so that
+// its next owner finds them
+func (c *Consumer) flushVbShadowCopies(vb uint16) {
+	c.shadowCopyFlushMutex.Lock()
+	defer c.shadowCopyFlushMutex.Unlock()
+
+	c.shadowCopyRWMutex.Lock()
+	c.shadowCopiesFlushing = make(map[string]*shadowCopy)
+	for key, entry := range c.shadowCopies {
+		if entry.vb == vb {
+			c.shadowCopiesFlushing[key] = entry
+			delete(c.shadowCopies, key)
+		}
+	}
+	c.shadowCopyRWMutex.Unlock()
+
+	c.writeFlushingShadowCopies()
+}
+
+// writeFlushingShadowCopies writes the shadow copies set apart by a flush. Caller must hold
+// shadowCopyFlushMutex, which keeps an older copy of a document from being written after a newer one
+func (c *Consumer) writeFlushingShadowCopies() {
+	logPrefix := "Consumer::writeFlushingShadowCopies"
+
+	for key, entry := range c.shadowCopiesFlushing {
+		var err error
+		if entry.removed {
+			_, err = c.gocbMetaBucket.Remove(c.shadowCopyKey([]byte(key)).Raw(), 0)
+			if err == gocb.ErrKeyNotFound {
+				err = nil
+			}
+		} else {
+			_, err = c.gocbMetaBucket.Upsert(c.shadowCopyKey([]byte(key)).Raw(), entry, 0)
+		}
+		if err != nil {
+			atomic.AddUint64(&c.shadowCopyErrCounter, 1)
+			logging.Errorf("%s [%s:%s:%d] key: %ru failed to write shadow copy, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), key, err)
+		}
+	}
+
+	c.shadowCopyRWMutex.Lock()
+	c.shadowCopiesFlushing = nil
+	c.shadowCopyRWMutex.Unlock()
+}
+
+// takeShadowCopy returns the shadow copy of a document that is gone, and buffers its removal. A
+// copy that isn't buffered or being written is read from the metadata bucket, without waiting on
+// a flush in progress, as it can't be writing that document
+func (c *Consumer) takeShadowCopy(e *memcached.DcpEvent) []byte {
+	logPrefix := "Consumer::takeShadowCopy"
+
+	c.shadowCopyRWMutex.Lock()
+	entry, ok := c.shadowCopies[string(e.Key)]
+	if !ok {
+		entry, ok = c.shadowCopiesFlushing[string(e.Key)]
+	}
+	c.shadowCopyRWMutex.Unlock()
+
+	c.bufferShadowCopy(&shadowCopy{Key: string(e.Key), vb: e.VBucket, removed: true})
+
+	if ok {
+		if entry.removed {
+			return nil
+		}
+		return entry.Body
+	}
+
+	var stored shadowCopy
+	_, err := c.gocbMetaBucket.Get(c.shadowCopyKey(e.Key).Raw(), &stored)
+	if err == gocb.ErrKeyNotFound || (err == nil && stored.Key != string(e.Key)) {
+		return nil
+	}
+	if err != nil {
+		atomic.AddUint64(&c.shadowCopyErrCounter, 1)
+		logging.Errorf("%s [%s:%s:%d] vb: %d seqNo: %d key: %ru failed to read shadow copy, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, e.Seqno, string(e.Key), err)
+		return nil
+	}
+	return stored.Body
+}
+
+// attachPreImage sets the last known body of a deleted or expired document as the old value of
+// the event
+func (c *Consumer) attachPreImage(e *memcached.DcpEvent) {
+	var shadowBody []byte
+	if c.shadowCopy {
+		shadowBody = c.takeShadowCopy(e)
+	}
+
+	if body := documentBody(e); len(body) > 0 {
+		e.OldValue = body
+		c.preImageFromStreamCounter++
+		return
+	}
+
+	if len(shadowBody) > 0 {
+		e.OldValue = shadowBody
+		c.preImageFromShadowCopyCounter++
+	}
+}
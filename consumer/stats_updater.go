@@ -55,6 +55,8 @@ func newVbProcessingStats(appName string, numVbuckets uint16, uuid, workerName s
 		vbsts[i].stats["last_checkpointed_seq_no"] = uint64(0)
 		vbsts[i].stats["last_read_seq_no"] = uint64(0)
 		vbsts[i].stats["node_uuid"] = uuid
+		vbsts[i].stats["rollback_counter"] = uint64(0)
+		vbsts[i].stats["rolled_back_seqnos"] = uint64(0)
 		vbsts[i].stats["start_seq_no"] = uint64(0)
 		vbsts[i].stats["seq_no_at_stream_end"] = uint64(0)
 		vbsts[i].stats["seq_no_after_close_stream"] = uint64(0)
@@ -0,0 +1,136 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+)
+
+// With an update batch size, mutations are packed into batches per cpp worker thread, and each
+// batch crosses the socket as a single message. A batch is sent once it's full, older than the
+// batch window or over updateBatchMemCap, and before any other message for its thread, so it
+// keeps its place among the events of its keys.
+
+type batchedMutation struct {
+	key      []byte
+	value    []byte
+	metadata string
+	vb       uint16
+	seqNo    uint64
+}
+
+type updateBatch struct {
+	partition int16 // of the first mutation, routes the batch to its thread
+	mutations []*batchedMutation
+	size      int
+	started   time.Time
+}
+
+type updateBatcher struct {
+	sync.Mutex
+	size    int
+	window  time.Duration
+	batches map[int]*updateBatch // per cpp worker thread
+}
+
+func newUpdateBatcher(size int, window time.Duration) *updateBatcher {
+	return &updateBatcher{
+		size:    size,
+		window:  window,
+		batches: make(map[int]*updateBatch),
+	}
+}
+
+func (c *Consumer) batchMutation(e *memcached.DcpEvent, metadata string, partition int16) {
+	thread := c.cppWorkerThread(partition)
+
+	c.updateBatcher.Lock()
+	batch, ok := c.updateBatcher.batches[thread]
+	if !ok {
+		batch = &updateBatch{partition: partition, started: time.Now()}
+		c.updateBatcher.batches[thread] = batch
+	}
+
+	batch.mutations = append(batch.mutations, &batchedMutation{
+		key:      e.Key,
+		value:    e.Value,
+		metadata: metadata,
+		vb:       e.VBucket,
+		seqNo:    e.Seqno,
+	})
+	batch.size += len(e.Key) + len(e.Value) + len(metadata)
+
+	full := len(batch.mutations) >= c.updateBatcher.size || batch.size >= updateBatchMemCap
+	if full {
+		delete(c.updateBatcher.batches, thread)
+	}
+	c.updateBatcher.Unlock()
+
+	if full {
+		c.sendUpdateBatch(batch)
+	}
+}
+
+// flushUpdateBatch sends the batch of the thread a partition belongs to
+func (c *Consumer) flushUpdateBatch(partition int16) {
+	thread := c.cppWorkerThread(partition)
+
+	c.updateBatcher.Lock()
+	batch, ok := c.updateBatcher.batches[thread]
+	delete(c.updateBatcher.batches, thread)
+	c.updateBatcher.Unlock()
+
+	if ok {
+		c.sendUpdateBatch(batch)
+	}
+}
+
+// flushUpdateBatches sends every batch, or only those older than the batch window
+func (c *Consumer) flushUpdateBatches(all bool) {
+	now := time.Now()
+
+	c.updateBatcher.Lock()
+	var batches []*updateBatch
+	for thread, batch := range c.updateBatcher.batches {
+		if all || now.Sub(batch.started) >= c.updateBatcher.window {
+			batches = append(batches, batch)
+			delete(c.updateBatcher.batches, thread)
+		}
+	}
+	c.updateBatcher.Unlock()
+
+	for _, batch := range batches {
+		c.sendUpdateBatch(batch)
+	}
+}
+
+func (c *Consumer) sendUpdateBatch(batch *updateBatch) {
+	logPrefix := "Consumer::sendUpdateBatch"
+
+	batchHeader, hBuilder := c.makeDcpMutationBatchHeader(batch.partition)
+	batchPayload, pBuilder := c.makeDcpBatchPayload(batch.mutations)
+
+	msg := &msgToTransmit{
+		msg: &message{
+			Header:  batchHeader,
+			Payload: batchPayload,
+		},
+		sendToDebugger: false,
+		prioritize:     false,
+		headerBuilder:  hBuilder,
+		payloadBuilder: pBuilder,
+	}
+
+	for _, mutation := range batch.mutations {
+		c.vbProcessingStats.updateVbStat(mutation.vb, "last_sent_seq_no", mutation.seqNo)
+	}
+	c.sentEventsSize += int64(len(batchHeader) + len(batchPayload))
+	c.numSentEvents += int64(len(batch.mutations))
+	c.updateBatchCounter++
+
+	logging.Tracef("%s [%s:%s:%d] partition: %d sending batch of %d mutations",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), batch.partition, len(batch.mutations))
+	c.sendMessage(msg)
+}
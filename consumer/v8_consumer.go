@@ -37,6 +37,7 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		aggDCPFeedMemCap:                hConfig.AggDCPFeedMemCap,
 		breakpadOn:                      pConfig.BreakpadOn,
 		bucket:                          hConfig.SourceBucket,
+		keyspace:                        hConfig.SourceKeyspace,
 		cbBucket:                        b,
 		cbBucketRWMutex:                 &sync.RWMutex{},
 		checkpointInterval:              time.Duration(hConfig.CheckpointInterval) * time.Millisecond,
@@ -47,10 +48,15 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		controlRoutineWg:                &sync.WaitGroup{},
 		cppThrPartitionMap:              make(map[int][]uint16),
 		cppWorkerThrCount:               hConfig.CPPWorkerThrCount,
+		compressionPassthrough:          hConfig.CompressionPassthrough,
 		crcTable:                        crc32.MakeTable(crc32.Castagnoli),
 		dcpConfig:                       dcpConfig,
 		dcpFeedVbMap:                    make(map[*couchbase.DcpFeed][]uint16),
 		dcpStreamBoundary:               hConfig.StreamBoundary,
+		dcpStreamSeqNos:                 hConfig.StreamSeqNos,
+		deadLetterBucket:                hConfig.DeadLetterBucket,
+		deadLetterCh:                    make(chan *common.DeadLetterEntry, deadLetterChanSize),
+		deadLetterReplayCh:              make(chan *cb.DcpEvent),
 		diagDir:                         pConfig.DiagDir,
 		debuggerPort:                    pConfig.DebuggerPort,
 		eventingAdminPort:               pConfig.EventingPort,
@@ -70,18 +76,31 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		gracefulShutdownChan:            make(chan struct{}, 1),
 		handlerFooters:                  hConfig.HandlerFooters,
 		handlerHeaders:                  hConfig.HandlerHeaders,
+		idempotencyJournal:              hConfig.IdempotencyJournal,
 		index:                           index,
 		ipcType:                         pConfig.IPCType,
 		inflightDcpStreams:              make(map[uint16]struct{}),
 		inflightDcpStreamsRWMutex:       &sync.RWMutex{},
 		hostDcpFeedRWMutex:              &sync.RWMutex{},
 		insight:                         make(chan *common.Insight),
+		journal:                         make(map[uint16]map[uint64]struct{}),
+		journalInflight:                 make(map[uint16]map[int][]uint64),
+		journalMutex:                    &sync.Mutex{},
+		journalPending:                  make(map[uint16][]uint64),
+		journalTracked:                  make(map[uint16]map[uint64]struct{}),
+		journalWriteMutex:               &sync.Mutex{},
 		kvHostDcpFeedMap:                make(map[string]*couchbase.DcpFeed),
 		kvNodesRWMutex:                  &sync.RWMutex{},
 		lcbInstCapacity:                 hConfig.LcbInstCapacity,
 		n1qlConsistency:                 hConfig.N1qlConsistency,
 		logLevel:                        hConfig.LogLevel,
+		shadowCopy:                      hConfig.ShadowCopy,
+		shadowCopies:                    make(map[string]*shadowCopy),
+		shadowCopyRWMutex:               &sync.RWMutex{},
+		shadowCopyFlushMutex:            &sync.Mutex{},
+		shadowCopyFlushCh:               make(chan struct{}, 1),
 		msgProcessedRWMutex:             &sync.RWMutex{},
+		notificationCh:                  make(chan *publishedNotification, notificationChanSize),
 		nsServerPort:                    nsServerPort,
 		numVbuckets:                     numVbuckets,
 		opsTimestamp:                    time.Now(),
@@ -147,6 +166,25 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		},
 	}
 
+	eventFilter, err := newEventFilter(hConfig.EventFilter)
+	if err != nil {
+		logging.Errorf("Consumer::NewConsumer [%s] Ignoring event_filter, err: %v", consumer.workerName, err)
+	}
+	consumer.eventFilter = eventFilter
+
+	if hConfig.CoalesceWindow > 0 {
+		consumer.coalescer = newMutationCoalescer(time.Duration(hConfig.CoalesceWindow) * time.Millisecond)
+	}
+
+	if hConfig.UpdateBatchSize > 1 {
+		consumer.updateBatcher = newUpdateBatcher(hConfig.UpdateBatchSize,
+			time.Duration(hConfig.UpdateBatchWindow)*time.Millisecond)
+	}
+
+	if hConfig.Ordering == orderingStrictPerKey {
+		consumer.ordering = newKeyOrdering()
+	}
+
 	return consumer
 }
 
@@ -196,6 +234,26 @@ func (c *Consumer) Serve() {
 		return
 	}
 
+	if c.deadLetterBucket != "" {
+		err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, gocbConnectDeadLetterBucketCallback, c)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+
+		go c.processDeadLetters()
+	}
+
+	if c.idempotencyJournal {
+		go c.processJournal()
+	}
+
+	go c.processNotifications()
+
+	if c.shadowCopy {
+		go c.processShadowCopies()
+	}
+
 	var flogs couchbase.FailoverLog
 	err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getFailoverLogOpCallback, c, &flogs)
 	if err == common.ErrRetryTimeout {
@@ -373,6 +431,10 @@ func (c *Consumer) Stop(context string) {
 		c.gocbMetaBucket.Close()
 	}
 
+	if c.gocbDeadLetterBucket != nil {
+		c.gocbDeadLetterBucket.Close()
+	}
+
 	logging.Infof("%s [%s:%s:%d] Issued close for go-couchbase and gocb handles",
 		logPrefix, c.workerName, c.tcpPort, c.Pid())
 
@@ -566,6 +566,34 @@ func (b *Bucket) GetsRaw(k string) (data []byte, flags int,
 	return
 }
 
+// GetsRawCollection gets a raw value of a key in a collection, including its CAS
+// counter. Keys of the default collection are read like GetsRaw.
+func (b *Bucket) GetsRawCollection(k string, collectionID uint32) (data []byte, flags int,
+	cas uint64, err error) {
+
+	if collectionID == 0 {
+		return b.GetsRaw(k)
+	}
+
+	if ClientOpCallback != nil {
+		defer func(t time.Time) { ClientOpCallback("GetsRawCollection", k, t, err) }(time.Now())
+	}
+
+	err = b.Do(k, func(mc *memcached.Client, vb uint16) error {
+		res, err := mc.GetCollection(vb, collectionID, k)
+		if err != nil {
+			return err
+		}
+		cas = res.Cas
+		if len(res.Extras) >= 4 {
+			flags = int(binary.BigEndian.Uint32(res.Extras))
+		}
+		data = res.Body
+		return nil
+	})
+	return
+}
+
 // Gets gets a value from this bucket, including its CAS counter.  The
 // value is expected to be a JSON stream and will be deserialized into
 // rv.
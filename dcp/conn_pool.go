@@ -163,7 +163,8 @@ func (cp *connectionPool) Return(c *memcached.Client) {
 		c.Close()
 	}
 
-	if c.IsHealthy() {
+	// Collection aware connections don't take the default collection keys of other callers
+	if c.IsHealthy() && !c.CollectionsEnabled() {
 		defer func() {
 			if recover() != nil {
 				// This happens when the pool has already been
@@ -223,10 +224,15 @@ func (cp *connectionPool) StartDcpFeed(
 	// Dont' count it against the connection pool capacity
 	<-cp.createsem
 
+	bufsize := DEFAULT_WINDOW_SIZE
+	if val, ok := config["connectionBufferSize"]; ok && val != nil {
+		bufsize = val.(uint32)
+	}
+
 	dcpf, err := memcached.NewDcpFeed(mc, name.Raw(), outch, opaque, config)
 	if err == nil {
 		err = dcpf.DcpOpen(
-			name.Raw(), sequence, flags, DEFAULT_WINDOW_SIZE, opaque,
+			name.Raw(), sequence, flags, bufsize, opaque,
 		)
 		if err == nil {
 			return dcpf, err
@@ -62,6 +62,7 @@ type Node struct {
 	ClusterCompatibility int                `json:"clusterCompatibility"`
 	ClusterMembership    string             `json:"clusterMembership"`
 	CouchAPIBase         string             `json:"couchApiBase"`
+	CPUCount             int                `json:"cpuCount"`
 	Hostname             string             `json:"hostname"`
 	InterestingStats     map[string]float64 `json:"interestingStats,omitempty"`
 	MCDMemoryAllocated   float64            `json:"mcdMemoryAllocated"`
@@ -33,6 +33,9 @@ var ErrorConnection = errors.New("dcp.connection")
 // ErrorInvalidFeed
 var ErrorInvalidFeed = errors.New("dcp.invalidFeed")
 
+// ErrorCollectionsNotSupported
+var ErrorCollectionsNotSupported = errors.New("dcp.collectionsNotSupported")
+
 // DcpFeed represents an DCP feed. A feed contains a connection to a single
 // host and multiple vBuckets
 type DcpFeed struct {
@@ -51,6 +54,16 @@ type DcpFeed struct {
 	stats              DcpStats  // Stats for dcp client
 	dcplatency         *Average
 	enableReadDeadline int32 // 0 => Read deadline is disabled in doReceive, 1 => enabled
+	// flow control
+	unackedSince     time.Time // when bytes started to pile up since the last BufferAck
+	workerStallSince time.Time // when handing an event over blocked on a full outch
+	socketStallTime  int64     // nanoseconds doReceive was blocked on a full rcvch, accessed atomically
+	// collections
+	collectionsAware bool   // streams are filtered to collectionID
+	collectionID     uint32 // from "collectionID" in config
+	// compression
+	compression bool // snappy asked for, by "compression" in config
+	compressed  bool // snappy negotiated, values may be compressed
 }
 
 // NewDcpFeed creates a new DCP Feed.
@@ -70,6 +83,13 @@ func NewDcpFeed(
 		logPrefix:  fmt.Sprintf("DCPT[%s]", name),
 		dcplatency: &Average{},
 	}
+	if val, ok := config["collectionID"]; ok && val != nil {
+		feed.collectionsAware = true
+		feed.collectionID = val.(uint32)
+	}
+	if val, ok := config["compression"]; ok && val != nil {
+		feed.compression = val.(bool)
+	}
 
 	mc.Hijack()
 	feed.conn = mc
@@ -144,6 +164,17 @@ func (feed *DcpFeed) CloseStream(vbno, opaqueMSB uint16) error {
 	return opError(err, resp, 0)
 }
 
+// GetStats returns a snapshot of the stats of this DcpFeed.
+func (feed *DcpFeed) GetStats() (*DcpStats, error) {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{dfCmdGetStats, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	if err = opError(err, resp, 1); err != nil {
+		return nil, err
+	}
+	return resp[0].(*DcpStats), nil
+}
+
 // Close this DcpFeed.
 func (feed *DcpFeed) Close() error {
 	respch := make(chan []interface{}, 1)
@@ -159,6 +190,7 @@ const (
 	dfCmdRequestStream
 	dfCmdCloseStream
 	dfCmdClose
+	dfCmdGetStats
 )
 
 func (feed *DcpFeed) genServer(
@@ -265,6 +297,10 @@ func (feed *DcpFeed) handleControlRequest(
 		err := feed.doDcpCloseStream(vbno, opaqueMSB)
 		respch <- []interface{}{err}
 
+	case dfCmdGetStats:
+		respch := msg[1].(chan []interface{})
+		respch <- []interface{}{feed.snapshotStats(), nil}
+
 	case dfCmdClose:
 		feed.sendStreamEnd(feed.outch)
 		respch := msg[1].(chan []interface{})
@@ -360,6 +396,15 @@ func (feed *DcpFeed) handlePacket(
 	case transport.DCP_FLUSH:
 		event = newDcpEvent(pkt, stream) // special processing ?
 
+	case transport.DCP_SYSTEM_EVENT, transport.DCP_SEQNO_ADVANCED:
+		// Take up a seqno of the stream, without an item
+		event = newDcpEvent(pkt, stream)
+		event.Seqno = binary.BigEndian.Uint64(pkt.Extras[0:8])
+		stream.Seqno = event.Seqno
+		sendAck = true
+		fmsg := "%v ##%x %v for vb %d seqno %d\n"
+		logging.Debugf(fmsg, prefix, stream.AppOpaque, pkt.Opcode, vb, event.Seqno)
+
 	case transport.DCP_CLOSESTREAM:
 		// since send_stream_end_on_client_close_stream is set in the
 		// control message. we will ignore the close_stream and wait for
@@ -395,6 +440,9 @@ func (feed *DcpFeed) handlePacket(
 
 	rc := "ok"
 	if event != nil {
+		if len(feed.outch) == cap(feed.outch) {
+			feed.workerStallSince = time.Now()
+		}
 	loop:
 		for {
 			select {
@@ -407,6 +455,10 @@ func (feed *DcpFeed) handlePacket(
 				break loop
 			}
 		}
+		if !feed.workerStallSince.IsZero() {
+			feed.stats.WorkerStallTime += int64(time.Since(feed.workerStallSince))
+			feed.workerStallSince = time.Time{}
+		}
 	}
 	feed.sendBufferAck(sendAck, uint32(bytes))
 	return rc
@@ -580,6 +632,14 @@ func (feed *DcpFeed) doDcpOpen(
 	feed.conn.SetMcdConnectionDeadline()
 	defer feed.conn.ResetMcdConnectionDeadline()
 
+	// Keys are prefixed by their collection id once collections are negotiated,
+	// which must happen before the connection is opened for DCP
+	if feed.collectionsAware || feed.compression {
+		if err := feed.doHello(name, opaque, rcvch); err != nil {
+			return err
+		}
+	}
+
 	if err := feed.conn.Transmit(rq); err != nil {
 		return err
 	}
@@ -618,6 +678,7 @@ func (feed *DcpFeed) doDcpOpen(
 			return err
 		}
 		feed.maxAckBytes = uint32(bufferAckThreshold * float32(bufsize))
+		feed.stats.ConnectionBufferSize = bufsize
 	}
 
 	// send a DCP control message to enable_noop
@@ -646,6 +707,81 @@ func (feed *DcpFeed) doDcpOpen(
 			return err
 		}
 	}
+
+	// Values are only sent compressed as they're stored, unless compression is forced
+	if feed.compressed {
+		if err := feed.doControlRequest(opaque, "force_value_compression", []byte("true"), rcvch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (feed *DcpFeed) doHello(name string, opaque uint16, rcvch chan []interface{}) error {
+	prefix := feed.logPrefix
+
+	features := []transport.Feature{transport.FEATURE_XATTR, transport.FEATURE_JSON}
+	if feed.collectionsAware {
+		features = append(features, transport.FEATURE_COLLECTIONS)
+	}
+	if feed.compression {
+		features = append(features, transport.FEATURE_SNAPPY)
+	}
+	rq := &transport.MCRequest{
+		Opcode: transport.HELLO,
+		Key:    []byte(name),
+		Opaque: opaqueOpen,
+		Body:   make([]byte, 2*len(features)),
+	}
+	for i, feature := range features {
+		binary.BigEndian.PutUint16(rq.Body[2*i:], uint16(feature))
+	}
+
+	if err := feed.conn.Transmit(rq); err != nil {
+		fmsg := "%v ##%x doHello.Transmit(): %v"
+		logging.Errorf(fmsg, prefix, opaque, err)
+		return err
+	}
+	msg, ok := <-rcvch
+	if !ok {
+		logging.Errorf("%v ##%x doHello.rcvch closed", prefix, opaque)
+		return ErrorConnection
+	}
+	pkt := msg[0].(*transport.MCRequest)
+	opcode, status := pkt.Opcode, transport.Status(pkt.VBucket)
+	if opcode != transport.HELLO {
+		logging.Errorf("%v ##%x unexpected #%v", prefix, opaque, opcode)
+		return ErrorConnection
+	} else if status != transport.SUCCESS {
+		fmsg := "%v ##%x doHello response status %v"
+		logging.Errorf(fmsg, prefix, opaque, status)
+		return ErrorConnection
+	}
+
+	collections := false
+	for i := 0; i+2 <= len(pkt.Body); i += 2 {
+		switch transport.Feature(binary.BigEndian.Uint16(pkt.Body[i:])) {
+		case transport.FEATURE_COLLECTIONS:
+			collections = true
+		case transport.FEATURE_SNAPPY:
+			feed.compressed = true
+		}
+	}
+
+	if feed.collectionsAware {
+		if !collections {
+			logging.Errorf("%v ##%x collections not supported by producer", prefix, opaque)
+			return ErrorCollectionsNotSupported
+		}
+		fmsg := "%v ##%x collections enabled, streaming collection %x"
+		logging.Infof(fmsg, prefix, opaque, feed.collectionID)
+	}
+
+	// Values are streamed uncompressed when the producer doesn't do snappy
+	if feed.compression {
+		fmsg := "%v ##%x snappy compression negotiated: %v"
+		logging.Infof(fmsg, prefix, opaque, feed.compressed)
+	}
 	return nil
 }
 
@@ -702,6 +838,9 @@ func (feed *DcpFeed) doDcpRequestStream(
 	binary.BigEndian.PutUint64(rq.Extras[24:32], vuuid)
 	binary.BigEndian.PutUint64(rq.Extras[32:40], snapStart)
 	binary.BigEndian.PutUint64(rq.Extras[40:48], snapEnd)
+	if feed.collectionsAware {
+		rq.Body = []byte(fmt.Sprintf(`{"collections":["%x"]}`, feed.collectionID))
+	}
 
 	prefix := feed.logPrefix
 
@@ -719,6 +858,8 @@ func (feed *DcpFeed) doDcpRequestStream(
 		Vbuuid:    vuuid,
 		StartSeq:  startSequence,
 		EndSeq:    endSequence,
+
+		collectionsAware: feed.collectionsAware,
 	}
 	feed.vbstreams[vbno] = stream
 	return nil
@@ -808,6 +949,9 @@ func (feed *DcpFeed) handleStreamRequest(
 func (feed *DcpFeed) sendBufferAck(sendAck bool, bytes uint32) {
 	prefix := feed.logPrefix
 	if sendAck {
+		if feed.unackedSince.IsZero() {
+			feed.unackedSince = time.Now()
+		}
 		totalBytes := feed.toAckBytes + bytes
 		if totalBytes > feed.maxAckBytes || time.Since(feed.lastAckTime).Seconds() > bufferAckPeriod {
 			bufferAck := &transport.MCRequest{
@@ -828,6 +972,11 @@ func (feed *DcpFeed) sendBufferAck(sendAck bool, bytes uint32) {
 					feed.toAckBytes = 0
 					feed.lastAckTime = time.Now()
 					feed.stats.LastAckTime = feed.lastAckTime.UnixNano()
+					feed.stats.LastAckLatency = int64(feed.lastAckTime.Sub(feed.unackedSince))
+					if feed.stats.LastAckLatency > feed.stats.MaxAckLatency {
+						feed.stats.MaxAckLatency = feed.stats.LastAckLatency
+					}
+					feed.unackedSince = time.Time{}
 					logging.Tracef("%v buffer-ack %v, lastAckTime: %v\n", prefix, totalBytes, feed.lastAckTime.UnixNano())
 				}
 			}()
@@ -862,6 +1011,8 @@ type DcpStream struct {
 	Snapend     uint64
 	LastSeen    int64 // UnixNano value of last seen
 	connected   bool
+
+	collectionsAware bool // keys are prefixed by their collection id
 }
 
 // DcpEvent memcached events for DCP streams.
@@ -875,6 +1026,8 @@ type DcpEvent struct {
 	Key, Value []byte                // Item key/value
 	OldValue   []byte                // TODO: TBD: old document value
 	Cas        uint64                // CAS value of the item
+	// collection of the item, on collection aware streams
+	CollectionID uint32
 	// meta fields
 	Seqno uint64 // seqno. of the mutation, doubles as rollback-seqno
 	// https://issues.couchbase.com/browse/MB-15333,
@@ -903,8 +1056,17 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) *DcpEvent {
 		VBuuid:   stream.Vbuuid,
 		Ctime:    time.Now().UnixNano(),
 	}
-	event.Key = make([]byte, len(rq.Key))
-	copy(event.Key, rq.Key)
+	key := rq.Key
+	if stream.collectionsAware {
+		switch event.Opcode {
+		case transport.DCP_MUTATION, transport.DCP_DELETION, transport.DCP_EXPIRATION:
+			var n int
+			event.CollectionID, n = decodeLeb128(key)
+			key = key[n:]
+		}
+	}
+	event.Key = make([]byte, len(key))
+	copy(event.Key, key)
 	event.Value = make([]byte, len(rq.Body))
 	copy(event.Value, rq.Body)
 
@@ -940,6 +1102,18 @@ func newDcpEvent(rq *transport.MCRequest, stream *DcpStream) *DcpEvent {
 	return event
 }
 
+// decodeLeb128 returns the unsigned LEB128 value prefixing buf, and the number of bytes it takes
+func decodeLeb128(buf []byte) (uint32, int) {
+	var value uint32
+	for i, b := range buf {
+		value |= uint32(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return value, len(buf)
+}
+
 func (event *DcpEvent) String() string {
 	name := transport.CommandNames[event.Opcode]
 	if name == "" {
@@ -950,24 +1124,44 @@ func (event *DcpEvent) String() string {
 
 // DcpStats on mutations/snapshots/buff-acks.
 type DcpStats struct {
-	TotalBufferAckSent uint64
-	TotalBytes         uint64
-	TotalCloseStream   uint64
-	TotalMutation      uint64
-	TotalSnapShot      uint64
-	TotalStreamReq     uint64
-	TotalStreamEnd     uint64
-	LastAckTime        int64
+	TotalBufferAckSent uint64 `json:"total_buffer_ack_sent"`
+	TotalBytes         uint64 `json:"total_bytes"`
+	TotalCloseStream   uint64 `json:"total_close_stream"`
+	TotalMutation      uint64 `json:"total_mutation"`
+	TotalSnapShot      uint64 `json:"total_snapshot"`
+	TotalStreamReq     uint64 `json:"total_stream_req"`
+	TotalStreamEnd     uint64 `json:"total_stream_end"`
+	LastAckTime        int64  `json:"last_ack_time"`
+	// flow control, durations are in nanoseconds
+	ConnectionBufferSize uint32 `json:"connection_buffer_size"`
+	BytesUnacked         uint32 `json:"bytes_unacked"`           // read but not acknowledged to the producer yet
+	LastAckLatency       int64  `json:"last_ack_latency"`        // from the first unacked byte to the BufferAck
+	MaxAckLatency        int64  `json:"max_ack_latency"`         // highest LastAckLatency so far
+	SocketStallTime      int64  `json:"socket_stall_time"`       // reading from the socket blocked on a full data_chan_size
+	WorkerStallTime      int64  `json:"worker_queue_stall_time"` // handing events to the consumer blocked on its full queue
+}
+
+// snapshotStats copies the stats, including the stalls still in progress.
+func (feed *DcpFeed) snapshotStats() *DcpStats {
+	stats := feed.stats
+	stats.BytesUnacked = feed.toAckBytes
+	stats.SocketStallTime = atomic.LoadInt64(&feed.socketStallTime)
+	if !feed.workerStallSince.IsZero() {
+		stats.WorkerStallTime += int64(time.Since(feed.workerStallSince))
+	}
+	return &stats
 }
 
 func (stats *DcpStats) String(feed *DcpFeed) string {
 	return fmt.Sprintf(
 		"bytes: %v buffacks: %v toAckBytes: %v streamreqs: %v "+
 			"snapshots: %v mutations: %v streamends: %v closestreams: %v"+
-			"lastAckTime: %v",
+			"lastAckTime: %v lastAckLatency: %v socketStall: %v workerStall: %v",
 		stats.TotalBytes, stats.TotalBufferAckSent, feed.toAckBytes,
 		stats.TotalStreamReq, stats.TotalSnapShot, stats.TotalMutation,
 		stats.TotalStreamEnd, stats.TotalCloseStream, stats.LastAckTime,
+		time.Duration(stats.LastAckLatency), time.Duration(atomic.LoadInt64(&feed.socketStallTime)),
+		time.Duration(stats.WorkerStallTime),
 	)
 }
 
@@ -1168,6 +1362,7 @@ loop:
 		if blocked {
 			blockedTs := time.Since(start)
 			duration += blockedTs
+			atomic.AddInt64(&feed.socketStallTime, int64(blockedTs))
 			blocked = false
 			select {
 			case <-tick.C:
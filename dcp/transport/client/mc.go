@@ -19,8 +19,9 @@ const bufsize = 1024
 
 // The Client itself.
 type Client struct {
-	conn    io.ReadWriteCloser
-	healthy bool
+	conn        io.ReadWriteCloser
+	healthy     bool
+	collections bool // keys are prefixed with their collection id
 
 	hdrBuf []byte
 }
@@ -208,6 +209,62 @@ func (c *Client) Get(vb uint16, key string) (*transport.MCResponse, error) {
 	})
 }
 
+// GetCollection gets the value for a key of a collection. The connection negotiates
+// collections on first use, after which every key it sends must carry its collection id.
+func (c *Client) GetCollection(vb uint16, collectionID uint32, key string) (*transport.MCResponse, error) {
+	if err := c.enableCollections(); err != nil {
+		return nil, err
+	}
+	return c.Send(&transport.MCRequest{
+		Opcode:  transport.GET,
+		VBucket: vb,
+		Key:     append(encodeLeb128(collectionID), key...),
+	})
+}
+
+// CollectionsEnabled tells if the connection takes collection aware keys.
+func (c *Client) CollectionsEnabled() bool {
+	return c.collections
+}
+
+func (c *Client) enableCollections() error {
+	if c.collections {
+		return nil
+	}
+
+	rq := &transport.MCRequest{
+		Opcode: transport.HELLO,
+		Key:    []byte("eventing"),
+		Body:   make([]byte, 2),
+	}
+	binary.BigEndian.PutUint16(rq.Body, uint16(transport.FEATURE_COLLECTIONS))
+	res, err := c.Send(rq)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+2 <= len(res.Body); i += 2 {
+		if transport.Feature(binary.BigEndian.Uint16(res.Body[i:])) == transport.FEATURE_COLLECTIONS {
+			c.collections = true
+			return nil
+		}
+	}
+	return ErrorCollectionsNotSupported
+}
+
+// encodeLeb128 returns the unsigned LEB128 encoding of a collection id
+func encodeLeb128(value uint32) []byte {
+	buf := make([]byte, 0, 5)
+	for {
+		b := byte(value & 0x7f)
+		value >>= 7
+		if value == 0 {
+			return append(buf, b)
+		}
+		buf = append(buf, b|0x80)
+	}
+}
+
 // Del deletes a key.
 func (c *Client) Del(vb uint16, key string) (*transport.MCResponse, error) {
 	return c.Send(&transport.MCRequest{
@@ -55,6 +55,8 @@ const (
 	RDECR      = CommandCode(0x3b)
 	RDECRQ     = CommandCode(0x3c)
 
+	HELLO = CommandCode(0x1f) // Negotiate the features of a connection
+
 	SASL_LIST_MECHS = CommandCode(0x20)
 	SASL_AUTH       = CommandCode(0x21)
 	SASL_STEP       = CommandCode(0x22)
@@ -84,6 +86,9 @@ const (
 	DCP_BUFFERACK   = CommandCode(0x5d) // DCP Buffer Acknowledgement
 	DCP_CONTROL     = CommandCode(0x5e) // Set flow control params
 
+	DCP_SYSTEM_EVENT   = CommandCode(0x5f) // Change of the collections of a vbucket, e.g. a collection created
+	DCP_SEQNO_ADVANCED = CommandCode(0x64) // Seqno of a filtered stream moved past items it doesn't carry
+
 	SELECT_BUCKET = CommandCode(0x89) // Select bucket
 
 	OBSERVE = CommandCode(0x92)
@@ -106,6 +111,18 @@ const (
 	UNKNOWN_COMMAND = Status(0x81)
 	ENOMEM          = Status(0x82)
 	TMPFAIL         = Status(0x86)
+
+	UNKNOWN_COLLECTION = Status(0x88)
+)
+
+// Feature negotiated by HELLO
+type Feature uint16
+
+const (
+	FEATURE_XATTR       = Feature(0x06)
+	FEATURE_SNAPPY      = Feature(0x0a)
+	FEATURE_JSON        = Feature(0x0b)
+	FEATURE_COLLECTIONS = Feature(0x12)
 )
 
 // MCItem is an internal representation of an item.
@@ -167,6 +184,8 @@ func init() {
 	CommandNames[RDECR] = "RDECR"
 	CommandNames[RDECRQ] = "RDECRQ"
 
+	CommandNames[HELLO] = "HELLO"
+
 	CommandNames[SASL_LIST_MECHS] = "SASL_LIST_MECHS"
 	CommandNames[SASL_AUTH] = "SASL_AUTH"
 	CommandNames[SASL_STEP] = "SASL_STEP"
@@ -195,6 +214,8 @@ func init() {
 	CommandNames[DCP_BUFFERACK] = "DCP_BUFFERACK"
 	CommandNames[DCP_CONTROL] = "DCP_CONTROL"
 	CommandNames[DCP_GET_SEQNO] = "DCP_GET_SEQNO"
+	CommandNames[DCP_SYSTEM_EVENT] = "DCP_SYSTEM_EVENT"
+	CommandNames[DCP_SEQNO_ADVANCED] = "DCP_SEQNO_ADVANCED"
 
 	StatusNames = make(map[Status]string)
 	StatusNames[SUCCESS] = "SUCCESS"
@@ -210,6 +231,7 @@ func init() {
 	StatusNames[ROLLBACK] = "ROLLBACK"
 	StatusNames[ENOMEM] = "ENOMEM"
 	StatusNames[TMPFAIL] = "TMPFAIL"
+	StatusNames[UNKNOWN_COLLECTION] = "UNKNOWN_COLLECTION"
 
 }
 
@@ -180,6 +180,7 @@ func (b *Bucket) StartDcpFeed(
 //      "genChanSize", buffer channel size for control path.
 //      "dataChanSize", buffer channel size for data path.
 //      "numConnections", number of connections with DCP for local vbuckets.
+//      "connectionBufferSize", flow control buffer size of each connection, in bytes.
 func (b *Bucket) StartDcpFeedOver(
 	name DcpFeedName,
 	sequence, flags uint32,
@@ -221,6 +222,7 @@ const (
 	ufCmdCloseStream
 	ufCmdGetSeqnos
 	ufCmdClose
+	ufCmdGetStats
 )
 
 // DcpRequestStream starts a stream for a vb on a feed
@@ -271,6 +273,18 @@ func (feed *DcpFeed) DcpGetSeqnos() (map[uint16]uint64, error) {
 	return resp[0].(map[uint16]uint64), nil
 }
 
+// GetStats returns the stats of the DCP feeds of the individual nodes,
+// by feed name and host. Synchronous call.
+func (feed *DcpFeed) GetStats() (map[string]*memcached.DcpStats, error) {
+	respch := make(chan []interface{}, 1)
+	cmd := []interface{}{ufCmdGetStats, respch}
+	resp, err := failsafeOp(feed.reqch, respch, cmd, feed.finch)
+	if err = opError(err, resp, 1); err != nil {
+		return nil, err
+	}
+	return resp[0].(map[string]*memcached.DcpStats), nil
+}
+
 // Close DcpFeed. Synchronous call.
 func (feed *DcpFeed) Close() error {
 	respch := make(chan []interface{}, 1)
@@ -329,6 +343,10 @@ loop:
 				seqnos, err := feed.dcpGetSeqnos()
 				respch <- []interface{}{seqnos, err}
 
+			case ufCmdGetStats:
+				respch := msg[1].(chan []interface{})
+				respch <- []interface{}{feed.dcpGetStats(), nil}
+
 			case ufCmdClose:
 				closeNodeFeeds()
 				respch := msg[1].(chan []interface{})
@@ -552,6 +570,26 @@ func (feed *DcpFeed) dcpGetSeqnos() (map[uint16]uint64, error) {
 	return seqnos, nil
 }
 
+func (feed *DcpFeed) dcpGetStats() map[string]*memcached.DcpStats {
+	prefix := feed.logPrefix
+	stats := make(map[string]*memcached.DcpStats)
+	for host, nodeFeeds := range feed.nodeFeeds {
+		for _, singleFeed := range nodeFeeds {
+			if singleFeed == nil {
+				continue
+			}
+			feedStats, err := singleFeed.dcpFeed.GetStats()
+			if err != nil {
+				fmsg := "%v failed to get stats of %v on %v, err: %v"
+				logging.Errorf(fmsg, prefix, singleFeed.dcpFeed.Name(), host, err)
+				continue
+			}
+			stats[fmt.Sprintf("%v@%v", singleFeed.dcpFeed.Name(), host)] = feedStats
+		}
+	}
+	return stats
+}
+
 func addtofeed(nodeFeeds []*FeedInfo) (*FeedInfo, bool) {
 	if len(nodeFeeds) == 0 {
 		return nil, false
@@ -12,6 +12,7 @@ var (
 	TopicNotFound    Code = errors.New("topic does not exist")
 	TopicSliceClosed Code = errors.New("topic slice is closed")
 	Timeout          Code = errors.New("operation timed out")
+	StoreFailure     Code = errors.New("notification store operation failed")
 )
 
 type Error interface {
@@ -47,6 +48,11 @@ type TopicSlice interface {
 	// Caller should never close this channel.
 	AckChannel() (chan<- Notification, Error)
 
+	// Give up the lease of a notification so that it is queued again for delivery. Once queued
+	// on this channel, the underlying object is no longer valid for further use.
+	// Caller should never close this channel.
+	RequeueChannel() (chan<- Notification, Error)
+
 	// Request that no more items should be queued into NotificationChannel. Any notifications
 	// already queued on the channel are valid and must be processed before expiry.
 	Pause() Error
@@ -108,6 +114,15 @@ type NotificationManager interface {
 
 	// Describe the definition time characteristics of a topic. This is a superset of what appears in the UI.
 	DescribeTopic(topic string) (*TopicDef, Error)
+
+	// Publish a notification to a topic. Value must be JSON serialisable. When the topic is full,
+	// Ephemeral topics drop the oldest notification while Persistent topics wait for room and
+	// return a Timeout error if none frees up.
+	Publish(topic string, value interface{}) Error
+
+	// Delete a topic definition along with the notifications queued on it. TopicSlices opened for
+	// the topic on this node are closed, those on other nodes get TopicNotFound errors on their next poll.
+	DeleteTopic(topic string) Error
 }
 
 // Singleton object set by implementation. Caller should use this directly (do not copy).
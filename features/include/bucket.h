@@ -42,10 +42,38 @@ private:
   v8::Persistent<v8::ObjectTemplate> bucket_template_;
 };
 
+// A keyspace is a collection of a bucket. Bucket names may contain dots, so the
+// scope and collection are always given apart from the bucket
+struct Keyspace {
+  static constexpr const char *kDefaultScope = "_default";
+  static constexpr const char *kDefaultCollection = "_default";
+
+  Keyspace() = default;
+  // An empty scope or collection stands for the default one
+  Keyspace(std::string bucket_name, const std::string &scope_name,
+           const std::string &collection_name);
+
+  bool IsDefaultCollection() const;
+  // The default collection is written as its bucket name, other collections
+  // as `bucket`.`scope`.`collection`
+  std::string ToString() const;
+
+  bool operator==(const Keyspace &other) const {
+    return bucket_name == other.bucket_name &&
+           scope_name == other.scope_name &&
+           collection_name == other.collection_name;
+  }
+
+  std::string bucket_name;
+  std::string scope_name{kDefaultScope};
+  std::string collection_name{kDefaultCollection};
+};
+
 class Bucket {
 public:
-  Bucket(v8::Isolate *isolate, std::string bucket_name)
-      : isolate_(isolate), bucket_name_(std::move(bucket_name)) {}
+  Bucket(v8::Isolate *isolate, Keyspace keyspace)
+      : isolate_(isolate), bucket_name_(keyspace.ToString()),
+        keyspace_(std::move(keyspace)) {}
   ~Bucket();
 
   Bucket(const Bucket &) = default;
@@ -89,8 +117,34 @@ private:
   Error FormatErrorAndDestroyConn(const std::string &message,
                                   const lcb_error_t &error) const;
 
+  // Writes made while testing a function go to its sandbox
+  std::tuple<Error, std::unique_ptr<lcb_error_t>, std::unique_ptr<Result>>
+  SandboxSet(Sandbox *sandbox, const std::string &key, const void *value,
+             int value_length, bool insert, lcb_U32 expiry, lcb_CAS cas);
+
+  std::tuple<Error, std::unique_ptr<lcb_error_t>, std::unique_ptr<Result>>
+  SandboxDelete(Sandbox *sandbox, const std::string &key, lcb_CAS cas);
+
+  std::tuple<Error, std::unique_ptr<lcb_error_t>, std::unique_ptr<Result>>
+  SandboxCounter(Sandbox *sandbox, const std::string &key, lcb_U32 expiry,
+                 const std::string &delta);
+
+  // Commands on the default collection are left as they are, so that buckets
+  // are accessed the same way on clusters without collections
+  template <typename T> void SetCollection(T *cmd) const {
+    if (keyspace_.IsDefaultCollection()) {
+      return;
+    }
+    cmd->scope = keyspace_.scope_name.c_str();
+    cmd->nscope = keyspace_.scope_name.size();
+    cmd->collection = keyspace_.collection_name.c_str();
+    cmd->ncollection = keyspace_.collection_name.size();
+  }
+
   v8::Isolate *isolate_{nullptr};
+  // Keyspace of the binding as written by Keyspace::ToString
   std::string bucket_name_;
+  Keyspace keyspace_;
   lcb_t connection_{nullptr};
   bool is_connected_{false};
 };
@@ -101,11 +155,11 @@ class BucketBinding {
 
 public:
   BucketBinding(v8::Isolate *isolate, std::shared_ptr<BucketFactory> factory,
-                const std::string &bucket_name, std::string alias,
+                const Keyspace &keyspace, std::string alias,
                 bool block_mutation, bool is_source_bucket)
       : block_mutation_(block_mutation), is_source_bucket_(is_source_bucket),
-        bucket_name_(bucket_name), bucket_alias_(std::move(alias)),
-        factory_(std::move(factory)), bucket_(isolate, bucket_name) {}
+        bucket_name_(keyspace.ToString()), bucket_alias_(std::move(alias)),
+        factory_(std::move(factory)), bucket_(isolate, keyspace) {}
 
   Error InstallBinding(v8::Isolate *isolate,
                        const v8::Local<v8::Context> &context);
@@ -0,0 +1,86 @@
+// Copyright (c) 2020 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an "AS IS"
+// BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+#ifndef CURL_THROTTLE_H
+#define CURL_THROTTLE_H
+
+#include <atomic>
+#include <chrono>
+#include <cstdint>
+#include <mutex>
+#include <string>
+#include <unordered_map>
+#include <v8.h>
+
+// A value of 0 leaves the corresponding limit unset
+struct CurlLimits {
+  uint32_t max_requests_per_sec{0};
+  uint32_t max_concurrent{0};
+  uint32_t timeout_ms{0};
+};
+
+// CurlThrottle enforces the limits of cURL bindings across all the V8 workers
+// of the process. Limits are kept per binding alias. A binding's limits hold
+// for the whole cluster, each process enforces its share of them.
+class CurlThrottle {
+public:
+  static CurlThrottle &Get();
+
+  void SetLimits(const std::string &alias, const CurlLimits &limits);
+
+  // Sets the share of the limits enforced by the process, the fraction of the
+  // vbuckets it owns
+  void SetShare(double share);
+
+  // Tags the object of a binding with its alias, so that its calls find their
+  // limits
+  static void TagBinding(v8::Isolate *isolate,
+                         const v8::Local<v8::Context> &context,
+                         const v8::Local<v8::Object> &binding,
+                         const std::string &alias);
+  static std::string GetAlias(v8::Isolate *isolate,
+                              const v8::Local<v8::Context> &context,
+                              const v8::Local<v8::Object> &binding);
+
+  // Takes a slot for a call through the binding, with the transfer timeout of
+  // the binding in timeout_ms. Returns false with the reason in err if the call
+  // has to be rejected
+  bool Acquire(const std::string &alias, std::string &err,
+               uint32_t &timeout_ms);
+  void Release(const std::string &alias);
+
+  int64_t GetThrottledCount() const { return throttled_count_.load(); }
+  int64_t GetRejectedCount() const { return rejected_count_.load(); }
+
+private:
+  using Clock = std::chrono::steady_clock;
+
+  struct Limiter {
+    CurlLimits limits;
+    double tokens{0};
+    Clock::time_point last_refill;
+    uint32_t in_flight{0};
+  };
+
+  CurlThrottle() = default;
+
+  std::mutex lock_;
+  std::unordered_map<std::string, Limiter> limiters_;
+  double share_{1};
+  std::atomic<int64_t> throttled_count_{0};
+  std::atomic<int64_t> rejected_count_{0};
+};
+
+// Installed as curl(), applies the limits of the binding before handing the
+// call over to CurlFunction
+void ThrottledCurlFunction(const v8::FunctionCallbackInfo<v8::Value> &args);
+
+#endif
@@ -30,6 +30,7 @@ class CodeInsight;
 struct CurlCodex;
 struct LanguageCompatibility;
 class BucketOps;
+class Sandbox;
 
 namespace Query {
 class Manager;
@@ -67,6 +68,8 @@ struct IsolateData {
   LanguageCompatibility *lang_compat{nullptr};
 
   BucketOps *bucket_ops{nullptr};
+  // Set only while a function is being tested
+  Sandbox *sandbox{nullptr};
   std::mutex termination_lock_;
   bool is_executing_{false};
 };
@@ -0,0 +1,94 @@
+// Copyright (c) 2020 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an "AS IS"
+// BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+#ifndef SANDBOX_H
+#define SANDBOX_H
+
+#include <cstdint>
+#include <map>
+#include <memory>
+#include <nlohmann/json.hpp>
+#include <string>
+#include <utility>
+#include <v8.h>
+
+#include "lcb_utils.h"
+
+// Sandbox holds the side effects of a handler under test. Writes to bucket
+// bindings land in an in-memory overlay instead of the bucket, and reads of
+// documents written in the overlay are served from it. cURL calls, timers and
+// notifications are recorded but never sent.
+class Sandbox {
+public:
+  Sandbox() = default;
+
+  Sandbox(const Sandbox &) = delete;
+  Sandbox(Sandbox &&) = delete;
+  Sandbox &operator=(const Sandbox &) = delete;
+  Sandbox &operator=(Sandbox &&) = delete;
+
+  // Returns nullptr if the key hasn't been written in the overlay, the caller
+  // must read it from the bucket then
+  std::unique_ptr<Result> Get(const std::string &bucket,
+                              const std::string &key) const;
+
+  std::unique_ptr<Result> Set(const std::string &bucket, const std::string &key,
+                              const void *value, int value_length,
+                              lcb_U32 expiry, lcb_CAS cas);
+
+  std::unique_ptr<Result> Delete(const std::string &bucket,
+                                 const std::string &key, lcb_CAS cas);
+
+  std::unique_ptr<Result> Counter(const std::string &bucket,
+                                  const std::string &key, int64_t current,
+                                  const std::string &delta, lcb_U32 expiry);
+
+  void AddLog(const std::string &msg);
+  void AddCurlCall(nlohmann::json call);
+  void AddTimer(nlohmann::json timer);
+  void AddNotification(const std::string &topic, const std::string &value);
+
+  // Returns the side effects recorded since the previous call
+  nlohmann::json TakeEventReport();
+
+private:
+  struct Document {
+    std::string value;
+    bool is_json{false};
+    bool deleted{false};
+    lcb_CAS cas{0};
+    lcb_U32 expiry{0};
+  };
+
+  using DocumentKey = std::pair<std::string, std::string>;
+
+  bool CasMismatch(const DocumentKey &doc_key, lcb_CAS cas) const;
+  void AddWrite(const std::string &op, const std::string &bucket,
+                const std::string &key, const Document &doc);
+
+  std::map<DocumentKey, Document> docs_;
+  lcb_CAS cas_counter_{0};
+
+  nlohmann::json logs_ = nlohmann::json::array();
+  nlohmann::json kv_writes_ = nlohmann::json::array();
+  nlohmann::json curl_calls_ = nlohmann::json::array();
+  nlohmann::json timers_ = nlohmann::json::array();
+  nlohmann::json notifications_ = nlohmann::json::array();
+};
+
+// Replaces curl() while testing, the request is recorded and an empty
+// successful response is returned
+void SandboxCurlFunction(const v8::FunctionCallbackInfo<v8::Value> &args);
+
+// Replaces N1QL() while testing, as queries could modify buckets
+void SandboxQueryFunction(const v8::FunctionCallbackInfo<v8::Value> &args);
+
+#endif
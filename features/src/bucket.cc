@@ -23,6 +23,7 @@
 #include "lang_compat.h"
 #include "lcb_utils.h"
 #include "retry_util.h"
+#include "sandbox.h"
 #include "utils.h"
 #include "v8worker.h"
 
@@ -75,6 +76,28 @@ BucketFactory::NewBucketObj() const {
                        handle_scope.Escape(bucket_obj))};
 }
 
+Keyspace::Keyspace(std::string bucket_name, const std::string &scope_name,
+                   const std::string &collection_name)
+    : bucket_name(std::move(bucket_name)) {
+  if (!scope_name.empty()) {
+    this->scope_name = scope_name;
+  }
+  if (!collection_name.empty()) {
+    this->collection_name = collection_name;
+  }
+}
+
+bool Keyspace::IsDefaultCollection() const {
+  return scope_name == kDefaultScope && collection_name == kDefaultCollection;
+}
+
+std::string Keyspace::ToString() const {
+  if (IsDefaultCollection()) {
+    return bucket_name;
+  }
+  return "`" + bucket_name + "`.`" + scope_name + "`.`" + collection_name + "`";
+}
+
 Bucket::~Bucket() {
   if (is_connected_) {
     lcb_destroy(connection_);
@@ -94,7 +117,7 @@ Error Bucket::Connect() {
 
   auto utils = UnwrapData(isolate_)->utils;
 
-  auto conn_str_info = utils->GetConnectionString(bucket_name_);
+  auto conn_str_info = utils->GetConnectionString(keyspace_.bucket_name);
   if (!conn_str_info.is_valid) {
     return std::make_unique<std::string>(conn_str_info.msg);
   }
@@ -164,6 +187,14 @@ Error Bucket::Connect() {
                                      result);
   }
 
+  if (!keyspace_.IsDefaultCollection()) {
+    result = RetryWithFixedBackoff(5, 200, IsRetriable, lcb_cntl_string,
+                                   connection_, "enable_collections", "true");
+    if (result != LCB_SUCCESS) {
+      return FormatErrorAndDestroyConn("Unable to enable collections", result);
+    }
+  }
+
   auto enable_detailed_err_codes = true;
   result = RetryWithFixedBackoff(5, 200, IsRetriable, lcb_cntl, connection_,
                                  LCB_CNTL_SET, LCB_CNTL_DETAILED_ERRCODES,
@@ -194,8 +225,16 @@ Bucket::Get(const std::string &key) {
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    if (auto result = sandbox->Get(bucket_name_, key); result != nullptr) {
+      return {nullptr, std::make_unique<lcb_error_t>(LCB_SUCCESS),
+              std::move(result)};
+    }
+  }
+
   lcb_CMDGET cmd = {0};
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   const auto max_retry = UnwrapData(isolate_)->lcb_retry_count;
   auto [err_code, result] =
       RetryLcbCommand(connection_, cmd, max_retry, LcbGet);
@@ -214,6 +253,13 @@ Bucket::GetWithMeta(const std::string &key) {
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    if (auto result = sandbox->Get(bucket_name_, key); result != nullptr) {
+      return {nullptr, std::make_unique<lcb_error_t>(LCB_SUCCESS),
+              std::move(result)};
+    }
+  }
+
   lcb_SDSPEC specs[3] = {};
 
   specs[0].sdcmd = LCB_SDCMD_GET;
@@ -233,6 +279,7 @@ Bucket::GetWithMeta(const std::string &key) {
   cmd.specs = specs;
   cmd.nspecs = 3;
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   cmd.multimode = LCB_SDMULTI_MODE_LOOKUP;
 
   const auto max_retry = UnwrapData(isolate_)->lcb_retry_count;
@@ -253,6 +300,10 @@ Bucket::CounterWithoutXattr(const std::string &key, lcb_CAS cas, lcb_U32 expiry,
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    return SandboxCounter(sandbox, key, expiry, delta);
+  }
+
   lcb_SDSPEC specs[1] = {};
   specs[0].sdcmd = LCB_SDCMD_COUNTER;
   LCB_SDSPEC_SET_PATH(&specs[0], "count", strlen("count"));
@@ -262,6 +313,7 @@ Bucket::CounterWithoutXattr(const std::string &key, lcb_CAS cas, lcb_U32 expiry,
   cmd.specs = specs;
   cmd.nspecs = 1;
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   cmd.cmdflags = LCB_CMDSUBDOC_F_UPSERT_DOC;
   cmd.exptime = expiry;
   cmd.cas = cas;
@@ -284,6 +336,10 @@ Bucket::CounterWithXattr(const std::string &key, lcb_CAS cas, lcb_U32 expiry, st
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    return SandboxCounter(sandbox, key, expiry, delta);
+  }
+
   lcb_SDSPEC function_id_spec = {0};
   auto function_instance_id = GetFunctionInstanceID(isolate_);
   std::string function_instance_id_path("_eventing.fiid");
@@ -329,6 +385,7 @@ Bucket::CounterWithXattr(const std::string &key, lcb_CAS cas, lcb_U32 expiry, st
   cmd.specs = specs.data();
   cmd.nspecs = specs.size();
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   cmd.cmdflags = LCB_CMDSUBDOC_F_UPSERT_DOC;
   cmd.exptime = expiry;
   cmd.cas = cas;
@@ -352,6 +409,11 @@ Bucket::SetWithXattr(const std::string &key, const void* value, int value_length
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    return SandboxSet(sandbox, key, value, value_length,
+                      op_type == LCB_CMDSUBDOC_F_INSERT_DOC, expiry, cas);
+  }
+
   lcb_SDSPEC function_id_spec = {0};
   auto function_instance_id = GetFunctionInstanceID(isolate_);
   std::string function_instance_id_path("_eventing.fiid");
@@ -394,6 +456,7 @@ Bucket::SetWithXattr(const std::string &key, const void* value, int value_length
                                    value_crc32_spec, doc_spec};
   lcb_CMDSUBDOC cmd = {0};
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   cmd.specs = specs.data();
   cmd.nspecs = specs.size();
   cmd.cmdflags = op_type;
@@ -419,8 +482,14 @@ Bucket::SetWithoutXattr(const std::string &key, const void* value, int value_len
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    return SandboxSet(sandbox, key, value, value_length, op_type == LCB_ADD,
+                      expiry, cas);
+  }
+
   lcb_CMDSTORE cmd = {0};
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   LCB_CMD_SET_VALUE(&cmd, value, value_length);
   cmd.operation = op_type;
   cmd.exptime = expiry;
@@ -445,6 +514,10 @@ Bucket::DeleteWithXattr(const std::string &key, lcb_CAS cas) {
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    return SandboxDelete(sandbox, key, cas);
+  }
+
   lcb_SDSPEC function_id_spec = {0};
   std::string function_instance_id = GetFunctionInstanceID(isolate_);
   std::string function_instance_id_path("_eventing.fiid");
@@ -487,6 +560,7 @@ Bucket::DeleteWithXattr(const std::string &key, lcb_CAS cas) {
                                    value_crc32_spec, doc_spec};
   lcb_CMDSUBDOC cmd = {0};
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   cmd.specs = specs.data();
   cmd.nspecs = specs.size();
   cmd.cas = cas;
@@ -509,8 +583,13 @@ Bucket::DeleteWithoutXattr(const std::string &key, lcb_CAS cas) {
             nullptr, nullptr};
   }
 
+  if (auto sandbox = UnwrapData(isolate_)->sandbox; sandbox != nullptr) {
+    return SandboxDelete(sandbox, key, cas);
+  }
+
   lcb_CMDREMOVE cmd = {0};
   LCB_CMD_SET_KEY(&cmd, key.c_str(), key.length());
+  SetCollection(&cmd);
   cmd.cas = cas;
 
   const auto max_retry = UnwrapData(isolate_)->lcb_retry_count;
@@ -524,6 +603,62 @@ Bucket::DeleteWithoutXattr(const std::string &key, lcb_CAS cas) {
           std::make_unique<Result>(std::move(result))};
 }
 
+std::tuple<Error, std::unique_ptr<lcb_error_t>, std::unique_ptr<Result>>
+Bucket::SandboxSet(Sandbox *sandbox, const std::string &key, const void *value,
+                   int value_length, bool insert, lcb_U32 expiry, lcb_CAS cas) {
+  if (insert) {
+    auto [error, err_code, existing] = Get(key);
+    if (error != nullptr || *err_code != LCB_SUCCESS) {
+      return {std::move(error), std::move(err_code), nullptr};
+    }
+    if (existing->rc == LCB_SUCCESS) {
+      existing->rc = LCB_KEY_EEXISTS;
+      return {nullptr, std::move(err_code), std::move(existing)};
+    }
+  }
+
+  return {nullptr, std::make_unique<lcb_error_t>(LCB_SUCCESS),
+          sandbox->Set(bucket_name_, key, value, value_length, expiry, cas)};
+}
+
+std::tuple<Error, std::unique_ptr<lcb_error_t>, std::unique_ptr<Result>>
+Bucket::SandboxDelete(Sandbox *sandbox, const std::string &key, lcb_CAS cas) {
+  auto [error, err_code, existing] = Get(key);
+  if (error != nullptr || *err_code != LCB_SUCCESS) {
+    return {std::move(error), std::move(err_code), nullptr};
+  }
+  if (existing->rc != LCB_SUCCESS) {
+    return {nullptr, std::move(err_code), std::move(existing)};
+  }
+
+  return {nullptr, std::make_unique<lcb_error_t>(LCB_SUCCESS),
+          sandbox->Delete(bucket_name_, key, cas)};
+}
+
+std::tuple<Error, std::unique_ptr<lcb_error_t>, std::unique_ptr<Result>>
+Bucket::SandboxCounter(Sandbox *sandbox, const std::string &key,
+                       lcb_U32 expiry, const std::string &delta) {
+  auto [error, err_code, existing] = Get(key);
+  if (error != nullptr || *err_code != LCB_SUCCESS) {
+    return {std::move(error), std::move(err_code), nullptr};
+  }
+
+  int64_t current = 0;
+  if (existing->rc == LCB_SUCCESS) {
+    auto doc = nlohmann::json::parse(existing->value, nullptr, false);
+    if (!doc.is_object() || !doc["count"].is_number_integer()) {
+      existing->rc = LCB_DELTA_BADVAL;
+      return {nullptr, std::move(err_code), std::move(existing)};
+    }
+    current = doc["count"].get<int64_t>();
+  } else if (existing->rc != LCB_KEY_ENOENT) {
+    return {nullptr, std::move(err_code), std::move(existing)};
+  }
+
+  return {nullptr, std::make_unique<lcb_error_t>(LCB_SUCCESS),
+          sandbox->Counter(bucket_name_, key, current, delta, expiry)};
+}
+
 // Performs the lcb related calls when bucket object is accessed
 template <>
 void BucketBinding::BucketGet<v8::Local<v8::Name>>(
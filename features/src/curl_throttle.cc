@@ -0,0 +1,170 @@
+// Copyright (c) 2020 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an "AS IS"
+// BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+#include <algorithm>
+
+#include "curl.h"
+#include "curl_throttle.h"
+#include "isolate_data.h"
+#include "js_exception.h"
+#include "utils.h"
+
+namespace {
+// Private key under which the object of a binding keeps its alias
+v8::Local<v8::Private> AliasKey(v8::Isolate *isolate) {
+  return v8::Private::ForApi(isolate, v8Str(isolate, "curl_binding_alias"));
+}
+} // namespace
+
+CurlThrottle &CurlThrottle::Get() {
+  static CurlThrottle throttle;
+  return throttle;
+}
+
+void CurlThrottle::SetLimits(const std::string &alias,
+                             const CurlLimits &limits) {
+  if (limits.max_requests_per_sec == 0 && limits.max_concurrent == 0 &&
+      limits.timeout_ms == 0) {
+    return;
+  }
+
+  // Every worker of the function sets the same limits, the first one keeps
+  // the limiter
+  std::lock_guard<std::mutex> guard(lock_);
+  if (limiters_.find(alias) != limiters_.end()) {
+    return;
+  }
+
+  Limiter limiter;
+  limiter.limits = limits;
+  limiter.tokens = limits.max_requests_per_sec;
+  limiter.last_refill = Clock::now();
+  limiters_.emplace(alias, limiter);
+}
+
+void CurlThrottle::SetShare(double share) {
+  std::lock_guard<std::mutex> guard(lock_);
+  share_ = std::min(std::max(share, 0.0), 1.0);
+}
+
+void CurlThrottle::TagBinding(v8::Isolate *isolate,
+                              const v8::Local<v8::Context> &context,
+                              const v8::Local<v8::Object> &binding,
+                              const std::string &alias) {
+  binding->SetPrivate(context, AliasKey(isolate), v8Str(isolate, alias));
+}
+
+std::string CurlThrottle::GetAlias(v8::Isolate *isolate,
+                                   const v8::Local<v8::Context> &context,
+                                   const v8::Local<v8::Object> &binding) {
+  v8::Local<v8::Value> alias;
+  if (!TO_LOCAL(binding->GetPrivate(context, AliasKey(isolate)), &alias) ||
+      !alias->IsString()) {
+    return "";
+  }
+
+  v8::String::Utf8Value alias_utf8(isolate, alias);
+  return *alias_utf8 != nullptr ? *alias_utf8 : "";
+}
+
+bool CurlThrottle::Acquire(const std::string &alias, std::string &err,
+                           uint32_t &timeout_ms) {
+  timeout_ms = 0;
+  std::lock_guard<std::mutex> guard(lock_);
+  auto it = limiters_.find(alias);
+  if (it == limiters_.end()) {
+    return true;
+  }
+
+  auto &limiter = it->second;
+  const auto &limits = limiter.limits;
+  // Every process is allowed at least one call in flight
+  const auto max_concurrent = std::max(
+      uint32_t(1), static_cast<uint32_t>(limits.max_concurrent * share_));
+  if (limits.max_concurrent > 0 && limiter.in_flight >= max_concurrent) {
+    ++rejected_count_;
+    err = "Exceeded max_concurrent of " +
+          std::to_string(limits.max_concurrent) + " for " + alias;
+    return false;
+  }
+
+  if (limits.max_requests_per_sec > 0) {
+    // Token bucket that allows a burst of up to a second's worth of calls, or
+    // a single call if the share of the process is below one per second.
+    // Calls aren't held back for a token, as the handler holds the isolate
+    // and the clock of its execution timeout meanwhile
+    const auto now = Clock::now();
+    const std::chrono::duration<double> elapsed = now - limiter.last_refill;
+    const double rate = limits.max_requests_per_sec * share_;
+    limiter.tokens = std::min(std::max(rate, 1.0),
+                              limiter.tokens + elapsed.count() * rate);
+    limiter.last_refill = now;
+
+    if (limiter.tokens < 1) {
+      ++throttled_count_;
+      err = "Exceeded max_requests_per_sec of " +
+            std::to_string(limits.max_requests_per_sec) + " for " + alias;
+      return false;
+    }
+    limiter.tokens -= 1;
+  }
+
+  timeout_ms = limits.timeout_ms;
+  ++limiter.in_flight;
+  return true;
+}
+
+void CurlThrottle::Release(const std::string &alias) {
+  std::lock_guard<std::mutex> guard(lock_);
+  auto it = limiters_.find(alias);
+  if (it != limiters_.end() && it->second.in_flight > 0) {
+    --it->second.in_flight;
+  }
+}
+
+void ThrottledCurlFunction(const v8::FunctionCallbackInfo<v8::Value> &args) {
+  auto isolate = args.GetIsolate();
+  v8::HandleScope handle_scope(isolate);
+  auto context = isolate->GetCurrentContext();
+
+  // Malformed calls are reported by CurlFunction
+  if (args.Length() < 2 || !args[1]->IsObject() ||
+      !CurlBinding::IsGenuine(isolate, args[1].As<v8::Object>())) {
+    CurlFunction(args);
+    return;
+  }
+
+  const auto alias =
+      CurlThrottle::GetAlias(isolate, context, args[1].As<v8::Object>());
+  auto &throttle = CurlThrottle::Get();
+  std::string err;
+  uint32_t timeout_ms;
+  if (!throttle.Acquire(alias, err, timeout_ms)) {
+    auto js_exception = UnwrapData(isolate)->js_exception;
+    js_exception->ThrowCurlError(err);
+    return;
+  }
+
+  // The transfer is bounded by curl_timeout, in seconds, which the binding's
+  // timeout_ms can only shorten
+  auto data = UnwrapData(isolate);
+  const auto curl_timeout = data->curl_timeout;
+  if (timeout_ms > 0) {
+    const long timeout_secs = (timeout_ms + 999) / 1000;
+    data->curl_timeout = curl_timeout > 0
+                             ? std::min(curl_timeout, timeout_secs)
+                             : timeout_secs;
+  }
+
+  CurlFunction(args);
+  data->curl_timeout = curl_timeout;
+  throttle.Release(alias);
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2020 Couchbase, Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//     http://www.apache.org/licenses/LICENSE-2.0
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an "AS IS"
+// BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+// or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+#include <mutex>
+
+#include "curl.h"
+#include "isolate_data.h"
+#include "js_exception.h"
+#include "sandbox.h"
+#include "utils.h"
+
+std::unique_ptr<Result> Sandbox::Get(const std::string &bucket,
+                                     const std::string &key) const {
+  auto it = docs_.find({bucket, key});
+  if (it == docs_.end()) {
+    return nullptr;
+  }
+
+  auto result = std::make_unique<Result>();
+  result->key = key;
+  if (it->second.deleted) {
+    result->rc = LCB_KEY_ENOENT;
+    return result;
+  }
+
+  result->cas = it->second.cas;
+  result->exptime = it->second.expiry;
+  result->value = it->second.value;
+  if (it->second.is_json) {
+    result->datatype = 1;
+  } else {
+    result->binary = it->second.value.data();
+    result->byteLength = it->second.value.size();
+  }
+  return result;
+}
+
+std::unique_ptr<Result> Sandbox::Set(const std::string &bucket,
+                                     const std::string &key, const void *value,
+                                     int value_length, lcb_U32 expiry,
+                                     lcb_CAS cas) {
+  auto result = std::make_unique<Result>();
+  result->key = key;
+  if (CasMismatch({bucket, key}, cas)) {
+    result->rc = LCB_KEY_EEXISTS;
+    return result;
+  }
+
+  Document doc;
+  doc.value.assign(static_cast<const char *>(value), value_length);
+  doc.is_json = nlohmann::json::accept(doc.value);
+  doc.cas = ++cas_counter_;
+  doc.expiry = expiry;
+  AddWrite("set", bucket, key, doc);
+
+  result->cas = doc.cas;
+  docs_[{bucket, key}] = std::move(doc);
+  return result;
+}
+
+std::unique_ptr<Result> Sandbox::Delete(const std::string &bucket,
+                                        const std::string &key, lcb_CAS cas) {
+  auto result = std::make_unique<Result>();
+  result->key = key;
+  if (CasMismatch({bucket, key}, cas)) {
+    result->rc = LCB_KEY_EEXISTS;
+    return result;
+  }
+
+  Document doc;
+  doc.deleted = true;
+  doc.cas = ++cas_counter_;
+  AddWrite("delete", bucket, key, doc);
+
+  result->cas = doc.cas;
+  docs_[{bucket, key}] = std::move(doc);
+  return result;
+}
+
+std::unique_ptr<Result> Sandbox::Counter(const std::string &bucket,
+                                         const std::string &key,
+                                         int64_t current,
+                                         const std::string &delta,
+                                         lcb_U32 expiry) {
+  auto count = current + std::stoll(delta);
+  auto value = nlohmann::json{{"count", count}}.dump();
+
+  auto result = Set(bucket, key, value.c_str(), value.size(), expiry, 0);
+  result->counter = count;
+  return result;
+}
+
+// CAS is only verified for documents written in the overlay
+bool Sandbox::CasMismatch(const DocumentKey &doc_key, lcb_CAS cas) const {
+  if (cas == 0) {
+    return false;
+  }
+
+  auto it = docs_.find(doc_key);
+  return it != docs_.end() && it->second.cas != cas;
+}
+
+void Sandbox::AddWrite(const std::string &op, const std::string &bucket,
+                       const std::string &key, const Document &doc) {
+  nlohmann::json write;
+  write["op"] = op;
+  write["bucket"] = bucket;
+  write["key"] = key;
+  if (!doc.deleted) {
+    if (doc.is_json) {
+      write["value"] = nlohmann::json::parse(doc.value);
+    } else {
+      write["value"] = doc.value;
+    }
+    if (doc.expiry != 0) {
+      write["expiry"] = doc.expiry;
+    }
+  }
+  kv_writes_.push_back(write);
+}
+
+void Sandbox::AddLog(const std::string &msg) { logs_.push_back(msg); }
+
+void Sandbox::AddCurlCall(nlohmann::json call) {
+  curl_calls_.push_back(std::move(call));
+}
+
+void Sandbox::AddTimer(nlohmann::json timer) {
+  timers_.push_back(std::move(timer));
+}
+
+void Sandbox::AddNotification(const std::string &topic,
+                              const std::string &value) {
+  nlohmann::json notification;
+  notification["topic"] = topic;
+  notification["value"] = nlohmann::json::parse(value, nullptr, false);
+  notifications_.push_back(notification);
+}
+
+nlohmann::json Sandbox::TakeEventReport() {
+  nlohmann::json report;
+  report["logs"] = std::move(logs_);
+  report["kv_writes"] = std::move(kv_writes_);
+  report["curl_calls"] = std::move(curl_calls_);
+  report["timers"] = std::move(timers_);
+  report["notifications"] = std::move(notifications_);
+
+  logs_ = nlohmann::json::array();
+  kv_writes_ = nlohmann::json::array();
+  curl_calls_ = nlohmann::json::array();
+  timers_ = nlohmann::json::array();
+  notifications_ = nlohmann::json::array();
+  return report;
+}
+
+void SandboxCurlFunction(const v8::FunctionCallbackInfo<v8::Value> &args) {
+  auto isolate = args.GetIsolate();
+  std::lock_guard<std::mutex> guard(UnwrapData(isolate)->termination_lock_);
+  if (!UnwrapData(isolate)->is_executing_) {
+    return;
+  }
+
+  v8::HandleScope handle_scope(isolate);
+  auto context = isolate->GetCurrentContext();
+  auto js_exception = UnwrapData(isolate)->js_exception;
+  auto sandbox = UnwrapData(isolate)->sandbox;
+
+  if (args.Length() < 2 || !args[0]->IsString() || !args[1]->IsObject()) {
+    js_exception->ThrowCurlError(
+        "Need at least two parameters: method and binding");
+    return;
+  }
+
+  auto binding_info =
+      CurlBinding::FromObject(isolate, context, args[1].As<v8::Object>());
+  if (binding_info.is_fatal) {
+    js_exception->ThrowCurlError(binding_info.msg);
+    return;
+  }
+
+  auto utils = UnwrapData(isolate)->utils;
+  nlohmann::json call;
+  call["method"] = utils->ToCPPString(args[0]);
+  call["hostname"] = binding_info.binding.hostname;
+  if (args.Length() > 2) {
+    call["request"] =
+        nlohmann::json::parse(JSONStringify(isolate, args[2]), nullptr, false);
+  }
+  sandbox->AddCurlCall(call);
+
+  v8::Local<v8::Value> response;
+  if (!TO_LOCAL(v8::JSON::Parse(context,
+                                v8Str(isolate, R"({"status":200,"headers":{},"body":""})")),
+                &response)) {
+    return;
+  }
+  args.GetReturnValue().Set(response);
+}
+
+void SandboxQueryFunction(const v8::FunctionCallbackInfo<v8::Value> &args) {
+  auto isolate = args.GetIsolate();
+  v8::HandleScope handle_scope(isolate);
+
+  auto js_exception = UnwrapData(isolate)->js_exception;
+  js_exception->ThrowN1QLError(
+      "N1QL queries are not run while testing a function");
+}
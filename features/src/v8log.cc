@@ -13,6 +13,7 @@
 
 #include "insight.h"
 #include "isolate_data.h"
+#include "sandbox.h"
 #include "utils.h"
 
 const auto ConsoleLogMaxArity = 20;
@@ -57,6 +58,11 @@ void Log(const v8::FunctionCallbackInfo<v8::Value> &args) {
     log_msg += " ";
   }
 
+  if (auto sandbox = UnwrapData(isolate)->sandbox; sandbox != nullptr) {
+    sandbox->AddLog(log_msg);
+    return;
+  }
+
   APPLOG << log_msg << std::endl;
   CodeInsight::Get(isolate).AccumulateLog(log_msg);
 }
@@ -0,0 +1,124 @@
+package notification
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/dcp"
+)
+
+const (
+	// MetakvTopicsPath stores the definition of each topic, keyed by topic name
+	MetakvTopicsPath = common.MetakvEventingPath + "topics/"
+
+	// QoS names accepted in a topic definition
+	QoSEphemeral  = "ephemeral"
+	QoSPersistent = "persistent"
+
+	DefaultLeaseMs = 30000
+	MinLeaseMs     = 1000
+	MaxLeaseMs     = 3600000
+
+	keyPrefix = "eventing::notification::"
+
+	notifyChanSize  = 100
+	ackChanSize     = 100
+	pollInterval    = time.Duration(100) * time.Millisecond
+	maxScanWindow   = 1000
+	refreshInterval = time.Duration(5) * time.Second
+
+	// Documents looked up per poll, while scanning the window in turns
+	maxLookupsPerPoll = 100
+
+	// A notification id missing from the metadata bucket for this long is either acked
+	// or was never written by a failed publisher, and is skipped by the low watermark
+	holeGracePeriod = time.Duration(2) * time.Second
+
+	// Time a publisher waits for room in a full Persistent topic
+	publishTimeout      = time.Duration(5) * time.Second
+	publishWaitInterval = time.Duration(100) * time.Millisecond
+)
+
+// TopicConfig is the definition of a topic as stored in metakv
+type TopicConfig struct {
+	Name           string `json:"name"`
+	MetadataBucket string `json:"metadata_bucket"`
+	QoSName        string `json:"qos"`
+	MaxItems       uint64 `json:"capacity"`
+	LeaseMs        int64  `json:"lease_ms"`
+}
+
+// Stored in metadata bucket, one document per published notification
+type notificationDoc struct {
+	ID         uint64          `json:"id"`
+	Value      json.RawMessage `json:"value"`
+	Published  int64           `json:"published"`
+	Owner      string          `json:"owner,omitempty"`
+	Expiry     int64           `json:"expiry,omitempty"`
+	Deliveries uint64          `json:"deliveries"`
+}
+
+// storeBucket is the part of a bucket a topic store uses
+type storeBucket interface {
+	GetRaw(k string) ([]byte, error)
+	Add(k string, exp int, v interface{}) (added bool, err error)
+	Update(k string, exp int, callback couchbase.UpdateFunc) error
+	Delete(k string) error
+	Close()
+}
+
+// topicStore accesses the documents of a topic in its metadata bucket. It's shared by
+// the publishers and the slice of the topic on this node, which hold it from getStore
+// until they put it back. A store replaced or dropped closes its bucket once it's put back
+// by its last user.
+type topicStore struct {
+	def      *TopicConfig
+	bucket   storeBucket
+	loadedAt int64
+
+	users     int64
+	retired   int32
+	closeOnce sync.Once
+
+	sync.Mutex
+	holes   map[uint64]time.Time // Access controlled by default lock
+	scanned uint64               // Next id advanceLow looks up, access controlled by default lock
+}
+
+type notification struct {
+	id         uint64
+	deliveries uint64
+	value      json.RawMessage
+	expiry     time.Time
+	slice      *topicSlice
+}
+
+type topicSlice struct {
+	id    string
+	topic string
+	mgr   *manager
+
+	notifyCh  chan Notification
+	ackCh     chan Notification
+	requeueCh chan Notification
+	stopCh    chan struct{}
+
+	paused int32
+	closed int32
+	next   uint64 // Next id to claim, only accessed by poll
+
+	closeOnce sync.Once
+}
+
+type manager struct {
+	restPort string
+	uuid     string
+
+	sliceCounter uint64
+
+	sync.RWMutex
+	slices map[string]*topicSlice // Access controlled by default lock
+	stores map[string]*topicStore // Access controlled by default lock
+}
@@ -0,0 +1,26 @@
+package notification
+
+import (
+	"fmt"
+)
+
+type notificationError struct {
+	code    Code
+	details string
+}
+
+func newError(code Code, format string, args ...interface{}) Error {
+	return &notificationError{code: code, details: fmt.Sprintf(format, args...)}
+}
+
+func (e *notificationError) Code() Code {
+	return e.code
+}
+
+func (e *notificationError) Details() string {
+	return e.details
+}
+
+func (e *notificationError) String() string {
+	return fmt.Sprintf("%v: %s", e.code, e.details)
+}
@@ -0,0 +1,229 @@
+package notification
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// NewManager returns the notification manager of this eventing node
+func NewManager(restPort, uuid string) NotificationManager {
+	return &manager{
+		restPort: restPort,
+		uuid:     uuid,
+		slices:   make(map[string]*topicSlice),
+		stores:   make(map[string]*topicStore),
+	}
+}
+
+func (m *manager) OpenTopic(topic string) (*TopicSlice, Error) {
+	logPrefix := "manager::OpenTopic"
+
+	store, err := m.getStore(topic)
+	if err != nil {
+		return nil, err
+	}
+	store.put()
+
+	id := m.uuid + "-" + strconv.FormatUint(atomic.AddUint64(&m.sliceCounter, 1), 10)
+	s := newTopicSlice(m, id, topic)
+
+	m.Lock()
+	prev := m.slices[topic]
+	m.slices[topic] = s
+	m.Unlock()
+
+	// Only one slice per topic is allowed on a node
+	if prev != nil {
+		prev.Close()
+	}
+
+	logging.Infof("%s topic: %s opened slice: %s", logPrefix, topic, id)
+
+	var ts TopicSlice = s
+	return &ts, nil
+}
+
+func (m *manager) DescribeTopic(topic string) (*TopicDef, Error) {
+	def, err := GetTopic(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var td TopicDef = def
+	return &td, nil
+}
+
+func (m *manager) Publish(topic string, value interface{}) Error {
+	logPrefix := "manager::Publish"
+
+	data, jErr := json.Marshal(value)
+	if jErr != nil {
+		return newError(StoreFailure, "failed to marshal notification for topic: %s, err: %v", topic, jErr)
+	}
+
+	store, err := m.getStore(topic)
+	if err != nil {
+		return err
+	}
+	defer store.put()
+
+	capacity, _ := store.def.Capacity()
+	low, sErr := store.low()
+	if sErr != nil {
+		return newError(StoreFailure, "failed to read pending notifications of topic: %s, err: %v", topic, sErr)
+	}
+
+	deadline := time.Now().Add(publishTimeout)
+	for {
+		id, full, sErr := store.publish(data, low, capacity)
+		if sErr != nil {
+			return newError(StoreFailure, "failed to publish notification to topic: %s, err: %v", topic, sErr)
+		}
+		if !full {
+			logging.Tracef("%s topic: %s published notification: %d", logPrefix, topic, id)
+			return nil
+		}
+
+		// Acked notifications may have made room the low watermark hasn't caught up with yet
+		prevLow := low
+		if low, _, sErr = store.advanceLow(); sErr != nil {
+			return newError(StoreFailure, "failed to read pending notifications of topic: %s, err: %v", topic, sErr)
+		}
+		if low != prevLow {
+			continue
+		}
+
+		if store.def.ephemeral() {
+			if sErr = store.dropHead(low); sErr != nil {
+				return newError(StoreFailure, "failed to drop notification from full topic: %s, err: %v", topic, sErr)
+			}
+			low++
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return newError(Timeout, "topic: %s is full with %d notifications", topic, capacity)
+		}
+		time.Sleep(publishWaitInterval)
+	}
+}
+
+func (m *manager) DeleteTopic(topic string) Error {
+	logPrefix := "manager::DeleteTopic"
+
+	store, err := m.getStore(topic)
+	if err != nil {
+		return err
+	}
+	defer store.put()
+
+	m.RLock()
+	s := m.slices[topic]
+	m.RUnlock()
+	if s != nil {
+		s.Close()
+	}
+
+	if dErr := DeleteTopic(topic); dErr != nil {
+		return newError(StoreFailure, "failed to delete definition of topic: %s, err: %v", topic, dErr)
+	}
+
+	if pErr := store.purge(); pErr != nil {
+		logging.Errorf("%s topic: %s failed to purge notifications, err: %v", logPrefix, topic, pErr)
+	}
+
+	m.dropStore(topic)
+	return nil
+}
+
+func (m *manager) removeSlice(s *topicSlice) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.slices[s.topic] == s {
+		delete(m.slices, s.topic)
+	}
+}
+
+// getStore returns the store of a topic, the definition is refreshed from metakv
+// periodically so that changes made on other nodes are picked up. Callers put the store
+// back once they're done with it.
+func (m *manager) getStore(topic string) (*topicStore, Error) {
+	m.RLock()
+	store, ok := m.stores[topic]
+	if ok && time.Since(time.Unix(0, atomic.LoadInt64(&store.loadedAt))) < refreshInterval {
+		atomic.AddInt64(&store.users, 1)
+		m.RUnlock()
+		return store, nil
+	}
+	m.RUnlock()
+
+	def, err := GetTopic(topic)
+	if err != nil {
+		if err.Code() == TopicNotFound {
+			m.dropStore(topic)
+		}
+		return nil, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	prev, ok := m.stores[topic]
+	if ok && *prev.def == *def {
+		atomic.StoreInt64(&prev.loadedAt, time.Now().UnixNano())
+		atomic.AddInt64(&prev.users, 1)
+		return prev, nil
+	}
+
+	// Definition is never modified in place as publishers and slices read it without locks,
+	// so a changed one gets a store of its own. The previous store stays usable by those
+	// holding it, and is closed once they put it back.
+	bucket, bErr := util.ConnectBucket(net.JoinHostPort(util.Localhost(), m.restPort), "default", def.MetadataBucket)
+	if bErr != nil {
+		return nil, newError(StoreFailure, "topic: %s failed to connect to metadata bucket: %s, err: %v",
+			topic, def.MetadataBucket, bErr)
+	}
+
+	store = newTopicStore(def, bucket)
+	if ok {
+		// Holes already known stay valid while the notifications are in the same bucket
+		if prev.def.MetadataBucket == def.MetadataBucket {
+			prev.Lock()
+			for id, since := range prev.holes {
+				store.holes[id] = since
+			}
+			prev.Unlock()
+		}
+		prev.retire()
+	}
+
+	store.users = 1
+	m.stores[topic] = store
+	return store, nil
+}
+
+func newTopicStore(def *TopicConfig, bucket storeBucket) *topicStore {
+	return &topicStore{
+		def:      def,
+		bucket:   bucket,
+		loadedAt: time.Now().UnixNano(),
+		holes:    make(map[uint64]time.Time),
+	}
+}
+
+func (m *manager) dropStore(topic string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if store, ok := m.stores[topic]; ok {
+		delete(m.stores, topic)
+		store.retire()
+	}
+}
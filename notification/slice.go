@@ -0,0 +1,268 @@
+package notification
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+func (n *notification) Key() (string, Error) {
+	if time.Now().After(n.expiry) {
+		return "", newError(Timeout, "lease of notification: %d expired at %v", n.id, n.expiry)
+	}
+	return strconv.FormatUint(n.id, 10) + "-" + strconv.FormatUint(n.deliveries, 10), nil
+}
+
+func (n *notification) Value() (interface{}, Error) {
+	if time.Now().After(n.expiry) {
+		return nil, newError(Timeout, "lease of notification: %d expired at %v", n.id, n.expiry)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(n.value, &value); err != nil {
+		return nil, newError(StoreFailure, "failed to unmarshal notification: %d, err: %v", n.id, err)
+	}
+	return value, nil
+}
+
+func (n *notification) Expiry() time.Time {
+	return n.expiry
+}
+
+func newTopicSlice(m *manager, id, topic string) *topicSlice {
+	s := &topicSlice{
+		id:        id,
+		topic:     topic,
+		mgr:       m,
+		notifyCh:  make(chan Notification, notifyChanSize),
+		ackCh:     make(chan Notification, ackChanSize),
+		requeueCh: make(chan Notification, ackChanSize),
+		stopCh:    make(chan struct{}),
+	}
+
+	go s.poll()
+	go s.processAcks()
+	return s
+}
+
+func (s *topicSlice) isClosed() bool {
+	return atomic.LoadInt32(&s.closed) == 1
+}
+
+func (s *topicSlice) closedError() Error {
+	return newError(TopicSliceClosed, "topic: %s slice: %s", s.topic, s.id)
+}
+
+func (s *topicSlice) NotifyChannel() (<-chan Notification, Error) {
+	if s.isClosed() {
+		return nil, s.closedError()
+	}
+	return s.notifyCh, nil
+}
+
+func (s *topicSlice) AckChannel() (chan<- Notification, Error) {
+	if s.isClosed() {
+		return nil, s.closedError()
+	}
+	return s.ackCh, nil
+}
+
+func (s *topicSlice) RequeueChannel() (chan<- Notification, Error) {
+	if s.isClosed() {
+		return nil, s.closedError()
+	}
+	return s.requeueCh, nil
+}
+
+func (s *topicSlice) Pause() Error {
+	if s.isClosed() {
+		return s.closedError()
+	}
+	atomic.StoreInt32(&s.paused, 1)
+	return nil
+}
+
+func (s *topicSlice) Resume() Error {
+	if s.isClosed() {
+		return s.closedError()
+	}
+	atomic.StoreInt32(&s.paused, 0)
+	return nil
+}
+
+func (s *topicSlice) Describe() (*TopicDef, Error) {
+	if s.isClosed() {
+		return nil, s.closedError()
+	}
+	return s.mgr.DescribeTopic(s.topic)
+}
+
+func (s *topicSlice) Close() Error {
+	logPrefix := "topicSlice::Close"
+
+	if s.isClosed() {
+		return s.closedError()
+	}
+
+	s.closeOnce.Do(func() {
+		atomic.StoreInt32(&s.closed, 1)
+		close(s.stopCh)
+		s.mgr.removeSlice(s)
+		logging.Infof("%s topic: %s slice: %s closed", logPrefix, s.topic, s.id)
+	})
+	return nil
+}
+
+// poll leases notifications pending in the topic as long as there's room in the notify
+// channel. It's the only writer to the notify channel.
+func (s *topicSlice) poll() {
+	logPrefix := "topicSlice::poll"
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if atomic.LoadInt32(&s.paused) == 1 || len(s.notifyCh) == cap(s.notifyCh) {
+				continue
+			}
+
+			store, err := s.mgr.getStore(s.topic)
+			if err != nil {
+				logging.Errorf("%s topic: %s slice: %s failed to access topic, err: %v",
+					logPrefix, s.topic, s.id, err.Details())
+				continue
+			}
+
+			if err := s.claimPending(store); err != nil {
+				logging.Errorf("%s topic: %s slice: %s failed to lease notifications, err: %v",
+					logPrefix, s.topic, s.id, err)
+			}
+			store.put()
+
+		case <-s.stopCh:
+			s.releaseUnread()
+			return
+		}
+	}
+}
+
+// claimPending leases notifications of the scan window, looking up at most maxLookupsPerPoll of
+// them per poll. The next poll carries on where this one stopped, and goes back to the low
+// watermark once it reaches the end of the window. Ids known to be missing aren't looked up
+func (s *topicSlice) claimPending(store *topicStore) error {
+	low, seq, err := store.advanceLow()
+	if err != nil {
+		return err
+	}
+
+	if s.next < low {
+		s.next = low
+	}
+	for lookups := 0; lookups < maxLookupsPerPoll; {
+		if s.next > seq || s.next >= low+maxScanWindow {
+			s.next = low
+			return nil
+		}
+		if len(s.notifyCh) == cap(s.notifyCh) || atomic.LoadInt32(&s.paused) == 1 || s.isClosed() {
+			return nil
+		}
+
+		id := s.next
+		s.next++
+		if store.isHole(id) {
+			continue
+		}
+
+		lookups++
+		doc, err := store.claim(id, s.id)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			continue
+		}
+
+		s.notifyCh <- &notification{
+			id:         doc.ID,
+			deliveries: doc.Deliveries,
+			value:      doc.Value,
+			expiry:     time.Unix(0, doc.Expiry),
+			slice:      s,
+		}
+	}
+	return nil
+}
+
+// releaseUnread gives up leases of notifications that were queued but not read before close
+func (s *topicSlice) releaseUnread() {
+	for {
+		select {
+		case n := <-s.notifyCh:
+			s.release(n, false)
+		default:
+			return
+		}
+	}
+}
+
+func (s *topicSlice) processAcks() {
+	for {
+		select {
+		case n := <-s.ackCh:
+			s.release(n, true)
+		case n := <-s.requeueCh:
+			s.release(n, false)
+		case <-s.stopCh:
+			s.drainAcks()
+			return
+		}
+	}
+}
+
+// drainAcks processes acks queued before the slice was closed
+func (s *topicSlice) drainAcks() {
+	for {
+		select {
+		case n := <-s.ackCh:
+			s.release(n, true)
+		case n := <-s.requeueCh:
+			s.release(n, false)
+		default:
+			return
+		}
+	}
+}
+
+func (s *topicSlice) release(n Notification, ack bool) {
+	logPrefix := "topicSlice::release"
+
+	notif, ok := n.(*notification)
+	if !ok || notif.slice != s {
+		logging.Errorf("%s topic: %s slice: %s got a notification that wasn't leased by this slice",
+			logPrefix, s.topic, s.id)
+		return
+	}
+
+	// Lease has expired, notification is claimed afresh
+	if time.Now().After(notif.expiry) {
+		return
+	}
+
+	store, err := s.mgr.getStore(s.topic)
+	if err != nil {
+		logging.Errorf("%s topic: %s slice: %s failed to access topic, err: %v",
+			logPrefix, s.topic, s.id, err.Details())
+		return
+	}
+	defer store.put()
+
+	if err := store.release(notif.id, notif.deliveries, s.id, ack); err != nil {
+		logging.Errorf("%s topic: %s slice: %s failed to release notification: %d ack: %t, err: %v",
+			logPrefix, s.topic, s.id, notif.id, ack, err)
+	}
+}
@@ -0,0 +1,340 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/dcp"
+	mcd "github.com/couchbase/eventing/dcp/transport"
+	"github.com/couchbase/eventing/logging"
+)
+
+// Layout of a topic in its metadata bucket:
+//   <prefix><topic>::seq    id of the latest published notification
+//   <prefix><topic>::low    lowest id that may still be pending delivery
+//   <prefix><topic>::n::<id> notification document
+// Acknowledged notifications are deleted, the low watermark moves past them as they're acked
+// or, for ids missing for another reason, once their grace period ends.
+
+var getNow = time.Now // tests move the clock to end grace periods
+
+func seqKey(topic string) string {
+	return keyPrefix + topic + "::seq"
+}
+
+func lowKey(topic string) string {
+	return keyPrefix + topic + "::low"
+}
+
+func docKey(topic string, id uint64) string {
+	return fmt.Sprintf("%s%s::n::%d", keyPrefix, topic, id)
+}
+
+// put gives the store back, it's closed with its last user once it's retired
+func (ts *topicStore) put() {
+	if atomic.AddInt64(&ts.users, -1) == 0 && atomic.LoadInt32(&ts.retired) == 1 {
+		ts.close()
+	}
+}
+
+// retire marks a store that's no longer handed out by the manager
+func (ts *topicStore) retire() {
+	atomic.StoreInt32(&ts.retired, 1)
+	if atomic.LoadInt64(&ts.users) == 0 {
+		ts.close()
+	}
+}
+
+func (ts *topicStore) close() {
+	ts.closeOnce.Do(ts.bucket.Close)
+}
+
+func (ts *topicStore) readCounter(key string, def uint64) (uint64, error) {
+	data, err := ts.bucket.GetRaw(key)
+	if err != nil {
+		if mcd.IsNotFound(err) {
+			return def, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseUint(string(data), 10, 64)
+}
+
+func (ts *topicStore) seq() (uint64, error) {
+	return ts.readCounter(seqKey(ts.def.Name), 0)
+}
+
+func (ts *topicStore) low() (uint64, error) {
+	return ts.readCounter(lowKey(ts.def.Name), 1)
+}
+
+// setLow moves the low watermark forward, it never moves backwards
+func (ts *topicStore) setLow(low uint64) error {
+	err := ts.bucket.Update(lowKey(ts.def.Name), 0, func(current []byte) ([]byte, error) {
+		if current != nil {
+			curr, err := strconv.ParseUint(string(current), 10, 64)
+			if err == nil && curr >= low {
+				return nil, couchbase.UpdateCancel
+			}
+		}
+		return []byte(strconv.FormatUint(low, 10)), nil
+	})
+	if err == couchbase.UpdateCancel {
+		return nil
+	}
+	return err
+}
+
+// pending returns the range of ids between the low watermark and the latest published id
+func (ts *topicStore) pending() (low, seq uint64, err error) {
+	if low, err = ts.low(); err != nil {
+		return
+	}
+	seq, err = ts.seq()
+	return
+}
+
+// advanceLow moves the low watermark past ids whose documents have been missing for longer
+// than holeGracePeriod. A missing document is usually an acked notification, but could also
+// be one whose publisher hasn't written it yet, so a hole is looked up once more before it's
+// passed. The ids of the scan window are looked up in turns of maxLookupsPerPoll, noting the
+// missing ones, so a run of acked notifications is passed in one go once its grace period ends.
+func (ts *topicStore) advanceLow() (low, seq uint64, err error) {
+	if low, seq, err = ts.pending(); err != nil {
+		return
+	}
+
+	ts.Lock()
+	defer ts.Unlock()
+
+	for id := range ts.holes {
+		if id < low {
+			delete(ts.holes, id)
+		}
+	}
+
+	start := low
+	now := getNow()
+	lookups := 0
+	for ; low <= seq && lookups < maxLookupsPerPoll; low++ {
+		since, ok := ts.holes[low]
+		if !ok || now.Sub(since) < holeGracePeriod {
+			break
+		}
+
+		lookups++
+		var present bool
+		if present, err = ts.exists(low); err != nil {
+			return
+		}
+		if present {
+			delete(ts.holes, low)
+			break
+		}
+		delete(ts.holes, low)
+	}
+
+	if ts.scanned < low {
+		ts.scanned = low
+	}
+	for ; lookups < maxLookupsPerPoll; lookups++ {
+		if ts.scanned > seq || ts.scanned >= low+maxScanWindow {
+			ts.scanned = low
+			break
+		}
+
+		id := ts.scanned
+		var present bool
+		if present, err = ts.exists(id); err != nil {
+			return
+		}
+		if present {
+			delete(ts.holes, id)
+		} else if _, ok := ts.holes[id]; !ok {
+			ts.holes[id] = now
+		}
+		ts.scanned++
+	}
+
+	if low != start {
+		err = ts.setLow(low)
+	}
+	return
+}
+
+func (ts *topicStore) exists(id uint64) (bool, error) {
+	_, err := ts.bucket.GetRaw(docKey(ts.def.Name, id))
+	if err == nil {
+		return true, nil
+	}
+	if mcd.IsNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// isHole tells if the document of an id was found missing
+func (ts *topicStore) isHole(id uint64) bool {
+	ts.Lock()
+	defer ts.Unlock()
+	_, ok := ts.holes[id]
+	return ok
+}
+
+// ackedHole notes an id whose notification was acked, so advanceLow passes it without
+// waiting for holeGracePeriod. The low watermark moves right away if it's at the id.
+func (ts *topicStore) ackedHole(id uint64) error {
+	ts.Lock()
+	ts.holes[id] = time.Time{}
+	ts.Unlock()
+
+	low, err := ts.low()
+	if err != nil || low != id {
+		return err
+	}
+	return ts.setLow(id + 1)
+}
+
+// dropHead removes the oldest pending notification to make room in a full Ephemeral topic
+func (ts *topicStore) dropHead(low uint64) error {
+	logPrefix := "topicStore::dropHead"
+
+	err := ts.bucket.Delete(docKey(ts.def.Name, low))
+	if err != nil && !mcd.IsNotFound(err) {
+		return err
+	}
+
+	logging.Debugf("%s topic: %s dropped notification: %d", logPrefix, ts.def.Name, low)
+	return ts.setLow(low + 1)
+}
+
+// publish writes a notification under the next id, unless the topic already holds capacity
+// notifications from the low watermark on. The id is reserved with a CAS on the latest id, so
+// concurrent publishers, on this node or others, can't overshoot the capacity.
+func (ts *topicStore) publish(value json.RawMessage, low, capacity uint64) (id uint64, full bool, err error) {
+	err = ts.bucket.Update(seqKey(ts.def.Name), 0, func(current []byte) ([]byte, error) {
+		var seq uint64
+		if current != nil {
+			var pErr error
+			if seq, pErr = strconv.ParseUint(string(current), 10, 64); pErr != nil {
+				return nil, pErr
+			}
+		}
+
+		id, full = seq+1, false
+		if id >= low && id-low+1 > capacity {
+			full = true
+			return nil, couchbase.UpdateCancel
+		}
+		return []byte(strconv.FormatUint(id, 10)), nil
+	})
+	if err == couchbase.UpdateCancel {
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	doc := &notificationDoc{
+		ID:        id,
+		Value:     value,
+		Published: time.Now().UnixNano(),
+	}
+	_, err = ts.bucket.Add(docKey(ts.def.Name, id), 0, doc)
+	return id, false, err
+}
+
+// claim leases a notification to the slice. A notification can be claimed if it isn't leased
+// or its lease has expired, Ephemeral topics drop notifications with expired leases instead.
+func (ts *topicStore) claim(id uint64, owner string) (*notificationDoc, error) {
+	var claimed *notificationDoc
+	err := ts.bucket.Update(docKey(ts.def.Name, id), 0, func(current []byte) ([]byte, error) {
+		claimed = nil
+		if current == nil {
+			return nil, couchbase.UpdateCancel
+		}
+
+		doc := &notificationDoc{}
+		if err := json.Unmarshal(current, doc); err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		if doc.Owner != "" {
+			if now.UnixNano() < doc.Expiry {
+				return nil, couchbase.UpdateCancel
+			}
+			if ts.def.ephemeral() {
+				return nil, nil
+			}
+		}
+
+		doc.Owner = owner
+		doc.Expiry = now.Add(ts.def.lease()).UnixNano()
+		doc.Deliveries++
+		claimed = doc
+		return json.Marshal(doc)
+	})
+	if err == couchbase.UpdateCancel || mcd.IsNotFound(err) {
+		return nil, nil
+	}
+	return claimed, err
+}
+
+// release ends the lease of a notification held by owner. Acked notifications are deleted,
+// others become available to be claimed again.
+func (ts *topicStore) release(id, deliveries uint64, owner string, ack bool) error {
+	err := ts.bucket.Update(docKey(ts.def.Name, id), 0, func(current []byte) ([]byte, error) {
+		if current == nil {
+			return nil, couchbase.UpdateCancel
+		}
+
+		doc := &notificationDoc{}
+		if err := json.Unmarshal(current, doc); err != nil {
+			return nil, err
+		}
+
+		// Lease has already expired and the notification was claimed again
+		if doc.Owner != owner || doc.Deliveries != deliveries {
+			return nil, couchbase.UpdateCancel
+		}
+
+		if ack {
+			return nil, nil
+		}
+		doc.Owner = ""
+		doc.Expiry = 0
+		return json.Marshal(doc)
+	})
+	if err == couchbase.UpdateCancel || mcd.IsNotFound(err) {
+		return nil
+	}
+	if err != nil || !ack {
+		return err
+	}
+	return ts.ackedHole(id)
+}
+
+// purge deletes all documents of the topic from its metadata bucket
+func (ts *topicStore) purge() error {
+	low, seq, err := ts.pending()
+	if err != nil {
+		return err
+	}
+
+	for id := low; id <= seq; id++ {
+		if err = ts.bucket.Delete(docKey(ts.def.Name, id)); err != nil && !mcd.IsNotFound(err) {
+			return err
+		}
+	}
+
+	for _, key := range []string{lowKey(ts.def.Name), seqKey(ts.def.Name)} {
+		if err = ts.bucket.Delete(key); err != nil && !mcd.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
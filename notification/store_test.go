@@ -0,0 +1,308 @@
+package notification
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/couchbase/eventing/dcp"
+	mcd "github.com/couchbase/eventing/dcp/transport"
+)
+
+// memBucket keeps the documents of a topic store in memory, updates are applied atomically
+// like a CAS loop that never conflicts
+type memBucket struct {
+	sync.Mutex
+	docs    map[string][]byte
+	lookups int // Notification documents looked up
+	closed  int
+}
+
+func newMemBucket() *memBucket {
+	return &memBucket{docs: make(map[string][]byte)}
+}
+
+func notFound() error {
+	return &mcd.MCResponse{Status: mcd.KEY_ENOENT}
+}
+
+func (b *memBucket) GetRaw(k string) ([]byte, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if strings.Contains(k, "::n::") {
+		b.lookups++
+	}
+	data, ok := b.docs[k]
+	if !ok {
+		return nil, notFound()
+	}
+	return data, nil
+}
+
+func (b *memBucket) Add(k string, exp int, v interface{}) (bool, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.docs[k]; ok {
+		return false, nil
+	}
+	b.docs[k] = data
+	return true, nil
+}
+
+func (b *memBucket) Update(k string, exp int, callback couchbase.UpdateFunc) error {
+	b.Lock()
+	defer b.Unlock()
+
+	updated, err := callback(b.docs[k])
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		delete(b.docs, k)
+	} else {
+		b.docs[k] = updated
+	}
+	return nil
+}
+
+func (b *memBucket) Delete(k string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.docs[k]; !ok {
+		return notFound()
+	}
+	delete(b.docs, k)
+	return nil
+}
+
+func (b *memBucket) Close() {
+	b.Lock()
+	defer b.Unlock()
+	b.closed++
+}
+
+func (b *memBucket) lookupCount() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.lookups
+}
+
+// setClock moves the clock of hole grace periods to now. Tests defer the returned func to restore it
+func setClock(now *time.Time) func() {
+	prev := getNow
+	getNow = func() time.Time { return *now }
+	return func() { getNow = prev }
+}
+
+func newTestStore(capacity uint64) (*topicStore, *memBucket) {
+	bucket := newMemBucket()
+	def := &TopicConfig{Name: "topic", MetadataBucket: "meta", QoSName: QoSPersistent, MaxItems: capacity}
+	return newTopicStore(def, bucket), bucket
+}
+
+func publishN(t *testing.T, store *topicStore, n int) {
+	capacity, _ := store.def.Capacity()
+	for i := 0; i < n; i++ {
+		if _, full, err := store.publish(json.RawMessage(`{}`), 1, capacity); full || err != nil {
+			t.Fatalf("Failed to publish notification %d, full: %v err: %v", i, full, err)
+		}
+	}
+}
+
+func checkLow(t *testing.T, store *topicStore, expected uint64) {
+	low, _, err := store.advanceLow()
+	if err != nil {
+		t.Fatalf("Failed to advance low watermark, err: %v", err)
+	}
+	if low != expected {
+		t.Fatalf("Expected low watermark %d, got %d", expected, low)
+	}
+	if persisted, _ := store.low(); persisted != expected {
+		t.Fatalf("Expected persisted low watermark %d, got %d", expected, persisted)
+	}
+}
+
+func TestPublishCapacityConcurrent(t *testing.T) {
+	store, _ := newTestStore(10)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	published := make(map[uint64]struct{})
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, full, err := store.publish(json.RawMessage(`{}`), 1, 10)
+			if err != nil {
+				t.Errorf("Failed to publish, err: %v", err)
+				return
+			}
+			if !full {
+				mu.Lock()
+				published[id] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(published) != 10 {
+		t.Fatalf("Expected 10 notifications to fit in the topic, got %d", len(published))
+	}
+	for id := uint64(1); id <= 10; id++ {
+		if _, ok := published[id]; !ok {
+			t.Fatalf("Expected notification %d to be published, got %v", id, published)
+		}
+	}
+	if seq, _ := store.seq(); seq != 10 {
+		t.Fatalf("Expected latest id 10, got %d", seq)
+	}
+
+	// Room is made as the low watermark moves
+	if err := store.setLow(4); err != nil {
+		t.Fatalf("Failed to set low watermark, err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, full, err := store.publish(json.RawMessage(`{}`), 4, 10); full || err != nil {
+			t.Fatalf("Expected room for notification %d, full: %v err: %v", i, full, err)
+		}
+	}
+	if _, full, _ := store.publish(json.RawMessage(`{}`), 4, 10); !full {
+		t.Fatalf("Expected the topic to be full again")
+	}
+}
+
+func TestSetLowNeverMovesBack(t *testing.T) {
+	store, _ := newTestStore(0)
+
+	for _, low := range []uint64{5, 3, 5, 7} {
+		if err := store.setLow(low); err != nil {
+			t.Fatalf("Failed to set low watermark to %d, err: %v", low, err)
+		}
+	}
+	if low, _ := store.low(); low != 7 {
+		t.Fatalf("Expected low watermark 7, got %d", low)
+	}
+}
+
+func TestAdvanceLowHoles(t *testing.T) {
+	now := time.Unix(1000, 0)
+	defer setClock(&now)()
+
+	store, bucket := newTestStore(0)
+	publishN(t, store, 6)
+
+	// Notifications acked on other nodes leave holes, passed once their grace period ends
+	for _, id := range []uint64{1, 2, 4} {
+		bucket.Delete(docKey(store.def.Name, id))
+	}
+	checkLow(t, store, 1)
+	now = now.Add(holeGracePeriod)
+	checkLow(t, store, 3)
+
+	// A pending notification holds the low watermark until it's acked, which moves it right away
+	if err := store.release(3, 0, "", true); err != nil {
+		t.Fatalf("Failed to release notification, err: %v", err)
+	}
+	if low, _ := store.low(); low != 4 {
+		t.Fatalf("Expected acked notification to move low watermark to 4, got %d", low)
+	}
+	checkLow(t, store, 5)
+
+	// Holes are forgotten once passed
+	store.Lock()
+	for id := range store.holes {
+		if id < 5 {
+			t.Fatalf("Expected hole %d to be forgotten, got %v", id, store.holes)
+		}
+	}
+	store.Unlock()
+}
+
+func TestAdvanceLowLateWrite(t *testing.T) {
+	now := time.Unix(1000, 0)
+	defer setClock(&now)()
+
+	store, bucket := newTestStore(0)
+	publishN(t, store, 2)
+
+	// Notification 1 is reserved but its publisher writes it late, within the grace period
+	late := bucket.docs[docKey(store.def.Name, 1)]
+	bucket.Delete(docKey(store.def.Name, 1))
+	checkLow(t, store, 1)
+
+	bucket.Lock()
+	bucket.docs[docKey(store.def.Name, 1)] = late
+	bucket.Unlock()
+	now = now.Add(holeGracePeriod)
+	checkLow(t, store, 1)
+
+	if store.isHole(1) {
+		t.Fatalf("Expected notification written late to no longer be a hole")
+	}
+}
+
+func TestAdvanceLowLookupsBounded(t *testing.T) {
+	now := time.Unix(1000, 0)
+	defer setClock(&now)()
+
+	const count = 3 * maxLookupsPerPoll
+	store, bucket := newTestStore(0)
+	publishN(t, store, count)
+	for id := uint64(1); id <= count; id++ {
+		bucket.Delete(docKey(store.def.Name, id))
+	}
+
+	// The window is looked up in turns
+	for i := 0; i < count/maxLookupsPerPoll; i++ {
+		before := bucket.lookupCount()
+		checkLow(t, store, 1)
+		if lookups := bucket.lookupCount() - before; lookups > maxLookupsPerPoll {
+			t.Fatalf("Expected at most %d lookups per poll, got %d", maxLookupsPerPoll, lookups)
+		}
+	}
+
+	// Holes noted over several polls are passed in as many polls once their grace period ends
+	now = now.Add(holeGracePeriod)
+	expected := uint64(1)
+	for i := 0; i < count/maxLookupsPerPoll; i++ {
+		before := bucket.lookupCount()
+		expected += maxLookupsPerPoll
+		checkLow(t, store, expected)
+		if lookups := bucket.lookupCount() - before; lookups > maxLookupsPerPoll {
+			t.Fatalf("Expected at most %d lookups per poll, got %d", maxLookupsPerPoll, lookups)
+		}
+	}
+}
+
+func TestStoreClosedAfterLastUser(t *testing.T) {
+	store, bucket := newTestStore(0)
+
+	store.users = 2
+	store.retire()
+	store.put()
+	if bucket.closed != 0 {
+		t.Fatalf("Expected store to stay open while it has users")
+	}
+	store.put()
+	if bucket.closed != 1 {
+		t.Fatalf("Expected store to be closed once by its last user, got %d closes", bucket.closed)
+	}
+
+	// A store without users is closed when retired
+	store, bucket = newTestStore(0)
+	store.retire()
+	if bucket.closed != 1 {
+		t.Fatalf("Expected idle store to be closed when retired, got %d closes", bucket.closed)
+	}
+}
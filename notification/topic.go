@@ -0,0 +1,155 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/cbauth/metakv"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Topic names become part of metakv paths and document keys
+var topicNameRegex = regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_-]*$")
+
+const (
+	maxTopicNameLength = 100
+
+	// Permission a user needs to publish to or subscribe from a topic
+	topicPermission = "cluster.eventing.functions!manage"
+)
+
+// QoS returns one of the declared Ephemeral or Persistent combinations
+func (t *TopicConfig) QoS() (*[]Characteristic, Error) {
+	switch t.QoSName {
+	case QoSEphemeral:
+		return Ephemeral, nil
+	case QoSPersistent:
+		return Persistent, nil
+	}
+	return nil, newError(StoreFailure, "topic: %s has unknown qos: %s", t.Name, t.QoSName)
+}
+
+func (t *TopicConfig) Capacity() (uint64, Error) {
+	if t.MaxItems == 0 {
+		return math.MaxInt64, nil
+	}
+	return t.MaxItems, nil
+}
+
+func (t *TopicConfig) Lease() (time.Duration, Error) {
+	return time.Duration(t.LeaseMs) * time.Millisecond, nil
+}
+
+func (t *TopicConfig) CheckUser(user, pass string) (authenticated, authorized bool, err Error) {
+	logPrefix := "TopicConfig::CheckUser"
+
+	creds, authErr := cbauth.Auth(user, pass)
+	if authErr != nil || creds == nil {
+		logging.Debugf("%s topic: %s failed to authenticate user: %ru, err: %v", logPrefix, t.Name, user, authErr)
+		return false, false, nil
+	}
+
+	allowed, authErr := creds.IsAllowed(topicPermission)
+	if authErr != nil {
+		return true, false, newError(StoreFailure, "topic: %s failed to check permissions, err: %v", t.Name, authErr)
+	}
+	return true, allowed, nil
+}
+
+func (t *TopicConfig) ephemeral() bool {
+	return t.QoSName == QoSEphemeral
+}
+
+func (t *TopicConfig) lease() time.Duration {
+	return time.Duration(t.LeaseMs) * time.Millisecond
+}
+
+// Validate checks the definition and fills in defaults for unset fields
+func (t *TopicConfig) Validate() error {
+	if t.Name == "" || len(t.Name) > maxTopicNameLength || !topicNameRegex.MatchString(t.Name) {
+		return fmt.Errorf("topic name must be 1 to %d characters of letters, digits, '_' and '-', starting with a letter or digit",
+			maxTopicNameLength)
+	}
+
+	if t.MetadataBucket == "" {
+		return fmt.Errorf("metadata_bucket must be specified")
+	}
+
+	switch t.QoSName {
+	case "":
+		t.QoSName = QoSPersistent
+	case QoSEphemeral, QoSPersistent:
+	default:
+		return fmt.Errorf("qos must be either %s or %s", QoSEphemeral, QoSPersistent)
+	}
+
+	if t.MaxItems > math.MaxInt64 {
+		return fmt.Errorf("capacity must be at most %d", int64(math.MaxInt64))
+	}
+
+	if t.LeaseMs == 0 {
+		t.LeaseMs = DefaultLeaseMs
+	}
+	if t.LeaseMs < MinLeaseMs || t.LeaseMs > MaxLeaseMs {
+		return fmt.Errorf("lease_ms must be between %d and %d", MinLeaseMs, MaxLeaseMs)
+	}
+	return nil
+}
+
+// GetTopic reads a topic definition from metakv, TopicNotFound is returned if it doesn't exist
+func GetTopic(topic string) (*TopicConfig, Error) {
+	data, _, err := metakv.Get(MetakvTopicsPath + topic)
+	if err != nil {
+		return nil, newError(StoreFailure, "failed to read definition of topic: %s, err: %v", topic, err)
+	}
+	if data == nil {
+		return nil, newError(TopicNotFound, "topic: %s", topic)
+	}
+
+	def := &TopicConfig{}
+	if err = json.Unmarshal(data, def); err != nil {
+		return nil, newError(StoreFailure, "failed to unmarshal definition of topic: %s, err: %v", topic, err)
+	}
+	return def, nil
+}
+
+// SaveTopic creates or updates a topic definition in metakv
+func SaveTopic(def *TopicConfig) error {
+	data, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	return util.MetakvSet(MetakvTopicsPath+def.Name, data, nil)
+}
+
+// ListTopics returns definitions of all topics stored in metakv
+func ListTopics() ([]*TopicConfig, error) {
+	logPrefix := "notification::ListTopics"
+
+	entries, err := metakv.ListAllChildren(MetakvTopicsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make([]*TopicConfig, 0, len(entries))
+	for _, entry := range entries {
+		def := &TopicConfig{}
+		if err := json.Unmarshal(entry.Value, def); err != nil {
+			logging.Errorf("%s Failed to unmarshal topic definition at path: %s, err: %v", logPrefix, entry.Path, err)
+			continue
+		}
+		topics = append(topics, def)
+	}
+	return topics, nil
+}
+
+// DeleteTopic removes the topic definition. Notifications left in the metadata bucket
+// are purged by the caller through the manager.
+func DeleteTopic(topic string) error {
+	return util.MetaKvDelete(MetakvTopicsPath+topic, nil)
+}
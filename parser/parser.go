@@ -45,7 +45,7 @@ var function_name = regexp.MustCompile(
 	`^function[[:space:]]+([A-Za-z]+)[[:space:]]*\(`)
 
 var requiredFunctions = map[string]struct{}{"OnUpdate": struct{}{},
-	"OnDelete": struct{}{}}
+	"OnUpdateBatch": struct{}{}, "OnDelete": struct{}{}}
 
 func cleanse(str string) string {
 	washed := []byte(str)
@@ -256,7 +256,7 @@ func (parsed *ParsedStatements) ValidateExports() (bool, error) {
 			}
 		}
 	}
-	msg := fmt.Sprintf("Handler code is missing OnUpdate() and OnDelete() functions. At least one of them is needed to deploy the handler")
+	msg := fmt.Sprintf("Handler code is missing OnUpdate(), OnUpdateBatch() and OnDelete() functions. At least one of them is needed to deploy the handler")
 	return false, errors.New(msg)
 }
 
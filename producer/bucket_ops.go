@@ -69,7 +69,7 @@ var cleanupMetadataCallback = func(args ...interface{}) error {
 		return err
 	}
 
-	*dcpFeed, err = (*b).StartDcpFeedOver(feedName, uint32(0), 0, kvNodeAddrs, 0xABCD, p.dcpConfig)
+	*dcpFeed, err = (*b).StartDcpFeedOver(feedName, uint32(0), 0, kvNodeAddrs, 0xABCD, p.metadataDcpConfig())
 	if err != nil {
 		logging.Errorf("%s [%s:%d] Failed to start dcp feed for bucket: %s, err: %v",
 			logPrefix, p.appName, p.LenRunningConsumers(), p.metadatabucket, err)
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync/atomic"
 	"unsafe"
 
@@ -100,6 +101,66 @@ var getEventingNodesAddressesOpCallback = func(args ...interface{}) error {
 
 }
 
+var getPlacementTopologyOpCallback = func(args ...interface{}) error {
+	logPrefix := "Producer::getPlacementTopologyOpCallback"
+
+	p := args[0].(*Producer)
+	bucketName := args[1].(string)
+	topology := args[2].(**util.PlacementTopology)
+
+	hostAddress := net.JoinHostPort(util.Localhost(), p.nsServerPort)
+
+	var err error
+	*topology, err = util.FetchPlacementTopology(hostAddress, bucketName)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to get topology for vbucket placement, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return err
+	}
+
+	return nil
+}
+
+var getPlacementRoundCallback = func(args ...interface{}) error {
+	logPrefix := "Producer::getPlacementRoundCallback"
+
+	p := args[0].(*Producer)
+	round := args[1].(*string)
+
+	// Old rebalance tokens are purged when a rebalance starts, which leaves the current one
+	tokens, err := util.MetakvLeafNames(metakvRebalanceTokenPath)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to list rebalance tokens from metakv, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return err
+	}
+
+	*round = p.app.FunctionInstanceID + ":" + strings.Join(tokens, ",")
+	return nil
+}
+
+var getPlacementPlanCallback = func(args ...interface{}) error {
+	logPrefix := "Producer::getPlacementPlanCallback"
+
+	p := args[0].(*Producer)
+	round := args[1].(string)
+	plan := args[2].(*placementPlan)
+
+	found, err := p.readPlacementPlan(round, plan)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to read placement plan from metakv, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return err
+	}
+	if !found {
+		logging.Infof("%s [%s:%d] Waiting for placement plan of round: %s",
+			logPrefix, p.appName, p.LenRunningConsumers(), round)
+		return fmt.Errorf("placement plan of round: %s not published yet", round)
+	}
+
+	return nil
+}
+
 var getHTTPServiceAuth = func(args ...interface{}) error {
 	logPrefix := "Producer::getHTTPServiceAuth"
 
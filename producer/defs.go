@@ -17,11 +17,22 @@ const (
 	metakvAppSettingsPath = metakvEventingPath + "appsettings/"
 	metakvConfigKeepNodes = metakvEventingPath + "config/keepNodes" // Store list of eventing keepNodes
 	metakvChecksumPath    = metakvEventingPath + "checksum/"
+
+	// Checkpoint snapshots replayed with the from_checkpoint_snapshot stream boundary
+	metakvCheckpointSnapshotsPath = metakvEventingPath + "checkpointSnapshots/"
+
+	metakvRebalanceTokenPath = metakvEventingPath + "rebalanceToken/"
+
+	// Vbucket placement of each function, planned by one eventing node for all of them
+	metakvPlacementPlansPath = metakvEventingPath + "placementPlans/"
 )
 
 const (
 	bucketOpRetryInterval = time.Duration(1000) * time.Millisecond
 
+	// Time a node waits for the placement plan of a round, before it falls back to even placement
+	placementPlanWaitTimeout = time.Duration(30) * time.Second
+
 	udsSockPathLimit = 100
 
 	dataService = "kv"
@@ -176,6 +187,15 @@ type vbNodeWorkerMapping struct {
 	assignedWorker string
 }
 
+// placementPlan is the vbucket placement of a function published to metakv. Round names the
+// deploy and the rebalance it was planned for
+type placementPlan struct {
+	Round     string            `json:"round"`
+	Strategy  string            `json:"strategy"`
+	NodeAddrs []string          `json:"node_addrs"`
+	AssignMap map[uint16]string `json:"assign_map"`
+}
+
 type acceptedConn struct {
 	conn net.Conn
 	err  error
@@ -65,6 +65,9 @@ func (p *Producer) parseDepcfg() error {
 	p.auth = fmt.Sprintf("%s:%s", user, password)
 
 	p.handlerConfig.SourceBucket = string(depcfg.SourceBucket())
+	p.handlerConfig.SourceKeyspace = common.NewKeyspace(p.handlerConfig.SourceBucket,
+		string(depcfg.SourceScope()), string(depcfg.SourceCollection()))
+	p.handlerConfig.DeadLetterBucket = string(depcfg.DeadLetterBucket())
 	p.cfgData = string(cfgData)
 	p.metadatabucket = string(depcfg.MetadataBucket())
 
@@ -121,6 +124,36 @@ func (p *Producer) parseDepcfg() error {
 		p.handlerConfig.CleanupTimers = false
 	}
 
+	if val, ok := settings["ordering"]; ok {
+		p.handlerConfig.Ordering = val.(string)
+	} else {
+		p.handlerConfig.Ordering = "none"
+	}
+
+	if val, ok := settings["placement_strategy"]; ok {
+		p.handlerConfig.PlacementStrategy = val.(string)
+	} else {
+		p.handlerConfig.PlacementStrategy = util.PlacementEven
+	}
+
+	if val, ok := settings["idempotency_journal"]; ok {
+		p.handlerConfig.IdempotencyJournal = val.(bool)
+	} else {
+		p.handlerConfig.IdempotencyJournal = false
+	}
+
+	if val, ok := settings["shadow_copy"]; ok {
+		p.handlerConfig.ShadowCopy = val.(bool)
+	} else {
+		p.handlerConfig.ShadowCopy = false
+	}
+
+	if val, ok := settings["coalesce_window_ms"]; ok {
+		p.handlerConfig.CoalesceWindow = int(val.(float64))
+	} else {
+		p.handlerConfig.CoalesceWindow = 0
+	}
+
 	if val, ok := settings["cpp_worker_thread_count"]; ok {
 		p.handlerConfig.CPPWorkerThrCount = int(val.(float64))
 	} else {
@@ -133,12 +166,48 @@ func (p *Producer) parseDepcfg() error {
 		p.handlerConfig.StreamBoundary = common.DcpStreamBoundary("everything")
 	}
 
+	p.handlerConfig.StreamSeqNos = nil
+	switch p.handlerConfig.StreamBoundary {
+	case common.DcpFromSeqnos:
+		seqNos, err := common.ParseStreamSeqNos(settings["dcp_stream_seqnos"])
+		if err != nil {
+			logging.Errorf("%s [%s] Failed to parse dcp_stream_seqnos, err: %v", logPrefix, p.appName, err)
+		} else {
+			p.handlerConfig.StreamSeqNos = seqNos
+		}
+
+	case common.DcpFromCheckpointSnapshot:
+		data, err := util.MetakvGet(metakvCheckpointSnapshotsPath + p.appName)
+		if err != nil || data == nil {
+			logging.Errorf("%s [%s] Failed to read checkpoint snapshot, err: %v", logPrefix, p.appName, err)
+			break
+		}
+
+		var snapshot common.CheckpointSnapshot
+		if err = json.Unmarshal(data, &snapshot); err != nil {
+			logging.Errorf("%s [%s] Failed to unmarshal checkpoint snapshot, err: %v", logPrefix, p.appName, err)
+		} else {
+			p.handlerConfig.StreamSeqNos = snapshot.SeqNos
+		}
+	}
+
 	if val, ok := settings["deadline_timeout"]; ok {
 		p.handlerConfig.SocketTimeout = int(val.(float64))
 	} else {
 		p.handlerConfig.SocketTimeout = 62
 	}
 
+	if val, ok := settings["event_filter"]; ok {
+		filter, err := common.ParseEventFilter(val)
+		if err != nil {
+			logging.Errorf("%s [%s] Failed to parse event_filter, err: %v", logPrefix, p.appName, err)
+		} else {
+			p.handlerConfig.EventFilter = filter
+		}
+	} else {
+		p.handlerConfig.EventFilter = nil
+	}
+
 	if val, ok := settings["execution_timeout"]; ok {
 		p.handlerConfig.ExecutionTimeout = int(val.(float64))
 	} else {
@@ -282,6 +351,18 @@ func (p *Producer) parseDepcfg() error {
 		p.handlerConfig.TimerQueueSize = 10000
 	}
 
+	if val, ok := settings["update_batch_size"]; ok {
+		p.handlerConfig.UpdateBatchSize = int(val.(float64))
+	} else {
+		p.handlerConfig.UpdateBatchSize = 0
+	}
+
+	if val, ok := settings["update_batch_window_ms"]; ok {
+		p.handlerConfig.UpdateBatchWindow = int(val.(float64))
+	} else {
+		p.handlerConfig.UpdateBatchWindow = 100
+	}
+
 	if val, ok := settings["undeploy_routine_count"]; ok {
 		p.handlerConfig.UndeployRoutineCount = int(val.(float64))
 	} else {
@@ -352,6 +433,12 @@ func (p *Producer) parseDepcfg() error {
 		p.dcpConfig["dataChanSize"] = 50
 	}
 
+	if val, ok := settings["dcp_connection_buffer_size"]; ok {
+		p.dcpConfig["connectionBufferSize"] = uint32(val.(float64)) * 1024 * 1024
+	} else {
+		p.dcpConfig["connectionBufferSize"] = uint32(20 * 1024 * 1024)
+	}
+
 	p.dcpConfig["latencyTick"] = p.handlerConfig.StatsLogInterval
 
 	if val, ok := settings["dcp_gen_chan_size"]; ok {
@@ -366,6 +453,18 @@ func (p *Producer) parseDepcfg() error {
 		p.dcpConfig["numConnections"] = 1
 	}
 
+	if val, ok := settings["dcp_compression"]; ok {
+		p.dcpConfig["compression"] = val.(bool)
+	} else {
+		p.dcpConfig["compression"] = false
+	}
+
+	if val, ok := settings["dcp_compression_passthrough"]; ok {
+		p.handlerConfig.CompressionPassthrough = val.(bool)
+	} else {
+		p.handlerConfig.CompressionPassthrough = false
+	}
+
 	p.dcpConfig["activeVbOnly"] = true
 	p.app.Settings = settings
 
@@ -395,9 +494,37 @@ func (p *Producer) parseDepcfg() error {
 
 	logging.Infof("%s [%s] kv nodes from cinfo: %+v", logPrefix, p.appName, p.kvHostPorts)
 
+	// Streams of the default collection carry the items of collection unaware clients
+	if !p.handlerConfig.SourceKeyspace.IsDefaultCollection() {
+		cid, err := util.CollectionID(p.nsServerHostPort, p.handlerConfig.SourceKeyspace)
+		if err != nil {
+			logging.Errorf("%s [%s] Failed to get id of source collection %s, err: %v",
+				logPrefix, p.appName, p.handlerConfig.SourceKeyspace, err)
+			return err
+		}
+		p.dcpConfig["collectionID"] = cid
+
+		logging.Infof("%s [%s] source collection %s id: %x",
+			logPrefix, p.appName, p.handlerConfig.SourceKeyspace, cid)
+	} else {
+		delete(p.dcpConfig, "collectionID")
+	}
+
 	return nil
 }
 
+// metadataDcpConfig returns the dcp config of the source bucket less its collection filter, for
+// streaming the metadata bucket
+func (p *Producer) metadataDcpConfig() map[string]interface{} {
+	config := make(map[string]interface{}, len(p.dcpConfig))
+	for key, val := range p.dcpConfig {
+		if key != "collectionID" {
+			config[key] = val
+		}
+	}
+	return config
+}
+
 func (p *Producer) consumerMemQuota() int64 {
 	wc := int64(p.handlerConfig.WorkerCount)
 	if wc > 0 {
@@ -328,6 +328,17 @@ func (p *Producer) GetEventingConsumerPids() map[string]int {
 	return workerPidMapping
 }
 
+// DcpFeedStats returns the stats of the DCP connections of all consumers
+func (p *Producer) DcpFeedStats() map[string]interface{} {
+	feedStats := make(map[string]interface{})
+
+	for _, consumer := range p.getConsumers() {
+		feedStats[consumer.ConsumerName()] = consumer.DcpFeedStats()
+	}
+
+	return feedStats
+}
+
 // Last ditch effort to kill all consumers
 func (p *Producer) KillAllConsumers() {
 	for _, consumer := range p.getConsumers() {
@@ -971,6 +982,14 @@ func (p *Producer) RemoveConsumerToken(workerName string) {
 	}
 }
 
+// ReplayDeadLetters hands dead letter entries to all running consumers, each of them
+// replays the entries belonging to vbuckets it currently owns
+func (p *Producer) ReplayDeadLetters(entries []*common.DeadLetterEntry) {
+	for _, c := range p.getConsumers() {
+		c.ReplayDeadLetters(entries)
+	}
+}
+
 func (p *Producer) stopAndDeleteConsumer(c common.EventingConsumer) {
 	p.tokenRWMutex.RLock()
 	token := p.consumerSupervisorTokenMap[c]
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"reflect"
 	"sort"
 	"time"
 
@@ -69,15 +70,7 @@ func (p *Producer) vbEventingNodeAssign(bucketName string) error {
 		return err
 	}
 
-	p.vbEventingNodeAssignRWMutex.Lock()
-	defer p.vbEventingNodeAssignRWMutex.Unlock()
-	p.vbEventingNodeAssignMap = make(map[uint16]string)
-
-	if len(keepNodes) > 0 {
-		logging.Infof("%s [%s:%d] Updating Eventing keepNodes uuids. Previous: %v current: %v",
-			logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, keepNodes)
-		p.eventingNodeUUIDs = append([]string(nil), keepNodes...)
-	} else {
+	if len(keepNodes) == 0 {
 		logging.Errorf("%s [%s:%d] KeepNodes is empty: %v",
 			logPrefix, p.appName, p.LenRunningConsumers(), keepNodes)
 		return fmt.Errorf("KeepNodes is empty")
@@ -85,65 +78,177 @@ func (p *Producer) vbEventingNodeAssign(bucketName string) error {
 
 	// Only includes nodes that supposed to be part of cluster post StartTopologyChange call
 	eventingNodeAddrs := make([]string, 0)
-	for _, uuid := range p.eventingNodeUUIDs {
+	for _, uuid := range keepNodes {
 		eventingNodeAddrs = append(eventingNodeAddrs, addrUUIDMap[uuid])
 	}
 	sort.Strings(eventingNodeAddrs)
 
+	assignMap, eventingNodeAddrs, err := p.planVbPlacement(bucketName, keepNodes, eventingNodeAddrs)
+	if err != nil {
+		return err
+	}
+
+	p.vbEventingNodeAssignRWMutex.Lock()
+	defer p.vbEventingNodeAssignRWMutex.Unlock()
+
+	logging.Infof("%s [%s:%d] Updating Eventing keepNodes uuids. Previous: %v current: %v",
+		logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, keepNodes)
+	p.eventingNodeUUIDs = append([]string(nil), keepNodes...)
+
 	logging.Infof("%s [%s:%d] EventingNodeUUIDs: %v eventingNodeAddrs: %rs",
 		logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, eventingNodeAddrs)
 
-	vbucketsPerNode := p.numVbuckets / len(eventingNodeAddrs)
-	var vbNo int
-	var startVb uint16
+	p.vbEventingNodeAssignMap = assignMap
+
+	p.plannerNodeMappingsRWMutex.Lock()
+	defer p.plannerNodeMappingsRWMutex.Unlock()
+	p.plannerNodeMappings = util.PlannerNodeVbMappings(p.vbEventingNodeAssignMap, eventingNodeAddrs)
 
-	vbCountPerNode := make([]int, len(eventingNodeAddrs))
-	for i := 0; i < len(eventingNodeAddrs); i++ {
-		vbCountPerNode[i] = vbucketsPerNode
-		vbNo += vbucketsPerNode
+	for i, mapping := range p.plannerNodeMappings {
+		logging.Infof("%s [%s:%d] EventingNodeUUIDs: %v Eventing node index: %d eventing node addr: %rs strategy: %s startVb: %v vbs count: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, i, mapping.Hostname,
+			p.handlerConfig.PlacementStrategy, mapping.StartVb, mapping.VbsCount)
 	}
 
-	remainingVbs := p.numVbuckets - vbNo
-	if remainingVbs > 0 {
-		for i := 0; i < remainingVbs; i++ {
-			vbCountPerNode[i] = vbCountPerNode[i] + 1
-		}
+	vbEventingNodeAssignMap := make(map[uint16]string)
+	for vb, node := range p.vbEventingNodeAssignMap {
+		vbEventingNodeAssignMap[vb] = node
 	}
 
-	p.plannerNodeMappingsRWMutex.Lock()
-	defer p.plannerNodeMappingsRWMutex.Unlock()
-	p.plannerNodeMappings = make([]*common.PlannerNodeVbMapping, 0)
+	for _, consumer := range p.getConsumers() {
+		consumer.VbEventingNodeAssignMapUpdate(vbEventingNodeAssignMap)
+	}
+
+	return nil
+}
+
+// planVbPlacement assigns vbuckets to eventing nodes. Strategies other than even read the cluster
+// topology, which nodes could see at different points of a rebalance. So the first of the
+// keepNodes plans for all of them, and the others wait for its plan in metakv. A node that waits
+// longer than placementPlanWaitTimeout publishes an even plan for the round instead, which the
+// first of the keepNodes keeps if it comes up later. Returns the addresses of the nodes the
+// placement was planned for
+func (p *Producer) planVbPlacement(bucketName string, keepNodes, eventingNodeAddrs []string) (map[uint16]string, []string, error) {
+	logPrefix := "Producer::planVbPlacement"
+
+	strategy := p.handlerConfig.PlacementStrategy
+
+	// Cleanup of the metadata bucket only needs the nodes to agree, which even placement does
+	if strategy == util.PlacementEven || bucketName != p.handlerConfig.SourceBucket {
+		return util.PlanVbPlacement(util.PlacementEven, p.numVbuckets, eventingNodeAddrs, nil), eventingNodeAddrs, nil
+	}
+
+	var round string
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, getPlacementRoundCallback, p, &round)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+		return nil, nil, err
+	}
 
-	for i, v := range vbCountPerNode {
+	var plan placementPlan
+	leader := append([]string(nil), keepNodes...)
+	sort.Strings(leader)
 
-		logging.Infof("%s [%s:%d] EventingNodeUUIDs: %v Eventing node index: %d eventing node addr: %rs startVb: %v vbs count: %v",
-			logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, i, eventingNodeAddrs[i], startVb, v)
+	if leader[0] != p.uuid {
+		backoff := util.NewExponentialBackoff()
+		backoff.MaxElapsedTime = placementPlanWaitTimeout
 
-		nodeMapping := &common.PlannerNodeVbMapping{
-			Hostname: eventingNodeAddrs[i],
-			StartVb:  int(startVb),
-			VbsCount: v,
+		err = util.Retry(backoff, &p.retryCount, getPlacementPlanCallback, p, round, &plan)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+			return nil, nil, err
 		}
-		p.plannerNodeMappings = append(p.plannerNodeMappings, nodeMapping)
 
-		for j := 0; j < v; j++ {
-			p.vbEventingNodeAssignMap[startVb] = eventingNodeAddrs[i]
-			startVb++
+		if err != nil {
+			logging.Warnf("%s [%s:%d] No placement plan of round: %s published by: %s in %v, falling back to even placement",
+				logPrefix, p.appName, p.LenRunningConsumers(), round, leader[0], placementPlanWaitTimeout)
+
+			plan = placementPlan{
+				Round:     round,
+				Strategy:  strategy,
+				NodeAddrs: eventingNodeAddrs,
+				AssignMap: util.PlanVbPlacement(util.PlacementEven, p.numVbuckets, eventingNodeAddrs, nil),
+			}
+			if err = p.publishPlacementPlan(&plan); err != nil {
+				return nil, nil, err
+			}
+			return plan.AssignMap, plan.NodeAddrs, nil
+		}
+
+		if !reflect.DeepEqual(plan.NodeAddrs, eventingNodeAddrs) {
+			logging.Warnf("%s [%s:%d] Applying placement plan of round: %s made for nodes: %rs, local view: %rs",
+				logPrefix, p.appName, p.LenRunningConsumers(), round, plan.NodeAddrs, eventingNodeAddrs)
 		}
+		return plan.AssignMap, plan.NodeAddrs, nil
 	}
 
-	vbEventingNodeAssignMap := make(map[uint16]string)
-	for vb, node := range p.vbEventingNodeAssignMap {
-		vbEventingNodeAssignMap[vb] = node
+	// Other nodes may have applied a plan published earlier in the round, so it's kept
+	found, err := p.readPlacementPlan(round, &plan)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to read placement plan from metakv, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return nil, nil, err
+	}
+	if found {
+		return plan.AssignMap, plan.NodeAddrs, nil
 	}
 
-	for _, consumer := range p.getConsumers() {
-		consumer.VbEventingNodeAssignMapUpdate(vbEventingNodeAssignMap)
+	var topology *util.PlacementTopology
+	err = util.Retry(util.NewFixedBackoff(time.Second), &p.retryCount, getPlacementTopologyOpCallback, p, bucketName, &topology)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+		return nil, nil, err
+	}
+
+	plan = placementPlan{
+		Round:     round,
+		Strategy:  strategy,
+		NodeAddrs: eventingNodeAddrs,
+		AssignMap: util.PlanVbPlacement(strategy, p.numVbuckets, eventingNodeAddrs, topology),
+	}
+
+	if err = p.publishPlacementPlan(&plan); err != nil {
+		return nil, nil, err
+	}
+	return plan.AssignMap, plan.NodeAddrs, nil
+}
+
+// publishPlacementPlan shares the plan of a round of placement with the other eventing nodes
+func (p *Producer) publishPlacementPlan(plan *placementPlan) error {
+	logPrefix := "Producer::publishPlacementPlan"
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to marshal placement plan, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return err
+	}
+
+	err = util.MetakvSet(metakvPlacementPlansPath+p.appName, data, nil)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to publish placement plan to metakv, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return err
 	}
 
+	logging.Infof("%s [%s:%d] Published placement plan of round: %s strategy: %s",
+		logPrefix, p.appName, p.LenRunningConsumers(), plan.Round, plan.Strategy)
 	return nil
 }
 
+// readPlacementPlan looks up the plan published for a round of placement
+func (p *Producer) readPlacementPlan(round string, plan *placementPlan) (bool, error) {
+	data, err := util.MetakvGet(metakvPlacementPlansPath + p.appName)
+	if err != nil || len(data) == 0 {
+		return false, err
+	}
+
+	if err = json.Unmarshal(data, plan); err != nil {
+		return false, err
+	}
+	return plan.Round == round && plan.Strategy == p.handlerConfig.PlacementStrategy, nil
+}
+
 func (p *Producer) vbNodeWorkerMap() {
 	logPrefix := "Producer::vbNodeWorkerMap"
 
@@ -257,6 +257,22 @@ func (bg *bucketMultiDiGraph) removeEdges(label string) {
 		logPrefix, bg.adjacenyList, bg.inDegreeLabels, bg.outDegreeLabels)
 }
 
+// Returns a copy of the graph, used to try out several inserts without affecting the graph
+func (bg *bucketMultiDiGraph) clone() *bucketMultiDiGraph {
+	bg.lock.RLock()
+	labelState := make(map[string]dependency, len(bg.labelState))
+	for label, state := range bg.labelState {
+		labelState[label] = state
+	}
+	bg.lock.RUnlock()
+
+	graph := newBucketMultiDiGraph()
+	for label, state := range labelState {
+		graph.insertEdges(label, state.source, state.destination)
+	}
+	return graph
+}
+
 func (bg *bucketMultiDiGraph) isAcyclicInsertPossible(label, source string, destinations map[string]struct{}) (possible bool, labels []string) {
 	logPrefix := "isAcyclicInsertPossible"
 	bg.lock.Lock()
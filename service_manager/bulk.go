@@ -0,0 +1,403 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/parser"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	bulkDeploy   = "deploy"
+	bulkUndeploy = "undeploy"
+	bulkPause    = "pause"
+	bulkResume   = "resume"
+
+	// Function name taken by the bulk endpoints under /api/v1/functions/
+	bulkReservedName = "bulk"
+
+	// Rolling back a function waits for it to finish bootstrapping, as settings can't be
+	// changed meanwhile
+	bulkRollbackPollInterval = time.Duration(1) * time.Second
+	bulkRollbackTimeout      = time.Duration(30) * time.Minute
+)
+
+type bulkRequest struct {
+	Names          []string `json:"names"`
+	Pattern        string   `json:"pattern"`
+	AbortOnFailure bool     `json:"abort_on_failure"`
+}
+
+type bulkResult struct {
+	Name string `json:"name"`
+	runtimeInfo
+}
+
+// Settings applied by the single function endpoint of the operation
+func bulkSettings(op string) map[string]interface{} {
+	settings := make(map[string]interface{})
+	switch op {
+	case bulkDeploy:
+		settings["deployment_status"] = true
+		settings["processing_status"] = true
+	case bulkUndeploy:
+		settings["deployment_status"] = false
+		settings["processing_status"] = false
+	case bulkPause:
+		settings["deployment_status"] = true
+		settings["processing_status"] = false
+		settings["dcp_stream_boundary"] = "everything"
+	case bulkResume:
+		settings["deployment_status"] = true
+		settings["processing_status"] = true
+		settings["dcp_stream_boundary"] = "from_prior"
+	}
+	return settings
+}
+
+// Operation that undoes op, empty if op can't be undone
+func bulkInverse(op string) string {
+	switch op {
+	case bulkDeploy:
+		return bulkUndeploy
+	case bulkPause:
+		return bulkResume
+	case bulkResume:
+		return bulkPause
+	}
+	return ""
+}
+
+// Returns the functions named in the request followed by those matching its pattern
+func (m *ServiceMgr) resolveBulkNames(req *bulkRequest) (names []string, info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	if len(req.Names) == 0 && req.Pattern == "" {
+		info.Info = "Either names or pattern should be specified"
+		return
+	}
+
+	seen := make(map[string]struct{})
+	for _, name := range req.Names {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+
+	if req.Pattern != "" {
+		if _, err := path.Match(req.Pattern, ""); err != nil {
+			info.Info = fmt.Sprintf("Invalid pattern: %s, err: %v", req.Pattern, err)
+			return
+		}
+
+		matched := make([]string, 0)
+		m.fnMu.RLock()
+		for name := range m.fnsInTempStore {
+			if ok, _ := path.Match(req.Pattern, name); ok {
+				if _, ok := seen[name]; !ok {
+					seen[name] = struct{}{}
+					matched = append(matched, name)
+				}
+			}
+		}
+		m.fnMu.RUnlock()
+
+		sort.Strings(matched)
+		names = append(names, matched...)
+	}
+
+	if len(names) == 0 {
+		info.Info = fmt.Sprintf("No function matches pattern: %s", req.Pattern)
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// Checks that the operation is allowed on the function in its current state
+func (m *ServiceMgr) validateBulkState(op, appName string) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	state := m.superSup.GetAppState(appName)
+
+	switch op {
+	case bulkDeploy:
+		if state != common.AppStateUndeployed {
+			info.Code = m.statusCodes.errAppDeployed.Code
+			info.Info = fmt.Sprintf("Function: %s is already deployed", appName)
+			return
+		}
+	case bulkUndeploy:
+		if state != common.AppStateEnabled && state != common.AppStatePaused {
+			info.Code = m.statusCodes.errAppNotDeployed.Code
+			info.Info = fmt.Sprintf("Function: %s is not deployed", appName)
+			return
+		}
+	case bulkPause:
+		if state != common.AppStateEnabled {
+			info.Code = m.statusCodes.errAppNotInit.Code
+			info.Info = fmt.Sprintf("Function: %s not processing mutations. Operation is not permitted", appName)
+			return
+		}
+	case bulkResume:
+		if state != common.AppStatePaused {
+			info.Code = m.statusCodes.errInvalidConfig.Code
+			info.Info = fmt.Sprintf("Function: %s is not paused, current state: %v", appName, state)
+			return
+		}
+	}
+
+	if op != bulkUndeploy {
+		if m.isBootstrapping(appName) {
+			info.Code = m.statusCodes.errAppNotInit.Code
+			info.Info = fmt.Sprintf("Function: %s is undergoing bootstrap", appName)
+			return
+		}
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// isBootstrapping tells whether the function is bootstrapping on any node, assuming it is
+// when its status can't be found
+func (m *ServiceMgr) isBootstrapping(appName string) bool {
+	logPrefix := "ServiceMgr::isBootstrapping"
+
+	status, err := util.GetAggBootstrapAppStatus(net.JoinHostPort(util.Localhost(), m.adminHTTPPort), appName)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to find bootstrap status, err: %v", logPrefix, appName, err)
+		return true
+	}
+	return status
+}
+
+// validateBulkOp checks every function of the batch before any of them is changed. Besides
+// the checks done for each function against the deployed ones, functions deployed or resumed
+// together must not form a cycle between themselves.
+func (m *ServiceMgr) validateBulkOp(op string, names []string) ([]*bulkResult, bool) {
+	results := make([]*bulkResult, 0, len(names))
+	valid := true
+
+	var allowInterBucketRecursion bool
+	if config, info := m.getConfig(); info.Code == m.statusCodes.ok.Code {
+		if flag, ok := config["allow_interbucket_recursion"].(bool); ok {
+			allowInterBucketRecursion = flag
+		}
+	}
+	graph := m.graph.clone()
+
+	for _, name := range names {
+		result := &bulkResult{Name: name}
+		results = append(results, result)
+
+		app, info := m.getTempStore(name)
+		if info.Code == m.statusCodes.ok.Code {
+			info = m.validateBulkState(op, name)
+		}
+
+		if info.Code == m.statusCodes.ok.Code && (op == bulkDeploy || op == bulkResume) {
+			info = m.validateAppRecursion(&app)
+			if info.Code == m.statusCodes.ok.Code && !allowInterBucketRecursion {
+				source, destinations := m.getSourceAndDestinationsFromDepCfg(&app.DeploymentConfig)
+				_, pinfos := parser.TranspileQueries(app.AppHandlers, "")
+				for _, pinfo := range pinfos {
+					destinations[pinfo.PInfo.KeyspaceName] = struct{}{}
+				}
+
+				if possible, cycle := graph.isAcyclicInsertPossible(name, source, destinations); !possible {
+					info.Code = m.statusCodes.errInterBucketRecursion.Code
+					info.Info = fmt.Sprintf("Inter bucket recursion error; function: %s causes a cycle "+
+						"involving functions: %v in the batch, hence deployment is disallowed", name, cycle)
+				} else {
+					graph.insertEdges(name, source, destinations)
+				}
+			}
+		}
+
+		if info.Code != m.statusCodes.ok.Code {
+			valid = false
+		}
+		result.runtimeInfo = *info
+	}
+
+	if !valid {
+		for _, result := range results {
+			if result.Code == m.statusCodes.ok.Code {
+				result.Code = m.statusCodes.errBulkOpAborted.Code
+				result.Info = "Not applied as other functions in the batch failed validation"
+			}
+		}
+	}
+	return results, valid
+}
+
+// bulkOp validates the whole batch up front and then applies the operation to each function
+// in order. With abortOnFailure the batch is applied as a group: functions after the first
+// failure are left untouched and the ones already changed are changed back, except for
+// undeploy which can't be undone. Otherwise the rest of the batch is still applied.
+func (m *ServiceMgr) bulkOp(op string, req *bulkRequest, author revisionAuthor) ([]*bulkResult, *runtimeInfo) {
+	logPrefix := "ServiceMgr::bulkOp"
+
+	names, info := m.resolveBulkNames(req)
+	if info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	if op != bulkUndeploy {
+		var isMixedMode bool
+		if isMixedMode, info = m.isMixedModeCluster(); info.Code != m.statusCodes.ok.Code {
+			return nil, info
+		}
+
+		if isMixedMode {
+			info.Code = m.statusCodes.errMixedMode.Code
+			info.Info = "Life-cycle operations except delete and undeploy are not allowed in a mixed mode cluster"
+			return nil, info
+		}
+	}
+
+	if info = m.checkLifeCycleOpsDuringRebalance(); info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	results, valid := m.validateBulkOp(op, names)
+	if !valid {
+		logging.Errorf("%s Operation: %s on functions: %v failed validation", logPrefix, op, names)
+		return results, info
+	}
+
+	data, err := json.Marshal(bulkSettings(op))
+	if err != nil {
+		info.Code = m.statusCodes.errMarshalResp.Code
+		info.Info = fmt.Sprintf("failed to marshal function settings, err : %v", err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	var failed *bulkResult
+	applied := make([]*bulkResult, 0, len(results))
+	for _, result := range results {
+		if failed != nil && req.AbortOnFailure {
+			result.Code = m.statusCodes.errBulkOpAborted.Code
+			result.Info = "Skipped as an earlier function in the batch failed"
+			continue
+		}
+
+		result.runtimeInfo = *m.setSettings(result.Name, data, author)
+		if result.Code != m.statusCodes.ok.Code {
+			failed = result
+			logging.Errorf("%s Operation: %s on function: %s failed, info: %v", logPrefix, op, result.Name, result.Info)
+			continue
+		}
+		applied = append(applied, result)
+	}
+
+	if failed != nil && req.AbortOnFailure {
+		m.rollbackBulkOp(op, failed.Name, applied, author)
+	}
+
+	logging.Infof("%s Operation: %s applied on functions: %v", logPrefix, op, names)
+	return results, info
+}
+
+// rollbackBulkOp changes the functions already applied back to their state before the batch,
+// in reverse order. Functions that were deployed or resumed bootstrap first, which outlasts
+// the request, so they're changed back in the background once bootstrap is done. Results say
+// that they're being rolled back, the outcome is logged.
+func (m *ServiceMgr) rollbackBulkOp(op, failedName string, applied []*bulkResult, author revisionAuthor) {
+	logPrefix := "ServiceMgr::rollbackBulkOp"
+
+	inverse := bulkInverse(op)
+	if inverse == "" {
+		for _, result := range applied {
+			result.Info = fmt.Sprintf("Applied, %s can't be rolled back after function: %s failed", op, failedName)
+		}
+		return
+	}
+
+	data, err := json.Marshal(bulkSettings(inverse))
+	if err != nil {
+		logging.Errorf("%s failed to marshal function settings, err : %v", logPrefix, err)
+		return
+	}
+
+	names := make([]string, 0, len(applied))
+	for i := len(applied) - 1; i >= 0; i-- {
+		result := applied[i]
+		result.Code = m.statusCodes.errBulkOpAborted.Code
+		result.Info = fmt.Sprintf("Being rolled back as function: %s in the batch failed", failedName)
+		names = append(names, result.Name)
+	}
+
+	go func() {
+		for _, name := range names {
+			if !m.waitForBootstrap(name) {
+				logging.Errorf("%s Operation: %s on function: %s not rolled back, function is still bootstrapping after %v",
+					logPrefix, op, name, bulkRollbackTimeout)
+				continue
+			}
+
+			info := m.setSettings(name, data, author)
+			if info.Code != m.statusCodes.ok.Code {
+				logging.Errorf("%s Operation: %s on function: %s failed to roll back, info: %v", logPrefix, op, name, info.Info)
+				continue
+			}
+			logging.Infof("%s Operation: %s on function: %s rolled back", logPrefix, op, name)
+		}
+	}()
+}
+
+// waitForBootstrap returns once the function is done bootstrapping, or false if it still
+// is after bulkRollbackTimeout
+func (m *ServiceMgr) waitForBootstrap(appName string) bool {
+	ticker := time.NewTicker(bulkRollbackPollInterval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(bulkRollbackTimeout)
+	for m.isBootstrapping(appName) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		<-ticker.C
+	}
+	return true
+}
+
+func (m *ServiceMgr) sendBulkResults(w http.ResponseWriter, results []*bulkResult) {
+	response, err := json.MarshalIndent(results, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(m.getDisposition(m.statusCodes.errMarshalResp.Code))
+		fmt.Fprintf(w, `{"error":"Failed to marshal error info, err: %v"}`, err)
+		return
+	}
+
+	allOK := true
+	allFail := true
+	for _, result := range results {
+		allOK = allOK && (result.Code == m.statusCodes.ok.Code)
+		allFail = allFail && (result.Code != m.statusCodes.ok.Code)
+	}
+
+	if allOK {
+		w.WriteHeader(http.StatusOK)
+	} else if allFail {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+
+	fmt.Fprintf(w, "%s", response)
+}
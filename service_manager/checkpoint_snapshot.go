@@ -0,0 +1,109 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// saveCheckpointSnapshot records the last seq no processed by a deployed function on every
+// vbucket, read from its checkpoint blobs. A later deployment with the from_checkpoint_snapshot
+// stream boundary replays the source bucket from there. Saving again replaces the snapshot.
+func (m *ServiceMgr) saveCheckpointSnapshot(appName string) (*common.CheckpointSnapshot, *runtimeInfo) {
+	logPrefix := "ServiceMgr::saveCheckpointSnapshot"
+
+	info := &runtimeInfo{}
+	if !m.checkIfDeployed(appName) {
+		info.Code = m.statusCodes.errAppNotDeployed.Code
+		info.Info = fmt.Sprintf("Function: %s not deployed", appName)
+		return nil, info
+	}
+
+	dump, err := m.superSup.CheckpointBlobDump(appName)
+	if err != nil {
+		info.Code = m.statusCodes.errAppNotInit.Code
+		info.Info = fmt.Sprintf("Function: %s failed to read checkpoints, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	blobs, _ := dump.(map[string]interface{})
+	snapshot := &common.CheckpointSnapshot{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		SeqNos:    make(map[uint16]uint64),
+	}
+	for vbKey, blob := range blobs {
+		vb, err := strconv.ParseUint(vbKey[strings.LastIndex(vbKey, "::")+2:], 10, 16)
+		if err != nil {
+			continue
+		}
+
+		vbBlob, ok := blob.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if seqNo, ok := vbBlob["last_processed_seq_no"].(float64); ok {
+			snapshot.SeqNos[uint16(vb)] = uint64(seqNo)
+		}
+	}
+
+	if len(snapshot.SeqNos) == 0 {
+		info.Code = m.statusCodes.errAppNotInit.Code
+		info.Info = fmt.Sprintf("Function: %s has no checkpoints yet", appName)
+		return nil, info
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		info.Code = m.statusCodes.errMarshalResp.Code
+		info.Info = fmt.Sprintf("Function: %s failed to marshal checkpoint snapshot, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	if err = util.MetakvSet(metakvSnapshotsPath+appName, data, nil); err != nil {
+		info.Code = m.statusCodes.errSaveConfig.Code
+		info.Info = fmt.Sprintf("Function: %s failed to store checkpoint snapshot, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	logging.Infof("%s Function: %s saved checkpoint snapshot of %d vbuckets", logPrefix, appName, len(snapshot.SeqNos))
+	info.Code = m.statusCodes.ok.Code
+	return snapshot, info
+}
+
+func (m *ServiceMgr) getCheckpointSnapshot(appName string) (*common.CheckpointSnapshot, *runtimeInfo) {
+	info := &runtimeInfo{}
+
+	data, err := util.MetakvGet(metakvSnapshotsPath + appName)
+	if err != nil || data == nil {
+		info.Code = m.statusCodes.errSnapshotNotFound.Code
+		info.Info = fmt.Sprintf("Function: %s has no checkpoint snapshot saved", appName)
+		return nil, info
+	}
+
+	var snapshot common.CheckpointSnapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		info.Code = m.statusCodes.errUnmarshalPld.Code
+		info.Info = fmt.Sprintf("Function: %s failed to unmarshal checkpoint snapshot, err: %v", appName, err)
+		return nil, info
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return &snapshot, info
+}
+
+func (m *ServiceMgr) deleteCheckpointSnapshot(appName string) {
+	logPrefix := "ServiceMgr::deleteCheckpointSnapshot"
+
+	if err := util.MetaKvDelete(metakvSnapshotsPath+appName, nil); err != nil {
+		logging.Errorf("%s Function: %s failed to delete checkpoint snapshot, err: %v", logPrefix, appName, err)
+	}
+}
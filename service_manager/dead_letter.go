@@ -0,0 +1,227 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/couchbase/cbauth/metakv"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/dcp"
+	mcd "github.com/couchbase/eventing/dcp/transport"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	deadLetterDefaultLimit = 100
+	deadLetterMaxLimit     = 1000
+
+	deadLetterReplayTimeout      = 30 * time.Second
+	deadLetterReplayPollInterval = time.Second
+)
+
+func (m *ServiceMgr) connectDeadLetterBucket(appName string) (*couchbase.Bucket, *runtimeInfo) {
+	app, info := m.getTempStore(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	if app.DeploymentConfig.DeadLetter == nil {
+		info.Code = m.statusCodes.errDeadLetterDisabled.Code
+		info.Info = fmt.Sprintf("Function: %s doesn't have a dead letter bucket configured", appName)
+		return nil, info
+	}
+
+	bucketName := app.DeploymentConfig.DeadLetter.BucketName
+	b, err := util.ConnectBucket(net.JoinHostPort(util.Localhost(), m.restPort), "default", bucketName)
+	if err != nil {
+		info.Code = m.statusCodes.errBucketMissing.Code
+		info.Info = fmt.Sprintf("Function: %s failed to connect to dead letter bucket %s, err: %v", appName, bucketName, err)
+		return nil, info
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return b, info
+}
+
+// deadLetterCount returns the id of the latest entry written to the dead letter queue
+func deadLetterCount(b *couchbase.Bucket, appName string) (uint64, error) {
+	data, err := b.GetRaw(common.DeadLetterCounterKey(appName))
+	if err != nil {
+		if mcd.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseUint(string(data), 10, 64)
+}
+
+func fetchDeadLetters(b *couchbase.Bucket, appName string, ids []uint64) ([]*common.DeadLetterEntry, error) {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, common.DeadLetterEntryKey(appName, id))
+	}
+
+	res, err := b.GetBulk(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*common.DeadLetterEntry, 0, len(res))
+	for _, resp := range res {
+		entry := &common.DeadLetterEntry{}
+		if err := json.Unmarshal(resp.Body, entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+func (m *ServiceMgr) getDeadLetters(appName string, start, limit uint64) (*deadLetterList, *runtimeInfo) {
+	logPrefix := "ServiceMgr::getDeadLetters"
+
+	b, info := m.connectDeadLetterBucket(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+	defer b.Close()
+
+	count, err := deadLetterCount(b, appName)
+	if err != nil {
+		info.Code = m.statusCodes.errBucketMissing.Code
+		info.Info = fmt.Sprintf("Function: %s failed to read dead letter counter, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	var ids []uint64
+	for id := start; id <= count && uint64(len(ids)) < limit; id++ {
+		ids = append(ids, id)
+	}
+
+	list := &deadLetterList{Entries: make([]*common.DeadLetterEntry, 0)}
+	if len(ids) > 0 {
+		list.Entries, err = fetchDeadLetters(b, appName, ids)
+		if err != nil {
+			info.Code = m.statusCodes.errBucketMissing.Code
+			info.Info = fmt.Sprintf("Function: %s failed to read dead letter entries, err: %v", appName, err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			return nil, info
+		}
+		if next := ids[len(ids)-1] + 1; next <= count {
+			list.Next = next
+		}
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return list, info
+}
+
+// replayDeadLetters publishes the requested entries to metakv, eventing nodes owning
+// the vbuckets of the entries send them to the handler again. Nodes claim an entry by
+// removing it from the dead letter bucket. Once every entry is claimed, or after
+// deadLetterReplayTimeout, the request is removed from metakv. Entries of vbuckets no
+// consumer owned meanwhile, e.g. during a rebalance, stay in the dead letter bucket and
+// are returned as left, so they can be replayed by another request.
+func (m *ServiceMgr) replayDeadLetters(appName string, ids []uint64) (int, []uint64, *runtimeInfo) {
+	logPrefix := "ServiceMgr::replayDeadLetters"
+
+	info := &runtimeInfo{}
+	if !m.checkIfDeployed(appName) {
+		info.Code = m.statusCodes.errAppNotDeployed.Code
+		info.Info = fmt.Sprintf("Function: %s not deployed", appName)
+		return 0, nil, info
+	}
+
+	if len(ids) == 0 || len(ids) > deadLetterMaxLimit {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Number of dead letter ids to replay should be between 1 and %d", deadLetterMaxLimit)
+		return 0, nil, info
+	}
+
+	b, info := m.connectDeadLetterBucket(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		return 0, nil, info
+	}
+	defer b.Close()
+
+	entries, err := fetchDeadLetters(b, appName, ids)
+	if err != nil {
+		info.Code = m.statusCodes.errBucketMissing.Code
+		info.Info = fmt.Sprintf("Function: %s failed to read dead letter entries, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return 0, nil, info
+	}
+
+	if len(entries) == 0 {
+		info.Code = m.statusCodes.ok.Code
+		return 0, nil, info
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		info.Code = m.statusCodes.errMarshalResp.Code
+		info.Info = fmt.Sprintf("Function: %s failed to marshal dead letter entries, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return 0, nil, info
+	}
+
+	path := common.MetakvDeadLetterReplayPath + appName
+	err = util.MetakvSet(path, data, nil)
+	if err != nil {
+		info.Code = m.statusCodes.errMetakvWriteFailed.Code
+		info.Info = fmt.Sprintf("Function: %s failed to write dead letter replay request to metakv, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return 0, nil, info
+	}
+	_, rev, err := metakv.Get(path)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to read back dead letter replay request, err: %v", logPrefix, appName, err)
+	}
+
+	logging.Infof("%s Function: %s requested replay of %d dead letter entries", logPrefix, appName, len(entries))
+
+	ids = ids[:0]
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+
+	left := ids
+	deadline := time.Now().Add(deadLetterReplayTimeout)
+	for len(left) > 0 && time.Now().Before(deadline) {
+		time.Sleep(deadLetterReplayPollInterval)
+
+		pending, err := fetchDeadLetters(b, appName, ids)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to read dead letter entries, err: %v", logPrefix, appName, err)
+			continue
+		}
+		left = make([]uint64, 0, len(pending))
+		for _, entry := range pending {
+			left = append(left, entry.ID)
+		}
+	}
+
+	// A newer request written meanwhile fails the rev check and is kept
+	err = metakv.Delete(path, rev)
+	if err != nil && err != metakv.ErrRevMismatch {
+		logging.Errorf("%s Function: %s failed to remove dead letter replay request, err: %v", logPrefix, appName, err)
+	}
+
+	if len(left) > 0 {
+		logging.Infof("%s Function: %s %d dead letter entries weren't claimed for replay: %v",
+			logPrefix, appName, len(left), left)
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return len(entries) - len(left), left, info
+}
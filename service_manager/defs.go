@@ -7,6 +7,7 @@ import (
 
 	"github.com/couchbase/cbauth/service"
 	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/notification"
 	"github.com/couchbase/eventing/util"
 )
 
@@ -22,6 +23,11 @@ const (
 	metakvTempAppsPath       = metakvEventingPath + "tempApps/"
 	metakvChecksumPath       = metakvEventingPath + "checksum/"
 	metakvTempChecksumPath   = metakvEventingPath + "tempchecksum/"
+	metakvVersionsPath       = metakvEventingPath + "versions/"      // revision fragments of functions
+	metakvVersionsIndexPath  = metakvEventingPath + "versionsindex/" // revision list of each function
+	metakvSnapshotsPath      = metakvEventingPath + "checkpointSnapshots/"
+	metakvPlacementPlansPath = metakvEventingPath + "placementPlans/" // vbucket placement of each function
+	metakvSchedulePath       = metakvEventingPath + "schedule/"       // last scheduled transition of each function
 	stopRebalance            = "stopRebalance"
 )
 
@@ -102,6 +108,9 @@ type ServiceMgr struct {
 	errorCodes    map[int]errorPayload
 
 	consistencyValues []string
+
+	topicSlices map[string]*topicLeases // Access controlled by topicsMutex
+	topicsMutex *sync.Mutex
 }
 
 type functionInfo struct {
@@ -175,16 +184,21 @@ type application struct {
 }
 
 type depCfg struct {
-	Buckets        []bucket      `json:"buckets"`
-	Curl           []common.Curl `json:"curl"`
-	MetadataBucket string        `json:"metadata_bucket"`
-	SourceBucket   string        `json:"source_bucket"`
+	Buckets          []bucket           `json:"buckets"`
+	Curl             []common.Curl      `json:"curl"`
+	DeadLetter       *common.DeadLetter `json:"dead_letter,omitempty"`
+	MetadataBucket   string             `json:"metadata_bucket"`
+	SourceBucket     string             `json:"source_bucket"`
+	SourceScope      string             `json:"source_scope,omitempty"`
+	SourceCollection string             `json:"source_collection,omitempty"`
 }
 
 type bucket struct {
-	Alias      string `json:"alias"`
-	BucketName string `json:"bucket_name"`
-	Access     string `json:"access"`
+	Alias          string `json:"alias"`
+	BucketName     string `json:"bucket_name"`
+	ScopeName      string `json:"scope_name,omitempty"`
+	CollectionName string `json:"collection_name,omitempty"`
+	Access         string `json:"access"`
 }
 
 type backlogStat struct {
@@ -194,6 +208,7 @@ type backlogStat struct {
 type stats struct {
 	CheckpointBlobDump              interface{} `json:"checkpoint_blob_dump,omitempty"`
 	DCPFeedBoundary                 interface{} `json:"dcp_feed_boundary"`
+	DcpFeedStats                    interface{} `json:"dcp_feed_stats,omitempty"`
 	DocTimerDebugStats              interface{} `json:"doc_timer_debug_stats,omitempty"`
 	EventProcessingStats            interface{} `json:"event_processing_stats,omitempty"`
 	EventsRemaining                 interface{} `json:"events_remaining,omitempty"`
@@ -227,6 +242,80 @@ type retry struct {
 	Count int64 `json:"count"`
 }
 
+type deadLetterList struct {
+	Entries []*common.DeadLetterEntry `json:"entries"`
+	Next    uint64                    `json:"next,omitempty"`
+}
+
+type deadLetterReplay struct {
+	IDs []uint64 `json:"ids"`
+}
+
+// topicLeases tracks notifications leased over REST from the slice of a topic on this node,
+// so that they can be acked or requeued by key in later requests
+type topicLeases struct {
+	slice  notification.TopicSlice
+	leased map[string]notification.Notification
+}
+
+type leasedNotification struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Expiry time.Time   `json:"expiry"`
+}
+
+type notificationKeys struct {
+	Keys []string `json:"keys"`
+}
+
+type notificationAckResult struct {
+	Released []string `json:"released"`
+	Unknown  []string `json:"unknown"`
+}
+
+type revisionAuthor struct {
+	Source string `json:"source"`
+	User   string `json:"user"`
+}
+
+type revisionSummary struct {
+	Rev       uint64         `json:"rev"`
+	Author    revisionAuthor `json:"author"`
+	Timestamp string         `json:"timestamp"`
+	Deployed  bool           `json:"deployed"`
+	Hash      string         `json:"hash"`
+}
+
+type revisionIndexEntry struct {
+	revisionSummary
+	Fragments int `json:"fragments"`
+}
+
+type revisionIndex struct {
+	NextRev   uint64                `json:"next_rev"`
+	Revisions []*revisionIndexEntry `json:"revisions"`
+}
+
+type functionRevision struct {
+	revisionSummary
+	AppHandlers      string                 `json:"appcode"`
+	DeploymentConfig depCfg                 `json:"depcfg"`
+	Settings         map[string]interface{} `json:"settings"`
+}
+
+type valueChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type revisionDiff struct {
+	From     uint64                 `json:"from"`
+	To       uint64                 `json:"to"`
+	Code     []string               `json:"code"`
+	DepCfg   map[string]valueChange `json:"depcfg"`
+	Settings map[string]valueChange `json:"settings"`
+}
+
 type appStatus struct {
 	CompositeStatus       string `json:"composite_status"`
 	Name                  string `json:"name"`
@@ -234,6 +323,8 @@ type appStatus struct {
 	NumDeployedNodes      int    `json:"num_deployed_nodes"`
 	DeploymentStatus      bool   `json:"deployment_status"`
 	ProcessingStatus      bool   `json:"processing_status"`
+
+	NextScheduledTransition *common.ScheduleTransition `json:"next_scheduled_transition,omitempty"`
 }
 
 type appStatusResponse struct {
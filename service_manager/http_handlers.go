@@ -203,6 +203,11 @@ func (m *ServiceMgr) deleteTempStore(appName string) (info *runtimeInfo) {
 		logging.Errorf("%s %s", logPrefix, info.Info)
 		return
 	}
+	m.deleteRevisions(appName)
+	m.deleteCheckpointSnapshot(appName)
+	m.deletePlacementPlan(appName)
+	m.deleteScheduleClaim(appName)
+
 	info.Code = m.statusCodes.ok.Code
 	info.Info = fmt.Sprintf("Function: %s deleting in the background", appName)
 	logging.Infof("%s %s", logPrefix, info.Info)
@@ -1182,7 +1187,7 @@ func (m *ServiceMgr) setSettingsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if info := m.setSettings(appName, data); info.Code != m.statusCodes.ok.Code {
+	if info := m.setSettings(appName, data, requestAuthor(r)); info.Code != m.statusCodes.ok.Code {
 		m.sendErrorInfo(w, info)
 		return
 	}
@@ -1207,7 +1212,7 @@ func (m *ServiceMgr) getSettings(appName string) (*map[string]interface{}, *runt
 	return &app.Settings, &info
 }
 
-func (m *ServiceMgr) setSettings(appName string, data []byte) (info *runtimeInfo) {
+func (m *ServiceMgr) setSettings(appName string, data []byte, author revisionAuthor) (info *runtimeInfo) {
 	logPrefix := "ServiceMgr::setSettings"
 
 	info = &runtimeInfo{}
@@ -1336,7 +1341,7 @@ func (m *ServiceMgr) setSettings(appName string, data []byte) (info *runtimeInfo
 		if deploymentStatus && processingStatus {
 			if m.superSup.GetAppState(appName) == common.AppStatePaused {
 				switch filterFeedBoundary(settings) {
-				case common.DcpFromNow, common.DcpEverything:
+				case common.DcpFromNow, common.DcpEverything, common.DcpFromSeqnos, common.DcpFromCheckpointSnapshot:
 					info.Code = m.statusCodes.errInvalidConfig.Code
 					info.Info = fmt.Sprintf("Function: %s only from_prior feed boundary is allowed during resume", appName)
 					logging.Errorf("%s %s", logPrefix, info.Info)
@@ -1356,7 +1361,7 @@ func (m *ServiceMgr) setSettings(appName string, data []byte) (info *runtimeInfo
 
 			// Write to primary store in case of deployment
 			if !m.checkIfDeployedAndRunning(appName) {
-				info = m.savePrimaryStore(&app)
+				info = m.savePrimaryStore(&app, author)
 				if info.Code != m.statusCodes.ok.Code {
 					logging.Errorf("%s %s", logPrefix, info.Info)
 					return
@@ -1389,7 +1394,7 @@ func (m *ServiceMgr) setSettings(appName string, data []byte) (info *runtimeInfo
 	}
 
 	// Write the updated app along with its settings back to temp store
-	if info = m.saveTempStore(app); info.Code != m.statusCodes.ok.Code {
+	if info = m.saveTempStore(app, author); info.Code != m.statusCodes.ok.Code {
 		return
 	}
 
@@ -1420,6 +1425,12 @@ func (m *ServiceMgr) parseFunctionPayload(data []byte, fnName string) applicatio
 
 	depcfg.MetadataBucket = string(dcfg.MetadataBucket())
 	depcfg.SourceBucket = string(dcfg.SourceBucket())
+	depcfg.SourceScope = string(dcfg.SourceScope())
+	depcfg.SourceCollection = string(dcfg.SourceCollection())
+
+	if deadLetterBucket := string(dcfg.DeadLetterBucket()); deadLetterBucket != "" {
+		depcfg.DeadLetter = &common.DeadLetter{BucketName: deadLetterBucket}
+	}
 
 	var buckets []bucket
 	b := new(cfg.Bucket)
@@ -1427,9 +1438,11 @@ func (m *ServiceMgr) parseFunctionPayload(data []byte, fnName string) applicatio
 
 		if dcfg.Buckets(b, i) {
 			newBucket := bucket{
-				Alias:      string(b.Alias()),
-				BucketName: string(b.BucketName()),
-				Access:     string(config.Access(i)),
+				Alias:          string(b.Alias()),
+				BucketName:     string(b.BucketName()),
+				ScopeName:      string(b.ScopeName()),
+				CollectionName: string(b.CollectionName()),
+				Access:         string(config.Access(i)),
 			}
 			buckets = append(buckets, newBucket)
 		}
@@ -1621,12 +1634,12 @@ func (m *ServiceMgr) saveTempStoreHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	info := m.saveTempStore(app)
+	info := m.saveTempStore(app, requestAuthor(r))
 	m.sendErrorInfo(w, info)
 }
 
 // Saves application to temp store
-func (m *ServiceMgr) saveTempStore(app application) (info *runtimeInfo) {
+func (m *ServiceMgr) saveTempStore(app application, author revisionAuthor) (info *runtimeInfo) {
 	logPrefix := "ServiceMgr::saveTempStore"
 	info = &runtimeInfo{}
 	appName := app.Name
@@ -1657,6 +1670,8 @@ func (m *ServiceMgr) saveTempStore(app application) (info *runtimeInfo) {
 		return
 	}
 
+	m.recordRevision(&app, author, false)
+
 	info.Code = m.statusCodes.ok.Code
 	info.Info = fmt.Sprintf("Function: %s stored in temp store", appName)
 	logging.Infof("%s %s", logPrefix, info.Info)
@@ -1698,7 +1713,7 @@ func (m *ServiceMgr) savePrimaryStoreHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	info := m.savePrimaryStore(&app)
+	info := m.savePrimaryStore(&app, requestAuthor(r))
 	m.sendRuntimeInfo(w, info)
 }
 
@@ -1758,6 +1773,9 @@ func (m *ServiceMgr) encodeAppPayload(app *application) []byte {
 		cfg.CurlAddBearerKey(builder, bearerKeyEncoded)
 		cfg.CurlAddAllowCookies(builder, cookiesEncoded)
 		cfg.CurlAddValidateSSLCertificate(builder, validateSSLCertificateEncoded)
+		cfg.CurlAddMaxRequestsPerSec(builder, uint32(app.DeploymentConfig.Curl[i].MaxRequestsPerSec))
+		cfg.CurlAddMaxConcurrent(builder, uint32(app.DeploymentConfig.Curl[i].MaxConcurrent))
+		cfg.CurlAddTimeoutMs(builder, uint32(app.DeploymentConfig.Curl[i].TimeoutMs))
 		curlBindingsEnd := cfg.CurlEnd(builder)
 
 		curlBindings = append(curlBindings, curlBindingsEnd)
@@ -1774,11 +1792,15 @@ func (m *ServiceMgr) encodeAppPayload(app *application) []byte {
 	for i := 0; i < len(app.DeploymentConfig.Buckets); i++ {
 		alias := builder.CreateString(app.DeploymentConfig.Buckets[i].Alias)
 		bName := builder.CreateString(app.DeploymentConfig.Buckets[i].BucketName)
+		bScope := builder.CreateString(app.DeploymentConfig.Buckets[i].ScopeName)
+		bCollection := builder.CreateString(app.DeploymentConfig.Buckets[i].CollectionName)
 		bAccess := builder.CreateString(app.DeploymentConfig.Buckets[i].Access)
 
 		cfg.BucketStart(builder)
 		cfg.BucketAddAlias(builder, alias)
 		cfg.BucketAddBucketName(builder, bName)
+		cfg.BucketAddScopeName(builder, bScope)
+		cfg.BucketAddCollectionName(builder, bCollection)
 		csBucket := cfg.BucketEnd(builder)
 
 		bNames = append(bNames, csBucket)
@@ -1799,11 +1821,22 @@ func (m *ServiceMgr) encodeAppPayload(app *application) []byte {
 
 	metaBucket := builder.CreateString(app.DeploymentConfig.MetadataBucket)
 	sourceBucket := builder.CreateString(app.DeploymentConfig.SourceBucket)
+	sourceScope := builder.CreateString(app.DeploymentConfig.SourceScope)
+	sourceCollection := builder.CreateString(app.DeploymentConfig.SourceCollection)
+
+	var deadLetterBucketName string
+	if app.DeploymentConfig.DeadLetter != nil {
+		deadLetterBucketName = app.DeploymentConfig.DeadLetter.BucketName
+	}
+	deadLetterBucket := builder.CreateString(deadLetterBucketName)
 
 	cfg.DepCfgStart(builder)
 	cfg.DepCfgAddBuckets(builder, buckets)
 	cfg.DepCfgAddMetadataBucket(builder, metaBucket)
 	cfg.DepCfgAddSourceBucket(builder, sourceBucket)
+	cfg.DepCfgAddSourceScope(builder, sourceScope)
+	cfg.DepCfgAddSourceCollection(builder, sourceCollection)
+	cfg.DepCfgAddDeadLetterBucket(builder, deadLetterBucket)
 	depcfg := cfg.DepCfgEnd(builder)
 
 	appCode := builder.CreateString(app.AppHandlers)
@@ -1849,7 +1882,8 @@ func filterFeedBoundary(settings map[string]interface{}) common.DcpStreamBoundar
 }
 
 // Saves application to metakv and returns appropriate success/error code
-func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
+// author is recorded in the revision history of the function
+func (m *ServiceMgr) savePrimaryStore(app *application, author revisionAuthor) (info *runtimeInfo) {
 	logPrefix := "ServiceMgr::savePrimaryStore"
 
 	info = &runtimeInfo{}
@@ -1868,7 +1902,7 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 		return
 	}
 
-	if app.DeploymentConfig.SourceBucket == app.DeploymentConfig.MetadataBucket {
+	if app.DeploymentConfig.sourceKeyspace() == bucketKeyspace(app.DeploymentConfig.MetadataBucket) {
 		info.Code = m.statusCodes.errSrcMbSame.Code
 		info.Info = fmt.Sprintf("Function: %s source bucket same as metadata bucket. source_bucket : %s metadata_bucket : %s",
 			app.Name, app.DeploymentConfig.SourceBucket, app.DeploymentConfig.MetadataBucket)
@@ -1895,7 +1929,7 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 
 	if m.superSup.GetAppState(app.Name) == common.AppStatePaused {
 		switch filterFeedBoundary(app.Settings) {
-		case common.DcpFromNow, common.DcpEverything:
+		case common.DcpFromNow, common.DcpEverything, common.DcpFromSeqnos, common.DcpFromCheckpointSnapshot:
 			info.Code = m.statusCodes.errInvalidConfig.Code
 			info.Info = fmt.Sprintf("Function: %s only from_prior feed boundary is allowed during resume", app.Name)
 			logging.Errorf("%s %s", logPrefix, info.Info)
@@ -1906,6 +1940,21 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 		}
 	}
 
+	switch filterFeedBoundary(app.Settings) {
+	case common.DcpFromSeqnos:
+		if _, exists := app.Settings["dcp_stream_seqnos"]; !exists {
+			info.Code = m.statusCodes.errInvalidConfig.Code
+			info.Info = fmt.Sprintf("Function: %s feed boundary: from_seqnos needs dcp_stream_seqnos", app.Name)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			return
+		}
+	case common.DcpFromCheckpointSnapshot:
+		if _, info = m.getCheckpointSnapshot(app.Name); info.Code != m.statusCodes.ok.Code {
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			return
+		}
+	}
+
 	app.SrcMutationEnabled = m.isSrcMutationEnabled(&app.DeploymentConfig)
 	if app.SrcMutationEnabled && !m.compareEventingVersion(mhVersion) {
 		info.Code = m.statusCodes.errClusterVersion.Code
@@ -2007,6 +2056,9 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 		return
 	}
 
+	deployed, _ := app.Settings["deployment_status"].(bool)
+	m.recordRevision(app, author, deployed)
+
 	wInfo, err := m.determineWarnings(app, compilationInfo)
 	if err != nil {
 		info.Code = m.statusCodes.errGetConfig.Code
@@ -2525,6 +2577,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	functions := regexp.MustCompile("^/api/v1/functions/?$")
+	functionsBulk := regexp.MustCompile("^/api/v1/functions/bulk/(deploy|undeploy|pause|resume)/?$")
 	functionsName := regexp.MustCompile("^/api/v1/functions/(.*[^/])/?$") // Match is agnostic of trailing '/'
 	functionsNameSettings := regexp.MustCompile("^/api/v1/functions/(.*[^/])/settings/?$")
 	functionsNameRetry := regexp.MustCompile("^/api/v1/functions/(.*[^/])/retry/?$")
@@ -2532,8 +2585,401 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 	functionsUndeploy := regexp.MustCompile("^/api/v1/functions/(.*[^/])/undeploy/?$")
 	functionsPause := regexp.MustCompile("^/api/v1/functions/(.*[^/])/pause/?$")
 	functionsResume := regexp.MustCompile("^/api/v1/functions/(.*[^/])/resume/?$")
+	functionsDeadLetter := regexp.MustCompile("^/api/v1/functions/(.*[^/])/deadletter/?$")
+	functionsDeadLetterReplay := regexp.MustCompile("^/api/v1/functions/(.*[^/])/deadletter/replay/?$")
+	functionsVersions := regexp.MustCompile("^/api/v1/functions/(.*[^/])/versions/?$")
+	functionsVersion := regexp.MustCompile("^/api/v1/functions/(.*[^/])/versions/([0-9]+)/?$")
+	functionsVersionDiff := regexp.MustCompile("^/api/v1/functions/(.*[^/])/versions/([0-9]+)/diff/?$")
+	functionsVersionRedeploy := regexp.MustCompile("^/api/v1/functions/(.*[^/])/versions/([0-9]+)/redeploy/?$")
+	functionsTest := regexp.MustCompile("^/api/v1/functions/(.*[^/])/test/?$")
+	functionsSnapshot := regexp.MustCompile("^/api/v1/functions/(.*[^/])/checkpoint_snapshot/?$")
+	functionsPlanner := regexp.MustCompile("^/api/v1/functions/(.*[^/])/planner/?$")
+
+	if match := functionsBulk.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		op := match[1]
+		info := &runtimeInfo{}
+		if r.Method != "POST" {
+			info.Code = m.statusCodes.errInvalidConfig.Code
+			info.Info = fmt.Sprintf("Only POST call allowed to this endpoint")
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		audit.Log(auditevent.BulkLifecycleOperation, r, op)
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			info.Code = m.statusCodes.errReadReq.Code
+			info.Info = fmt.Sprintf("failed to read request body, err: %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		var req bulkRequest
+		if err = json.Unmarshal(data, &req); err != nil {
+			info.Code = m.statusCodes.errUnmarshalPld.Code
+			info.Info = fmt.Sprintf("failed to unmarshal bulk request, err: %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		results, info := m.bulkOp(op, &req, requestAuthor(r))
+		if results == nil {
+			m.sendErrorInfo(w, info)
+			return
+		}
+		m.sendBulkResults(w, results)
+
+	} else if match := functionsVersionRedeploy.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+		rev, _ := strconv.ParseUint(match[2], 10, 64)
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.RedeployFunctionVersion, r, appName)
+
+		var isMixedMode bool
+		info := &runtimeInfo{}
+		if isMixedMode, info = m.isMixedModeCluster(); info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		if isMixedMode {
+			info.Code = m.statusCodes.errMixedMode.Code
+			info.Info = "Life-cycle operations except delete and undeploy are not allowed in a mixed mode cluster"
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		if info = m.redeployRevision(appName, rev, requestAuthor(r)); info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+		m.sendRuntimeInfo(w, info)
+
+	} else if match := functionsVersionDiff.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+		rev, _ := strconv.ParseUint(match[2], 10, 64)
+		info := &runtimeInfo{}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.FetchFunctionVersions, r, appName)
+
+		// Diff is against the current definition unless another revision is specified
+		against := uint64(0)
+		if av := r.URL.Query()["against"]; len(av) == 1 {
+			val, err := strconv.ParseUint(av[0], 10, 64)
+			if err != nil || val == 0 {
+				info.Code = m.statusCodes.errInvalidConfig.Code
+				info.Info = fmt.Sprintf("Parameter 'against' should be a positive integer")
+				m.sendErrorInfo(w, info)
+				return
+			}
+			against = val
+		}
+
+		diff, info := m.diffRevision(appName, rev, against)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		response, err := json.MarshalIndent(diff, "", " ")
+		if err != nil {
+			info.Code = m.statusCodes.errMarshalResp.Code
+			info.Info = fmt.Sprintf("failed to marshal revision diff, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "%s", string(response))
+
+	} else if match := functionsVersion.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+		rev, _ := strconv.ParseUint(match[2], 10, 64)
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.FetchFunctionVersions, r, appName)
+
+		revision, info := m.getRevision(appName, rev)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		response, err := json.MarshalIndent(revision, "", " ")
+		if err != nil {
+			info.Code = m.statusCodes.errMarshalResp.Code
+			info.Info = fmt.Sprintf("failed to marshal revision, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "%s", string(response))
+
+	} else if match := functionsVersions.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.FetchFunctionVersions, r, appName)
+
+		revisions, info := m.getRevisions(appName)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		response, err := json.MarshalIndent(revisions, "", " ")
+		if err != nil {
+			info.Code = m.statusCodes.errMarshalResp.Code
+			info.Info = fmt.Sprintf("failed to marshal revisions, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "%s", string(response))
+
+	} else if match := functionsPlanner.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.PlanVbucketPlacement, r, appName)
+
+		mappings, info := m.planVbPlacement(appName, r.URL.Query().Get("placement_strategy"))
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		response, err := json.MarshalIndent(mappings, "", " ")
+		if err != nil {
+			info.Code = m.statusCodes.errMarshalResp.Code
+			info.Info = fmt.Sprintf("failed to marshal vbucket placement, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "%s", string(response))
 
-	if match := functionsNameRetry.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+	} else if match := functionsSnapshot.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+		info := &runtimeInfo{}
+
+		var snapshot *common.CheckpointSnapshot
+		switch r.Method {
+		case "GET":
+			audit.Log(auditevent.FetchCheckpointSnapshot, r, appName)
+			snapshot, info = m.getCheckpointSnapshot(appName)
+
+		case "POST":
+			audit.Log(auditevent.SaveCheckpointSnapshot, r, appName)
+			snapshot, info = m.saveCheckpointSnapshot(appName)
+
+		case "DELETE":
+			audit.Log(auditevent.DeleteCheckpointSnapshot, r, appName)
+			m.deleteCheckpointSnapshot(appName)
+			info.Code = m.statusCodes.ok.Code
+			info.Info = fmt.Sprintf("Function: %s checkpoint snapshot deleted", appName)
+			m.sendRuntimeInfo(w, info)
+			return
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		response, err := json.MarshalIndent(snapshot, "", " ")
+		if err != nil {
+			info.Code = m.statusCodes.errMarshalResp.Code
+			info.Info = fmt.Sprintf("failed to marshal checkpoint snapshot, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "%s", string(response))
+
+	} else if match := functionsTest.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+		info := &runtimeInfo{}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.TestFunction, r, appName)
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			info.Code = m.statusCodes.errReadReq.Code
+			info.Info = fmt.Sprintf("failed to read request body, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		var req testEventsRequest
+		err = json.Unmarshal(data, &req)
+		if err != nil {
+			info.Code = m.statusCodes.errUnmarshalPld.Code
+			info.Info = fmt.Sprintf("failed to unmarshal test events, err: %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		results, info := m.testFunction(appName, req.Events)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		response, err := json.MarshalIndent(results, "", " ")
+		if err != nil {
+			info.Code = m.statusCodes.errMarshalResp.Code
+			info.Info = fmt.Sprintf("failed to marshal test results, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "%s", string(response))
+
+	} else if match := functionsDeadLetterReplay.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+		info := &runtimeInfo{}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.ReplayDeadLetters, r, appName)
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			info.Code = m.statusCodes.errReadReq.Code
+			info.Info = fmt.Sprintf("failed to read request body, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		var replay deadLetterReplay
+		err = json.Unmarshal(data, &replay)
+		if err != nil {
+			info.Code = m.statusCodes.errUnmarshalPld.Code
+			info.Info = fmt.Sprintf("failed to unmarshal dead letter replay request, err: %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		count, left, info := m.replayDeadLetters(appName, replay.IDs)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		if len(left) > 0 {
+			info.Info = fmt.Sprintf("Function: %s replayed %d dead letter entries, entries left in the dead letter bucket: %v",
+				appName, count, left)
+		} else {
+			info.Info = fmt.Sprintf("Function: %s replayed %d dead letter entries", appName, count)
+		}
+		m.sendRuntimeInfo(w, info)
+
+	} else if match := functionsDeadLetter.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		appName := match[1]
+		info := &runtimeInfo{}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.FetchDeadLetters, r, appName)
+
+		start, limit := uint64(1), uint64(deadLetterDefaultLimit)
+		if sv := r.URL.Query()["start"]; len(sv) == 1 {
+			val, err := strconv.ParseUint(sv[0], 10, 64)
+			if err != nil || val == 0 {
+				info.Code = m.statusCodes.errInvalidConfig.Code
+				info.Info = fmt.Sprintf("Parameter 'start' should be a positive integer")
+				m.sendErrorInfo(w, info)
+				return
+			}
+			start = val
+		}
+
+		if lv := r.URL.Query()["limit"]; len(lv) == 1 {
+			val, err := strconv.ParseUint(lv[0], 10, 64)
+			if err != nil || val == 0 || val > deadLetterMaxLimit {
+				info.Code = m.statusCodes.errInvalidConfig.Code
+				info.Info = fmt.Sprintf("Parameter 'limit' should be between 1 and %d", deadLetterMaxLimit)
+				m.sendErrorInfo(w, info)
+				return
+			}
+			limit = val
+		}
+
+		list, info := m.getDeadLetters(appName, start, limit)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		response, err := json.MarshalIndent(list, "", " ")
+		if err != nil {
+			info.Code = m.statusCodes.errMarshalResp.Code
+			info.Info = fmt.Sprintf("failed to marshal dead letter entries, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "%s", string(response))
+
+	} else if match := functionsNameRetry.FindStringSubmatch(r.URL.Path); len(match) != 0 {
 		appName := match[1]
 		info := &runtimeInfo{}
 
@@ -2613,7 +3059,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			if info = m.setSettings(appName, data); info.Code != m.statusCodes.ok.Code {
+			if info = m.setSettings(appName, data, requestAuthor(r)); info.Code != m.statusCodes.ok.Code {
 				m.sendErrorInfo(w, info)
 				return
 			}
@@ -2646,7 +3092,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, requestAuthor(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -2676,7 +3122,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, requestAuthor(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -2725,7 +3171,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, requestAuthor(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -2754,7 +3200,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, requestAuthor(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -2844,11 +3290,11 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 				app.Settings["language_compatibility"] = common.LanguageCompatibility[len(common.LanguageCompatibility)-1]
 			}
 
-			runtimeInfo := m.savePrimaryStore(&app)
+			runtimeInfo := m.savePrimaryStore(&app, requestAuthor(r))
 			if runtimeInfo.Code == m.statusCodes.ok.Code {
 				audit.Log(auditevent.SaveDraft, r, appName)
 				// Save to temp store only if saving to primary store succeeds
-				if tempInfo := m.saveTempStore(app); tempInfo.Code != m.statusCodes.ok.Code {
+				if tempInfo := m.saveTempStore(app, requestAuthor(r)); tempInfo.Code != m.statusCodes.ok.Code {
 					m.sendErrorInfo(w, tempInfo)
 					return
 				}
@@ -3011,6 +3457,12 @@ func (m *ServiceMgr) statusHandlerImpl() (response appStatusResponse, info *runt
 			status.NumBootstrappingNodes = num
 		}
 
+		if val, exists := app.Settings["schedule"]; exists && deploymentStatus {
+			if schedule, err := common.ParseSchedule(val); err == nil {
+				status.NextScheduledTransition, _ = util.NextScheduledTransition(schedule, time.Now())
+			}
+		}
+
 		mhVersion := eventingVerMap["mad-hatter"]
 		if m.compareEventingVersion(mhVersion) {
 			bootstrapStatus, err := util.GetAggBootstrapAppStatus(net.JoinHostPort(util.Localhost(), m.adminHTTPPort), status.Name)
@@ -3104,6 +3556,34 @@ func (m *ServiceMgr) statsHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+func (m *ServiceMgr) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::metricsHandler"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		cbauth.SendForbidden(w, EventingPermissionManage)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodeName := m.uuid
+	nsServerEndpoint := net.JoinHostPort(util.Localhost(), m.restPort)
+	if nodeAddr, err := util.CurrentEventingNodeAddress(m.auth, nsServerEndpoint); err == nil {
+		nodeName = nodeAddr
+	} else {
+		logging.Errorf("%s Failed to get current eventing node address, using node uuid as node label, err: %v", logPrefix, err)
+	}
+
+	var buf bytes.Buffer
+	m.populateMetrics(nodeName).write(&buf)
+
+	w.Header().Set("Content-Type", openMetricsContentType)
+	w.Write(buf.Bytes())
+}
+
 func percentileN(latencyStats map[string]uint64, p int) int {
 	var samples sort.IntSlice
 	var numSamples uint64
@@ -3196,6 +3676,10 @@ func (m *ServiceMgr) populateStats(fullStats bool) []stats {
 				}
 
 				stats.VbDcpEventsRemaining = m.superSup.VbDcpEventsRemainingToProcess(app.Name)
+				dcpFeedStats, err := m.superSup.DcpFeedStats(app.Name)
+				if err == nil {
+					stats.DcpFeedStats = dcpFeedStats
+				}
 				debugStats, err := m.superSup.TimerDebugStats(app.Name)
 				if err == nil {
 					stats.DocTimerDebugStats = debugStats
@@ -3352,7 +3836,7 @@ func (m *ServiceMgr) createApplications(r *http.Request, appList *[]application,
 			continue
 		}
 
-		infoPri := m.savePrimaryStore(&app)
+		infoPri := m.savePrimaryStore(&app, requestAuthor(r))
 		if infoPri.Code != m.statusCodes.ok.Code {
 			logging.Errorf("%s Function: %s saving %ru to primary store failed: %v", logPrefix, app.Name, infoPri)
 			infoList = append(infoList, infoPri)
@@ -3361,7 +3845,7 @@ func (m *ServiceMgr) createApplications(r *http.Request, appList *[]application,
 
 		// Save to temp store only if saving to primary store succeeds
 		audit.Log(auditevent.SaveDraft, r, app.Name)
-		infoTmp := m.saveTempStore(app)
+		infoTmp := m.saveTempStore(app, requestAuthor(r))
 		if infoTmp.Code != m.statusCodes.ok.Code {
 			logging.Errorf("%s Function: %s saving to temporary store failed: %v", logPrefix, app.Name, infoTmp)
 			infoList = append(infoList, infoTmp)
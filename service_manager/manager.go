@@ -49,6 +49,8 @@ func NewServiceMgr(config util.Config, rebalanceRunning bool, superSup common.Ev
 		statsWritten: true,
 		stopTracerCh: make(chan struct{}, 1),
 		superSup:     superSup,
+		topicSlices:  make(map[string]*topicLeases),
+		topicsMutex:  &sync.Mutex{},
 	}
 
 	mgr.config.Store(config)
@@ -163,6 +165,7 @@ func (m *ServiceMgr) initService() {
 	// Public REST APIs
 	mux.HandleFunc("/api/v1/status", m.statusHandler)
 	mux.HandleFunc("/api/v1/stats", m.statsHandler)
+	mux.HandleFunc("/metrics", m.metricsHandler)
 	mux.HandleFunc("/api/v1/config", m.configHandler)
 	mux.HandleFunc("/api/v1/config/", m.configHandler)
 	mux.HandleFunc("/api/v1/functions", m.functionsHandler)
@@ -175,6 +178,9 @@ func (m *ServiceMgr) initService() {
 	mux.HandleFunc("/api/v1/list/functions", m.listFunctions)
 	mux.HandleFunc("/api/v1/list/functions/", m.listFunctions)
 
+	mux.HandleFunc("/api/v1/topics", m.topicsHandler)
+	mux.HandleFunc("/api/v1/topics/", m.topicsHandler)
+
 	go func() {
 		addr := net.JoinHostPort("", m.adminHTTPPort)
 
@@ -419,7 +425,7 @@ func (m *ServiceMgr) settingChangeCallback(path string, value []byte, rev interf
 
 	cfg := m.fnsInPrimaryStore[functionName]
 
-	source, _ := m.getSourceAndDestinationsFromDepCfg(&cfg)
+	source := cfg.SourceBucket
 	if processingStatus == false {
 		m.graph.removeEdges(functionName)
 	}
@@ -0,0 +1,262 @@
+package servicemanager
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenMetrics exposition of the per function stats that /api/v1/stats reports as JSON.
+// Samples of a metric family must be contiguous, so families are collected across
+// all functions first and rendered afterwards.
+
+const (
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	metricsPrefix          = "eventing_"
+
+	metricTypeCounter   = "counter"
+	metricTypeGauge     = "gauge"
+	metricTypeHistogram = "histogram"
+
+	// Layout of the latency histograms of the cpp workers, see v8_consumer/include/histogram.h.
+	// Bins are keyed by their lower bound, the last one collects every sample past the range.
+	latencyBinWidth    = 100
+	latencyOverflowBin = 1000*1000*10 - latencyBinWidth
+)
+
+// Stats that report a current level rather than a running count
+var gaugeStats = map[string]bool{
+	"agg_queue_memory":             true,
+	"agg_queue_memory_cap":         true,
+	"agg_queue_size":               true,
+	"agg_queue_size_cap":           true,
+	"agg_timer_feedback_queue_cap": true,
+	"feedback_queue_size":          true,
+}
+
+var invalidMetricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+type metricSample struct {
+	suffix string
+	labels []metricLabel
+	value  float64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []metricSample
+}
+
+type metricsRegistry struct {
+	families map[string]*metricFamily
+	order    []string
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{families: make(map[string]*metricFamily)}
+}
+
+func (mr *metricsRegistry) family(name, typ, help string) *metricFamily {
+	if f, ok := mr.families[name]; ok {
+		return f
+	}
+
+	f := &metricFamily{name: metricsPrefix + name, help: help, typ: typ}
+	mr.families[name] = f
+	mr.order = append(mr.order, name)
+	return f
+}
+
+func (f *metricFamily) add(suffix string, labels []metricLabel, value float64) {
+	f.samples = append(f.samples, metricSample{suffix: suffix, labels: labels, value: value})
+}
+
+// addStatMap adds a family per entry of a stats map, named after the stats map and the
+// entry. Entries are counters unless listed in gaugeStats.
+func (mr *metricsRegistry) addStatMap(name, help string, labels []metricLabel, statMap map[string]float64) {
+	keys := make([]string, 0, len(statMap))
+	for key := range statMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		statName := name + "_" + invalidMetricNameChars.ReplaceAllString(key, "_")
+		statHelp := help + ": " + key
+		if gaugeStats[key] {
+			mr.family(statName, metricTypeGauge, statHelp).add("", labels, statMap[key])
+			continue
+		}
+		mr.family(statName, metricTypeCounter, statHelp).add("_total", labels, statMap[key])
+	}
+}
+
+// addLatencyHistogram converts a latency histogram reported by the cpp workers into
+// cumulative buckets in seconds. Bin keys are lower bounds in microseconds, so each bin
+// is bounded by its key plus latencyBinWidth. The first bin, which holds everything up
+// to its key, shares its key with the second one and is bounded the same. Samples of
+// the overflow bin are only counted in +Inf. The histograms don't keep the samples, so
+// _sum is estimated from the middle of each bin and the lower bound of the overflow bin.
+func (mr *metricsRegistry) addLatencyHistogram(name, help string, labels []metricLabel, latencyStats map[string]uint64) {
+	bins := make([]int, 0, len(latencyStats))
+	for bin := range latencyStats {
+		if sample, err := strconv.Atoi(bin); err == nil {
+			bins = append(bins, sample)
+		}
+	}
+	sort.Ints(bins)
+
+	f := mr.family(name, metricTypeHistogram, help)
+
+	var count, sum float64
+	for _, bin := range bins {
+		binCount := float64(latencyStats[strconv.Itoa(bin)])
+		count += binCount
+		if bin >= latencyOverflowBin {
+			sum += binCount * float64(bin) / 1e6
+			continue
+		}
+
+		sum += binCount * (float64(bin) + latencyBinWidth/2) / 1e6
+		f.add("_bucket", withLabel(labels, "le", formatMetricValue(float64(bin+latencyBinWidth)/1e6)), count)
+	}
+	f.add("_bucket", withLabel(labels, "le", "+Inf"), count)
+	f.add("_count", labels, count)
+	f.add("_sum", labels, sum)
+}
+
+func (mr *metricsRegistry) write(buf *bytes.Buffer) {
+	for _, name := range mr.order {
+		f := mr.families[name]
+		fmt.Fprintf(buf, "# TYPE %s %s\n", f.name, f.typ)
+		fmt.Fprintf(buf, "# HELP %s %s\n", f.name, f.help)
+		for _, s := range f.samples {
+			buf.WriteString(f.name)
+			buf.WriteString(s.suffix)
+			writeMetricLabels(buf, s.labels)
+			buf.WriteByte(' ')
+			buf.WriteString(formatMetricValue(s.value))
+			buf.WriteByte('\n')
+		}
+	}
+	buf.WriteString("# EOF\n")
+}
+
+func writeMetricLabels(buf *bytes.Buffer, labels []metricLabel) {
+	if len(labels) == 0 {
+		return
+	}
+
+	buf.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(l.name)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeLabelValue(l.value))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func withLabel(labels []metricLabel, name, value string) []metricLabel {
+	res := make([]metricLabel, 0, len(labels)+1)
+	res = append(res, labels...)
+	return append(res, metricLabel{name: name, value: value})
+}
+
+func uint64StatMap(stats map[string]uint64) map[string]float64 {
+	res := make(map[string]float64, len(stats))
+	for k, v := range stats {
+		res[k] = float64(v)
+	}
+	return res
+}
+
+// numericStatMap flattens the stats aggregated from cpp workers. Nested maps such as
+// the "curl" execution stats get their key prefixed, non numeric entries are skipped.
+func numericStatMap(stats map[string]interface{}) map[string]float64 {
+	res := make(map[string]float64)
+	for k, v := range stats {
+		switch val := v.(type) {
+		case float64:
+			res[k] = val
+		case uint64:
+			res[k] = float64(val)
+		case int64:
+			res[k] = float64(val)
+		case int:
+			res[k] = float64(val)
+		case map[string]float64:
+			for nk, nv := range val {
+				res[k+"_"+nk] = nv
+			}
+		}
+	}
+	return res
+}
+
+func (m *ServiceMgr) populateMetrics(nodeName string) *metricsRegistry {
+	mr := newMetricsRegistry()
+
+	for _, app := range m.getTempStoreAll() {
+		if !m.checkIfDeployed(app.Name) {
+			continue
+		}
+
+		labels := []metricLabel{
+			{name: "function", value: app.Name},
+			{name: "function_id", value: strconv.FormatUint(uint64(app.FunctionID), 10)},
+			{name: "node", value: nodeName},
+		}
+
+		mr.addStatMap("event_processing_stats", "Event processing stats of the function",
+			labels, uint64StatMap(m.superSup.GetEventProcessingStats(app.Name)))
+		mr.addStatMap("failure_stats", "Failure stats reported by the handler workers",
+			labels, numericStatMap(m.superSup.GetFailureStats(app.Name)))
+		mr.addStatMap("execution_stats", "Execution stats reported by the handler workers",
+			labels, numericStatMap(m.superSup.GetExecutionStats(app.Name)))
+		mr.addStatMap("metastore_stats", "Timer metastore stats of the function",
+			labels, uint64StatMap(m.superSup.GetMetaStoreStats(app.Name)))
+
+		mr.family("dcp_backlog", metricTypeGauge, "DCP events remaining to be processed").
+			add("", labels, float64(m.superSup.GetDcpEventsRemainingToProcess(app.Name)))
+
+		mr.addLatencyHistogram("handler_latency_seconds", "Handler execution latency",
+			labels, m.superSup.GetLatencyStats(app.Name))
+		mr.addLatencyHistogram("curl_latency_seconds", "Latency of cURL calls made by the handler",
+			labels, m.superSup.GetCurlLatencyStats(app.Name))
+	}
+
+	return mr
+}
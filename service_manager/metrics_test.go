@@ -0,0 +1,122 @@
+package servicemanager
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func histogramSamples(t *testing.T, latencyStats map[string]uint64) []metricSample {
+	mr := newMetricsRegistry()
+	mr.addLatencyHistogram("latency", "Latency", []metricLabel{{name: "function", value: "fn"}}, latencyStats)
+
+	f, ok := mr.families["latency"]
+	if !ok {
+		t.Fatalf("Expected latency family to be registered")
+	}
+	if f.typ != metricTypeHistogram {
+		t.Fatalf("Expected histogram type, got %s", f.typ)
+	}
+	return f.samples
+}
+
+func sampleLabel(s metricSample, name string) string {
+	for _, l := range s.labels {
+		if l.name == name {
+			return l.value
+		}
+	}
+	return ""
+}
+
+func TestLatencyHistogramBuckets(t *testing.T) {
+	samples := histogramSamples(t, map[string]uint64{
+		"100":     2,
+		"200":     3,
+		"1000":    1,
+		"invalid": 7,
+		"9999900": 4,
+	})
+
+	expected := []struct {
+		suffix string
+		le     string
+		value  float64
+	}{
+		{"_bucket", "0.0002", 2},
+		{"_bucket", "0.0003", 5},
+		{"_bucket", "0.0011", 6},
+		{"_bucket", "+Inf", 10},
+		{"_count", "", 10},
+	}
+	if len(samples) != len(expected)+1 {
+		t.Fatalf("Expected %d samples, got %d: %+v", len(expected)+1, len(samples), samples)
+	}
+	for i, e := range expected {
+		s := samples[i]
+		if s.suffix != e.suffix || sampleLabel(s, "le") != e.le || s.value != e.value {
+			t.Fatalf("Expected sample %d to be %s le: %q value: %v, got %s le: %q value: %v",
+				i, e.suffix, e.le, e.value, s.suffix, sampleLabel(s, "le"), s.value)
+		}
+		if sampleLabel(s, "function") != "fn" {
+			t.Fatalf("Expected sample %d to keep the function label, got %+v", i, s.labels)
+		}
+	}
+
+	// Bins count from their middle, the overflow bin from its lower bound
+	sum := samples[len(samples)-1]
+	expectedSum := (2*150 + 3*250 + 1*1050 + 4*9999900) / 1e6
+	if sum.suffix != "_sum" || math.Abs(sum.value-expectedSum) > 1e-9 {
+		t.Fatalf("Expected _sum %v, got %s %v", expectedSum, sum.suffix, sum.value)
+	}
+}
+
+func TestLatencyHistogramOverflowOnlyInInf(t *testing.T) {
+	samples := histogramSamples(t, map[string]uint64{"9999900": 4})
+
+	for _, s := range samples {
+		if s.suffix == "_bucket" && sampleLabel(s, "le") != "+Inf" {
+			t.Fatalf("Expected overflow bin to be counted in +Inf only, got bucket le: %s", sampleLabel(s, "le"))
+		}
+	}
+	if len(samples) != 3 || samples[0].value != 4 || samples[1].value != 4 {
+		t.Fatalf("Expected +Inf bucket and _count of 4, got %+v", samples)
+	}
+}
+
+func TestLatencyHistogramEmpty(t *testing.T) {
+	samples := histogramSamples(t, map[string]uint64{})
+
+	for _, s := range samples {
+		if s.value != 0 {
+			t.Fatalf("Expected empty histogram to report zeros, got %s %v", s.suffix, s.value)
+		}
+	}
+	if len(samples) != 3 {
+		t.Fatalf("Expected +Inf bucket, _count and _sum, got %+v", samples)
+	}
+}
+
+func TestLatencyHistogramWrite(t *testing.T) {
+	mr := newMetricsRegistry()
+	mr.addLatencyHistogram("latency", "Latency", []metricLabel{{name: "function", value: "fn"}},
+		map[string]uint64{"100": 1, "9999900": 1})
+
+	var buf bytes.Buffer
+	mr.write(&buf)
+
+	expected := strings.Join([]string{
+		"# TYPE eventing_latency histogram",
+		"# HELP eventing_latency Latency",
+		`eventing_latency_bucket{function="fn",le="0.0002"} 1`,
+		`eventing_latency_bucket{function="fn",le="+Inf"} 2`,
+		`eventing_latency_count{function="fn"} 2`,
+		`eventing_latency_sum{function="fn"} 10.00005`,
+		"# EOF",
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
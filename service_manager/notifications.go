@@ -0,0 +1,494 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/eventing/audit"
+	"github.com/couchbase/eventing/gen/auditevent"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/notification"
+)
+
+const (
+	leaseDefaultCount   = 1
+	leaseMaxCount       = 1000
+	leaseDefaultTimeout = time.Duration(1) * time.Second
+	leaseMaxTimeout     = time.Duration(60) * time.Second
+	releaseTimeout      = time.Duration(5) * time.Second
+)
+
+func (m *ServiceMgr) topicsHandler(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::topicsHandler"
+
+	w.Header().Set("Content-Type", "application/json")
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		cbauth.SendForbidden(w, EventingPermissionManage)
+		return
+	}
+
+	topicsAll := regexp.MustCompile("^/api/v1/topics/?$")
+	topicsName := regexp.MustCompile("^/api/v1/topics/([^/]+)/?$")
+	topicsPublish := regexp.MustCompile("^/api/v1/topics/([^/]+)/publish/?$")
+	topicsLease := regexp.MustCompile("^/api/v1/topics/([^/]+)/lease/?$")
+	topicsAck := regexp.MustCompile("^/api/v1/topics/([^/]+)/ack/?$")
+	topicsRequeue := regexp.MustCompile("^/api/v1/topics/([^/]+)/requeue/?$")
+
+	if match := topicsPublish.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		topic := match[1]
+		info := &runtimeInfo{}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.PublishNotification, r, topic)
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			info.Code = m.statusCodes.errReadReq.Code
+			info.Info = fmt.Sprintf("failed to read request body, err : %v", err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		if !json.Valid(data) {
+			info.Code = m.statusCodes.errUnmarshalPld.Code
+			info.Info = "Notification value must be a JSON document"
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		if info = m.publishNotification(topic, json.RawMessage(data)); info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		info.Info = fmt.Sprintf("Notification published to topic: %s", topic)
+		m.sendRuntimeInfo(w, info)
+
+	} else if match := topicsLease.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		topic := match[1]
+		info := &runtimeInfo{}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.LeaseNotifications, r, topic)
+
+		count := leaseDefaultCount
+		if cv := r.URL.Query()["count"]; len(cv) == 1 {
+			val, err := strconv.Atoi(cv[0])
+			if err != nil || val <= 0 || val > leaseMaxCount {
+				info.Code = m.statusCodes.errInvalidConfig.Code
+				info.Info = fmt.Sprintf("Parameter 'count' should be between 1 and %d", leaseMaxCount)
+				m.sendErrorInfo(w, info)
+				return
+			}
+			count = val
+		}
+
+		timeout := leaseDefaultTimeout
+		if tv := r.URL.Query()["timeout"]; len(tv) == 1 {
+			val, err := strconv.Atoi(tv[0])
+			if err != nil || val < 0 || time.Duration(val)*time.Millisecond > leaseMaxTimeout {
+				info.Code = m.statusCodes.errInvalidConfig.Code
+				info.Info = fmt.Sprintf("Parameter 'timeout' should be between 0 and %d milliseconds",
+					leaseMaxTimeout/time.Millisecond)
+				m.sendErrorInfo(w, info)
+				return
+			}
+			timeout = time.Duration(val) * time.Millisecond
+		}
+
+		leased, info := m.leaseNotifications(topic, count, timeout)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		m.sendTopicResponse(w, leased, "leased notifications")
+
+	} else if match := topicsAck.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		m.releaseNotificationsHandler(w, r, match[1], true)
+
+	} else if match := topicsRequeue.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		m.releaseNotificationsHandler(w, r, match[1], false)
+
+	} else if match := topicsName.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		topic := match[1]
+		info := &runtimeInfo{}
+
+		switch r.Method {
+		case "GET":
+			audit.Log(auditevent.FetchTopics, r, topic)
+
+			def, nErr := notification.GetTopic(topic)
+			if nErr != nil {
+				m.sendErrorInfo(w, m.notificationErrInfo(nErr))
+				return
+			}
+			m.sendTopicResponse(w, def, "topic definition")
+
+		case "POST":
+			audit.Log(auditevent.SaveTopic, r, topic)
+
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				info.Code = m.statusCodes.errReadReq.Code
+				info.Info = fmt.Sprintf("failed to read request body, err : %v", err)
+				logging.Errorf("%s %s", logPrefix, info.Info)
+				m.sendErrorInfo(w, info)
+				return
+			}
+
+			def := &notification.TopicConfig{}
+			if err = json.Unmarshal(data, def); err != nil {
+				info.Code = m.statusCodes.errUnmarshalPld.Code
+				info.Info = fmt.Sprintf("failed to unmarshal topic definition, err: %v", err)
+				logging.Errorf("%s %s", logPrefix, info.Info)
+				m.sendErrorInfo(w, info)
+				return
+			}
+
+			if info = m.saveTopic(topic, def); info.Code != m.statusCodes.ok.Code {
+				m.sendErrorInfo(w, info)
+				return
+			}
+
+			info.Info = fmt.Sprintf("Topic: %s stored", topic)
+			m.sendRuntimeInfo(w, info)
+
+		case "DELETE":
+			audit.Log(auditevent.DeleteTopic, r, topic)
+
+			if info = m.deleteTopic(topic); info.Code != m.statusCodes.ok.Code {
+				m.sendErrorInfo(w, info)
+				return
+			}
+
+			info.Info = fmt.Sprintf("Topic: %s deleted", topic)
+			m.sendRuntimeInfo(w, info)
+
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+
+	} else if match := topicsAll.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		audit.Log(auditevent.FetchTopics, r, nil)
+
+		topics, err := notification.ListTopics()
+		if err != nil {
+			info := &runtimeInfo{
+				Code: m.statusCodes.errTopicStoreFailed.Code,
+				Info: fmt.Sprintf("failed to read topic definitions from metakv, err: %v", err),
+			}
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			m.sendErrorInfo(w, info)
+			return
+		}
+		m.sendTopicResponse(w, topics, "topic definitions")
+
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (m *ServiceMgr) releaseNotificationsHandler(w http.ResponseWriter, r *http.Request, topic string, ack bool) {
+	logPrefix := "ServiceMgr::releaseNotificationsHandler"
+
+	info := &runtimeInfo{}
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	audit.Log(auditevent.LeaseNotifications, r, topic)
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		info.Code = m.statusCodes.errReadReq.Code
+		info.Info = fmt.Sprintf("failed to read request body, err : %v", err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	var keys notificationKeys
+	if err = json.Unmarshal(data, &keys); err != nil {
+		info.Code = m.statusCodes.errUnmarshalPld.Code
+		info.Info = fmt.Sprintf("failed to unmarshal notification keys, err: %v", err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	result, info := m.releaseNotifications(topic, keys.Keys, ack)
+	if info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	m.sendTopicResponse(w, result, "released notifications")
+}
+
+func (m *ServiceMgr) sendTopicResponse(w http.ResponseWriter, payload interface{}, what string) {
+	logPrefix := "ServiceMgr::sendTopicResponse"
+
+	response, err := json.MarshalIndent(payload, "", " ")
+	if err != nil {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errMarshalResp.Code,
+			Info: fmt.Sprintf("failed to marshal %s, err : %v", what, err),
+		}
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%s", string(response))
+}
+
+func (m *ServiceMgr) notificationErrInfo(err notification.Error) *runtimeInfo {
+	info := &runtimeInfo{Info: err.Details()}
+
+	switch err.Code() {
+	case notification.TopicNotFound:
+		info.Code = m.statusCodes.errTopicNotFound.Code
+		info.Info = fmt.Sprintf("Topic not found, %s", err.Details())
+	case notification.Timeout:
+		info.Code = m.statusCodes.errTopicTimeout.Code
+	default:
+		info.Code = m.statusCodes.errTopicStoreFailed.Code
+	}
+	return info
+}
+
+func (m *ServiceMgr) saveTopic(topic string, def *notification.TopicConfig) (info *runtimeInfo) {
+	logPrefix := "ServiceMgr::saveTopic"
+
+	info = &runtimeInfo{}
+	if def.Name == "" {
+		def.Name = topic
+	}
+
+	if def.Name != topic {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Topic name in the definition: %s doesn't match the one in URL: %s", def.Name, topic)
+		return
+	}
+
+	if err := def.Validate(); err != nil {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = err.Error()
+		return
+	}
+
+	if info = m.validateBucketExists(def.MetadataBucket); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonMemcached(def.MetadataBucket); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if err := notification.SaveTopic(def); err != nil {
+		info.Code = m.statusCodes.errMetakvWriteFailed.Code
+		info.Info = fmt.Sprintf("Topic: %s failed to store definition in metakv, err: %v", topic, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	logging.Infof("%s Topic: %s stored with metadata bucket: %s qos: %s capacity: %d lease_ms: %d",
+		logPrefix, topic, def.MetadataBucket, def.QoSName, def.MaxItems, def.LeaseMs)
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+func (m *ServiceMgr) deleteTopic(topic string) *runtimeInfo {
+	m.topicsMutex.Lock()
+	delete(m.topicSlices, topic)
+	m.topicsMutex.Unlock()
+
+	if err := notification.Manager.DeleteTopic(topic); err != nil {
+		return m.notificationErrInfo(err)
+	}
+	return &runtimeInfo{Code: m.statusCodes.ok.Code}
+}
+
+func (m *ServiceMgr) publishNotification(topic string, value json.RawMessage) *runtimeInfo {
+	if err := notification.Manager.Publish(topic, value); err != nil {
+		return m.notificationErrInfo(err)
+	}
+	return &runtimeInfo{Code: m.statusCodes.ok.Code}
+}
+
+// getTopicLeases returns the slice of the topic on this node, opening one if required
+func (m *ServiceMgr) getTopicLeases(topic string) (*topicLeases, *runtimeInfo) {
+	m.topicsMutex.Lock()
+	defer m.topicsMutex.Unlock()
+
+	if tl, ok := m.topicSlices[topic]; ok {
+		return tl, &runtimeInfo{Code: m.statusCodes.ok.Code}
+	}
+
+	slice, err := notification.Manager.OpenTopic(topic)
+	if err != nil {
+		return nil, m.notificationErrInfo(err)
+	}
+
+	tl := &topicLeases{
+		slice:  *slice,
+		leased: make(map[string]notification.Notification),
+	}
+	m.topicSlices[topic] = tl
+	return tl, &runtimeInfo{Code: m.statusCodes.ok.Code}
+}
+
+// dropTopicLeases forgets a slice that was closed underneath, e.g. when the topic was deleted
+func (m *ServiceMgr) dropTopicLeases(topic string, tl *topicLeases) {
+	m.topicsMutex.Lock()
+	defer m.topicsMutex.Unlock()
+
+	if m.topicSlices[topic] == tl {
+		delete(m.topicSlices, topic)
+	}
+}
+
+func (m *ServiceMgr) leaseNotifications(topic string, count int, timeout time.Duration) ([]*leasedNotification, *runtimeInfo) {
+	tl, info := m.getTopicLeases(topic)
+	if info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	notifyCh, err := tl.slice.NotifyChannel()
+	if err != nil && err.Code() == notification.TopicSliceClosed {
+		m.dropTopicLeases(topic, tl)
+		if tl, info = m.getTopicLeases(topic); info.Code != m.statusCodes.ok.Code {
+			return nil, info
+		}
+		notifyCh, err = tl.slice.NotifyChannel()
+	}
+	if err != nil {
+		return nil, m.notificationErrInfo(err)
+	}
+
+	var notifications []notification.Notification
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+wait:
+	for len(notifications) < count {
+		select {
+		case n := <-notifyCh:
+			notifications = append(notifications, n)
+		case <-deadline.C:
+			break wait
+		}
+	}
+
+	m.topicsMutex.Lock()
+	defer m.topicsMutex.Unlock()
+
+	now := time.Now()
+	for key, n := range tl.leased {
+		if now.After(n.Expiry()) {
+			delete(tl.leased, key)
+		}
+	}
+
+	leased := make([]*leasedNotification, 0, len(notifications))
+	for _, n := range notifications {
+		key, kErr := n.Key()
+		if kErr != nil {
+			continue
+		}
+		value, vErr := n.Value()
+		if vErr != nil {
+			continue
+		}
+
+		tl.leased[key] = n
+		leased = append(leased, &leasedNotification{Key: key, Value: value, Expiry: n.Expiry()})
+	}
+
+	return leased, &runtimeInfo{Code: m.statusCodes.ok.Code}
+}
+
+func (m *ServiceMgr) releaseNotifications(topic string, keys []string, ack bool) (*notificationAckResult, *runtimeInfo) {
+	logPrefix := "ServiceMgr::releaseNotifications"
+
+	m.topicsMutex.Lock()
+	tl, ok := m.topicSlices[topic]
+	m.topicsMutex.Unlock()
+
+	result := &notificationAckResult{Released: make([]string, 0), Unknown: make([]string, 0)}
+	if !ok {
+		result.Unknown = append(result.Unknown, keys...)
+		return result, &runtimeInfo{Code: m.statusCodes.ok.Code}
+	}
+
+	var ch chan<- notification.Notification
+	var err notification.Error
+	if ack {
+		ch, err = tl.slice.AckChannel()
+	} else {
+		ch, err = tl.slice.RequeueChannel()
+	}
+	if err != nil {
+		return nil, m.notificationErrInfo(err)
+	}
+
+	notifications := make(map[string]notification.Notification)
+	m.topicsMutex.Lock()
+	for _, key := range keys {
+		n, ok := tl.leased[key]
+		if !ok {
+			result.Unknown = append(result.Unknown, key)
+			continue
+		}
+		delete(tl.leased, key)
+		notifications[key] = n
+	}
+	m.topicsMutex.Unlock()
+
+	// Slice may get closed meanwhile, its leases expire in that case
+	timer := time.NewTimer(releaseTimeout)
+	defer timer.Stop()
+
+	for _, key := range keys {
+		n, ok := notifications[key]
+		if !ok {
+			continue
+		}
+
+		select {
+		case ch <- n:
+			result.Released = append(result.Released, key)
+		case <-timer.C:
+			logging.Errorf("%s Topic: %s timed out releasing notifications", logPrefix, topic)
+			return nil, &runtimeInfo{
+				Code: m.statusCodes.errTopicTimeout.Code,
+				Info: fmt.Sprintf("Topic: %s timed out releasing notifications", topic),
+			}
+		}
+	}
+
+	return result, &runtimeInfo{Code: m.statusCodes.ok.Code}
+}
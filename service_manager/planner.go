@@ -0,0 +1,51 @@
+package servicemanager
+
+import (
+	"fmt"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// planVbPlacement is a dry run of the planner for a function. strategy defaults to the
+// placement_strategy setting of the function
+func (m *ServiceMgr) planVbPlacement(appName, strategy string) ([]*common.PlannerNodeVbMapping, *runtimeInfo) {
+	logPrefix := "ServiceMgr::planVbPlacement"
+
+	app, info := m.getTempStore(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	if strategy == "" {
+		strategy = util.PlacementEven
+		if val, ok := app.Settings["placement_strategy"].(string); ok {
+			strategy = val
+		}
+	}
+
+	settings := map[string]interface{}{"placement_strategy": strategy}
+	if info = m.validatePossibleValues("placement_strategy", settings, util.PlacementStrategies); info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	mappings, err := m.superSup.PlanVbPlacement(strategy, app.DeploymentConfig.SourceBucket)
+	if err != nil {
+		info.Code = m.statusCodes.errActiveEventingNodes.Code
+		info.Info = fmt.Sprintf("Function: %s failed to plan vbucket placement, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return mappings, info
+}
+
+func (m *ServiceMgr) deletePlacementPlan(appName string) {
+	logPrefix := "ServiceMgr::deletePlacementPlan"
+
+	if err := util.MetaKvDelete(metakvPlacementPlansPath+appName, nil); err != nil {
+		logging.Errorf("%s Function: %s failed to delete placement plan, err: %v", logPrefix, appName, err)
+	}
+}
@@ -91,6 +91,16 @@ type statusCodes struct {
 	errSyncGatewayEnabled     statusBase
 	errAppNotFound            statusBase
 	errMetakvWriteFailed      statusBase
+	errDeadLetterDisabled     statusBase
+	errTopicNotFound          statusBase
+	errTopicTimeout           statusBase
+	errTopicStoreFailed       statusBase
+	errRevisionNotFound       statusBase
+	errGetRevision            statusBase
+	errTestFunction           statusBase
+	errBulkOpAborted          statusBase
+	errSnapshotNotFound       statusBase
+	errCollectionMissing      statusBase
 }
 
 func (m *ServiceMgr) getDisposition(code int) int {
@@ -191,6 +201,26 @@ func (m *ServiceMgr) getDisposition(code int) int {
 		return http.StatusNotFound
 	case m.statusCodes.errMetakvWriteFailed.Code:
 		return http.StatusInternalServerError
+	case m.statusCodes.errDeadLetterDisabled.Code:
+		return http.StatusBadRequest
+	case m.statusCodes.errTopicNotFound.Code:
+		return http.StatusNotFound
+	case m.statusCodes.errTopicTimeout.Code:
+		return http.StatusRequestTimeout
+	case m.statusCodes.errTopicStoreFailed.Code:
+		return http.StatusInternalServerError
+	case m.statusCodes.errRevisionNotFound.Code:
+		return http.StatusNotFound
+	case m.statusCodes.errGetRevision.Code:
+		return http.StatusInternalServerError
+	case m.statusCodes.errTestFunction.Code:
+		return http.StatusInternalServerError
+	case m.statusCodes.errBulkOpAborted.Code:
+		return http.StatusConflict
+	case m.statusCodes.errSnapshotNotFound.Code:
+		return http.StatusNotFound
+	case m.statusCodes.errCollectionMissing.Code:
+		return http.StatusInternalServerError
 	default:
 		logging.Warnf("Unknown status code: %v", code)
 		return http.StatusInternalServerError
@@ -248,6 +278,16 @@ func (m *ServiceMgr) initErrCodes() {
 		errSyncGatewayEnabled:     statusBase{"ERR_SYNC_GATEWAY_ENABLED", 52},
 		errAppNotFound:            statusBase{"ERR_APP_NOT_FOUND", 53},
 		errMetakvWriteFailed:      statusBase{"ERR_METAKV_WRITE_FAILED", 54},
+		errDeadLetterDisabled:     statusBase{"ERR_DEAD_LETTER_DISABLED", 55},
+		errTopicNotFound:          statusBase{"ERR_TOPIC_NOT_FOUND", 56},
+		errTopicTimeout:           statusBase{"ERR_TOPIC_TIMEOUT", 57},
+		errTopicStoreFailed:       statusBase{"ERR_TOPIC_STORE_FAILED", 58},
+		errRevisionNotFound:       statusBase{"ERR_REVISION_NOT_FOUND", 59},
+		errGetRevision:            statusBase{"ERR_GET_REVISION", 60},
+		errTestFunction:           statusBase{"ERR_TEST_FUNCTION", 61},
+		errBulkOpAborted:          statusBase{"ERR_BULK_OP_ABORTED", 62},
+		errSnapshotNotFound:       statusBase{"ERR_CHECKPOINT_SNAPSHOT_NOT_FOUND", 63},
+		errCollectionMissing:      statusBase{"ERR_COLLECTION_MISSING", 64},
 	}
 
 	errors := []errorPayload{
@@ -514,6 +554,56 @@ func (m *ServiceMgr) initErrCodes() {
 			Code:        m.statusCodes.errMetakvWriteFailed.Code,
 			Description: "Metakv write failed",
 		},
+		{
+			Name:        m.statusCodes.errDeadLetterDisabled.Name,
+			Code:        m.statusCodes.errDeadLetterDisabled.Code,
+			Description: "Dead letter bucket isn't configured for the function",
+		},
+		{
+			Name:        m.statusCodes.errTopicNotFound.Name,
+			Code:        m.statusCodes.errTopicNotFound.Code,
+			Description: "Notification topic not found",
+		},
+		{
+			Name:        m.statusCodes.errTopicTimeout.Name,
+			Code:        m.statusCodes.errTopicTimeout.Code,
+			Description: "Notification topic operation timed out",
+		},
+		{
+			Name:        m.statusCodes.errTopicStoreFailed.Name,
+			Code:        m.statusCodes.errTopicStoreFailed.Code,
+			Description: "Notification topic store operation failed",
+		},
+		{
+			Name:        m.statusCodes.errRevisionNotFound.Name,
+			Code:        m.statusCodes.errRevisionNotFound.Code,
+			Description: "Function revision not found",
+		},
+		{
+			Name:        m.statusCodes.errGetRevision.Name,
+			Code:        m.statusCodes.errGetRevision.Code,
+			Description: "Failed to read function revisions",
+		},
+		{
+			Name:        m.statusCodes.errTestFunction.Name,
+			Code:        m.statusCodes.errTestFunction.Code,
+			Description: "Failed to run test events against function",
+		},
+		{
+			Name:        m.statusCodes.errBulkOpAborted.Name,
+			Code:        m.statusCodes.errBulkOpAborted.Code,
+			Description: "Function was left unchanged as the bulk operation was aborted",
+		},
+		{
+			Name:        m.statusCodes.errSnapshotNotFound.Name,
+			Code:        m.statusCodes.errSnapshotNotFound.Code,
+			Description: "No checkpoint snapshot saved for the function",
+		},
+		{
+			Name:        m.statusCodes.errCollectionMissing.Name,
+			Code:        m.statusCodes.errCollectionMissing.Code,
+			Description: "Scope or collection does not exist",
+		},
 	}
 
 	m.errorCodes = make(map[int]errorPayload)
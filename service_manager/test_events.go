@@ -0,0 +1,119 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/consumer"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/parser"
+	"github.com/couchbase/eventing/util"
+)
+
+// Upper bound on synthetic events accepted in a single test request
+const maxTestEvents = 100
+
+type testEventsRequest struct {
+	Events []common.TestEvent `json:"events"`
+}
+
+type testEventsResponse struct {
+	Results []*common.TestEventResult `json:"results"`
+}
+
+func (m *ServiceMgr) validateTestEvents(events []common.TestEvent) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	if len(events) == 0 || len(events) > maxTestEvents {
+		info.Info = fmt.Sprintf("Number of events should be between 1 and %d", maxTestEvents)
+		return
+	}
+
+	for i, event := range events {
+		switch event.Type {
+		case common.TestEventMutation:
+			if len(event.Value) == 0 || !json.Valid(event.Value) {
+				info.Info = fmt.Sprintf("Event %d: value should be a valid JSON", i)
+				return
+			}
+		case common.TestEventDeletion:
+		default:
+			info.Info = fmt.Sprintf("Event %d: type should be either %s or %s", i,
+				common.TestEventMutation, common.TestEventDeletion)
+			return
+		}
+
+		if event.Key == "" {
+			info.Info = fmt.Sprintf("Event %d: key should not be empty", i)
+			return
+		}
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// testFunction runs the stored definition of the function against the given events in
+// a sandboxed worker. Bucket writes, cURL calls, timers and notifications are captured
+// and returned per event instead of taking effect.
+func (m *ServiceMgr) testFunction(appName string, events []common.TestEvent) (*testEventsResponse, *runtimeInfo) {
+	logPrefix := "ServiceMgr::testFunction"
+
+	if info := m.validateTestEvents(events); info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	app, info := m.getTempStore(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	appContent := m.encodeAppPayload(&app)
+
+	var handlerHeaders []string
+	if headers, exists := app.Settings["handler_headers"]; exists {
+		handlerHeaders = util.ToStringArray(headers)
+	} else {
+		handlerHeaders = common.GetDefaultHandlerHeaders()
+	}
+	handlerFooters := util.ToStringArray(app.Settings["handler_footers"])
+
+	var n1qlParams string
+	if consistency, exists := app.Settings["n1ql_consistency"]; exists {
+		n1qlParams = "{ 'consistency': '" + consistency.(string) + "' }"
+	}
+	parsedCode, _ := parser.TranspileQueries(app.AppHandlers, n1qlParams)
+
+	compilationInfo, err := (&consumer.Consumer{}).SpawnCompilationWorker(parsedCode, string(appContent), app.Name,
+		m.adminHTTPPort, handlerHeaders, handlerFooters)
+	if err != nil {
+		info.Code = m.statusCodes.errTestFunction.Code
+		info.Info = fmt.Sprintf("Function: %s failed to compile handler, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+	if !compilationInfo.CompileSuccess {
+		info.Code = m.statusCodes.errHandlerCompile.Code
+		info.Info = compilationInfo
+		return nil, info
+	}
+
+	executionTimeout := 60
+	if val, ok := app.Settings["execution_timeout"].(float64); ok {
+		executionTimeout = int(val)
+	}
+
+	results, err := (&consumer.Consumer{}).SpawnTestWorker(parsedCode, string(appContent), app.Name,
+		m.adminHTTPPort, handlerHeaders, handlerFooters, executionTimeout, events)
+	if err != nil {
+		info.Code = m.statusCodes.errTestFunction.Code
+		info.Info = fmt.Sprintf("Function: %s failed to run test events, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	logging.Infof("%s Function: %s ran %d test events", logPrefix, appName, len(results))
+	return &testEventsResponse{Results: results}, info
+}
@@ -96,19 +96,28 @@ func (m *ServiceMgr) fillMissingWithDefaults(appName string, settings map[string
 	fillMissingDefault(app, settings, "n1ql_prepare_all", false)
 	fillMissingDefault(app, settings, "checkpoint_interval", float64(60000))
 	fillMissingDefault(app, settings, "cleanup_timers", false)
+	fillMissingDefault(app, settings, "coalesce_window_ms", float64(0))
 	fillMissingDefault(app, settings, "cpp_worker_thread_count", float64(2))
+	fillMissingDefault(app, settings, "dcp_compression", false)
+	fillMissingDefault(app, settings, "dcp_compression_passthrough", false)
 	fillMissingDefault(app, settings, "deadline_timeout", float64(62))
 	fillMissingDefault(app, settings, "execution_timeout", float64(60))
 	fillMissingDefault(app, settings, "feedback_batch_size", float64(100))
 	fillMissingDefault(app, settings, "feedback_read_buffer_size", float64(65536))
+	fillMissingDefault(app, settings, "idempotency_journal", false)
 	fillMissingDefault(app, settings, "idle_checkpoint_interval", float64(30000))
 	fillMissingDefault(app, settings, "lcb_inst_capacity", float64(5))
 	fillMissingDefault(app, settings, "log_level", "INFO")
+	fillMissingDefault(app, settings, "ordering", "none")
+	fillMissingDefault(app, settings, "placement_strategy", util.PlacementEven)
 	fillMissingDefault(app, settings, "poll_bucket_interval", float64(10))
+	fillMissingDefault(app, settings, "shadow_copy", false)
 	fillMissingDefault(app, settings, "sock_batch_size", float64(100))
 	fillMissingDefault(app, settings, "tick_duration", float64(60000))
 	fillMissingDefault(app, settings, "timer_context_size", float64(1024))
 	fillMissingDefault(app, settings, "undeploy_routine_count", float64(6))
+	fillMissingDefault(app, settings, "update_batch_size", float64(0))
+	fillMissingDefault(app, settings, "update_batch_window_ms", float64(100))
 	fillMissingDefault(app, settings, "worker_count", float64(3))
 	fillMissingDefault(app, settings, "worker_feedback_queue_cap", float64(500))
 	fillMissingDefault(app, settings, "worker_queue_cap", float64(100*1000))
@@ -137,6 +146,7 @@ func (m *ServiceMgr) fillMissingWithDefaults(appName string, settings map[string
 	// DCP connection related configurations
 	fillMissingDefault(app, settings, "agg_dcp_feed_mem_cap", float64(1024))
 	fillMissingDefault(app, settings, "data_chan_size", float64(50))
+	fillMissingDefault(app, settings, "dcp_connection_buffer_size", float64(20))
 	fillMissingDefault(app, settings, "dcp_gen_chan_size", float64(10000))
 	fillMissingDefault(app, settings, "dcp_num_connections", float64(1))
 
@@ -311,9 +321,23 @@ func (m *ServiceMgr) checkLifeCycleOpsDuringRebalance() (info *runtimeInfo) {
 	return
 }
 
+func (b *bucket) keyspace() common.Keyspace {
+	return common.NewKeyspace(b.BucketName, b.ScopeName, b.CollectionName)
+}
+
+func (cfg *depCfg) sourceKeyspace() common.Keyspace {
+	return common.NewKeyspace(cfg.SourceBucket, cfg.SourceScope, cfg.SourceCollection)
+}
+
+// bucketKeyspace is the keyspace of a name that can only be a bucket, as the metadata bucket or
+// the keyspace of a N1QL statement
+func bucketKeyspace(bucketName string) common.Keyspace {
+	return common.NewKeyspace(bucketName, "", "")
+}
+
 func (m *ServiceMgr) getSourceBinding(cfg *depCfg) *bucket {
 	for _, binding := range cfg.Buckets {
-		if binding.BucketName == cfg.SourceBucket && binding.Access == "rw" {
+		if binding.keyspace() == cfg.sourceKeyspace() && binding.Access == "rw" {
 			return &binding
 		}
 	}
@@ -321,10 +345,12 @@ func (m *ServiceMgr) getSourceBinding(cfg *depCfg) *bucket {
 }
 
 func (m *ServiceMgr) getSourceBindingFromFlatBuf(config *cfg.DepCfg, appdata *cfg.Config) *cfg.Bucket {
+	sourceKeyspace := common.NewKeyspace(string(config.SourceBucket()), string(config.SourceScope()), string(config.SourceCollection()))
 	binding := new(cfg.Bucket)
 	for idx := 0; idx < config.BucketsLength(); idx++ {
 		if config.Buckets(binding, idx) {
-			if string(binding.BucketName()) == string(config.SourceBucket()) && string(appdata.Access(idx)) == "rw" {
+			bindingKeyspace := common.NewKeyspace(string(binding.BucketName()), string(binding.ScopeName()), string(binding.CollectionName()))
+			if bindingKeyspace == sourceKeyspace && string(appdata.Access(idx)) == "rw" {
 				return binding
 			}
 		}
@@ -334,7 +360,7 @@ func (m *ServiceMgr) getSourceBindingFromFlatBuf(config *cfg.DepCfg, appdata *cf
 
 func (m *ServiceMgr) isSrcMutationEnabled(cfg *depCfg) bool {
 	for _, binding := range cfg.Buckets {
-		if binding.BucketName == cfg.SourceBucket && binding.Access == "rw" {
+		if binding.keyspace() == cfg.sourceKeyspace() && binding.Access == "rw" {
 			return true
 		}
 	}
@@ -357,7 +383,8 @@ func (m *ServiceMgr) isAppDeployable(app *application) bool {
 		appdata := cfg.GetRootAsConfig(data, 0)
 		config := new(cfg.DepCfg)
 		depcfg := appdata.DepCfg(config)
-		if app.DeploymentConfig.SourceBucket == string(depcfg.SourceBucket()) {
+		sourceKeyspace := common.NewKeyspace(string(depcfg.SourceBucket()), string(depcfg.SourceScope()), string(depcfg.SourceCollection()))
+		if app.DeploymentConfig.sourceKeyspace() == sourceKeyspace {
 			binding := m.getSourceBindingFromFlatBuf(depcfg, appdata)
 			if binding != nil {
 				return false
@@ -369,12 +396,12 @@ func (m *ServiceMgr) isAppDeployable(app *application) bool {
 
 func (m *ServiceMgr) getSourceAndDestinationsFromDepCfg(cfg *depCfg) (src string, dest map[string]struct{}) {
 	dest = make(map[string]struct{})
-	src = cfg.SourceBucket
+	src = cfg.sourceKeyspace().String()
 	dest[cfg.MetadataBucket] = struct{}{}
 	for idx := 0; idx < len(cfg.Buckets); idx++ {
-		bucketName := cfg.Buckets[idx].BucketName
-		if bucketName != src && cfg.Buckets[idx].Access == "rw" {
-			dest[bucketName] = struct{}{}
+		keyspace := cfg.Buckets[idx].keyspace().String()
+		if keyspace != src && cfg.Buckets[idx].Access == "rw" {
+			dest[keyspace] = struct{}{}
 		}
 	}
 	return src, dest
@@ -416,6 +443,28 @@ func (m *ServiceMgr) UpdateBucketGraphFromMetakv(functionName string) error {
 	return nil
 }
 
+// ApplyScheduledTransition pauses or resumes the function as asked by its schedule
+func (m *ServiceMgr) ApplyScheduledTransition(functionName, action string) error {
+	data, err := json.Marshal(bulkSettings(action))
+	if err != nil {
+		return err
+	}
+
+	if info := m.setSettings(functionName, data, revisionAuthor{Source: "schedule"}); info.Code != m.statusCodes.ok.Code {
+		return fmt.Errorf("%v", info.Info)
+	}
+	return nil
+}
+
+// deleteScheduleClaim removes the last scheduled transition claimed for a deleted function
+func (m *ServiceMgr) deleteScheduleClaim(appName string) {
+	logPrefix := "ServiceMgr::deleteScheduleClaim"
+
+	if err := util.MetaKvDelete(metakvSchedulePath+appName, nil); err != nil {
+		logging.Errorf("%s Function: %s failed to delete schedule claim, err: %v", logPrefix, appName, err)
+	}
+}
+
 func (m *ServiceMgr) validateQueryKey(query url.Values) (info *runtimeInfo) {
 	info = &runtimeInfo{}
 	info.Code = m.statusCodes.ok.Code
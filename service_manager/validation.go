@@ -22,7 +22,7 @@ func (m *ServiceMgr) sanitiseApplication(app *application) (info *runtimeInfo) {
 
 	for idx := 0; idx < len(app.DeploymentConfig.Buckets); idx++ {
 		if app.DeploymentConfig.Buckets[idx].Access == "" {
-			if app.DeploymentConfig.SourceBucket == app.DeploymentConfig.Buckets[idx].BucketName {
+			if app.DeploymentConfig.sourceKeyspace() == app.DeploymentConfig.Buckets[idx].keyspace() {
 				app.DeploymentConfig.Buckets[idx].Access = "r"
 			} else {
 				app.DeploymentConfig.Buckets[idx].Access = "rw"
@@ -57,7 +57,7 @@ func (m *ServiceMgr) validateAppRecursion(app *application) (info *runtimeInfo)
 	_, pinfos := parser.TranspileQueries(app.AppHandlers, "")
 	// Prevent deployment of handler with N1QL writing to source bucket
 	for _, pinfo := range pinfos {
-		if pinfo.PInfo.KeyspaceName == app.DeploymentConfig.SourceBucket {
+		if bucketKeyspace(pinfo.PInfo.KeyspaceName) == app.DeploymentConfig.sourceKeyspace() {
 			info.Code = m.statusCodes.errInterBucketRecursion.Code
 			info.Info = fmt.Sprintf("Function: %s N1QL dml to source bucket %s", app.Name, pinfo.PInfo.KeyspaceName)
 			logging.Errorf("%s %s", logPrefix, info.Info)
@@ -267,6 +267,12 @@ func (m *ServiceMgr) validateApplicationName(applicationName string) (info *runt
 		return
 	}
 
+	if applicationName == bulkReservedName {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Function name %s is reserved", bulkReservedName)
+		return
+	}
+
 	appNameRegex := regexp.MustCompile("^[a-zA-Z0-9][a-zA-Z0-9_-]*$")
 	if !appNameRegex.MatchString(applicationName) {
 		info.Code = m.statusCodes.errInvalidConfig.Code
@@ -320,6 +326,44 @@ func (m *ServiceMgr) validateBucketExists(bucketName string) (info *runtimeInfo)
 	return
 }
 
+// validateScopeAndCollection checks that a scope and a collection are named together, or neither
+// is for the default collection of the bucket
+func (m *ServiceMgr) validateScopeAndCollection(scopeName, collectionName, field string) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	if (scopeName == "") != (collectionName == "") {
+		info.Info = fmt.Sprintf("%s should have both a scope and a collection, or neither", field)
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+func (m *ServiceMgr) validateCollectionExists(keyspace common.Keyspace) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.ok.Code
+
+	if keyspace.IsDefaultCollection() {
+		return
+	}
+
+	nsServerEndpoint := net.JoinHostPort(util.Localhost(), m.restPort)
+	_, err := util.CollectionID(nsServerEndpoint, keyspace)
+	if err == util.ErrScopeMissing || err == util.ErrCollectionMissing {
+		info.Code = m.statusCodes.errCollectionMissing.Code
+		info.Info = fmt.Sprintf("Collection %s does not exist, err: %v", keyspace, err)
+		return
+	}
+	if err != nil {
+		info.Code = m.statusCodes.errConnectNsServer.Code
+		info.Info = fmt.Sprintf("Failed to get collections of bucket %s, err: %v", keyspace.BucketName, err)
+		return
+	}
+	return
+}
+
 func (m *ServiceMgr) validateConfig(c map[string]interface{}) (info *runtimeInfo) {
 	info = &runtimeInfo{}
 	info.Code = m.statusCodes.errInvalidConfig.Code
@@ -360,6 +404,10 @@ func (m *ServiceMgr) validateConfig(c map[string]interface{}) (info *runtimeInfo
 		return
 	}
 
+	if info = m.validatePositiveInteger("function_max_revisions", c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	info.Code = m.statusCodes.ok.Code
 	return
 }
@@ -414,6 +462,10 @@ func (m *ServiceMgr) validateDeploymentConfig(deploymentConfig *depCfg) (info *r
 		return
 	}
 
+	if info = m.validateScopeAndCollection(deploymentConfig.SourceScope, deploymentConfig.SourceCollection, "Source"); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validateBucketExists(deploymentConfig.SourceBucket); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -422,6 +474,10 @@ func (m *ServiceMgr) validateDeploymentConfig(deploymentConfig *depCfg) (info *r
 		return
 	}
 
+	if info = m.validateCollectionExists(deploymentConfig.sourceKeyspace()); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validateNonEmpty(deploymentConfig.MetadataBucket, "Metadata bucket name"); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -438,6 +494,150 @@ func (m *ServiceMgr) validateDeploymentConfig(deploymentConfig *depCfg) (info *r
 	if info = m.validateCurlBindings(deploymentConfig.Curl, aliasSet); info.Code != m.statusCodes.ok.Code {
 		return
 	}
+
+	if info = m.validateDeadLetter(deploymentConfig); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+func (m *ServiceMgr) validateDeadLetter(deploymentConfig *depCfg) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.ok.Code
+
+	if deploymentConfig.DeadLetter == nil {
+		return
+	}
+
+	bucketName := deploymentConfig.DeadLetter.BucketName
+	if info = m.validateNonEmpty(bucketName, "Dead letter bucket name"); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if bucketName == deploymentConfig.SourceBucket {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Dead letter bucket %s can't be the same as source bucket", bucketName)
+		return
+	}
+
+	if info = m.validateBucketExists(bucketName); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonMemcached(bucketName); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+func (m *ServiceMgr) validateEventFilter(field string, settings map[string]interface{}) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	val, ok := settings[field]
+	if !ok {
+		info.Code = m.statusCodes.ok.Code
+		return
+	}
+
+	if _, ok := val.(map[string]interface{}); !ok {
+		info.Info = fmt.Sprintf("%s must be an object", field)
+		return
+	}
+
+	filter, err := common.ParseEventFilter(val)
+	if err != nil {
+		info.Info = fmt.Sprintf("Invalid value for %s, err: %v", field, err)
+		return
+	}
+
+	if filter.KeyPrefix == "" && filter.KeyRegex == "" && filter.Predicate == nil {
+		info.Info = fmt.Sprintf("%s must have at least one of key_prefix, key_regex or predicate", field)
+		return
+	}
+
+	if filter.KeyRegex != "" {
+		if _, err := regexp.Compile(filter.KeyRegex); err != nil {
+			info.Info = fmt.Sprintf("Invalid key_regex in %s, err: %v", field, err)
+			return
+		}
+	}
+
+	if predicate := filter.Predicate; predicate != nil {
+		if predicate.Path == "" {
+			info.Info = fmt.Sprintf("predicate in %s must have a path", field)
+			return
+		}
+
+		if !util.Contains(predicate.Op, common.EventFilterOps) {
+			info.Info = fmt.Sprintf("Invalid op for predicate in %s, possible values are %s", field,
+				strings.Join(common.EventFilterOps, ", "))
+			return
+		}
+
+		if (predicate.Op == "eq" || predicate.Op == "ne") && predicate.Value == nil {
+			info.Info = fmt.Sprintf("predicate in %s must have a value for op %s", field, predicate.Op)
+			return
+		}
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+func (m *ServiceMgr) validateStreamSeqNos(field string, settings map[string]interface{}) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	val, ok := settings[field]
+	if !ok {
+		info.Code = m.statusCodes.ok.Code
+		return
+	}
+
+	if _, ok := val.(map[string]interface{}); !ok {
+		info.Info = fmt.Sprintf("%s must be an object", field)
+		return
+	}
+
+	if _, err := common.ParseStreamSeqNos(val); err != nil {
+		info.Info = fmt.Sprintf("%s must map vbucket numbers to non-negative seq nos, err: %v", field, err)
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+func (m *ServiceMgr) validateSchedule(field string, settings map[string]interface{}) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	val, ok := settings[field]
+	if !ok {
+		info.Code = m.statusCodes.ok.Code
+		return
+	}
+
+	if _, ok := val.(map[string]interface{}); !ok {
+		info.Info = fmt.Sprintf("%s must be an object", field)
+		return
+	}
+
+	schedule, err := common.ParseSchedule(val)
+	if err != nil {
+		info.Info = fmt.Sprintf("Invalid value for %s, err: %v", field, err)
+		return
+	}
+
+	if err = util.ValidateSchedule(schedule); err != nil {
+		info.Info = fmt.Sprintf("Invalid %s, err: %v", field, err)
+		return
+	}
+
 	info.Code = m.statusCodes.ok.Code
 	return
 }
@@ -450,6 +650,9 @@ func (m *ServiceMgr) validateBucketBindings(bindings []bucket, existingAliases m
 		if info = m.validateNonEmpty(binding.BucketName, "Bucket alias name"); info.Code != m.statusCodes.ok.Code {
 			return
 		}
+		if info = m.validateScopeAndCollection(binding.ScopeName, binding.CollectionName, fmt.Sprintf("Bucket alias %s", binding.Alias)); info.Code != m.statusCodes.ok.Code {
+			return
+		}
 		if info = m.validateAliasName(binding.Alias); info.Code != m.statusCodes.ok.Code {
 			return
 		}
@@ -499,6 +702,11 @@ func (m *ServiceMgr) validateCurlBindings(bindings []common.Curl, existingAliase
 		if info = m.validateAliasName(binding.Value); info.Code != m.statusCodes.ok.Code {
 			return
 		}
+		if binding.MaxRequestsPerSec < 0 || binding.MaxConcurrent < 0 || binding.TimeoutMs < 0 {
+			info.Info = fmt.Sprintf("URL alias %s can not have negative max_requests_per_sec, max_concurrent or timeout_ms", binding.Value)
+			info.Code = m.statusCodes.errInvalidConfig.Code
+			return
+		}
 
 		if _, exists := existingAliases[binding.Value]; exists {
 			info.Info = fmt.Sprintf("URL alias %s is not unique", binding.Value)
@@ -755,6 +963,19 @@ func (m *ServiceMgr) validateTimerContextSize(field string, settings map[string]
 	return
 }
 
+func (m *ServiceMgr) validateDcpBufferSize(field string, settings map[string]interface{}) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	if val, ok := settings[field]; ok && val.(float64) > 1024 {
+		info.Info = fmt.Sprintf("%s value can not be more than 1024MB", field)
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
 func (m *ServiceMgr) validatePossibleValues(field string, settings map[string]interface{}, possibleValues []string) (info *runtimeInfo) {
 	info = &runtimeInfo{}
 	info.Code = m.statusCodes.errInvalidConfig.Code
@@ -802,19 +1023,51 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validateBoolean("idempotency_journal", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("shadow_copy", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePossibleValues("ordering", settings, []string{"none", "strict_per_key"}); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePossibleValues("placement_strategy", settings, util.PlacementStrategies); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("coalesce_window_ms", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("cpp_worker_thread_count", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
 
-	dcpStreamBoundaryValues := []string{"everything", "from_now", "from_prior"}
+	dcpStreamBoundaryValues := []string{"everything", "from_now", "from_prior", "from_seqnos", "from_checkpoint_snapshot"}
 	if info = m.validatePossibleValues("dcp_stream_boundary", settings, dcpStreamBoundaryValues); info.Code != m.statusCodes.ok.Code {
 		return
 	}
 
+	if info = m.validateStreamSeqNos("dcp_stream_seqnos", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("deadline_timeout", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
 
+	if info = m.validateEventFilter("event_filter", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateSchedule("schedule", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("execution_timeout", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -913,6 +1166,14 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validateNonNegativeInteger("update_batch_size", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePositiveInteger("update_batch_window_ms", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	// Process related configuration
 	if info = m.validateBoolean("breakpad_on", true, settings); info.Code != m.statusCodes.ok.Code {
 		return
@@ -953,6 +1214,14 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validatePositiveInteger("dcp_connection_buffer_size", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateDcpBufferSize("dcp_connection_buffer_size", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("dcp_gen_chan_size", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -961,6 +1230,14 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validateBoolean("dcp_compression", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("dcp_compression_passthrough", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	// N1QL related configuration
 	if info = m.validatePossibleValues("n1ql_consistency", settings, m.consistencyValues); info.Code != m.statusCodes.ok.Code {
 		return
@@ -0,0 +1,539 @@
+package servicemanager
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/cbauth/metakv"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Every successful save of a function to the primary or temp store records a revision
+// of its code, depcfg and settings. Revisions are fragmented like function definitions,
+// and an index per function lists them in the order they were saved.
+
+const (
+	defaultMaxRevisions = 10
+
+	revisionIndexRetryCount = 5
+
+	// Code diffs of larger functions are reported as a single replaced block
+	maxDiffCells = 4 * 1024 * 1024
+)
+
+// Settings that change with lifecycle operations, they aren't part of what identifies a revision
+var lifecycleSettings = []string{"deployment_status", "processing_status", "using_timer"}
+
+func requestAuthor(r *http.Request) revisionAuthor {
+	creds, err := cbauth.AuthWebCreds(r)
+	if err != nil || creds == nil {
+		return revisionAuthor{}
+	}
+	return revisionAuthor{Source: creds.Domain(), User: creds.Name()}
+}
+
+func (m *ServiceMgr) maxRevisions() int {
+	config, info := m.getConfig()
+	if info.Code != m.statusCodes.ok.Code {
+		return defaultMaxRevisions
+	}
+
+	if val, exists := config["function_max_revisions"]; exists {
+		if count, ok := val.(float64); ok && count > 0 {
+			return int(count)
+		}
+	}
+	return defaultMaxRevisions
+}
+
+// newRevision captures the definition of a function, curl credentials aren't retained
+func newRevision(app *application, author revisionAuthor, deployed bool) *functionRevision {
+	rev := &functionRevision{
+		revisionSummary: revisionSummary{
+			Author:    author,
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Deployed:  deployed,
+		},
+		AppHandlers:      app.AppHandlers,
+		DeploymentConfig: app.DeploymentConfig,
+		Settings:         util.DeepCopy(app.Settings),
+	}
+
+	rev.DeploymentConfig.Curl = make([]common.Curl, len(app.DeploymentConfig.Curl))
+	for i, binding := range app.DeploymentConfig.Curl {
+		binding.Username = ""
+		binding.Password = ""
+		binding.BearerKey = ""
+		rev.DeploymentConfig.Curl[i] = binding
+	}
+
+	content := struct {
+		AppHandlers      string                 `json:"appcode"`
+		DeploymentConfig depCfg                 `json:"depcfg"`
+		Settings         map[string]interface{} `json:"settings"`
+	}{rev.AppHandlers, rev.DeploymentConfig, util.DeepCopy(rev.Settings)}
+	for _, setting := range lifecycleSettings {
+		delete(content.Settings, setting)
+	}
+
+	data, _ := json.Marshal(content)
+	rev.Hash = fmt.Sprintf("%x", md5.Sum(data))
+	return rev
+}
+
+func (m *ServiceMgr) recordRevision(app *application, author revisionAuthor, deployed bool) {
+	logPrefix := "ServiceMgr::recordRevision"
+
+	rev := newRevision(app, author, deployed)
+	for i := 0; i < revisionIndexRetryCount; i++ {
+		index, metaRev, err := m.readRevisionIndex(app.Name)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to read revision index, err: %v", logPrefix, app.Name, err)
+			return
+		}
+
+		// Same definition saved again, e.g. draft followed by deploy
+		written := false
+		if n := len(index.Revisions); n > 0 && index.Revisions[n-1].Hash == rev.Hash {
+			latest := index.Revisions[n-1]
+			if latest.Deployed || !deployed {
+				return
+			}
+			latest.Deployed = true
+		} else {
+			index.NextRev++
+			rev.Rev = index.NextRev
+
+			fragments, err := m.writeRevision(app.Name, rev)
+			if err != nil {
+				logging.Errorf("%s Function: %s failed to write revision: %d, err: %v", logPrefix, app.Name, rev.Rev, err)
+				return
+			}
+			index.Revisions = append(index.Revisions, &revisionIndexEntry{revisionSummary: rev.revisionSummary, Fragments: fragments})
+			written = true
+		}
+
+		var evicted []*revisionIndexEntry
+		if limit := m.maxRevisions(); len(index.Revisions) > limit {
+			evicted = index.Revisions[:len(index.Revisions)-limit]
+			index.Revisions = index.Revisions[len(index.Revisions)-limit:]
+		}
+
+		data, err := json.Marshal(index)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to marshal revision index, err: %v", logPrefix, app.Name, err)
+			return
+		}
+
+		// Revision of the index guards against concurrent saves from other nodes
+		if metaRev == nil {
+			err = metakv.Add(metakvVersionsIndexPath+app.Name, data)
+		} else {
+			err = metakv.Set(metakvVersionsIndexPath+app.Name, data, metaRev)
+		}
+		if err == metakv.ErrRevMismatch {
+			if written {
+				util.MetakvRecursiveDelete(revisionPath(app.Name, rev.Rev))
+			}
+			continue
+		}
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to write revision index, err: %v", logPrefix, app.Name, err)
+			return
+		}
+
+		for _, entry := range evicted {
+			util.MetakvRecursiveDelete(revisionPath(app.Name, entry.Rev))
+		}
+
+		logging.Infof("%s Function: %s recorded revision: %d deployed: %t", logPrefix, app.Name,
+			index.Revisions[len(index.Revisions)-1].Rev, deployed)
+		return
+	}
+
+	logging.Errorf("%s Function: %s gave up recording revision after concurrent updates", logPrefix, app.Name)
+}
+
+func revisionPath(appName string, rev uint64) string {
+	return fmt.Sprintf("%s%s/%d/", metakvVersionsPath, appName, rev)
+}
+
+func (m *ServiceMgr) readRevisionIndex(appName string) (*revisionIndex, interface{}, error) {
+	data, metaRev, err := metakv.Get(metakvVersionsIndexPath + appName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	index := &revisionIndex{}
+	if data == nil {
+		return index, metaRev, nil
+	}
+
+	if err = json.Unmarshal(data, index); err != nil {
+		return nil, nil, err
+	}
+	return index, metaRev, nil
+}
+
+func (m *ServiceMgr) writeRevision(appName string, rev *functionRevision) (int, error) {
+	data, err := json.Marshal(rev)
+	if err != nil {
+		return 0, err
+	}
+
+	payload, err := util.MaybeCompress(data, true)
+	if err != nil {
+		return 0, err
+	}
+
+	path := revisionPath(appName, rev.Rev)
+	fragments := 0
+	for start := 0; start < len(payload); start += util.MetaKvMaxDocSize() {
+		end := start + util.MetaKvMaxDocSize()
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		if err = util.MetakvSet(path+strconv.Itoa(fragments), payload[start:end], nil); err != nil {
+			util.MetakvRecursiveDelete(path)
+			return 0, err
+		}
+		fragments++
+	}
+	return fragments, nil
+}
+
+func (m *ServiceMgr) readRevision(appName string, entry *revisionIndexEntry) (*functionRevision, error) {
+	path := revisionPath(appName, entry.Rev)
+
+	var payload []byte
+	for idx := 0; idx < entry.Fragments; idx++ {
+		data, err := util.MetakvGet(path + strconv.Itoa(idx))
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			return nil, fmt.Errorf("fragment %d of revision %d is missing", idx, entry.Rev)
+		}
+		payload = append(payload, data...)
+	}
+
+	data, err := util.MaybeDecompress(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	rev := &functionRevision{}
+	if err = json.Unmarshal(data, rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func (m *ServiceMgr) deleteRevisions(appName string) {
+	logPrefix := "ServiceMgr::deleteRevisions"
+
+	if err := util.MetakvRecursiveDelete(metakvVersionsPath + appName + "/"); err != nil {
+		logging.Errorf("%s Function: %s failed to delete revisions, err: %v", logPrefix, appName, err)
+	}
+
+	if err := util.MetaKvDelete(metakvVersionsIndexPath+appName, nil); err != nil {
+		logging.Errorf("%s Function: %s failed to delete revision index, err: %v", logPrefix, appName, err)
+	}
+}
+
+func (m *ServiceMgr) getRevisions(appName string) ([]revisionSummary, *runtimeInfo) {
+	logPrefix := "ServiceMgr::getRevisions"
+
+	info := &runtimeInfo{}
+	if _, info = m.getTempStore(appName); info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	index, _, err := m.readRevisionIndex(appName)
+	if err != nil {
+		info.Code = m.statusCodes.errGetRevision.Code
+		info.Info = fmt.Sprintf("Function: %s failed to read revisions, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	// Latest revision first
+	revisions := make([]revisionSummary, 0, len(index.Revisions))
+	for i := len(index.Revisions) - 1; i >= 0; i-- {
+		revisions = append(revisions, index.Revisions[i].revisionSummary)
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return revisions, info
+}
+
+func (m *ServiceMgr) getRevision(appName string, revNo uint64) (*functionRevision, *runtimeInfo) {
+	logPrefix := "ServiceMgr::getRevision"
+
+	info := &runtimeInfo{}
+	index, _, err := m.readRevisionIndex(appName)
+	if err != nil {
+		info.Code = m.statusCodes.errGetRevision.Code
+		info.Info = fmt.Sprintf("Function: %s failed to read revisions, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return nil, info
+	}
+
+	for _, entry := range index.Revisions {
+		if entry.Rev != revNo {
+			continue
+		}
+
+		rev, err := m.readRevision(appName, entry)
+		if err != nil {
+			info.Code = m.statusCodes.errGetRevision.Code
+			info.Info = fmt.Sprintf("Function: %s failed to read revision: %d, err: %v", appName, revNo, err)
+			logging.Errorf("%s %s", logPrefix, info.Info)
+			return nil, info
+		}
+
+		// Index holds the latest deployed flag
+		rev.revisionSummary = entry.revisionSummary
+		info.Code = m.statusCodes.ok.Code
+		return rev, info
+	}
+
+	info.Code = m.statusCodes.errRevisionNotFound.Code
+	info.Info = fmt.Sprintf("Function: %s revision: %d not found", appName, revNo)
+	return nil, info
+}
+
+// diffRevision compares a revision against another one, or against the current
+// definition in temp store when against is 0
+func (m *ServiceMgr) diffRevision(appName string, revNo, against uint64) (*revisionDiff, *runtimeInfo) {
+	from, info := m.getRevision(appName, revNo)
+	if info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	var to *functionRevision
+	if against == 0 {
+		app, info := m.getTempStore(appName)
+		if info.Code != m.statusCodes.ok.Code {
+			return nil, info
+		}
+		to = newRevision(&app, revisionAuthor{}, false)
+	} else if to, info = m.getRevision(appName, against); info.Code != m.statusCodes.ok.Code {
+		return nil, info
+	}
+
+	diff := &revisionDiff{
+		From:     revNo,
+		To:       against,
+		Code:     diffLines(from.AppHandlers, to.AppHandlers),
+		DepCfg:   diffMaps(toJSONMap(from.DeploymentConfig), toJSONMap(to.DeploymentConfig), nil),
+		Settings: diffMaps(from.Settings, to.Settings, lifecycleSettings),
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return diff, info
+}
+
+// redeployRevision restores code, depcfg and settings of a revision and deploys the function
+func (m *ServiceMgr) redeployRevision(appName string, revNo uint64, author revisionAuthor) (info *runtimeInfo) {
+	logPrefix := "ServiceMgr::redeployRevision"
+
+	if m.checkIfDeployed(appName) {
+		info = &runtimeInfo{}
+		info.Code = m.statusCodes.errAppDeployed.Code
+		info.Info = fmt.Sprintf("Function: %s is deployed, undeploy it before redeploying revision: %d", appName, revNo)
+		return
+	}
+
+	app, info := m.getTempStore(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	rev, info := m.getRevision(appName, revNo)
+	if info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	// Credentials aren't part of revisions, reuse those of bindings still present
+	creds := make(map[string]common.Curl)
+	for _, binding := range app.DeploymentConfig.Curl {
+		creds[binding.Hostname+"/"+binding.Value] = binding
+	}
+
+	app.AppHandlers = rev.AppHandlers
+	app.DeploymentConfig = rev.DeploymentConfig
+	for i, binding := range app.DeploymentConfig.Curl {
+		if curr, ok := creds[binding.Hostname+"/"+binding.Value]; ok {
+			app.DeploymentConfig.Curl[i].Username = curr.Username
+			app.DeploymentConfig.Curl[i].Password = curr.Password
+			app.DeploymentConfig.Curl[i].BearerKey = curr.BearerKey
+		}
+	}
+
+	app.Settings = rev.Settings
+	app.Settings["deployment_status"] = false
+	app.Settings["processing_status"] = false
+
+	if info = m.validateApplication(&app); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.saveTempStore(app, author); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	settings := map[string]interface{}{
+		"deployment_status": true,
+		"processing_status": true,
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		info.Code = m.statusCodes.errMarshalResp.Code
+		info.Info = fmt.Sprintf("Function: %s failed to marshal settings, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	if info = m.setSettings(appName, data, author); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	info.Info = fmt.Sprintf("Function: %s redeploying revision: %d", appName, revNo)
+	logging.Infof("%s %s", logPrefix, info.Info)
+	return
+}
+
+func toJSONMap(v interface{}) map[string]interface{} {
+	res := make(map[string]interface{})
+	data, err := json.Marshal(v)
+	if err != nil {
+		return res
+	}
+	json.Unmarshal(data, &res)
+	return res
+}
+
+// diffMaps reports the keys whose values differ between from and to
+func diffMaps(from, to map[string]interface{}, skip []string) map[string]valueChange {
+	keys := make(map[string]struct{})
+	for key := range from {
+		keys[key] = struct{}{}
+	}
+	for key := range to {
+		keys[key] = struct{}{}
+	}
+	for _, key := range skip {
+		delete(keys, key)
+	}
+
+	changes := make(map[string]valueChange)
+	for key := range keys {
+		if !reflect.DeepEqual(from[key], to[key]) {
+			changes[key] = valueChange{From: from[key], To: to[key]}
+		}
+	}
+	return changes
+}
+
+// diffLines returns a line based diff where each line is prefixed by " ", "-" or "+"
+func diffLines(from, to string) []string {
+	if from == to {
+		return []string{}
+	}
+
+	a, b := splitLines(from), splitLines(to)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var diff []string
+	for _, line := range a[:prefix] {
+		diff = append(diff, " "+line)
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			diff = append(diff, "-"+line)
+		}
+		for _, line := range midB {
+			diff = append(diff, "+"+line)
+		}
+	} else {
+		diff = append(diff, lcsDiff(midA, midB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, " "+line)
+	}
+	return diff
+}
+
+// splitLines returns the lines of s, none for an empty string
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+func lcsDiff(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, " "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+"+b[j])
+	}
+	return diff
+}
@@ -0,0 +1,79 @@
+package servicemanager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		diff     []string
+	}{
+		{"both empty", "", "", []string{}},
+		{"identical", "a\nb", "a\nb", []string{}},
+		{"from empty", "", "a\nb", []string{"+a", "+b"}},
+		{"to empty", "a\nb", "", []string{"-a", "-b"}},
+		{"prepend", "b\nc", "a\nb\nc", []string{"+a", " b", " c"}},
+		{"append", "a\nb", "a\nb\nc", []string{" a", " b", "+c"}},
+		{"replace", "a\nb\nc", "a\nx\nc", []string{" a", "-b", "+x", " c"}},
+		{"remove middle", "a\nb\nc", "a\nc", []string{" a", "-b", " c"}},
+		{"replace all", "a\nb", "x\ny", []string{"-a", "-b", "+x", "+y"}},
+		{"trailing newline", "a", "a\n", []string{" a", "+"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := diffLines(test.from, test.to); !reflect.DeepEqual(diff, test.diff) {
+				t.Fatalf("Expected diff %q, got %q", test.diff, diff)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLargeChange(t *testing.T) {
+	// Changes too large for lcsDiff are shown as removing every line and adding the new ones
+	lines := 2*1024 + 1
+	from := make([]string, lines)
+	to := make([]string, lines)
+	for i := range from {
+		from[i] = "a"
+		to[i] = "b"
+	}
+
+	diff := diffLines("head\n"+strings.Join(from, "\n"), "head\n"+strings.Join(to, "\n"))
+	if len(diff) != 1+2*lines || diff[0] != " head" || diff[1] != "-a" || diff[len(diff)-1] != "+b" {
+		t.Fatalf("Expected head, %d removed and %d added lines, got %d lines", lines, lines, len(diff))
+	}
+	for i, line := range diff[1 : 1+lines] {
+		if line != "-a" {
+			t.Fatalf("Expected removed line at %d, got %q", i+1, line)
+		}
+	}
+}
+
+func TestLcsDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		diff []string
+	}{
+		{"empty", nil, nil, nil},
+		{"only removed", []string{"a", "b"}, nil, []string{"-a", "-b"}},
+		{"only added", nil, []string{"a", "b"}, []string{"+a", "+b"}},
+		{"interleaved", []string{"a", "b", "c", "d"}, []string{"b", "x", "d"},
+			[]string{"-a", " b", "-c", "+x", " d"}},
+		{"moved line", []string{"a", "b", "c"}, []string{"b", "c", "a"},
+			[]string{"-a", " b", " c", "+a"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := lcsDiff(test.a, test.b); !reflect.DeepEqual(diff, test.diff) {
+				t.Fatalf("Expected diff %q, got %q", test.diff, diff)
+			}
+		})
+	}
+}
@@ -34,6 +34,9 @@ const (
 
 	// MetakvChecksumPath within metakv is updated when new function definition is loaded
 	MetakvChecksumPath = metakvEventingPath + "checksum/"
+
+	// Records the last scheduled transition claimed for each function
+	metakvSchedulePath = metakvEventingPath + "schedule/"
 )
 
 const (
@@ -272,6 +272,35 @@ func (s *SuperSupervisor) PlannerStats(appName string) []*common.PlannerNodeVbMa
 	return nil
 }
 
+// PlanVbPlacement computes the vbucket distribution a placement strategy would produce on the
+// current eventing nodes, without applying it
+func (s *SuperSupervisor) PlanVbPlacement(strategy, bucketName string) ([]*common.PlannerNodeVbMapping, error) {
+	logPrefix := "SuperSupervisor::PlanVbPlacement"
+
+	hostAddress := net.JoinHostPort(util.Localhost(), s.restPort)
+
+	eventingNodeAddrs, err := util.EventingNodesAddresses("", hostAddress)
+	if err != nil {
+		logging.Errorf("%s Failed to get eventing nodes, err: %v", logPrefix, err)
+		return nil, err
+	}
+	if len(eventingNodeAddrs) == 0 {
+		return nil, fmt.Errorf("eventing node count reported as 0")
+	}
+
+	var topology *util.PlacementTopology
+	if strategy != util.PlacementEven {
+		topology, err = util.FetchPlacementTopology(hostAddress, bucketName)
+		if err != nil {
+			logging.Errorf("%s Failed to get topology for bucket: %s, err: %v", logPrefix, bucketName, err)
+			return nil, err
+		}
+	}
+
+	assignMap := util.PlanVbPlacement(strategy, s.numVbuckets, eventingNodeAddrs, topology)
+	return util.PlannerNodeVbMappings(assignMap, eventingNodeAddrs), nil
+}
+
 // RebalanceTaskProgress reports vbuckets remaining to be transferred as per planner
 // during the course of rebalance
 func (s *SuperSupervisor) RebalanceTaskProgress(appName string) (*common.RebalanceProgress, error) {
@@ -416,6 +445,16 @@ func (s *SuperSupervisor) VbSeqnoStats(appName string) (map[int][]map[string]int
 	return nil, fmt.Errorf("Eventing.Producer isn't alive")
 }
 
+// DcpFeedStats returns flow control stats of the DCP connections of a function
+func (s *SuperSupervisor) DcpFeedStats(appName string) (map[string]interface{}, error) {
+	p, ok := s.runningFns()[appName]
+	if ok {
+		return p.DcpFeedStats(), nil
+	}
+
+	return nil, fmt.Errorf("Eventing.Producer isn't alive")
+}
+
 // RemoveProducerToken takes out appName from supervision tree
 func (s *SuperSupervisor) RemoveProducerToken(appName string) {
 	if p, exists := s.runningFns()[appName]; exists {
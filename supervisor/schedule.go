@@ -0,0 +1,185 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/couchbase/cbauth/metakv"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Cron transitions missed, e.g. while no eventing node was up, are caught up until this late
+const scheduleCatchUp = 24 * time.Hour
+
+// watchSchedules pauses and resumes deployed functions as asked by their schedule setting.
+// Every node evaluates the schedules, and the transitions are claimed in metakv so that only
+// one of them drives each one. A claim holds the minute of the last transition of a function,
+// and a schedule is evaluated from there, so every transition is claimed once.
+func (s *SuperSupervisor) watchSchedules() {
+	logPrefix := "SuperSupervisor::watchSchedules"
+
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	claims := make(map[string]int64)
+	for {
+		select {
+		case now := <-tick.C:
+			s.applySchedules(claims, now)
+
+		case <-s.finch:
+			logging.Infof("%s [%d] Exiting schedules routine", logPrefix, s.runningFnsCount())
+			return
+		}
+	}
+}
+
+// applySchedules evaluates the schedule of each deployed function. claims caches the last
+// claimed minute of each function, as read from or written to metakv by this node
+func (s *SuperSupervisor) applySchedules(claims map[string]int64, now time.Time) {
+	logPrefix := "SuperSupervisor::applySchedules"
+
+	for appName := range s.GetDeployedApps() {
+		schedule, err := s.getSchedule(appName)
+		if err != nil {
+			logging.Errorf("%s [%d] Function: %s failed to read schedule, err: %v",
+				logPrefix, s.runningFnsCount(), appName, err)
+			continue
+		}
+		if schedule == nil {
+			continue
+		}
+
+		claimed, ok := claims[appName]
+		if !ok {
+			if claimed, ok = s.readScheduleClaim(appName); !ok {
+				continue
+			}
+			claims[appName] = claimed
+		}
+
+		since := now.Add(-scheduleCatchUp)
+		if last := time.Unix(claimed, 0); last.After(since) {
+			since = last
+		}
+
+		action, at, err := util.ScheduledAction(schedule, since, now)
+		if err != nil {
+			logging.Errorf("%s [%d] Function: %s invalid schedule, err: %v",
+				logPrefix, s.runningFnsCount(), appName, err)
+			continue
+		}
+		if action == "" || at.Unix() <= claimed {
+			continue
+		}
+
+		// Window schedules ask for their state every minute, but it's only applied when a
+		// window starts or ends after the last claim, or when no claim was made yet
+		if len(schedule.Windows) != 0 && claimed != 0 {
+			next, err := util.NextScheduledTransition(schedule, time.Unix(claimed, 0))
+			if err != nil || next == nil || next.At.After(now) {
+				continue
+			}
+		}
+
+		state := s.GetAppState(appName)
+		needed := (action == common.SchedulePause && state == common.AppStateEnabled) ||
+			(action == common.ScheduleResume && state == common.AppStatePaused)
+
+		// Transitions are claimed even when there's nothing to do, so that a function paused
+		// or resumed by hand since isn't changed back later
+
+		won, err := s.claimScheduledTransition(appName, at)
+		if err != nil {
+			logging.Errorf("%s [%d] Function: %s failed to claim scheduled %s at %v, err: %v",
+				logPrefix, s.runningFnsCount(), appName, action, at, err)
+			continue
+		}
+		claims[appName] = at.Unix()
+		if !won || !needed {
+			continue
+		}
+
+		logging.Infof("%s [%d] Function: %s scheduled %s at %v",
+			logPrefix, s.runningFnsCount(), appName, action, at)
+
+		if err = s.serviceMgr.ApplyScheduledTransition(appName, action); err != nil {
+			logging.Errorf("%s [%d] Function: %s scheduled %s failed, err: %v",
+				logPrefix, s.runningFnsCount(), appName, action, err)
+		}
+	}
+}
+
+func (s *SuperSupervisor) getSchedule(appName string) (*common.Schedule, error) {
+	data, err := util.MetakvGet(MetakvAppSettingsPath + appName)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	settings := make(map[string]interface{})
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+
+	val, ok := settings["schedule"]
+	if !ok || val == nil {
+		return nil, nil
+	}
+	return common.ParseSchedule(val)
+}
+
+// readScheduleClaim returns the minute of the last transition claimed for a function, zero if
+// there is none
+func (s *SuperSupervisor) readScheduleClaim(appName string) (int64, bool) {
+	logPrefix := "SuperSupervisor::readScheduleClaim"
+
+	data, err := util.MetakvGet(metakvSchedulePath + appName)
+	if err != nil {
+		logging.Errorf("%s [%d] Function: %s failed to read claim, err: %v",
+			logPrefix, s.runningFnsCount(), appName, err)
+		return 0, false
+	}
+	if data == nil {
+		return 0, true
+	}
+
+	claimed, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		logging.Errorf("%s [%d] Function: %s invalid claim: %s", logPrefix, s.runningFnsCount(), appName, string(data))
+		return 0, true
+	}
+	return claimed, true
+}
+
+// claimScheduledTransition reports whether this node gets to drive the transition of the
+// function due at the given minute. The claim is kept once the minute has passed, as the
+// minute of the last transition of the function
+func (s *SuperSupervisor) claimScheduledTransition(appName string, at time.Time) (bool, error) {
+	path := metakvSchedulePath + appName
+	data, rev, err := metakv.Get(path)
+	if err != nil {
+		return false, err
+	}
+
+	minute := at.Unix()
+	if data != nil {
+		claimed, err := strconv.ParseInt(string(data), 10, 64)
+		if err == nil && claimed >= minute {
+			return false, nil
+		}
+	}
+
+	value := []byte(strconv.FormatInt(minute, 10))
+	if data == nil {
+		err = metakv.Add(path, value)
+	} else {
+		err = metakv.Set(path, value, rev)
+	}
+	if err == metakv.ErrRevMismatch {
+		return false, nil
+	}
+	return err == nil, err
+}
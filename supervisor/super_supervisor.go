@@ -35,6 +35,7 @@ func NewSuperSupervisor(adminPort AdminPortConfig, eventingDir, kvPort, restPort
 		diagDir:                    diagDir,
 		ejectNodes:                 make([]string, 0),
 		eventingDir:                eventingDir,
+		finch:                      make(chan bool),
 		keepNodes:                  make([]string, 0),
 		kvPort:                     kvPort,
 		locallyDeployedApps:        make(map[string]string),
@@ -88,6 +89,7 @@ func NewSuperSupervisor(adminPort AdminPortConfig, eventingDir, kvPort, restPort
 	}()
 
 	go s.watchBucketChanges()
+	go s.watchSchedules()
 	return s
 }
 
@@ -619,6 +621,36 @@ func (s *SuperSupervisor) AppsRetryCallback(path string, value []byte, rev inter
 	return nil
 }
 
+// DeadLetterReplayCallback is registered as callback from metakv observe calls on dead letter replay path
+func (s *SuperSupervisor) DeadLetterReplayCallback(path string, value []byte, rev interface{}) error {
+	logPrefix := "SuperSupervisor::DeadLetterReplayCallback"
+
+	if value == nil {
+		return nil
+	}
+
+	appName := util.GetAppNameFromPath(path)
+	p, exists := s.runningFns()[appName]
+	if !exists || p == nil {
+		logging.Infof("%s [%d] Function: %s not running on this node, skipping dead letter replay",
+			logPrefix, s.runningFnsCount(), appName)
+		return nil
+	}
+
+	var entries []*common.DeadLetterEntry
+	if err := json.Unmarshal(value, &entries); err != nil {
+		logging.Errorf("%s [%d] Function: %s failed to unmarshal dead letter entries, err: %v",
+			logPrefix, s.runningFnsCount(), appName, err)
+		return nil
+	}
+
+	// The node that accepted the request removes it once the entries are claimed
+	logging.Infof("%s [%d] Function: %s replaying %d dead letter entries",
+		logPrefix, s.runningFnsCount(), appName, len(entries))
+	p.ReplayDeadLetters(entries)
+	return nil
+}
+
 func (s *SuperSupervisor) spawnApp(appName string, cleanupTimers bool) {
 	logPrefix := "SuperSupervisor::spawnApp"
 
@@ -0,0 +1,77 @@
+package timers
+
+import (
+	"gopkg.in/couchbase/gocb.v1"
+)
+
+// Backend is the document store holding alarms, contexts and spans. Calls only return
+// transient errors, which are retried; absent keys and CAS mismatches are reported
+// through the returned flags. A CAS of 0 skips the CAS check on Replace and Remove.
+type Backend interface {
+	// Counter adds delta to the counter at key, creating it with initial if it doesn't exist
+	Counter(bucket, key string, delta, initial int64, expiry uint32) (count int64, cas gocb.Cas, err error)
+
+	// Insert returns mismatch if the key exists
+	Insert(bucket, key string, value interface{}, expiry uint32) (cas gocb.Cas, mismatch bool, err error)
+
+	Upsert(bucket, key string, value interface{}, expiry uint32) (cas gocb.Cas, err error)
+
+	Get(bucket, key string, valuePtr interface{}) (cas gocb.Cas, absent bool, err error)
+
+	Replace(bucket, key string, value interface{}, cas gocb.Cas, expiry uint32) (rcas gocb.Cas, absent, mismatch bool, err error)
+
+	Remove(bucket, key string, cas gocb.Cas) (rcas gocb.Cas, absent, mismatch bool, err error)
+}
+
+// mustBackend retries calls to the backend until they succeed or time out
+type mustBackend struct {
+	Backend
+}
+
+func (r mustBackend) MustUpsert(bucket, key string, value interface{}, expiry uint32) (cas gocb.Cas, err error) {
+	err = MustRun(func() (e error) {
+		cas, e = r.Upsert(bucket, key, value, expiry)
+		return
+	})
+	return
+}
+
+func (r mustBackend) MustCounter(bucket, key string, delta, initial int64, expiry uint32) (val int64, cas gocb.Cas, err error) {
+	err = MustRun(func() (e error) {
+		val, cas, e = r.Counter(bucket, key, delta, initial, expiry)
+		return
+	})
+	return
+}
+
+func (r mustBackend) MustGet(bucket, key string, valuePtr interface{}) (cas gocb.Cas, absent bool, err error) {
+	err = MustRun(func() (e error) {
+		cas, absent, e = r.Get(bucket, key, valuePtr)
+		return
+	})
+	return
+}
+
+func (r mustBackend) MustReplace(bucket, key string, value interface{}, cas gocb.Cas, expiry uint32) (rcas gocb.Cas, absent, mismatch bool, err error) {
+	err = MustRun(func() (e error) {
+		rcas, absent, mismatch, e = r.Replace(bucket, key, value, cas, expiry)
+		return
+	})
+	return
+}
+
+func (r mustBackend) MustInsert(bucket, key string, value interface{}, expiry uint32) (rcas gocb.Cas, mismatch bool, err error) {
+	err = MustRun(func() (e error) {
+		rcas, mismatch, e = r.Insert(bucket, key, value, expiry)
+		return
+	})
+	return
+}
+
+func (r mustBackend) MustRemove(bucket, key string, cas gocb.Cas) (rcas gocb.Cas, absent bool, mismatch bool, err error) {
+	err = MustRun(func() (e error) {
+		rcas, absent, mismatch, e = r.Remove(bucket, key, cas)
+		return
+	})
+	return
+}
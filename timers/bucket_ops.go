@@ -183,7 +183,7 @@ func (r *kvPool) Insert(bucket, key string, value interface{}, expiry uint32) (r
 	}
 	atomic.AddUint64(&r.stats.InsertCounter, 1)
 	rcas, err = conn.Insert(key, value, expiry)
-	if err != nil && gocb.IsKeyNotFoundError(err) {
+	if err != nil && gocb.IsKeyExistsError(err) {
 		mismatch = true
 		err = nil
 	}
@@ -234,52 +234,6 @@ func (r *kvPool) Remove(bucket, key string, cas gocb.Cas) (rcas gocb.Cas, absent
 	return
 }
 
-func (r *kvPool) MustUpsert(bucket, key string, value interface{}, expiry uint32) (cas gocb.Cas, err error) {
-	err = MustRun(func() (e error) {
-		cas, e = r.Upsert(bucket, key, value, expiry)
-		return
-	})
-	return
-}
-
-func (r *kvPool) MustCounter(bucket, key string, delta, initial int64, expiry uint32) (val int64, cas gocb.Cas, err error) {
-	err = MustRun(func() (e error) {
-		val, cas, e = r.Counter(bucket, key, delta, initial, expiry)
-		return
-	})
-	return
-}
-
-func (r *kvPool) MustGet(bucket, key string, valuePtr interface{}) (cas gocb.Cas, absent bool, err error) {
-	err = MustRun(func() (e error) {
-		cas, absent, e = r.Get(bucket, key, valuePtr)
-		return
-	})
-	return
-}
-
-func (r *kvPool) MustReplace(bucket, key string, value interface{}, cas gocb.Cas, expiry uint32) (rcas gocb.Cas, absent, mismatch bool, err error) {
-	err = MustRun(func() (e error) {
-		rcas, absent, mismatch, e = r.Replace(bucket, key, value, cas, expiry)
-		return
-	})
-	return
-}
-func (r *kvPool) MustInsert(bucket, key string, value interface{}, expiry uint32) (rcas gocb.Cas, absent bool, err error) {
-	err = MustRun(func() (e error) {
-		rcas, absent, e = r.Insert(bucket, key, value, expiry)
-		return
-	})
-	return
-}
-func (r *kvPool) MustRemove(bucket, key string, cas gocb.Cas) (rcas gocb.Cas, absent bool, mismatch bool, err error) {
-	err = MustRun(func() (e error) {
-		rcas, absent, mismatch, e = r.Remove(bucket, key, cas)
-		return
-	})
-	return
-}
-
 func SetTimeout(tmout time.Duration) {
 	atomic.StoreInt64(&maxRetryTime, tmout.Nanoseconds())
 }
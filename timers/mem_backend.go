@@ -0,0 +1,141 @@
+package timers
+
+import (
+	"encoding/json"
+	"sync"
+
+	"gopkg.in/couchbase/gocb.v1"
+)
+
+type memDoc struct {
+	value []byte
+	cas   gocb.Cas
+}
+
+// MemBackend keeps documents in memory, so stores can be exercised without a cluster.
+// Values are stored as JSON like they are in a bucket. Expiry is ignored.
+type MemBackend struct {
+	lock    sync.Mutex
+	buckets map[string]map[string]*memDoc
+	cas     gocb.Cas
+}
+
+func NewMemBackend() *MemBackend {
+	return &MemBackend{buckets: make(map[string]map[string]*memDoc)}
+}
+
+// Caller must hold the lock
+func (r *MemBackend) doc(bucket, key string) *memDoc {
+	docs, ok := r.buckets[bucket]
+	if !ok {
+		return nil
+	}
+	return docs[key]
+}
+
+// Caller must hold the lock
+func (r *MemBackend) store(bucket, key string, value interface{}) (gocb.Cas, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+
+	docs, ok := r.buckets[bucket]
+	if !ok {
+		docs = make(map[string]*memDoc)
+		r.buckets[bucket] = docs
+	}
+	r.cas++
+	docs[key] = &memDoc{value: data, cas: r.cas}
+	return r.cas, nil
+}
+
+func (r *MemBackend) Counter(bucket, key string, delta, initial int64, expiry uint32) (count int64, cas gocb.Cas, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	count = initial
+	if doc := r.doc(bucket, key); doc != nil {
+		if err = json.Unmarshal(doc.value, &count); err != nil {
+			return
+		}
+		count += delta
+	}
+	cas, err = r.store(bucket, key, count)
+	return
+}
+
+func (r *MemBackend) Insert(bucket, key string, value interface{}, expiry uint32) (cas gocb.Cas, mismatch bool, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.doc(bucket, key) != nil {
+		return 0, true, nil
+	}
+	cas, err = r.store(bucket, key, value)
+	return
+}
+
+func (r *MemBackend) Upsert(bucket, key string, value interface{}, expiry uint32) (cas gocb.Cas, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.store(bucket, key, value)
+}
+
+func (r *MemBackend) Get(bucket, key string, valuePtr interface{}) (cas gocb.Cas, absent bool, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	doc := r.doc(bucket, key)
+	if doc == nil {
+		return 0, true, nil
+	}
+	if err = json.Unmarshal(doc.value, valuePtr); err != nil {
+		return
+	}
+	return doc.cas, false, nil
+}
+
+func (r *MemBackend) Replace(bucket, key string, value interface{}, cas gocb.Cas, expiry uint32) (rcas gocb.Cas, absent, mismatch bool, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	doc := r.doc(bucket, key)
+	if doc == nil {
+		return 0, true, false, nil
+	}
+	if cas != 0 && doc.cas != cas {
+		return 0, false, true, nil
+	}
+	rcas, err = r.store(bucket, key, value)
+	return
+}
+
+func (r *MemBackend) Remove(bucket, key string, cas gocb.Cas) (rcas gocb.Cas, absent, mismatch bool, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	doc := r.doc(bucket, key)
+	if doc == nil {
+		return 0, true, false, nil
+	}
+	if cas != 0 && doc.cas != cas {
+		return 0, false, true, nil
+	}
+	delete(r.buckets[bucket], key)
+	r.cas++
+	return r.cas, false, false, nil
+}
+
+// Keys returns the keys held in a bucket, to inspect what a store has left behind
+func (r *MemBackend) Keys(bucket string) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keys := make([]string, 0, len(r.buckets[bucket]))
+	for key := range r.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -15,6 +15,7 @@ import (
 var (
 	stats     = make(map[string]uint64)
 	statsLock = &sync.RWMutex{}
+	backend   *timers.MemBackend
 )
 
 func run(partn int, load int, pwg *sync.WaitGroup) {
@@ -31,7 +32,11 @@ func run(partn int, load int, pwg *sync.WaitGroup) {
 	if len(os.Args) == 2 {
 		cstr = os.Args[1]
 	}
-	timers.Create(uid, partn, cstr, "default")
+	if backend != nil {
+		timers.CreateWithBackend(uid, partn, backend, "default")
+	} else {
+		timers.Create(uid, partn, cstr, "default")
+	}
 	store, present := timers.Fetch(uid, partn)
 	if !present {
 		panic("store was absent")
@@ -193,6 +198,11 @@ func main() {
 	logging.SetLogLevel(logging.Info)
 	timers.SetTestAuth("Administrator", "asdasd")
 
+	// Runs against documents kept in memory instead of a cluster
+	if len(os.Args) == 2 && os.Args[1] == "mem" {
+		backend = timers.NewMemBackend()
+	}
+
 	for partn := 0; partn <= load/1000; partn++ {
 		pwg.Add(1)
 		go run(partn, load, &pwg)
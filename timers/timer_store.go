@@ -28,6 +28,7 @@ const (
 // Globals
 var (
 	stores *storeMap
+	getNow = time.Now // tests move the clock to make timers due
 )
 
 type storeMap struct {
@@ -94,13 +95,13 @@ type storeSpan struct {
 }
 
 type TimerStore struct {
-	connstr string
-	bucket  string
-	uid     string
-	partn   int
-	log     string
-	span    storeSpan
-	stats   timerStats
+	kv     mustBackend
+	bucket string
+	uid    string
+	partn  int
+	log    string
+	span   storeSpan
+	stats  timerStats
 }
 
 type TimerIter struct {
@@ -148,6 +149,11 @@ func SetRebalancer(r rebalancer) {
 }
 
 func Create(uid string, partn int, connstr string, bucket string) error {
+	return CreateWithBackend(uid, partn, Pool(connstr), bucket)
+}
+
+// CreateWithBackend creates a store keeping its documents in backend instead of the cluster
+func CreateWithBackend(uid string, partn int, backend Backend, bucket string) error {
 	logPrefix := "TimerStore::Create"
 
 	stores.lock.Lock()
@@ -158,7 +164,7 @@ func Create(uid string, partn int, connstr string, bucket string) error {
 		logging.Warnf("%s Asked to create store %v:%v which exists. Reusing", logPrefix, uid, partn)
 		return nil
 	}
-	store, err := newTimerStore(uid, partn, connstr, bucket)
+	store, err := newTimerStore(uid, partn, backend, bucket)
 	if err != nil {
 		return err
 	}
@@ -190,7 +196,7 @@ func (r *TimerStore) Free(syncSpan bool) {
 }
 
 func (r *TimerStore) Set(due int64, ref string, context interface{}) error {
-	now := time.Now().Unix()
+	now := getNow().Unix()
 	atomic.AddUint64(&r.stats.SetCounter, 1)
 
 	if due-now <= Resolution {
@@ -200,7 +206,7 @@ func (r *TimerStore) Set(due int64, ref string, context interface{}) error {
 	}
 	due = roundUp(due)
 
-	kv := Pool(r.connstr)
+	kv := r.kv
 	pos := r.kvLocatorRoot(due)
 	seq, _, err := kv.MustCounter(r.bucket, pos, 1, init_seq, 0)
 	if err != nil {
@@ -231,7 +237,7 @@ func (r *TimerStore) Set(due int64, ref string, context interface{}) error {
 func (r *TimerStore) Delete(entry *TimerEntry) error {
 	logging.Tracef("%v Deleting timer %+v", r.log, entry)
 	atomic.AddUint64(&r.stats.DelCounter, 1)
-	kv := Pool(r.connstr)
+	kv := r.kv
 
 	_, absent, mismatch, err := kv.MustRemove(r.bucket, entry.AlarmRef, entry.alrCas)
 	if err != nil {
@@ -274,7 +280,7 @@ func (r *TimerStore) Cancel(ref string) error {
 	atomic.AddUint64(&r.stats.CancelCounter, 1)
 	logging.Tracef("%v Cancelling timer ref %ru", r.log, ref)
 
-	kv := Pool(r.connstr)
+	kv := r.kv
 	cpos := r.kvLocatorContext(ref)
 
 	crecord := ContextRecord{}
@@ -353,7 +359,7 @@ func ForceSpanSync() {
 
 func (r *TimerStore) ScanDue() *TimerIter {
 	span := r.readSpan()
-	now := roundDown(time.Now().Unix())
+	now := roundDown(getNow().Unix())
 
 	atomic.AddUint64(&r.stats.ScanDueCounter, 1)
 	if span.Start > now {
@@ -409,7 +415,7 @@ func (r *TimerIter) ScanNext() (*TimerEntry, error) {
 func (r *TimerIter) nextRow() (bool, error) {
 	atomic.AddUint64(&r.store.stats.ScanRowCounter, 1)
 	logging.Tracef("%v Looking for row after %+v", r.store.log, r.row)
-	kv := Pool(r.store.connstr)
+	kv := r.store.kv
 
 	r.col = nil
 	r.entry = nil
@@ -446,7 +452,7 @@ func (r *TimerIter) nextColumn() (bool, error) {
 		return false, nil
 	}
 
-	kv := Pool(r.store.connstr)
+	kv := r.store.kv
 	alarm := AlarmRecord{}
 	context := ContextRecord{}
 
@@ -484,7 +490,7 @@ func (r *TimerIter) nextColumn() (bool, error) {
 		}
 
 		r.entry = &TimerEntry{AlarmRecord: alarm, ContextRecord: context, alarmSeq: current, ctxCas: ccas, alrCas: acas}
-		if r.entry.AlarmDue > time.Now().Unix() {
+		if r.entry.AlarmDue > getNow().Unix() {
 			atomic.AddUint64(&r.store.stats.TimerInFutureFiredCounter, 1)
 		}
 
@@ -521,7 +527,7 @@ func (r *TimerStore) readSpan() Span {
 func (r *TimerStore) expandSpan(point int64) {
 	r.span.lock.Lock()
 	defer r.span.lock.Unlock()
-	util.Assert(func() bool { return point >= roundDown(time.Now().Unix()) })
+	util.Assert(func() bool { return point >= roundDown(getNow().Unix()) })
 
 	if r.span.Start > point {
 		logging.Tracef("Expanding span start to %v", &r.span)
@@ -538,7 +544,7 @@ func (r *TimerStore) expandSpan(point int64) {
 func (r *TimerStore) shrinkSpan(start int64) {
 	r.span.lock.Lock()
 	defer r.span.lock.Unlock()
-	util.Assert(func() bool { return start <= roundDown(time.Now().Unix()) })
+	util.Assert(func() bool { return start <= roundDown(getNow().Unix()) })
 
 	if r.span.Start < start {
 		r.span.Start = start
@@ -555,7 +561,7 @@ func (r *TimerStore) syncSpan() (bool, error) {
 	defer r.span.lock.Unlock()
 
 	r.span.dirty = false
-	kv := Pool(r.connstr)
+	kv := r.kv
 	pos := r.kvLocatorSpan()
 	extspan := Span{}
 
@@ -569,7 +575,7 @@ func (r *TimerStore) syncSpan() (bool, error) {
 
 	// new, not on disk, not on node
 	case absent && r.span.empty:
-		now := time.Now().Unix()
+		now := getNow().Unix()
 		r.span.Span = Span{Start: roundDown(now), Stop: roundUp(now)}
 		wcas, mismatch, err := kv.MustInsert(r.bucket, pos, r.span.Span, 0)
 		if err != nil || mismatch {
@@ -623,7 +629,7 @@ func (r *TimerStore) syncSpan() (bool, error) {
 
 	// Merge conflict
 	atomic.AddUint64(&r.stats.SpanCasMismatchCounter, 1)
-	stores.conflict = time.Now().Unix()
+	stores.conflict = getNow().Unix()
 
 	if r.span.Start > extspan.Start {
 		logging.Debugf("%v Span conflict external write, moving Start: span=%+v extspan=%+v", &r.span, extspan)
@@ -648,10 +654,10 @@ func (r *TimerStore) syncSpan() (bool, error) {
 func (r *storeMap) syncRoutine() {
 	for {
 		if r.rebalancer != nil && r.rebalancer.RebalanceStatus() {
-			r.conflict = time.Now().Unix()
+			r.conflict = getNow().Unix()
 		}
 
-		force := time.Now().Unix()-r.conflict < tail_time
+		force := getNow().Unix()-r.conflict < tail_time
 		dirty := make([]*TimerStore, 0)
 		r.lock.RLock()
 
@@ -668,14 +674,14 @@ func (r *storeMap) syncRoutine() {
 	}
 }
 
-func newTimerStore(uid string, partn int, connstr string, bucket string) (*TimerStore, error) {
+func newTimerStore(uid string, partn int, backend Backend, bucket string) (*TimerStore, error) {
 	timerstore := TimerStore{
-		connstr: connstr,
-		bucket:  bucket,
-		uid:     uid,
-		partn:   partn,
-		log:     fmt.Sprintf("timerstore:%v:%v", uid, partn),
-		span:    storeSpan{empty: true, dirty: false},
+		kv:     mustBackend{backend},
+		bucket: bucket,
+		uid:    uid,
+		partn:  partn,
+		log:    fmt.Sprintf("timerstore:%v:%v", uid, partn),
+		span:   storeSpan{empty: true, dirty: false},
 	}
 
 	_, err := timerstore.syncSpan()
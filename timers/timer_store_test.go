@@ -0,0 +1,282 @@
+package timers
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+const (
+	testBucket = "timers"
+	testUID    = "uid"
+	testStart  = int64(7000)
+)
+
+// setClock moves the clock of the timer store to now. Tests defer the returned func to restore it
+func setClock(now *int64) func() {
+	prev := getNow
+	getNow = func() time.Time { return time.Unix(*now, 0) }
+	return func() { getNow = prev }
+}
+
+func newTestStore(t *testing.T, backend Backend, partn int) *TimerStore {
+	store, err := newTimerStore(testUID, partn, backend, testBucket)
+	if err != nil {
+		t.Fatalf("Failed to create store, err: %v", err)
+	}
+	return store
+}
+
+// persistedSpan reads the span a store last wrote to the backend
+func persistedSpan(t *testing.T, backend Backend, store *TimerStore) Span {
+	var span Span
+	_, absent, err := backend.Get(testBucket, store.kvLocatorSpan(), &span)
+	if err != nil || absent {
+		t.Fatalf("Failed to read persisted span, absent: %v err: %v", absent, err)
+	}
+	return span
+}
+
+// fireDue scans the due timers of a store and deletes them, as the consumer does once they fired
+func fireDue(t *testing.T, store *TimerStore) map[string]interface{} {
+	fired := make(map[string]interface{})
+	iter := store.ScanDue()
+	for {
+		entry, err := iter.ScanNext()
+		if err != nil {
+			t.Fatalf("Failed to scan timers, err: %v", err)
+		}
+		if entry == nil {
+			return fired
+		}
+		fired[entry.ContextRef] = entry.Context
+		if err = store.Delete(entry); err != nil {
+			t.Fatalf("Failed to delete timer, err: %v", err)
+		}
+	}
+}
+
+func TestTimerStoreSetScanDue(t *testing.T) {
+	now := testStart
+	defer setClock(&now)()
+
+	backend := NewMemBackend()
+	store := newTestStore(t, backend, 0)
+
+	if err := store.Set(now+10, "first", "ctx1"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+	if err := store.Set(now+20, "second", "ctx2"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+
+	if fired := fireDue(t, store); len(fired) != 0 {
+		t.Fatalf("Timers fired before they were due: %v", fired)
+	}
+
+	now += 14
+	fired := fireDue(t, store)
+	if len(fired) != 1 || fired[store.kvLocatorContext("first")] != "ctx1" {
+		t.Fatalf("Expected only the first timer to fire, got: %v", fired)
+	}
+
+	now += 14
+	fired = fireDue(t, store)
+	if len(fired) != 1 || fired[store.kvLocatorContext("second")] != "ctx2" {
+		t.Fatalf("Expected only the second timer to fire, got: %v", fired)
+	}
+
+	if fired = fireDue(t, store); len(fired) != 0 {
+		t.Fatalf("Timers fired twice: %v", fired)
+	}
+
+	keys := backend.Keys(testBucket)
+	if len(keys) != 1 || keys[0] != store.kvLocatorSpan() {
+		t.Fatalf("Expected only the span to be left, got: %v", keys)
+	}
+}
+
+func TestTimerStoreSetInPast(t *testing.T) {
+	now := testStart
+	defer setClock(&now)()
+
+	store := newTestStore(t, NewMemBackend(), 0)
+	if err := store.Set(now-100, "past", "ctx1"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+	if err := store.Set(now+3, "close", "ctx2"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+
+	// Timers in the past or closer than a resolution are moved to the next period
+	if stats := store.Stats(); stats["meta_timer_in_past"] != 2 {
+		t.Fatalf("Expected 2 timers in the past, got stats: %v", stats)
+	}
+
+	now += Resolution
+	iter := store.ScanDue()
+	for _, ref := range []string{"past", "close"} {
+		entry, err := iter.ScanNext()
+		if err != nil || entry == nil {
+			t.Fatalf("Expected timer %s to fire, entry: %v err: %v", ref, entry, err)
+		}
+		if entry.ContextRef != store.kvLocatorContext(ref) {
+			t.Fatalf("Expected timer %s to fire, got %+v", ref, entry)
+		}
+		if entry.AlarmDue != testStart+Resolution {
+			t.Fatalf("Expected timer %s due at %v, got %v", ref, testStart+Resolution, entry.AlarmDue)
+		}
+	}
+}
+
+func TestTimerStoreOverride(t *testing.T) {
+	now := testStart
+	defer setClock(&now)()
+
+	store := newTestStore(t, NewMemBackend(), 0)
+	if err := store.Set(now+10, "ref", "old"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+	if err := store.Set(now+30, "ref", "new"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+
+	now += 14
+	if fired := fireDue(t, store); len(fired) != 0 {
+		t.Fatalf("Overridden timer fired: %v", fired)
+	}
+
+	now += 28
+	fired := fireDue(t, store)
+	if len(fired) != 1 || fired[store.kvLocatorContext("ref")] != "new" {
+		t.Fatalf("Expected the overriding timer to fire, got: %v", fired)
+	}
+}
+
+func TestTimerStoreCancel(t *testing.T) {
+	now := testStart
+	defer setClock(&now)()
+
+	backend := NewMemBackend()
+	store := newTestStore(t, backend, 0)
+
+	if err := store.Set(now+10, "cancelled", "ctx1"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+	if err := store.Set(now+10, "kept", "ctx2"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+	if err := store.Cancel("cancelled"); err != nil {
+		t.Fatalf("Failed to cancel timer, err: %v", err)
+	}
+	if err := store.Cancel("absent"); err != nil {
+		t.Fatalf("Failed to cancel absent timer, err: %v", err)
+	}
+
+	stats := store.Stats()
+	if stats["meta_cancel_success"] != 1 || stats["meta_cancel_context_missing"] != 1 {
+		t.Fatalf("Unexpected cancel stats: %v", stats)
+	}
+
+	now += 14
+	fired := fireDue(t, store)
+	if len(fired) != 1 || fired[store.kvLocatorContext("kept")] != "ctx2" {
+		t.Fatalf("Expected only the kept timer to fire, got: %v", fired)
+	}
+
+	keys := backend.Keys(testBucket)
+	if len(keys) != 1 || keys[0] != store.kvLocatorSpan() {
+		t.Fatalf("Expected only the span to be left, got: %v", keys)
+	}
+}
+
+func TestTimerStoreSpanSync(t *testing.T) {
+	now := testStart
+	defer setClock(&now)()
+
+	backend := NewMemBackend()
+	store := newTestStore(t, backend, 0)
+
+	initial := Span{Start: roundDown(now), Stop: roundUp(now)}
+	if span := store.readSpan(); span != initial {
+		t.Fatalf("Expected initial span %+v, got %+v", initial, span)
+	}
+
+	if err := store.Set(now+100, "ref", "ctx"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+	if !store.span.dirty {
+		t.Fatalf("Expected span to be dirty after setting a timer")
+	}
+	if mismatch, err := store.syncSpan(); mismatch || err != nil {
+		t.Fatalf("Failed to sync span, mismatch: %v err: %v", mismatch, err)
+	}
+
+	expected := Span{Start: initial.Start, Stop: roundUp(now + 100)}
+	if span := persistedSpan(t, backend, store); span != expected {
+		t.Fatalf("Expected persisted span %+v, got %+v", expected, span)
+	}
+
+	// A store taking over the partition starts from the persisted span
+	other := newTestStore(t, backend, 0)
+	if span := other.readSpan(); span != expected {
+		t.Fatalf("Expected span %+v to be read, got %+v", expected, span)
+	}
+
+	// Concurrent writers merge their spans rather than overwrite each other
+	if err := other.Set(now+200, "other", "ctx"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+	if mismatch, err := other.syncSpan(); mismatch || err != nil {
+		t.Fatalf("Failed to sync span, mismatch: %v err: %v", mismatch, err)
+	}
+	if mismatch, err := store.syncSpan(); mismatch || err != nil {
+		t.Fatalf("Failed to merge span, mismatch: %v err: %v", mismatch, err)
+	}
+	expected.Stop = roundUp(now + 200)
+	if span := store.readSpan(); span != expected {
+		t.Fatalf("Expected merged span %+v, got %+v", expected, span)
+	}
+
+	// Once the timers fired, the span start moves up to the scanned rows
+	now += 210
+	fired := fireDue(t, store)
+	keys := make([]string, 0, len(fired))
+	for key := range fired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) != 2 {
+		t.Fatalf("Expected both timers to fire, got: %v", keys)
+	}
+	if span := store.readSpan(); span.Start != expected.Stop {
+		t.Fatalf("Expected span start to move to %v, got %+v", expected.Stop, span)
+	}
+}
+
+func TestTimerStoreRegistry(t *testing.T) {
+	now := testStart
+	defer setClock(&now)()
+
+	backend := NewMemBackend()
+	if err := CreateWithBackend(testUID, 7, backend, testBucket); err != nil {
+		t.Fatalf("Failed to create store, err: %v", err)
+	}
+
+	store, found := Fetch(testUID, 7)
+	if !found || store.Partition() != 7 {
+		t.Fatalf("Expected store of partition 7 to be found, got: %v", store)
+	}
+	if err := store.Set(now+10, "ref", "ctx"); err != nil {
+		t.Fatalf("Failed to set timer, err: %v", err)
+	}
+
+	store.Free(true)
+	if _, found = Fetch(testUID, 7); found {
+		t.Fatalf("Expected store to be gone once freed")
+	}
+
+	if span := persistedSpan(t, backend, store); span.Stop != roundUp(now+10) {
+		t.Fatalf("Expected freed store to have saved its span, got %+v", span)
+	}
+}
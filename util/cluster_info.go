@@ -255,6 +255,14 @@ func (c *ClusterInfoCache) GetServerGroup(nid NodeId) string {
 	return c.node2group[nid]
 }
 
+func (c *ClusterInfoCache) GetCPUCount(nid NodeId) (int, error) {
+	if int(nid) >= len(c.nodes) {
+		return 0, ErrInvalidNodeId
+	}
+
+	return c.nodes[nid].CPUCount, nil
+}
+
 func (c *ClusterInfoCache) GetNodesByServiceType(srvc string) (nids []NodeId) {
 	for i, svs := range c.nodesvs {
 		if _, ok := svs.Services[srvc]; ok {
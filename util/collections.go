@@ -0,0 +1,82 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+var (
+	ErrScopeMissing      = errors.New("scope does not exist")
+	ErrCollectionMissing = errors.New("collection does not exist")
+)
+
+// Collections manifest of a bucket, as returned by ns_server. Ids are hex strings.
+type collectionsManifest struct {
+	UID    string `json:"uid"`
+	Scopes []struct {
+		Name        string `json:"name"`
+		UID         string `json:"uid"`
+		Collections []struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"collections"`
+	} `json:"scopes"`
+}
+
+// CollectionID looks up the id of the collection of a keyspace in the manifest of its bucket
+func CollectionID(nsServerHostPort string, keyspace common.Keyspace) (uint32, error) {
+	logPrefix := "util::CollectionID"
+
+	netClient := NewClient(HTTPRequestTimeout)
+	endpointURL := fmt.Sprintf("http://%s/pools/default/buckets/%s/scopes",
+		nsServerHostPort, url.PathEscape(keyspace.BucketName))
+	res, err := netClient.Get(endpointURL)
+	if err != nil {
+		logging.Errorf("%s Failed to fetch collections manifest from url: %rs, err: %v", logPrefix, endpointURL, err)
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		logging.Errorf("%s Failed to read response body from url: %rs, err: %v", logPrefix, endpointURL, err)
+		return 0, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to fetch collections manifest of bucket %s, status: %d", keyspace.BucketName, res.StatusCode)
+	}
+
+	var manifest collectionsManifest
+	err = json.Unmarshal(buf, &manifest)
+	if err != nil {
+		logging.Errorf("%s Failed to unmarshal collections manifest from url: %rs, err: %v", logPrefix, endpointURL, err)
+		return 0, err
+	}
+
+	for _, scope := range manifest.Scopes {
+		if scope.Name != keyspace.ScopeName {
+			continue
+		}
+		for _, collection := range scope.Collections {
+			if collection.Name != keyspace.CollectionName {
+				continue
+			}
+			cid, err := strconv.ParseUint(collection.UID, 16, 32)
+			if err != nil {
+				return 0, fmt.Errorf("invalid id %q of collection %s", collection.UID, keyspace)
+			}
+			return uint32(cid), nil
+		}
+		return 0, ErrCollectionMissing
+	}
+	return 0, ErrScopeMissing
+}
@@ -0,0 +1,289 @@
+package util
+
+import (
+	"net"
+	"sort"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+// Strategies to place vbuckets on eventing nodes, picked by the placement_strategy setting
+const (
+	PlacementEven             = "even"
+	PlacementWeightedByCPU    = "weighted_by_cpu"
+	PlacementServerGroupAware = "server_group_aware"
+	PlacementKvColocated      = "kv_colocated"
+)
+
+var PlacementStrategies = []string{
+	PlacementEven,
+	PlacementWeightedByCPU,
+	PlacementServerGroupAware,
+	PlacementKvColocated,
+}
+
+// PlacementNode is what placement strategies know about a cluster node
+type PlacementNode struct {
+	Host        string
+	CPUCount    int
+	ServerGroup string
+}
+
+// PlacementTopology captures the eventing nodes, keyed by eventing address, and the node
+// holding the active copy of each vbucket of the source bucket
+type PlacementTopology struct {
+	EventingNodes map[string]*PlacementNode
+	KvVbNodes     map[uint16]*PlacementNode
+}
+
+// FetchPlacementTopology collects the cluster topology used by placement strategies. KV vbucket
+// ownership is skipped when bucket is empty
+func FetchPlacementTopology(hostaddress, bucket string) (*PlacementTopology, error) {
+	logPrefix := "util::FetchPlacementTopology"
+
+	cic, err := FetchClusterInfoClient(hostaddress)
+	if err != nil {
+		return nil, err
+	}
+	cinfo := cic.GetClusterInfoCache()
+	cinfo.RLock()
+	defer cinfo.RUnlock()
+
+	topology := &PlacementTopology{
+		EventingNodes: make(map[string]*PlacementNode),
+		KvVbNodes:     make(map[uint16]*PlacementNode),
+	}
+
+	for _, nid := range cinfo.GetNodesByServiceType(EventingAdminService) {
+		addr, err := cinfo.GetServiceAddress(nid, EventingAdminService)
+		if err != nil {
+			logging.Errorf("%s Failed to get eventing node address, err: %v", logPrefix, err)
+			continue
+		}
+		topology.EventingNodes[addr] = cinfo.placementNode(nid, addr)
+	}
+
+	if bucket == "" {
+		return topology, nil
+	}
+
+	kvNids, err := cinfo.GetNodesByBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nid := range kvNids {
+		addr, err := cinfo.GetServiceAddress(nid, DataService)
+		if err != nil {
+			logging.Errorf("%s Failed to get kv node address, err: %v", logPrefix, err)
+			continue
+		}
+
+		vbs, err := cinfo.GetVBuckets(nid, bucket)
+		if err != nil {
+			logging.Errorf("%s Failed to get vbuckets of kv node: %rs, err: %v", logPrefix, addr, err)
+			continue
+		}
+
+		node := cinfo.placementNode(nid, addr)
+		for _, vb := range vbs {
+			topology.KvVbNodes[uint16(vb)] = node
+		}
+	}
+
+	return topology, nil
+}
+
+func (c *ClusterInfoCache) placementNode(nid NodeId, addr string) *PlacementNode {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	cpuCount, _ := c.GetCPUCount(nid)
+
+	return &PlacementNode{
+		Host:        host,
+		CPUCount:    cpuCount,
+		ServerGroup: c.GetServerGroup(nid),
+	}
+}
+
+// PlanVbPlacement assigns every vbucket to one of the eventing nodes. The result only depends on
+// the arguments. Unknown strategies fall back to even
+func PlanVbPlacement(strategy string, numVbuckets int, nodeAddrs []string, topology *PlacementTopology) map[uint16]string {
+	addrs := append([]string(nil), nodeAddrs...)
+	sort.Strings(addrs)
+
+	assignMap := make(map[uint16]string)
+	if len(addrs) == 0 || numVbuckets <= 0 {
+		return assignMap
+	}
+
+	if topology == nil {
+		topology = &PlacementTopology{}
+	}
+
+	switch strategy {
+	case PlacementWeightedByCPU:
+		return placeContiguous(numVbuckets, addrs, cpuWeightedVbCounts(numVbuckets, addrs, topology))
+	case PlacementServerGroupAware:
+		return placeNearKv(numVbuckets, addrs, evenVbCounts(numVbuckets, len(addrs)), topology, sameServerGroup)
+	case PlacementKvColocated:
+		return placeNearKv(numVbuckets, addrs, evenVbCounts(numVbuckets, len(addrs)), topology, sameHost, sameServerGroup)
+	default:
+		return placeContiguous(numVbuckets, addrs, evenVbCounts(numVbuckets, len(addrs)))
+	}
+}
+
+// PlannerNodeVbMappings summarises a placement per eventing node, in address order
+func PlannerNodeVbMappings(assignMap map[uint16]string, nodeAddrs []string) []*common.PlannerNodeVbMapping {
+	addrs := append([]string(nil), nodeAddrs...)
+	sort.Strings(addrs)
+
+	nodeVbs := make(map[string][]uint16)
+	for vb, addr := range assignMap {
+		nodeVbs[addr] = append(nodeVbs[addr], vb)
+	}
+
+	mappings := make([]*common.PlannerNodeVbMapping, 0, len(addrs))
+	for _, addr := range addrs {
+		vbs := nodeVbs[addr]
+		sort.Sort(Uint16Slice(vbs))
+
+		mapping := &common.PlannerNodeVbMapping{
+			Hostname: addr,
+			VbsCount: len(vbs),
+		}
+		if len(vbs) > 0 {
+			mapping.StartVb = int(vbs[0])
+			if int(vbs[len(vbs)-1]-vbs[0])+1 != len(vbs) {
+				mapping.Vbuckets = vbs
+			}
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings
+}
+
+func evenVbCounts(numVbuckets, nodeCount int) []int {
+	counts := make([]int, nodeCount)
+	for i := range counts {
+		counts[i] = numVbuckets / nodeCount
+		if i < numVbuckets%nodeCount {
+			counts[i]++
+		}
+	}
+	return counts
+}
+
+// Splits vbuckets proportionally to node cpu counts using the largest remainder method, ties go to
+// the node that sorts first. Nodes with unknown cpu count weigh as one cpu
+func cpuWeightedVbCounts(numVbuckets int, addrs []string, topology *PlacementTopology) []int {
+	weights := make([]int, len(addrs))
+	var totalWeight int
+	for i, addr := range addrs {
+		weights[i] = 1
+		if node, ok := topology.EventingNodes[addr]; ok && node.CPUCount > 1 {
+			weights[i] = node.CPUCount
+		}
+		totalWeight += weights[i]
+	}
+
+	counts := make([]int, len(addrs))
+	remainders := make([]int, len(addrs))
+	order := make([]int, len(addrs))
+	var assigned int
+	for i := range addrs {
+		counts[i] = numVbuckets * weights[i] / totalWeight
+		remainders[i] = numVbuckets * weights[i] % totalWeight
+		order[i] = i
+		assigned += counts[i]
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for i := 0; i < numVbuckets-assigned; i++ {
+		counts[order[i]]++
+	}
+
+	return counts
+}
+
+func placeContiguous(numVbuckets int, addrs []string, counts []int) map[uint16]string {
+	assignMap := make(map[uint16]string)
+
+	var vb int
+	for i, count := range counts {
+		for j := 0; j < count && vb < numVbuckets; j++ {
+			assignMap[uint16(vb)] = addrs[i]
+			vb++
+		}
+	}
+
+	return assignMap
+}
+
+type placementAffinity func(eventingNode, kvNode *PlacementNode) bool
+
+func sameHost(eventingNode, kvNode *PlacementNode) bool {
+	return eventingNode != nil && kvNode != nil && eventingNode.Host == kvNode.Host
+}
+
+func sameServerGroup(eventingNode, kvNode *PlacementNode) bool {
+	return eventingNode != nil && kvNode != nil && eventingNode.ServerGroup != "" &&
+		eventingNode.ServerGroup == kvNode.ServerGroup
+}
+
+// Keeps the per node vbucket counts, but hands each vbucket to a node matching its kv node by the
+// first affinity possible, picking the node with the most room left. Vbuckets that match no node
+// fill up the remaining room in address order
+func placeNearKv(numVbuckets int, addrs []string, counts []int, topology *PlacementTopology, affinities ...placementAffinity) map[uint16]string {
+	assignMap := make(map[uint16]string)
+	room := append([]int(nil), counts...)
+
+	pending := make([]uint16, 0, numVbuckets)
+	for vb := 0; vb < numVbuckets; vb++ {
+		pending = append(pending, uint16(vb))
+	}
+
+	for _, affinity := range affinities {
+		unplaced := make([]uint16, 0, len(pending))
+		for _, vb := range pending {
+			kvNode := topology.KvVbNodes[vb]
+			best := -1
+			for i, addr := range addrs {
+				if room[i] == 0 || !affinity(topology.EventingNodes[addr], kvNode) {
+					continue
+				}
+				if best < 0 || room[i] > room[best] {
+					best = i
+				}
+			}
+
+			if best < 0 {
+				unplaced = append(unplaced, vb)
+				continue
+			}
+			assignMap[vb] = addrs[best]
+			room[best]--
+		}
+		pending = unplaced
+	}
+
+	var i int
+	for _, vb := range pending {
+		for i < len(room) && room[i] == 0 {
+			i++
+		}
+		if i == len(room) {
+			break
+		}
+		assignMap[vb] = addrs[i]
+		room[i]--
+	}
+
+	return assignMap
+}
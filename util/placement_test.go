@@ -0,0 +1,189 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/eventing/common"
+)
+
+func testPlacementTopology() *PlacementTopology {
+	e1 := &PlacementNode{Host: "h1", CPUCount: 4, ServerGroup: "g1"}
+	e2 := &PlacementNode{Host: "h2", CPUCount: 4, ServerGroup: "g1"}
+	e3 := &PlacementNode{Host: "h3", CPUCount: 8, ServerGroup: "g2"}
+	k1 := &PlacementNode{Host: "h1", ServerGroup: "g1"}
+	k2 := &PlacementNode{Host: "h4", ServerGroup: "g2"}
+	k3 := &PlacementNode{Host: "h5", ServerGroup: "g3"}
+
+	topology := &PlacementTopology{
+		EventingNodes: map[string]*PlacementNode{"e1:8096": e1, "e2:8096": e2, "e3:8096": e3},
+		KvVbNodes:     make(map[uint16]*PlacementNode),
+	}
+	for vb := uint16(0); vb < 12; vb++ {
+		switch {
+		case vb < 4:
+			topology.KvVbNodes[vb] = k1
+		case vb < 8:
+			topology.KvVbNodes[vb] = k2
+		default:
+			topology.KvVbNodes[vb] = k3
+		}
+	}
+	return topology
+}
+
+func TestCpuWeightedVbCounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		numVbuckets int
+		cpuCounts   []int
+		expected    []int
+	}{
+		{"same cpu counts", 1024, []int{4, 4, 4}, []int{342, 341, 341}},
+		{"proportional", 1024, []int{2, 6}, []int{256, 768}},
+		{"largest remainder", 1024, []int{1, 2, 4}, []int{146, 293, 585}},
+		{"unknown cpu count", 1024, []int{0, 3}, []int{256, 768}},
+		{"ties to first node", 10, []int{1, 1, 1}, []int{4, 3, 3}},
+		{"more nodes than vbuckets", 2, []int{1, 1, 1}, []int{1, 1, 0}},
+	}
+
+	for _, test := range tests {
+		addrs := make([]string, len(test.cpuCounts))
+		topology := &PlacementTopology{EventingNodes: make(map[string]*PlacementNode)}
+		for i, cpuCount := range test.cpuCounts {
+			addrs[i] = string(rune('a'+i)) + ":8096"
+			if cpuCount > 0 {
+				topology.EventingNodes[addrs[i]] = &PlacementNode{CPUCount: cpuCount}
+			}
+		}
+
+		counts := cpuWeightedVbCounts(test.numVbuckets, addrs, topology)
+		if !reflect.DeepEqual(counts, test.expected) {
+			t.Fatalf("%s: expected counts %v, got %v", test.name, test.expected, counts)
+		}
+
+		var total int
+		for _, count := range counts {
+			total += count
+		}
+		if total != test.numVbuckets {
+			t.Fatalf("%s: expected %d vbuckets in total, got %d", test.name, test.numVbuckets, total)
+		}
+	}
+}
+
+func TestPlaceNearKv(t *testing.T) {
+	addrs := []string{"e1:8096", "e2:8096", "e3:8096"}
+
+	tests := []struct {
+		name       string
+		counts     []int
+		affinities []placementAffinity
+		expected   map[string][]uint16
+	}{
+		{
+			"kv colocated", []int{4, 4, 4}, []placementAffinity{sameHost, sameServerGroup},
+			map[string][]uint16{
+				"e1:8096": {0, 1, 2, 3},
+				"e2:8096": {8, 9, 10, 11},
+				"e3:8096": {4, 5, 6, 7},
+			},
+		},
+		{
+			"server group aware", []int{4, 4, 4}, []placementAffinity{sameServerGroup},
+			map[string][]uint16{
+				"e1:8096": {0, 2, 8, 9},
+				"e2:8096": {1, 3, 10, 11},
+				"e3:8096": {4, 5, 6, 7},
+			},
+		},
+		{
+			"affinity past node count", []int{2, 5, 5}, []placementAffinity{sameHost},
+			map[string][]uint16{
+				"e1:8096": {0, 1},
+				"e2:8096": {2, 3, 4, 5, 6},
+				"e3:8096": {7, 8, 9, 10, 11},
+			},
+		},
+		{
+			"no affinity", []int{4, 4, 4}, nil,
+			map[string][]uint16{
+				"e1:8096": {0, 1, 2, 3},
+				"e2:8096": {4, 5, 6, 7},
+				"e3:8096": {8, 9, 10, 11},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		assignMap := placeNearKv(12, addrs, test.counts, testPlacementTopology(), test.affinities...)
+		if len(assignMap) != 12 {
+			t.Fatalf("%s: expected 12 vbuckets placed, got %d", test.name, len(assignMap))
+		}
+
+		nodeVbs := make(map[string][]uint16)
+		for vb := uint16(0); vb < 12; vb++ {
+			nodeVbs[assignMap[vb]] = append(nodeVbs[assignMap[vb]], vb)
+		}
+		for i, addr := range addrs {
+			if len(nodeVbs[addr]) != test.counts[i] {
+				t.Fatalf("%s: expected %d vbuckets on %s, got %v", test.name, test.counts[i], addr, nodeVbs[addr])
+			}
+		}
+		if !reflect.DeepEqual(nodeVbs, test.expected) {
+			t.Fatalf("%s: expected placement %v, got %v", test.name, test.expected, nodeVbs)
+		}
+	}
+}
+
+func TestPlanVbPlacement(t *testing.T) {
+	addrs := []string{"e3:8096", "e1:8096", "e2:8096"}
+
+	for _, strategy := range append(PlacementStrategies, "unknown") {
+		assignMap := PlanVbPlacement(strategy, 1024, addrs, testPlacementTopology())
+		if len(assignMap) != 1024 {
+			t.Fatalf("%s: expected 1024 vbuckets placed, got %d", strategy, len(assignMap))
+		}
+
+		// Ordering of the addresses is no input to the plan
+		reordered := PlanVbPlacement(strategy, 1024, []string{"e1:8096", "e2:8096", "e3:8096"}, testPlacementTopology())
+		if !reflect.DeepEqual(assignMap, reordered) {
+			t.Fatalf("%s: expected placement to not depend on address order", strategy)
+		}
+	}
+
+	if assignMap := PlanVbPlacement(PlacementKvColocated, 1024, nil, testPlacementTopology()); len(assignMap) != 0 {
+		t.Fatalf("Expected no placement without eventing nodes, got %d vbuckets placed", len(assignMap))
+	}
+}
+
+func TestPlannerNodeVbMappings(t *testing.T) {
+	assignMap := map[uint16]string{
+		0: "a:8096", 1: "a:8096", 2: "a:8096", 3: "a:8096",
+		4: "b:8096", 6: "b:8096",
+		5: "c:8096", 7: "c:8096",
+	}
+
+	expected := []*common.PlannerNodeVbMapping{
+		{Hostname: "a:8096", StartVb: 0, VbsCount: 4},
+		{Hostname: "b:8096", StartVb: 4, VbsCount: 2, Vbuckets: []uint16{4, 6}},
+		{Hostname: "c:8096", StartVb: 5, VbsCount: 2, Vbuckets: []uint16{5, 7}},
+		{Hostname: "d:8096", StartVb: 0, VbsCount: 0},
+	}
+
+	mappings := PlannerNodeVbMappings(assignMap, []string{"d:8096", "c:8096", "b:8096", "a:8096"})
+	if len(mappings) != len(expected) {
+		t.Fatalf("Expected %d mappings, got %d", len(expected), len(mappings))
+	}
+
+	var total int
+	for i, mapping := range mappings {
+		if !reflect.DeepEqual(mapping, expected[i]) {
+			t.Fatalf("Expected mapping %+v, got %+v", expected[i], mapping)
+		}
+		total += mapping.VbsCount
+	}
+	if total != len(assignMap) {
+		t.Fatalf("Expected %d vbuckets in total, got %d", len(assignMap), total)
+	}
+}
@@ -0,0 +1,342 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cm "github.com/couchbase/eventing/common"
+)
+
+// Transitions further away than this are not looked for
+const scheduleHorizon = 366 * 24 * time.Hour
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// cronExpr is a standard 5 field cron expression: minute, hour, day of month, month and day of week
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:idx]
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func parseCron(expr string) (*cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q should have 5 fields", expr)
+	}
+
+	c := &cronExpr{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// Both 0 and 7 stand for sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func (c *cronExpr) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	// As in cron, a day matches either field when both are restricted
+	if !c.domAny && !c.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (c *cronExpr) matches(t time.Time) bool {
+	return c.minute&(1<<uint(t.Minute())) != 0 && c.hour&(1<<uint(t.Hour())) != 0 &&
+		c.month&(1<<uint(t.Month())) != 0 && c.matchesDay(t)
+}
+
+// next returns the first minute after t matched by the expression
+func (c *cronExpr) next(t time.Time) (time.Time, bool) {
+	loc := t.Location()
+	limit := t.Add(scheduleHorizon)
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+type scheduleWindow struct {
+	days       map[time.Weekday]struct{}
+	start, end time.Duration
+}
+
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("time %q should be in HH:MM format", clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseScheduleWindow(w cm.ScheduleWindow) (*scheduleWindow, error) {
+	window := &scheduleWindow{days: make(map[time.Weekday]struct{})}
+	for _, day := range w.Days {
+		weekday, ok := scheduleDays[strings.ToLower(day)]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q, days should be one of sun, mon, tue, wed, thu, fri or sat", day)
+		}
+		window.days[weekday] = struct{}{}
+	}
+
+	var err error
+	if window.start, err = parseClock(w.Start); err != nil {
+		return nil, err
+	}
+	if window.end, err = parseClock(w.End); err != nil {
+		return nil, err
+	}
+	if window.end <= window.start {
+		window.end += 24 * time.Hour
+	}
+	return window, nil
+}
+
+// occurrences returns the start and end of the window on the days from..to, both inclusive
+func (w *scheduleWindow) occurrences(from, to time.Time) (bounds [][2]time.Time) {
+	loc := from.Location()
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for !day.After(to) {
+		if _, ok := w.days[day.Weekday()]; ok || len(w.days) == 0 {
+			start := day.Add(w.start)
+			end := day.Add(w.end)
+			bounds = append(bounds, [2]time.Time{start, end})
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+	}
+	return
+}
+
+type parsedSchedule struct {
+	loc     *time.Location
+	pause   *cronExpr
+	resume  *cronExpr
+	windows []*scheduleWindow
+}
+
+func parseSchedule(schedule *cm.Schedule) (*parsedSchedule, error) {
+	p := &parsedSchedule{loc: time.UTC}
+	if schedule.Timezone != "" {
+		loc, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q", schedule.Timezone)
+		}
+		p.loc = loc
+	}
+
+	hasCron := schedule.Pause != "" || schedule.Resume != ""
+	if hasCron == (len(schedule.Windows) != 0) {
+		return nil, fmt.Errorf("either pause and resume or windows should be specified")
+	}
+
+	if hasCron {
+		if schedule.Pause == "" || schedule.Resume == "" {
+			return nil, fmt.Errorf("both pause and resume should be specified")
+		}
+
+		var err error
+		if p.pause, err = parseCron(schedule.Pause); err != nil {
+			return nil, err
+		}
+		if p.resume, err = parseCron(schedule.Resume); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	for _, w := range schedule.Windows {
+		window, err := parseScheduleWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		p.windows = append(p.windows, window)
+	}
+	return p, nil
+}
+
+func (p *parsedSchedule) inWindow(t time.Time) bool {
+	for _, w := range p.windows {
+		for _, bounds := range w.occurrences(t.AddDate(0, 0, -1), t) {
+			if !t.Before(bounds[0]) && t.Before(bounds[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateSchedule checks that the schedule setting of a function can be applied
+func ValidateSchedule(schedule *cm.Schedule) error {
+	_, err := parseSchedule(schedule)
+	return err
+}
+
+// ScheduledAction returns the transition the schedule asks for by the minute of now, and the
+// minute it was asked for at. Cron schedules return their latest match after the minute of
+// since, so that a transition isn't missed when the schedule isn't evaluated in its minute,
+// or an empty action if nothing matched. Window schedules return the state they want the
+// function in at now.
+func ScheduledAction(schedule *cm.Schedule, since, now time.Time) (string, time.Time, error) {
+	p, err := parseSchedule(schedule)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now = now.In(p.loc).Truncate(time.Minute)
+
+	if p.pause != nil {
+		var action string
+		var at time.Time
+		for t := since.In(p.loc); ; {
+			match, ok := p.pause.next(t)
+			if resumeAt, resumeOk := p.resume.next(t); resumeOk && (!ok || resumeAt.Before(match)) {
+				match, ok = resumeAt, true
+			}
+			if !ok || match.After(now) {
+				return action, at, nil
+			}
+
+			action, at, t = cm.ScheduleResume, match, match
+			// Pause wins when both match the same minute
+			if p.pause.matches(match) {
+				action = cm.SchedulePause
+			}
+		}
+	}
+
+	if p.inWindow(now) {
+		return cm.ScheduleResume, now, nil
+	}
+	return cm.SchedulePause, now, nil
+}
+
+// NextScheduledTransition returns the first transition after now asked for by the schedule,
+// nil if there is none within a year
+func NextScheduledTransition(schedule *cm.Schedule, now time.Time) (*cm.ScheduleTransition, error) {
+	p, err := parseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(p.loc)
+
+	if p.pause != nil {
+		pauseAt, pauseOk := p.pause.next(now)
+		resumeAt, resumeOk := p.resume.next(now)
+		switch {
+		case pauseOk && (!resumeOk || !resumeAt.Before(pauseAt)):
+			return &cm.ScheduleTransition{Action: cm.SchedulePause, At: pauseAt}, nil
+		case resumeOk:
+			return &cm.ScheduleTransition{Action: cm.ScheduleResume, At: resumeAt}, nil
+		}
+		return nil, nil
+	}
+
+	// Windows repeat every week, so the boundaries of the coming week and the window
+	// running over from the day before cover every transition
+	var boundaries []time.Time
+	for _, w := range p.windows {
+		for _, bounds := range w.occurrences(now.AddDate(0, 0, -1), now.AddDate(0, 0, 7)) {
+			boundaries = append(boundaries, bounds[0], bounds[1])
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	for _, at := range boundaries {
+		if !at.After(now) {
+			continue
+		}
+		before, after := p.inWindow(at.Add(-time.Minute)), p.inWindow(at)
+		if before == after {
+			continue
+		}
+		if after {
+			return &cm.ScheduleTransition{Action: cm.ScheduleResume, At: at}, nil
+		}
+		return &cm.ScheduleTransition{Action: cm.SchedulePause, At: at}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,257 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	cm "github.com/couchbase/eventing/common"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		expected []int
+		valid    bool
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}, true},
+		{"3", 0, 59, []int{3}, true},
+		{"1,4,7", 0, 59, []int{1, 4, 7}, true},
+		{"2-5", 0, 59, []int{2, 3, 4, 5}, true},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}, true},
+		{"10-20/5", 0, 59, []int{10, 15, 20}, true},
+		{"50/4", 0, 59, []int{50, 54, 58}, true},
+		{"1-2,5", 1, 12, []int{1, 2, 5}, true},
+		{"60", 0, 59, nil, false},
+		{"0", 1, 31, nil, false},
+		{"5-2", 0, 59, nil, false},
+		{"*/0", 0, 59, nil, false},
+		{"*/x", 0, 59, nil, false},
+		{"a", 0, 59, nil, false},
+		{"1-b", 0, 59, nil, false},
+		{"", 0, 59, nil, false},
+	}
+
+	for _, test := range tests {
+		bits, err := parseCronField(test.field, test.min, test.max)
+		if (err == nil) != test.valid {
+			t.Fatalf("%q: expected valid %t, got err: %v", test.field, test.valid, err)
+		}
+
+		var expected uint64
+		for _, i := range test.expected {
+			expected |= 1 << uint(i)
+		}
+		if bits != expected {
+			t.Fatalf("%q: expected bits %b, got %b", test.field, expected, bits)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{"0 18 * * 1-5", true},
+		{"*/5 * * * *", true},
+		{"0 0 1,15 * 0", true},
+		{"0 0 * * 7", true},
+		{"0 18 * *", false},
+		{"0 18 * * * *", false},
+		{"0 24 * * *", false},
+		{"0 0 32 * *", false},
+		{"0 0 * 13 *", false},
+		{"0 0 * * 8", false},
+	}
+
+	for _, test := range tests {
+		_, err := parseCron(test.expr)
+		if (err == nil) != test.valid {
+			t.Fatalf("%q: expected valid %t, got err: %v", test.expr, test.valid, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", value)
+		return t
+	}
+
+	// 2024-01-01 is a monday
+	tests := []struct {
+		expr     string
+		from     string
+		expected string
+	}{
+		{"*/15 * * * *", "2024-01-01 10:07", "2024-01-01 10:15"},
+		{"*/15 * * * *", "2024-01-01 10:15", "2024-01-01 10:30"},
+		{"0 18 * * *", "2024-01-01 18:00", "2024-01-02 18:00"},
+		{"0 18 * * 1-5", "2024-01-05 19:00", "2024-01-08 18:00"},
+		{"0 9 * * 0", "2024-01-01 00:00", "2024-01-07 09:00"},
+		{"0 9 * * 7", "2024-01-01 00:00", "2024-01-07 09:00"},
+		{"30 6 29 2 *", "2023-06-01 00:00", "2024-02-29 06:30"},
+		{"0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00"},
+		{"0 0 1 1 *", "2024-06-01 00:00", "2025-01-01 00:00"},
+		// With both restricted, either the day of month or the day of week matches
+		{"0 12 15 * 3", "2024-01-01 00:00", "2024-01-03 12:00"},
+		{"0 12 2 * 5", "2024-01-01 00:00", "2024-01-02 12:00"},
+	}
+
+	for _, test := range tests {
+		expr, err := parseCron(test.expr)
+		if err != nil {
+			t.Fatalf("%q: failed to parse, err: %v", test.expr, err)
+		}
+
+		next, ok := expr.next(at(test.from))
+		if !ok || !next.Equal(at(test.expected)) {
+			t.Fatalf("%q from %s: expected %s, got %v (found: %t)", test.expr, test.from, test.expected, next, ok)
+		}
+	}
+
+	// Matches past the schedule horizon aren't looked for
+	for _, expr := range []string{"0 0 30 2 *", "30 6 29 2 *"} {
+		cron, _ := parseCron(expr)
+		if next, ok := cron.next(at("2024-03-01 00:00")); ok {
+			t.Fatalf("%q: expected no match, got %v", expr, next)
+		}
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	window := cm.ScheduleWindow{Days: []string{"sat", "Sun"}, Start: "02:00", End: "06:00"}
+
+	tests := []struct {
+		name     string
+		schedule cm.Schedule
+		valid    bool
+	}{
+		{"cron", cm.Schedule{Pause: "0 18 * * 1-5", Resume: "0 9 * * 1-5"}, true},
+		{"windows", cm.Schedule{Timezone: "Europe/London", Windows: []cm.ScheduleWindow{window}}, true},
+		{"overnight window", cm.Schedule{Windows: []cm.ScheduleWindow{{Start: "22:00", End: "04:00"}}}, true},
+		{"nothing set", cm.Schedule{}, false},
+		{"cron and windows", cm.Schedule{Pause: "0 18 * * *", Resume: "0 9 * * *", Windows: []cm.ScheduleWindow{window}}, false},
+		{"pause only", cm.Schedule{Pause: "0 18 * * *"}, false},
+		{"invalid cron", cm.Schedule{Pause: "0 18 * *", Resume: "0 9 * * *"}, false},
+		{"invalid timezone", cm.Schedule{Timezone: "Mars/Olympus", Pause: "0 18 * * *", Resume: "0 9 * * *"}, false},
+		{"invalid day", cm.Schedule{Windows: []cm.ScheduleWindow{{Days: []string{"someday"}, Start: "02:00", End: "06:00"}}}, false},
+		{"invalid start", cm.Schedule{Windows: []cm.ScheduleWindow{{Start: "2am", End: "06:00"}}}, false},
+		{"invalid end", cm.Schedule{Windows: []cm.ScheduleWindow{{Start: "02:00", End: "25:00"}}}, false},
+	}
+
+	for _, test := range tests {
+		err := ValidateSchedule(&test.schedule)
+		if (err == nil) != test.valid {
+			t.Fatalf("%s: expected valid %t, got err: %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestScheduledAction(t *testing.T) {
+	at := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", value)
+		return t
+	}
+
+	cron := &cm.Schedule{Pause: "0 18 * * 1-5", Resume: "0 9 * * 1-5"}
+	both := &cm.Schedule{Pause: "0 * * * *", Resume: "0 12 * * *"}
+	windows := &cm.Schedule{Windows: []cm.ScheduleWindow{
+		{Days: []string{"sat", "sun"}, Start: "02:00", End: "06:00"},
+		{Days: []string{"mon"}, Start: "22:00", End: "01:00"},
+	}}
+
+	// 2024-01-01 is a monday
+	tests := []struct {
+		name     string
+		schedule *cm.Schedule
+		since    string
+		now      string
+		action   string
+		at       string
+	}{
+		{"cron in its minute", cron, "2024-01-01 17:59", "2024-01-01 18:00", cm.SchedulePause, "2024-01-01 18:00"},
+		{"cron late tick", cron, "2024-01-01 17:59", "2024-01-01 18:03", cm.SchedulePause, "2024-01-01 18:00"},
+		{"cron latest match", cron, "2024-01-01 08:00", "2024-01-02 10:00", cm.ScheduleResume, "2024-01-02 09:00"},
+		{"cron over the weekend", cron, "2024-01-05 17:00", "2024-01-07 12:00", cm.SchedulePause, "2024-01-05 18:00"},
+		{"cron match at since", cron, "2024-01-01 18:00", "2024-01-01 18:30", "", ""},
+		{"cron no match", cron, "2024-01-01 10:00", "2024-01-01 17:59", "", ""},
+		{"cron pause wins a shared minute", both, "2024-01-01 11:30", "2024-01-01 12:10", cm.SchedulePause, "2024-01-01 12:00"},
+		{"in window", windows, "2024-01-06 03:00", "2024-01-06 03:00", cm.ScheduleResume, "2024-01-06 03:00"},
+		{"window start", windows, "2024-01-06 02:00", "2024-01-06 02:00", cm.ScheduleResume, "2024-01-06 02:00"},
+		{"window end", windows, "2024-01-06 06:00", "2024-01-06 06:00", cm.SchedulePause, "2024-01-06 06:00"},
+		{"outside windows", windows, "2024-01-03 03:00", "2024-01-03 03:00", cm.SchedulePause, "2024-01-03 03:00"},
+		{"overnight window", windows, "2024-01-02 00:30", "2024-01-02 00:30", cm.ScheduleResume, "2024-01-02 00:30"},
+	}
+
+	for _, test := range tests {
+		action, actionAt, err := ScheduledAction(test.schedule, at(test.since), at(test.now))
+		if err != nil {
+			t.Fatalf("%s: failed to evaluate schedule, err: %v", test.name, err)
+		}
+		if action != test.action {
+			t.Fatalf("%s: expected action %q, got %q", test.name, test.action, action)
+		}
+		if test.action != "" && !actionAt.Equal(at(test.at)) {
+			t.Fatalf("%s: expected action at %s, got %v", test.name, test.at, actionAt)
+		}
+	}
+}
+
+func TestScheduledActionTimezone(t *testing.T) {
+	schedule := &cm.Schedule{Timezone: "Asia/Kolkata", Pause: "0 18 * * *", Resume: "0 9 * * *"}
+
+	// 18:00 in Kolkata is 12:30 UTC
+	since := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := time.Date(2024, 1, 1, 12, 45, 0, 0, time.UTC)
+	action, at, err := ScheduledAction(schedule, since, now)
+	if err != nil {
+		t.Fatalf("Failed to evaluate schedule, err: %v", err)
+	}
+	if action != cm.SchedulePause || !at.Equal(time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC)) {
+		t.Fatalf("Expected pause at 12:30 UTC, got %q at %v", action, at.UTC())
+	}
+}
+
+func TestNextScheduledTransition(t *testing.T) {
+	at := func(value string) time.Time {
+		t, _ := time.Parse("2006-01-02 15:04", value)
+		return t
+	}
+
+	cron := &cm.Schedule{Pause: "0 18 * * 1-5", Resume: "0 9 * * 1-5"}
+	windows := &cm.Schedule{Windows: []cm.ScheduleWindow{
+		{Days: []string{"sat"}, Start: "02:00", End: "06:00"},
+		{Days: []string{"sat"}, Start: "06:00", End: "08:00"},
+	}}
+
+	// 2024-01-01 is a monday
+	tests := []struct {
+		name     string
+		schedule *cm.Schedule
+		now      string
+		action   string
+		at       string
+	}{
+		{"cron pause next", cron, "2024-01-01 12:00", cm.SchedulePause, "2024-01-01 18:00"},
+		{"cron resume next", cron, "2024-01-01 18:00", cm.ScheduleResume, "2024-01-02 09:00"},
+		{"cron over the weekend", cron, "2024-01-05 18:30", cm.ScheduleResume, "2024-01-08 09:00"},
+		{"window start", windows, "2024-01-01 12:00", cm.ScheduleResume, "2024-01-06 02:00"},
+		// Adjacent windows don't pause the function in between
+		{"adjacent windows", windows, "2024-01-06 03:00", cm.SchedulePause, "2024-01-06 08:00"},
+	}
+
+	for _, test := range tests {
+		transition, err := NextScheduledTransition(test.schedule, at(test.now))
+		if err != nil {
+			t.Fatalf("%s: failed to evaluate schedule, err: %v", test.name, err)
+		}
+		if transition == nil {
+			t.Fatalf("%s: expected %s at %s, got no transition", test.name, test.action, test.at)
+		}
+		if transition.Action != test.action || !transition.At.Equal(at(test.at)) {
+			t.Fatalf("%s: expected %s at %s, got %s at %v", test.name, test.action, test.at, transition.Action, transition.At)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Decoding of the snappy block format, which KV uses for values on DCP streams that negotiated
+// compression. See https://github.com/google/snappy/blob/master/format_description.txt
+
+var ErrSnappyCorrupt = errors.New("snappy: corrupt input")
+
+const (
+	snappyTagLiteral = 0x00
+	snappyTagCopy1   = 0x01
+	snappyTagCopy2   = 0x02
+	snappyTagCopy4   = 0x03
+)
+
+// SnappyDecodedLen returns the length of the inflated value, as written in its header
+func SnappyDecodedLen(src []byte) (int, error) {
+	dLen, _, err := snappyHeader(src)
+	return dLen, err
+}
+
+func snappyHeader(src []byte) (dLen, headerLen int, err error) {
+	v, n := binary.Uvarint(src)
+	if n <= 0 || v > 0xffffffff {
+		return 0, 0, ErrSnappyCorrupt
+	}
+	return int(v), n, nil
+}
+
+// SnappyDecode inflates a snappy compressed value
+func SnappyDecode(src []byte) ([]byte, error) {
+	dLen, s, err := snappyHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := make([]byte, 0, dLen)
+	for s < len(src) {
+		tag := src[s]
+		var length, offset uint64
+
+		switch tag & 0x03 {
+		case snappyTagLiteral:
+			x := uint64(tag >> 2)
+			s++
+			// Lengths of 60 and more are written in the next 1 to 4 bytes
+			if x >= 60 {
+				n := int(x - 59)
+				if n > len(src)-s {
+					return nil, ErrSnappyCorrupt
+				}
+				x = 0
+				for i := 0; i < n; i++ {
+					x |= uint64(src[s+i]) << (8 * uint(i))
+				}
+				s += n
+			}
+			length = x + 1
+			if length > uint64(len(src)-s) || length > uint64(dLen-len(dst)) {
+				return nil, ErrSnappyCorrupt
+			}
+			dst = append(dst, src[s:s+int(length)]...)
+			s += int(length)
+			continue
+
+		case snappyTagCopy1:
+			if len(src)-s < 2 {
+				return nil, ErrSnappyCorrupt
+			}
+			length = 4 + uint64(tag>>2)&0x07
+			offset = uint64(tag&0xe0)<<3 | uint64(src[s+1])
+			s += 2
+
+		case snappyTagCopy2:
+			if len(src)-s < 3 {
+				return nil, ErrSnappyCorrupt
+			}
+			length = 1 + uint64(tag>>2)
+			offset = uint64(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+
+		case snappyTagCopy4:
+			if len(src)-s < 5 {
+				return nil, ErrSnappyCorrupt
+			}
+			length = 1 + uint64(tag>>2)
+			offset = uint64(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+
+		if offset == 0 || offset > uint64(len(dst)) || length > uint64(dLen-len(dst)) {
+			return nil, ErrSnappyCorrupt
+		}
+		// Copies may overlap the bytes they append, so they go one byte at a time
+		for i := uint64(0); i < length; i++ {
+			dst = append(dst, dst[len(dst)-int(offset)])
+		}
+	}
+
+	if len(dst) != dLen {
+		return nil, ErrSnappyCorrupt
+	}
+	return dst, nil
+}
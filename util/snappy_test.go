@@ -0,0 +1,60 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSnappyDecode(t *testing.T) {
+	longLiteral := bytes.Repeat([]byte("x"), 100)
+
+	tests := []struct {
+		name     string
+		src      []byte
+		expected []byte
+	}{
+		{"empty", []byte{0x00}, []byte{}},
+		{"literal", []byte{0x05, 0x10, 'h', 'e', 'l', 'l', 'o'}, []byte("hello")},
+		{"long literal", append([]byte{0x64, 0xf0, 0x63}, longLiteral...), longLiteral},
+		{"overlapping copy1", []byte{0x0c, 0x08, 'a', 'b', 'c', 0x15, 0x03}, []byte("abcabcabcabc")},
+		{"copy2", []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x04, 0x00}, []byte("abcdabcd")},
+		{"copy4", []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0f, 0x04, 0x00, 0x00, 0x00}, []byte("abcdabcd")},
+	}
+
+	for _, test := range tests {
+		value, err := SnappyDecode(test.src)
+		if err != nil {
+			t.Fatalf("%s: failed to decode, err: %v", test.name, err)
+		}
+		if !bytes.Equal(value, test.expected) {
+			t.Fatalf("%s: expected %q, got %q", test.name, test.expected, value)
+		}
+
+		dLen, err := SnappyDecodedLen(test.src)
+		if err != nil || dLen != len(test.expected) {
+			t.Fatalf("%s: expected decoded length %d, got %d err: %v", test.name, len(test.expected), dLen, err)
+		}
+	}
+}
+
+func TestSnappyDecodeCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		src  []byte
+	}{
+		{"no header", []byte{}},
+		{"truncated literal", []byte{0x05, 0x10, 'h', 'e'}},
+		{"literal past length", []byte{0x02, 0x10, 'h', 'e', 'l', 'l', 'o'}},
+		{"short output", []byte{0x06, 0x10, 'h', 'e', 'l', 'l', 'o'}},
+		{"copy before output", []byte{0x04, 0x01, 0x01}},
+		{"zero offset", []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x00, 0x00}},
+		{"offset past output", []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x05, 0x00}},
+		{"truncated copy", []byte{0x08, 0x0c, 'a', 'b', 'c', 'd', 0x0e, 0x04}},
+	}
+
+	for _, test := range tests {
+		if value, err := SnappyDecode(test.src); err != ErrSnappyCorrupt {
+			t.Fatalf("%s: expected corrupt input error, got %q err: %v", test.name, value, err)
+		}
+	}
+}
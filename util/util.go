@@ -533,6 +533,24 @@ func ListChildren(path string) []string {
 	return children
 }
 
+// MetakvLeafNames lists the names of the keys right under a metakv directory, in sorted order
+func MetakvLeafNames(dirpath string) ([]string, error) {
+	entries, err := metakv.ListAllChildren(dirpath)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimPrefix(entry.Path, dirpath)
+		if name != "" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 func MetakvGet(path string) ([]byte, error) {
 	data, _, err := metakv.Get(path)
 	if err != nil {
@@ -1613,6 +1631,9 @@ func EncodeAppPayload(app *cm.Application) []byte {
 		cfg.CurlAddBearerKey(builder, bearerKeyEncoded)
 		cfg.CurlAddAllowCookies(builder, cookiesEncoded)
 		cfg.CurlAddValidateSSLCertificate(builder, validateSSLCertificateEncoded)
+		cfg.CurlAddMaxRequestsPerSec(builder, uint32(app.DeploymentConfig.Curl[i].MaxRequestsPerSec))
+		cfg.CurlAddMaxConcurrent(builder, uint32(app.DeploymentConfig.Curl[i].MaxConcurrent))
+		cfg.CurlAddTimeoutMs(builder, uint32(app.DeploymentConfig.Curl[i].TimeoutMs))
 		curlBindingsEnd := cfg.CurlEnd(builder)
 
 		curlBindings = append(curlBindings, curlBindingsEnd)
@@ -1629,11 +1650,15 @@ func EncodeAppPayload(app *cm.Application) []byte {
 	for i := 0; i < len(app.DeploymentConfig.Buckets); i++ {
 		alias := builder.CreateString(app.DeploymentConfig.Buckets[i].Alias)
 		bName := builder.CreateString(app.DeploymentConfig.Buckets[i].BucketName)
+		bScope := builder.CreateString(app.DeploymentConfig.Buckets[i].ScopeName)
+		bCollection := builder.CreateString(app.DeploymentConfig.Buckets[i].CollectionName)
 		bAccess := builder.CreateString(app.DeploymentConfig.Buckets[i].Access)
 
 		cfg.BucketStart(builder)
 		cfg.BucketAddAlias(builder, alias)
 		cfg.BucketAddBucketName(builder, bName)
+		cfg.BucketAddScopeName(builder, bScope)
+		cfg.BucketAddCollectionName(builder, bCollection)
 		csBucket := cfg.BucketEnd(builder)
 
 		bNames = append(bNames, csBucket)
@@ -1654,11 +1679,22 @@ func EncodeAppPayload(app *cm.Application) []byte {
 
 	metaBucket := builder.CreateString(app.DeploymentConfig.MetadataBucket)
 	sourceBucket := builder.CreateString(app.DeploymentConfig.SourceBucket)
+	sourceScope := builder.CreateString(app.DeploymentConfig.SourceScope)
+	sourceCollection := builder.CreateString(app.DeploymentConfig.SourceCollection)
+
+	var deadLetterBucketName string
+	if app.DeploymentConfig.DeadLetter != nil {
+		deadLetterBucketName = app.DeploymentConfig.DeadLetter.BucketName
+	}
+	deadLetterBucket := builder.CreateString(deadLetterBucketName)
 
 	cfg.DepCfgStart(builder)
 	cfg.DepCfgAddBuckets(builder, buckets)
 	cfg.DepCfgAddMetadataBucket(builder, metaBucket)
 	cfg.DepCfgAddSourceBucket(builder, sourceBucket)
+	cfg.DepCfgAddSourceScope(builder, sourceScope)
+	cfg.DepCfgAddSourceCollection(builder, sourceCollection)
+	cfg.DepCfgAddDeadLetterBucket(builder, deadLetterBucket)
 	depcfg := cfg.DepCfgEnd(builder)
 
 	appCode := builder.CreateString(app.AppHandlers)
@@ -1718,6 +1754,12 @@ func ParseFunctionPayload(data []byte, fnName string) cm.Application {
 
 	depcfg.MetadataBucket = string(dcfg.MetadataBucket())
 	depcfg.SourceBucket = string(dcfg.SourceBucket())
+	depcfg.SourceScope = string(dcfg.SourceScope())
+	depcfg.SourceCollection = string(dcfg.SourceCollection())
+
+	if deadLetterBucket := string(dcfg.DeadLetterBucket()); deadLetterBucket != "" {
+		depcfg.DeadLetter = &cm.DeadLetter{BucketName: deadLetterBucket}
+	}
 
 	var buckets []cm.Bucket
 	b := new(cfg.Bucket)
@@ -1725,9 +1767,11 @@ func ParseFunctionPayload(data []byte, fnName string) cm.Application {
 
 		if dcfg.Buckets(b, i) {
 			newBucket := cm.Bucket{
-				Alias:      string(b.Alias()),
-				BucketName: string(b.BucketName()),
-				Access:     string(config.Access(i)),
+				Alias:          string(b.Alias()),
+				BucketName:     string(b.BucketName()),
+				ScopeName:      string(b.ScopeName()),
+				CollectionName: string(b.CollectionName()),
+				Access:         string(config.Access(i)),
 			}
 			buckets = append(buckets, newBucket)
 		}
@@ -1754,6 +1798,9 @@ func ParseFunctionPayload(data []byte, fnName string) cm.Application {
 				BearerKey:              string(c.BearerKey()),
 				AllowCookies:           allowCookies,
 				ValidateSSLCertificate: validateSSL,
+				MaxRequestsPerSec:      int(c.MaxRequestsPerSec()),
+				MaxConcurrent:          int(c.MaxConcurrent()),
+				TimeoutMs:              int(c.TimeoutMs()),
 			}
 			curl = append(curl, newCurl)
 		}
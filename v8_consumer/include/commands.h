@@ -42,12 +42,25 @@ enum v8_worker_opcode {
   oGetCurlLatencyStats,
   oVersion,
   oInsight,
+  oTestEvents,
   V8_Worker_Opcode_Unknown
 };
 
-enum dcp_opcode { oDelete, oMutation, DCP_Opcode_Unknown };
+enum dcp_opcode {
+  oDelete,
+  oMutation,
+  oMutationBatch,
+  oCompressedMutation,
+  oRollback,
+  DCP_Opcode_Unknown
+};
 
-enum filter_opcode { oVbFilter, oProcessedSeqNo, Filter_Opcode_Unknown };
+enum filter_opcode {
+  oVbFilter,
+  oProcessedSeqNo,
+  oFilteredSeqNo,
+  Filter_Opcode_Unknown
+};
 
 enum internal_opcode {
   oScanTimer,
@@ -63,6 +76,7 @@ enum app_worker_setting_opcode {
   oTimerContextSize,
   oVbMap,
   oWorkerMemQuota,
+  oCurlLimitShare,
   App_Worker_Setting_Opcode_Unknown
 };
 
@@ -86,6 +100,8 @@ enum msg_type {
   mBucket_Ops_Response,
   mFilterAck,
   mPauseAck,
+  mDead_Letter,
+  mNotification,
   Msg_Unknown
 };
 
@@ -103,6 +119,7 @@ enum v8_worker_config_opcode {
   oLcbExceptions,
   oCurlLatencyStats,
   oCodeInsights,
+  oTestResult,
   V8_Worker_Config_Opcode_Unknown
 };
 
@@ -110,4 +127,8 @@ enum doc_timer_response_opcode { timerResponse };
 
 enum bucket_ops_response_opcode { checkpointResponse };
 
+enum dead_letter_opcode { deadLetterEntry };
+
+enum notification_opcode { notificationPublish };
+
 #endif
@@ -20,14 +20,20 @@
 #include "../../gen/flatbuf/payload_generated.h"
 
 #include "curl.h"
+#include "curl_throttle.h"
 
 typedef struct deployment_config_s {
   std::string metadata_bucket;
   std::string source_bucket;
+  std::string source_scope;
+  std::string source_collection;
+  std::string dead_letter_bucket;
   std::unordered_map<std::string,
                      std::unordered_map<std::string, std::vector<std::string>>>
       component_configs;
   std::vector<CurlBinding> curl_bindings;
+  // Keyed by binding alias
+  std::unordered_map<std::string, CurlLimits> curl_limits;
 } deployment_config;
 
 deployment_config *ParseDeployment(const char *app_name);
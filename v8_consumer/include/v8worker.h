@@ -191,6 +191,8 @@ extern std::atomic<int64_t> on_update_success;
 extern std::atomic<int64_t> on_update_failure;
 extern std::atomic<int64_t> on_delete_success;
 extern std::atomic<int64_t> on_delete_failure;
+extern std::atomic<int64_t> on_rollback_success;
+extern std::atomic<int64_t> on_rollback_failure;
 
 extern std::atomic<int64_t> timer_create_failure;
 
@@ -211,6 +213,7 @@ extern std::atomic<int64_t> enqueued_dcp_delete_msg_counter;
 extern std::atomic<int64_t> enqueued_dcp_mutation_msg_counter;
 extern std::atomic<int64_t> dcp_delete_parse_failure;
 extern std::atomic<int64_t> dcp_mutation_parse_failure;
+extern std::atomic<int64_t> dcp_mutation_inflate_failure;
 extern std::atomic<int64_t> filtered_dcp_delete_counter;
 extern std::atomic<int64_t> filtered_dcp_mutation_counter;
 extern std::atomic<int64_t> enqueued_timer_msg_counter;
@@ -230,9 +233,13 @@ public:
   void TaskDurationWatcher();
 
   int SendUpdate(const std::string &value, const std::string &meta);
+  int SendUpdateBatch(
+      const std::vector<std::pair<std::string, std::string>> &docs);
   int SendDelete(const std::string &value, const std::string &meta);
   void SendTimer(std::string callback, std::string timer_ctx);
+  void SendRollback(const std::string &rollback_info);
   std::string Compile(std::string handler);
+  std::string RunTestEvents(const std::string &events);
 
   void StartDebugger();
   void StopDebugger();
@@ -249,7 +256,10 @@ public:
   void UpdateHistogram(Time::time_point t);
   void UpdateCurlLatencyHistogram(const Time::time_point &start);
 
-  void GetBucketOpsMessages(std::vector<uv_buf_t> &messages);
+  void AddNotification(const std::string &topic, const std::string &value);
+
+  void GetBucketOpsMessages(std::vector<uv_buf_t> &messages,
+                            int16_t thread_index);
 
   void UpdateVbFilter(int vb_no, uint64_t seq_no);
 
@@ -293,12 +303,14 @@ public:
   v8::Isolate *GetIsolate() { return isolate_; }
   v8::Persistent<v8::Context> context_;
   v8::Persistent<v8::Function> on_update_;
+  v8::Persistent<v8::Function> on_update_batch_;
   v8::Persistent<v8::Function> on_delete_;
 
   std::string app_name_;
   std::string script_to_execute_;
 
   std::string cb_source_bucket_;
+  Keyspace cb_source_keyspace_;
   int64_t max_task_duration_;
 
   server_settings_t *settings_;
@@ -330,7 +342,15 @@ private:
   void UpdateSeqNumLocked(int vb, uint64_t seq_num);
   void HandleDeleteEvent(const std::unique_ptr<WorkerMessage> &msg);
   void HandleMutationEvent(const std::unique_ptr<WorkerMessage> &msg);
+  void HandleCompressedMutationEvent(const std::unique_ptr<WorkerMessage> &msg);
+  int HandleMutationBatchEvent(const std::unique_ptr<WorkerMessage> &msg);
+  void HandleFilteredSeqNo(const std::unique_ptr<WorkerMessage> &msg);
+  bool AcceptDcpEvent(const std::unique_ptr<WorkerMessage> &msg,
+                      std::atomic<int64_t> &parse_failure);
   bool IsFilteredEventLocked(int vb, uint64_t seq_num);
+  bool IsReplayedEvent(const std::unique_ptr<WorkerMessage> &msg) const;
+  void AddDeadLetter(const std::string &meta, const std::string &event,
+                     const std::string &exception);
   std::tuple<int, uint64_t, bool>
   GetVbAndSeqNum(const std::unique_ptr<WorkerMessage> &msg) const;
   v8::Local<v8::Object> NewCouchbaseNameSpace();
@@ -362,6 +382,11 @@ private:
   std::vector<std::vector<uint64_t>> vbfilter_map_;
   std::vector<uint64_t> processed_bucketops_;
   std::mutex bucketops_lock_;
+  bool dead_letter_enabled_{false};
+  std::mutex dead_letter_lock_;
+  std::vector<std::string> dead_letters_;
+  std::mutex notification_lock_;
+  std::vector<std::string> notifications_;
   std::mutex pause_lock_;
   v8::Isolate *isolate_;
   v8::Platform *platform_;
@@ -383,4 +408,6 @@ private:
   std::vector<std::string> handler_footers_;
 };
 
+void PublishNotification(const v8::FunctionCallbackInfo<v8::Value> &args);
+
 #endif
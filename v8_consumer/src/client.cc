@@ -67,6 +67,8 @@ std::string GetExecutionStats(const std::map<int16_t, V8Worker *> &workers) {
   estats["on_update_failure"] = on_update_failure.load();
   estats["on_delete_success"] = on_delete_success.load();
   estats["on_delete_failure"] = on_delete_failure.load();
+  estats["on_rollback_success"] = on_rollback_success.load();
+  estats["on_rollback_failure"] = on_rollback_failure.load();
   estats["timer_create_failure"] = timer_create_failure.load();
   estats["messages_parsed"] = messages_parsed;
   estats["dcp_delete_msg_counter"] = dcp_delete_msg_counter.load();
@@ -84,6 +86,7 @@ std::string GetExecutionStats(const std::map<int16_t, V8Worker *> &workers) {
   estats["lcb_retry_failure"] = lcb_retry_failure.load();
   estats["dcp_delete_parse_failure"] = dcp_delete_parse_failure.load();
   estats["dcp_mutation_parse_failure"] = dcp_mutation_parse_failure.load();
+  estats["dcp_mutation_inflate_failure"] = dcp_mutation_inflate_failure.load();
   estats["filtered_dcp_delete_counter"] = filtered_dcp_delete_counter.load();
   estats["filtered_dcp_mutation_counter"] =
       filtered_dcp_mutation_counter.load();
@@ -105,6 +108,8 @@ std::string GetExecutionStats(const std::map<int16_t, V8Worker *> &workers) {
   estats["curl"]["delete"] = Curl::GetStats().GetCurlDeleteStat();
   estats["curl"]["head"] = Curl::GetStats().GetCurlHeadStat();
   estats["curl"]["put"] = Curl::GetStats().GetCurlPutStat();
+  estats["curl"]["throttled"] = CurlThrottle::Get().GetThrottledCount();
+  estats["curl"]["rejected"] = CurlThrottle::Get().GetRejectedCount();
   estats["timestamp"] = GetTimestampNow();
   estats["uv_msg_parse_failure"] = uv_msg_parse_failure.load();
   return estats.dump();
@@ -624,6 +629,14 @@ void AppWorker::RouteMessageWithResponse(
       resp_msg_->opcode = oCompileInfo;
       msg_priority_ = true;
       break;
+    case oTestEvents:
+      LOG(logDebug) << "Running test events:" << RU(worker_msg->header.metadata)
+                    << std::endl;
+      resp_msg_->msg.assign(workers_[0]->RunTestEvents(worker_msg->header.metadata));
+      resp_msg_->msg_type = mV8_Worker_Config;
+      resp_msg_->opcode = oTestResult;
+      msg_priority_ = true;
+      break;
     case oGetLcbExceptions:
       for (const auto &w : workers_) {
         w.second->ListLcbExceptions(agg_lcb_exceptions);
@@ -651,7 +664,10 @@ void AppWorker::RouteMessageWithResponse(
   case eDCP:
     payload = flatbuf::payload::GetPayload(
         (const void *)worker_msg->payload.payload.c_str());
-    val.assign(payload->value()->str());
+    // Batches carry their mutations in a vector instead
+    if (payload->value() != nullptr) {
+      val.assign(payload->value()->str());
+    }
 
     switch (getDCPOpcode(worker_msg->header.opcode)) {
     case oDelete:
@@ -666,6 +682,7 @@ void AppWorker::RouteMessageWithResponse(
       }
       break;
     case oMutation:
+    case oCompressedMutation:
       worker_index = partition_thr_map_[worker_msg->header.partition];
       if (workers_[worker_index] != nullptr) {
         enqueued_dcp_mutation_msg_counter++;
@@ -676,6 +693,29 @@ void AppWorker::RouteMessageWithResponse(
         ++mutation_events_lost;
       }
       break;
+    case oMutationBatch: {
+      worker_index = partition_thr_map_[worker_msg->header.partition];
+      auto batch_size =
+          payload->mutations() != nullptr ? payload->mutations()->size() : 0;
+      if (workers_[worker_index] != nullptr) {
+        enqueued_dcp_mutation_msg_counter += batch_size;
+        workers_[worker_index]->PushBack(std::move(worker_msg));
+      } else {
+        LOG(logError) << "Mutation batch lost: worker " << worker_index
+                      << " is null" << std::endl;
+        mutation_events_lost += batch_size;
+      }
+    } break;
+    case oRollback:
+      worker_index = partition_thr_map_[worker_msg->header.partition];
+      if (workers_[worker_index] != nullptr) {
+        workers_[worker_index]->PushBack(std::move(worker_msg));
+      } else {
+        LOG(logError) << "Rollback event lost: worker " << worker_index
+                      << " is null" << std::endl;
+        ++e_dcp_lost;
+      }
+      break;
     default:
       LOG(logError) << "Opcode " << getDCPOpcode(worker_msg->header.opcode)
                     << "is not implemented for eDCP" << std::endl;
@@ -727,6 +767,14 @@ void AppWorker::RouteMessageWithResponse(
         }
       }
       break;
+    case oFilteredSeqNo:
+      // Queued behind the events sent before it, so that the checkpoint
+      // doesn't move past events that are yet to be processed
+      worker_index = partition_thr_map_[worker_msg->header.partition];
+      if (workers_[worker_index] != nullptr) {
+        workers_[worker_index]->PushBack(std::move(worker_msg));
+      }
+      break;
     default:
       LOG(logError) << "Opcode " << getFilterOpcode(worker_msg->header.opcode)
                     << "is not implemented for filtering" << std::endl;
@@ -817,6 +865,12 @@ void AppWorker::RouteMessageWithResponse(
       msg_priority_ = true;
       break;
     }
+    case oCurlLimitShare:
+      CurlThrottle::Get().SetShare(std::stod(worker_msg->header.metadata));
+      LOG(logInfo) << "Share of cURL binding limits: "
+                   << worker_msg->header.metadata << std::endl;
+      msg_priority_ = true;
+      break;
     default:
       LOG(logError) << "Opcode "
                     << getAppWorkerSettingOpcode(worker_msg->header.opcode)
@@ -886,7 +940,7 @@ void AppWorker::WriteResponses() {
     for (const auto &w : workers_) {
       std::vector<uv_buf_t> messages;
       std::vector<int> length_prefix_sum;
-      w.second->GetBucketOpsMessages(messages);
+      w.second->GetBucketOpsMessages(messages, w.first);
       if (messages.empty()) {
         continue;
       }
@@ -58,6 +58,8 @@ v8_worker_opcode getV8WorkerOpcode(int8_t opcode) {
     return oGetCurlLatencyStats;
   if (opcode == 13)
     return oInsight;
+  if (opcode == 14)
+    return oTestEvents;
   return V8_Worker_Opcode_Unknown;
 }
 
@@ -66,6 +68,12 @@ dcp_opcode getDCPOpcode(int8_t opcode) {
     return oDelete;
   if (opcode == 2)
     return oMutation;
+  if (opcode == 3)
+    return oMutationBatch;
+  if (opcode == 4)
+    return oCompressedMutation;
+  if (opcode == 5)
+    return oRollback;
   return DCP_Opcode_Unknown;
 }
 
@@ -82,6 +90,8 @@ app_worker_setting_opcode getAppWorkerSettingOpcode(int8_t opcode) {
     return oVbMap;
   if (opcode == 6)
     return oWorkerMemQuota;
+  if (opcode == 7)
+    return oCurlLimitShare;
   return App_Worker_Setting_Opcode_Unknown;
 }
 
@@ -96,6 +106,8 @@ filter_opcode getFilterOpcode(int8_t opcode) {
     return oVbFilter;
   if (opcode == 2)
     return oProcessedSeqNo;
+  if (opcode == 3)
+    return oFilteredSeqNo;
   return Filter_Opcode_Unknown;
 }
 
@@ -19,6 +19,15 @@ deployment_config *ParseDeployment(const char *app_code) {
   auto dep_cfg = app_cfg->depCfg();
   config->metadata_bucket = dep_cfg->metadataBucket()->str();
   config->source_bucket = dep_cfg->sourceBucket()->str();
+  if (dep_cfg->sourceScope() != nullptr) {
+    config->source_scope = dep_cfg->sourceScope()->str();
+  }
+  if (dep_cfg->sourceCollection() != nullptr) {
+    config->source_collection = dep_cfg->sourceCollection()->str();
+  }
+  if (dep_cfg->deadLetterBucket() != nullptr) {
+    config->dead_letter_bucket = dep_cfg->deadLetterBucket()->str();
+  }
 
   auto buckets = dep_cfg->buckets();
 
@@ -28,6 +37,12 @@ deployment_config *ParseDeployment(const char *app_code) {
     std::vector<std::string> bucket_info;
     bucket_info.push_back(buckets->Get(i)->bucketName()->str());
     bucket_info.push_back(buckets->Get(i)->alias()->str());
+    bucket_info.push_back(buckets->Get(i)->scopeName() != nullptr
+                              ? buckets->Get(i)->scopeName()->str()
+                              : "");
+    bucket_info.push_back(buckets->Get(i)->collectionName() != nullptr
+                              ? buckets->Get(i)->collectionName()->str()
+                              : "");
     bucket_alias.push_back(buckets->Get(i)->alias()->str());
 
     buckets_info[buckets->Get(i)->alias()->str()] = bucket_info;
@@ -56,7 +71,14 @@ deployment_config *ParseDeployment(const char *app_code) {
   if (curl_cfg != nullptr) {
     config->curl_bindings.reserve(static_cast<std::size_t>(curl_cfg->size()));
     for (flatbuffers::uoffset_t i = 0; i < curl_cfg->size(); ++i) {
-      config->curl_bindings.emplace_back(curl_cfg->Get(i));
+      const auto curl = curl_cfg->Get(i);
+      config->curl_bindings.emplace_back(curl);
+
+      CurlLimits limits;
+      limits.max_requests_per_sec = curl->maxRequestsPerSec();
+      limits.max_concurrent = curl->maxConcurrent();
+      limits.timeout_ms = curl->timeoutMs();
+      config->curl_limits[curl->value()->str()] = limits;
     }
   }
 
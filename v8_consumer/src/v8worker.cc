@@ -11,17 +11,20 @@
 
 #include <mutex>
 #include <nlohmann/json.hpp>
+#include <snappy.h>
 #include <string>
 #include <unordered_map>
 
 #include "bucket.h"
 #include "curl.h"
+#include "curl_throttle.h"
 #include "insight.h"
 #include "lang_compat.h"
 #include "query-helper.h"
 #include "query-iterable.h"
 #include "query-mgr.h"
 #include "retry_util.h"
+#include "sandbox.h"
 #include "timer.h"
 #include "utils.h"
 #include "v8worker.h"
@@ -36,6 +39,8 @@ std::atomic<int64_t> on_update_success = {0};
 std::atomic<int64_t> on_update_failure = {0};
 std::atomic<int64_t> on_delete_success = {0};
 std::atomic<int64_t> on_delete_failure = {0};
+std::atomic<int64_t> on_rollback_success = {0};
+std::atomic<int64_t> on_rollback_failure = {0};
 
 std::atomic<int64_t> timer_create_failure = {0};
 
@@ -47,6 +52,7 @@ std::atomic<int64_t> dcp_delete_msg_counter = {0};
 std::atomic<int64_t> dcp_mutation_msg_counter = {0};
 std::atomic<int64_t> dcp_delete_parse_failure = {0};
 std::atomic<int64_t> dcp_mutation_parse_failure = {0};
+std::atomic<int64_t> dcp_mutation_inflate_failure = {0};
 std::atomic<int64_t> filtered_dcp_delete_counter = {0};
 std::atomic<int64_t> filtered_dcp_mutation_counter = {0};
 std::atomic<int64_t> timer_msg_counter = {0};
@@ -95,7 +101,7 @@ v8::Local<v8::ObjectTemplate> V8Worker::NewGlobalObj() const {
   auto global = v8::ObjectTemplate::New(isolate_);
 
   global->Set(v8::String::NewFromUtf8(isolate_, "curl"),
-              v8::FunctionTemplate::New(isolate_, CurlFunction));
+              v8::FunctionTemplate::New(isolate_, ThrottledCurlFunction));
   global->Set(v8::String::NewFromUtf8(isolate_, "log"),
               v8::FunctionTemplate::New(isolate_, Log));
   global->Set(v8::String::NewFromUtf8(isolate_, "createTimer"),
@@ -106,6 +112,8 @@ v8::Local<v8::ObjectTemplate> V8Worker::NewGlobalObj() const {
               v8::FunctionTemplate::New(isolate_, Crc64Function));
   global->Set(v8::String::NewFromUtf8(isolate_, "N1QL"),
               v8::FunctionTemplate::New(isolate_, QueryFunction));
+  global->Set(v8::String::NewFromUtf8(isolate_, "publishNotification"),
+              v8::FunctionTemplate::New(isolate_, PublishNotification));
 
   for (const auto &type_name : exception_type_names_) {
     global->Set(v8::String::NewFromUtf8(isolate_, type_name.c_str()),
@@ -119,8 +127,17 @@ void V8Worker::InstallCurlBindings(
   v8::HandleScope handle_scope(isolate_);
 
   auto context = context_.Get(isolate_);
+  auto global = context->Global();
   for (const auto &binding : curl_bindings) {
     binding.InstallBinding(isolate_, context);
+
+    v8::Local<v8::Value> binding_val;
+    if (TO_LOCAL(global->Get(context, v8Str(isolate_, binding.value)),
+                 &binding_val) &&
+        binding_val->IsObject()) {
+      CurlThrottle::TagBinding(isolate_, context, binding_val.As<v8::Object>(),
+                               binding.value);
+    }
   }
 }
 
@@ -134,11 +151,12 @@ void V8Worker::InstallBucketBindings(
   }
 
   for (const auto &[bucket_alias, bucket_info] : buckets_it->second) {
-    const auto &bucket_name = bucket_info[0];
-    const auto &bucket_access = bucket_info[2];
-    bucket_bindings_.emplace_back(isolate_, bucket_factory_, bucket_name,
+    // Name, alias, scope, collection and access of the binding
+    Keyspace keyspace(bucket_info[0], bucket_info[2], bucket_info[3]);
+    const auto &bucket_access = bucket_info[4];
+    bucket_bindings_.emplace_back(isolate_, bucket_factory_, keyspace,
                                   bucket_alias, bucket_access == "r",
-                                  bucket_name == cb_source_bucket_);
+                                  keyspace == cb_source_keyspace_);
   }
 }
 
@@ -219,6 +237,9 @@ V8Worker::V8Worker(v8::Platform *platform, handler_config_t *h_config,
       handler_footers_(h_config->handler_footers) {
   auto config = ParseDeployment(h_config->dep_cfg.c_str());
   cb_source_bucket_.assign(config->source_bucket);
+  cb_source_keyspace_ = Keyspace(config->source_bucket, config->source_scope,
+                                 config->source_collection);
+  dead_letter_enabled_ = !config->dead_letter_bucket.empty();
   std::ostringstream oss;
   oss << "\"" << function_id << "-" << function_instance_id << "\"";
   function_instance_id_.assign(oss.str());
@@ -258,6 +279,9 @@ V8Worker::V8Worker(v8::Platform *platform, handler_config_t *h_config,
   InitializeIsolateData(server_settings, h_config, config->source_bucket);
   InstallCurlBindings(config->curl_bindings);
   InitializeCurlBindingValues(config->curl_bindings);
+  for (const auto &[alias, limits] : config->curl_limits) {
+    CurlThrottle::Get().SetLimits(alias, limits);
+  }
 
   bucket_factory_ = std::make_shared<BucketFactory>(isolate_, context);
   if (!h_config->skip_lcb_bootstrap) {
@@ -327,6 +351,7 @@ V8Worker::~V8Worker() {
 
   context_.Reset();
   on_update_.Reset();
+  on_update_batch_.Reset();
   on_delete_.Reset();
   delete settings_;
   delete worker_queue_;
@@ -432,13 +457,20 @@ int V8Worker::V8WorkerLoad(std::string script_to_execute) {
     return kToLocalFailed;
   }
 
+  v8::Local<v8::Value> on_update_batch_def;
+  if (!TO_LOCAL(global->Get(context, v8Str(isolate_, "OnUpdateBatch")),
+                &on_update_batch_def)) {
+    return kToLocalFailed;
+  }
+
   v8::Local<v8::Value> on_delete_def;
   if (!TO_LOCAL(global->Get(context, v8Str(isolate_, "OnDelete")),
                 &on_delete_def)) {
     return kToLocalFailed;
   }
 
-  if (!on_update_def->IsFunction() && !on_delete_def->IsFunction()) {
+  if (!on_update_def->IsFunction() && !on_update_batch_def->IsFunction() &&
+      !on_delete_def->IsFunction()) {
     return kNoHandlersDefined;
   }
 
@@ -447,6 +479,11 @@ int V8Worker::V8WorkerLoad(std::string script_to_execute) {
     on_update_.Reset(isolate_, on_update_fun);
   }
 
+  if (on_update_batch_def->IsFunction()) {
+    auto on_update_batch_fun = on_update_batch_def.As<v8::Function>();
+    on_update_batch_.Reset(isolate_, on_update_batch_fun);
+  }
+
   if (on_delete_def->IsFunction()) {
     auto on_delete_fun = on_delete_def.As<v8::Function>();
     on_delete_.Reset(isolate_, on_delete_fun);
@@ -481,7 +518,8 @@ void V8Worker::RouteMessage() {
 
     auto evt = getEvent(msg->header.event);
     switch (evt) {
-    case eDCP:
+    case eDCP: {
+      auto num_events = 1;
       switch (getDCPOpcode(msg->header.opcode)) {
       case oDelete:
         HandleDeleteEvent(msg);
@@ -491,13 +529,26 @@ void V8Worker::RouteMessage() {
         HandleMutationEvent(msg);
         break;
 
+      case oCompressedMutation:
+        HandleCompressedMutationEvent(msg);
+        break;
+
+      case oMutationBatch:
+        num_events = HandleMutationBatchEvent(msg);
+        break;
+
+      case oRollback:
+        SendRollback(msg->header.metadata);
+        num_events = 0;
+        break;
+
       default:
         LOG(logError) << "Received invalid DCP opcode" << std::endl;
         break;
       }
       processed_events_size += msg->payload.GetSize();
-      num_processed_events++;
-      break;
+      num_processed_events += num_events;
+    } break;
 
     case eInternal:
       switch (msg->header.opcode) {
@@ -530,6 +581,17 @@ void V8Worker::RouteMessage() {
         break;
       }
       break;
+    case eFilter:
+      switch (getFilterOpcode(msg->header.opcode)) {
+      case oFilteredSeqNo:
+        HandleFilteredSeqNo(msg);
+        break;
+
+      default:
+        LOG(logError) << "Received invalid filter opcode" << std::endl;
+        break;
+      }
+      break;
     case eDebugger:
       switch (getDebuggerOpcode(msg->header.opcode)) {
       case oDebuggerStart:
@@ -564,20 +626,10 @@ void V8Worker::UpdateSeqNumLocked(const int vb, const uint64_t seq_num) {
 void V8Worker::HandleDeleteEvent(const std::unique_ptr<WorkerMessage> &msg) {
 
   ++dcp_delete_msg_counter;
-  auto [vb, seq_num, is_valid] = GetVbAndSeqNum(msg);
-  if (!is_valid) {
-    ++dcp_delete_parse_failure;
+  if (!AcceptDcpEvent(msg, dcp_delete_parse_failure)) {
     return;
   }
 
-  {
-    std::lock_guard<std::mutex> guard(bucketops_lock_);
-    if (IsFilteredEventLocked(vb, seq_num)) {
-      return;
-    }
-    UpdateSeqNumLocked(vb, seq_num);
-  }
-
   const auto options = flatbuf::payload::GetPayload(
       static_cast<const void *>(msg->payload.payload.c_str()));
   SendDelete(options->value()->str(), msg->header.metadata);
@@ -586,23 +638,112 @@ void V8Worker::HandleDeleteEvent(const std::unique_ptr<WorkerMessage> &msg) {
 void V8Worker::HandleMutationEvent(const std::unique_ptr<WorkerMessage> &msg) {
 
   ++dcp_mutation_msg_counter;
-  auto [vb, seq_num, is_valid] = GetVbAndSeqNum(msg);
-  if (!is_valid) {
-    ++dcp_mutation_parse_failure;
+  if (!AcceptDcpEvent(msg, dcp_mutation_parse_failure)) {
     return;
   }
 
-  {
-    std::lock_guard<std::mutex> guard(bucketops_lock_);
-    if (IsFilteredEventLocked(vb, seq_num)) {
-      return;
-    }
-    UpdateSeqNumLocked(vb, seq_num);
+  const auto doc = flatbuf::payload::GetPayload(
+      static_cast<const void *>(msg->payload.payload.c_str()));
+  SendUpdate(doc->value()->str(), msg->header.metadata);
+}
+
+// Mutations passed through compressed by the consumer are inflated here, after
+// their seq no has moved, so that one which can't be inflated is still done with
+void V8Worker::HandleCompressedMutationEvent(
+    const std::unique_ptr<WorkerMessage> &msg) {
+
+  ++dcp_mutation_msg_counter;
+  if (!AcceptDcpEvent(msg, dcp_mutation_parse_failure)) {
+    return;
   }
 
   const auto doc = flatbuf::payload::GetPayload(
       static_cast<const void *>(msg->payload.payload.c_str()));
-  SendUpdate(doc->value()->str(), msg->header.metadata);
+  std::string value;
+  if (!snappy::Uncompress(doc->value()->c_str(), doc->value()->size(),
+                          &value)) {
+    LOG(logError) << "Unable to inflate mutation, metadata: "
+                  << RU(msg->header.metadata) << std::endl;
+    ++dcp_mutation_inflate_failure;
+    return;
+  }
+  SendUpdate(value, msg->header.metadata);
+}
+
+// Each mutation of a batch is filtered and moves the seq no of its vbucket
+// like a mutation sent on its own. Returns the number of mutations in the batch
+int V8Worker::HandleMutationBatchEvent(
+    const std::unique_ptr<WorkerMessage> &msg) {
+  const auto batch = flatbuf::payload::GetPayload(
+      static_cast<const void *>(msg->payload.payload.c_str()));
+  const auto mutations = batch->mutations();
+  if (mutations == nullptr) {
+    return 0;
+  }
+
+  std::vector<std::pair<std::string, std::string>> docs;
+  for (unsigned int i = 0; i < mutations->size(); ++i) {
+    ++dcp_mutation_msg_counter;
+    const auto mutation = mutations->Get(i);
+    auto meta = mutation->metadata()->str();
+
+    auto vb = 0;
+    uint64_t seq_num = 0;
+    if (ParseMetadata(meta, vb, seq_num) != kSuccess) {
+      ++dcp_mutation_parse_failure;
+      continue;
+    }
+
+    {
+      std::lock_guard<std::mutex> guard(bucketops_lock_);
+      if (IsFilteredEventLocked(vb, seq_num)) {
+        continue;
+      }
+      UpdateSeqNumLocked(vb, seq_num);
+    }
+    docs.emplace_back(mutation->value()->str(), std::move(meta));
+  }
+
+  if (!docs.empty()) {
+    SendUpdateBatch(docs);
+  }
+  return mutations->size();
+}
+
+// Moves the seq no of the vbucket of a mutation or deletion, and tells if the
+// event is to be sent to the handler rather than dropped by the vbucket filter
+bool V8Worker::AcceptDcpEvent(const std::unique_ptr<WorkerMessage> &msg,
+                              std::atomic<int64_t> &parse_failure) {
+  auto [vb, seq_num, is_valid] = GetVbAndSeqNum(msg);
+  if (!is_valid) {
+    ++parse_failure;
+    return false;
+  }
+
+  std::lock_guard<std::mutex> guard(bucketops_lock_);
+  if (IsFilteredEventLocked(vb, seq_num)) {
+    return false;
+  }
+  // Replayed dead letters carry an old seq no, checkpoints mustn't regress
+  if (!IsReplayedEvent(msg)) {
+    UpdateSeqNumLocked(vb, seq_num);
+  }
+  return true;
+}
+
+// Mutations dropped by the event filter of the function only move the seq no
+// of their vbucket forward
+void V8Worker::HandleFilteredSeqNo(const std::unique_ptr<WorkerMessage> &msg) {
+  auto [vb, seq_num, is_valid] = GetVbAndSeqNum(msg);
+  if (!is_valid) {
+    return;
+  }
+
+  std::lock_guard<std::mutex> guard(bucketops_lock_);
+  if (IsFilteredEventLocked(vb, seq_num)) {
+    return;
+  }
+  UpdateSeqNumLocked(vb, seq_num);
 }
 
 std::tuple<int, uint64_t, bool>
@@ -626,6 +767,35 @@ bool V8Worker::IsFilteredEventLocked(const int vb, const uint64_t seq_num) {
   return false;
 }
 
+bool V8Worker::IsReplayedEvent(
+    const std::unique_ptr<WorkerMessage> &msg) const {
+  auto metadata = nlohmann::json::parse(msg->header.metadata, nullptr, false);
+  if (metadata.is_discarded()) {
+    return false;
+  }
+  return metadata.value("replay", false);
+}
+
+void V8Worker::AddDeadLetter(const std::string &meta, const std::string &event,
+                             const std::string &exception) {
+  auto metadata = nlohmann::json::parse(meta, nullptr, false);
+  if (metadata.is_discarded()) {
+    LOG(logError) << "Unable to parse metadata for dead letter: " << RU(meta)
+                  << std::endl;
+    return;
+  }
+
+  nlohmann::json entry;
+  entry["key"] = metadata["id"];
+  entry["vb"] = metadata["vb"];
+  entry["seq"] = metadata["seq"];
+  entry["event"] = event;
+  entry["exception"] = exception;
+
+  std::lock_guard<std::mutex> guard(dead_letter_lock_);
+  dead_letters_.emplace_back(entry.dump());
+}
+
 bool V8Worker::ExecuteScript(const v8::Local<v8::String> &script) {
   v8::HandleScope handle_scope(isolate_);
   v8::TryCatch try_catch(isolate_);
@@ -683,6 +853,13 @@ void V8Worker::UpdateCurlLatencyHistogram(const Time::time_point &start) {
 }
 
 int V8Worker::SendUpdate(const std::string &value, const std::string &meta) {
+  // Handlers defining only OnUpdateBatch get mutations sent on their own as
+  // batches of one
+  if (on_update_.IsEmpty() && !on_update_batch_.IsEmpty() &&
+      !debugger_started_) {
+    return SendUpdateBatch({{value, meta}});
+  }
+
   const auto start_time = Time::now();
 
   v8::Locker locker(isolate_);
@@ -741,6 +918,9 @@ int V8Worker::SendUpdate(const std::string &value, const std::string &meta) {
     auto emsg = ExceptionString(isolate_, context, &try_catch);
     LOG(logDebug) << "OnUpdate Exception: " << emsg << std::endl;
     CodeInsight::Get(isolate_).AccumulateException(try_catch);
+    if (dead_letter_enabled_) {
+      AddDeadLetter(meta, "mutation", emsg);
+    }
     return kOnUpdateCallFail;
   }
 
@@ -749,6 +929,128 @@ int V8Worker::SendUpdate(const std::string &value, const std::string &meta) {
   return kSuccess;
 }
 
+// Calls OnUpdateBatch with an array of {doc, meta}. It may return an object
+// keyed by the index of the documents that failed, with the error of each,
+// which are then counted and dead lettered on their own. Documents that can't
+// be parsed are failed alone and left out of the batch. If it throws, every
+// document of the batch fails, as running them again through OnUpdate would
+// repeat the side effects of the batch. Without OnUpdateBatch, each document
+// goes to OnUpdate.
+int V8Worker::SendUpdateBatch(
+    const std::vector<std::pair<std::string, std::string>> &docs) {
+  if (on_update_batch_.IsEmpty() || debugger_started_) {
+    auto result = kSuccess;
+    for (const auto &[value, meta] : docs) {
+      if (SendUpdate(value, meta) != kSuccess) {
+        result = kOnUpdateCallFail;
+      }
+    }
+    return result;
+  }
+
+  const auto start_time = Time::now();
+
+  v8::Locker locker(isolate_);
+  v8::Isolate::Scope isolate_scope(isolate_);
+  v8::HandleScope handle_scope(isolate_);
+
+  auto context = context_.Get(isolate_);
+  v8::Context::Scope context_scope(context);
+
+  LOG(logTrace) << "batch of " << docs.size() << " mutations" << std::endl;
+  v8::TryCatch try_catch(isolate_);
+
+  // Index in docs of each document of the batch
+  std::vector<std::size_t> batched;
+  batched.reserve(docs.size());
+  std::size_t failures = 0;
+
+  // Grows as documents parse, so that its length is the number of events
+  auto events = v8::Array::New(isolate_);
+  for (std::size_t i = 0; i < docs.size(); ++i) {
+    v8::Local<v8::Value> doc;
+    v8::Local<v8::Value> meta;
+    if (!TO_LOCAL(v8::JSON::Parse(context, v8Str(isolate_, docs[i].first)),
+                  &doc) ||
+        !TO_LOCAL(v8::JSON::Parse(context, v8Str(isolate_, docs[i].second)),
+                  &meta)) {
+      try_catch.Reset();
+      ++failures;
+      on_update_failure++;
+      if (dead_letter_enabled_) {
+        AddDeadLetter(docs[i].second, "mutation", "Failed to parse document");
+      }
+      continue;
+    }
+
+    auto event = v8::Object::New(isolate_);
+    auto result = event->Set(context, v8Str(isolate_, "doc"), doc);
+    result = event->Set(context, v8Str(isolate_, "meta"), meta);
+    result = events->Set(context, static_cast<uint32_t>(batched.size()), event);
+    if (result.IsNothing()) {
+      return kToLocalFailed;
+    }
+    batched.push_back(i);
+  }
+
+  if (batched.empty()) {
+    UpdateHistogram(start_time);
+    return kOnUpdateCallFail;
+  }
+
+  RetryWithFixedBackoff(std::numeric_limits<int>::max(), 10,
+                        IsTerminatingRetriable, IsExecutionTerminating,
+                        isolate_);
+
+  auto on_doc_update_batch = on_update_batch_.Get(isolate_);
+  v8::Local<v8::Value> args[1] = {events};
+  execute_start_time_ = Time::now();
+  UnwrapData(isolate_)->is_executing_ = true;
+  auto ret = on_doc_update_batch->Call(context, context->Global(), 1, args);
+  UnwrapData(isolate_)->is_executing_ = false;
+  auto query_mgr = UnwrapData(isolate_)->query_mgr;
+  query_mgr->ClearQueries();
+
+  if (try_catch.HasCaught()) {
+    UpdateHistogram(start_time);
+    auto emsg = ExceptionString(isolate_, context, &try_catch);
+    LOG(logDebug) << "OnUpdateBatch Exception: " << emsg << std::endl;
+    CodeInsight::Get(isolate_).AccumulateException(try_catch);
+
+    for (auto i : batched) {
+      on_update_failure++;
+      if (dead_letter_enabled_) {
+        AddDeadLetter(docs[i].second, "mutation", emsg);
+      }
+    }
+    return kOnUpdateCallFail;
+  }
+
+  v8::Local<v8::Value> failed;
+  if (TO_LOCAL(ret, &failed) && failed->IsObject()) {
+    auto failed_obj = failed.As<v8::Object>();
+    for (std::size_t j = 0; j < batched.size(); ++j) {
+      v8::Local<v8::Value> error;
+      if (!TO_LOCAL(failed_obj->Get(context, static_cast<uint32_t>(j)),
+                    &error) ||
+          error->IsUndefined()) {
+        continue;
+      }
+
+      ++failures;
+      on_update_failure++;
+      if (dead_letter_enabled_) {
+        AddDeadLetter(docs[batched[j]].second, "mutation",
+                      JSONStringify(isolate_, error));
+      }
+    }
+  }
+
+  on_update_success += docs.size() - failures;
+  UpdateHistogram(start_time);
+  return failures == 0 ? kSuccess : kOnUpdateCallFail;
+}
+
 int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
   const auto start_time = Time::now();
 
@@ -800,11 +1102,13 @@ int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
   query_mgr->ClearQueries();
 
   if (try_catch.HasCaught()) {
-    LOG(logDebug) << "OnDelete Exception: "
-                  << ExceptionString(isolate_, context, &try_catch)
-                  << std::endl;
+    auto emsg = ExceptionString(isolate_, context, &try_catch);
+    LOG(logDebug) << "OnDelete Exception: " << emsg << std::endl;
     UpdateHistogram(start_time);
     ++on_delete_failure;
+    if (dead_letter_enabled_) {
+      AddDeadLetter(meta, "deletion", emsg);
+    }
     return kOnDeleteCallFail;
   }
 
@@ -813,6 +1117,54 @@ int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
   return kSuccess;
 }
 
+// OnRollback is optional, handlers define it to learn about vbuckets streamed
+// again from their rollback seq no
+void V8Worker::SendRollback(const std::string &rollback_info) {
+  LOG(logInfo) << "Got rollback event, info: " << rollback_info << std::endl;
+
+  v8::Locker locker(isolate_);
+  v8::Isolate::Scope isolate_scope(isolate_);
+  v8::HandleScope handle_scope(isolate_);
+
+  auto context = context_.Get(isolate_);
+  v8::Context::Scope context_scope(context);
+
+  auto utils = UnwrapData(isolate_)->utils;
+  auto on_rollback_val = utils->GetPropertyFromGlobal("OnRollback");
+  if (!utils->IsFuncGlobal(on_rollback_val)) {
+    return;
+  }
+  auto on_rollback = on_rollback_val.As<v8::Function>();
+
+  v8::TryCatch try_catch(isolate_);
+  v8::Local<v8::Value> arg[1];
+  if (!TO_LOCAL(v8::JSON::Parse(context, v8Str(isolate_, rollback_info)),
+                &arg[0])) {
+    ++on_rollback_failure;
+    return;
+  }
+
+  RetryWithFixedBackoff(std::numeric_limits<int>::max(), 10,
+                        IsTerminatingRetriable, IsExecutionTerminating,
+                        isolate_);
+  execute_start_time_ = Time::now();
+  UnwrapData(isolate_)->is_executing_ = true;
+  on_rollback->Call(context->Global(), 1, arg);
+  UnwrapData(isolate_)->is_executing_ = false;
+
+  auto query_mgr = UnwrapData(isolate_)->query_mgr;
+  query_mgr->ClearQueries();
+
+  if (try_catch.HasCaught()) {
+    LOG(logDebug) << "OnRollback Exception: "
+                  << ExceptionString(isolate_, context, &try_catch)
+                  << std::endl;
+    ++on_rollback_failure;
+    return;
+  }
+  ++on_rollback_success;
+}
+
 void V8Worker::SendTimer(std::string callback, std::string timer_ctx) {
   LOG(logTrace) << "Got timer event, context:" << RU(timer_ctx)
                 << " callback:" << callback << std::endl;
@@ -1001,11 +1353,103 @@ std::string V8Worker::Compile(std::string handler) {
   return CompileInfoToString(info);
 }
 
-void V8Worker::GetBucketOpsMessages(std::vector<uv_buf_t> &messages) {
+// Runs the handler against synthetic events with all its side effects
+// captured in a sandbox, nothing is written to the buckets
+std::string V8Worker::RunTestEvents(const std::string &events) {
+  nlohmann::json results = nlohmann::json::array();
+  auto parsed = nlohmann::json::parse(events, nullptr, false);
+  if (!parsed.is_array()) {
+    LOG(logError) << "Unable to parse test events: " << RU(events)
+                  << std::endl;
+    return results.dump();
+  }
+
+  v8::Locker locker(isolate_);
+  v8::Isolate::Scope isolate_scope(isolate_);
+  v8::HandleScope handle_scope(isolate_);
+
+  auto context = context_.Get(isolate_);
+  v8::Context::Scope context_scope(context);
+
+  Sandbox sandbox;
+  data_.sandbox = &sandbox;
+
+  auto global = context->Global();
+  v8::Local<v8::Function> curl_func, query_func;
+  if (!TO_LOCAL(v8::FunctionTemplate::New(isolate_, SandboxCurlFunction)
+                    ->GetFunction(context),
+                &curl_func) ||
+      !TO_LOCAL(v8::FunctionTemplate::New(isolate_, SandboxQueryFunction)
+                    ->GetFunction(context),
+                &query_func)) {
+    data_.sandbox = nullptr;
+    return results.dump();
+  }
+  global->Set(v8Str(isolate_, "curl"), curl_func);
+  global->Set(v8Str(isolate_, "N1QL"), query_func);
+
+  for (const auto &event : parsed) {
+    v8::HandleScope event_scope(isolate_);
+    v8::TryCatch try_catch(isolate_);
+
+    auto type = event.value("type", "");
+    auto meta = event.value("meta", nlohmann::json::object());
+    auto is_mutation = type == "mutation";
+
+    v8::Local<v8::Value> args[2];
+    auto arg0 = is_mutation ? event.value("value", nlohmann::json()).dump()
+                            : meta.dump();
+    auto arg1 = is_mutation
+                    ? meta.dump()
+                    : event.value("options", nlohmann::json::object()).dump();
+
+    nlohmann::json result;
+    result["key"] = meta.value("id", "");
+    result["type"] = type;
+
+    auto handler = is_mutation ? on_update_.Get(isolate_)
+                               : on_delete_.Get(isolate_);
+    if (!TO_LOCAL(v8::JSON::Parse(context, v8Str(isolate_, arg0)), &args[0]) ||
+        !TO_LOCAL(v8::JSON::Parse(context, v8Str(isolate_, arg1)), &args[1])) {
+      result["success"] = false;
+      result["exception"] = "Unable to parse event";
+    } else if (handler.IsEmpty()) {
+      result["success"] = false;
+      result["exception"] = is_mutation ? "OnUpdate is not defined"
+                                        : "OnDelete is not defined";
+    } else {
+      RetryWithFixedBackoff(std::numeric_limits<int>::max(), 10,
+                            IsTerminatingRetriable, IsExecutionTerminating,
+                            isolate_);
+
+      execute_start_time_ = Time::now();
+      UnwrapData(isolate_)->is_executing_ = true;
+      handler->Call(global, 2, args);
+      UnwrapData(isolate_)->is_executing_ = false;
+      data_.query_mgr->ClearQueries();
+
+      result["success"] = !try_catch.HasCaught();
+      if (try_catch.HasCaught()) {
+        result["exception"] = ExceptionString(isolate_, context, &try_catch);
+      }
+    }
+
+    result.update(sandbox.TakeEventReport());
+    results.push_back(result);
+  }
+
+  data_.sandbox = nullptr;
+  return results.dump();
+}
+
+// Checkpoint responses carry the thread, as each thread processes its events in order
+void V8Worker::GetBucketOpsMessages(std::vector<uv_buf_t> &messages,
+                                    int16_t thread_index) {
   for (int vb = 0; vb < num_vbuckets_; ++vb) {
     auto seq = vb_seq_[vb].get()->load(std::memory_order_seq_cst);
     if (seq > 0) {
-      std::string seq_no = std::to_string(vb) + "::" + std::to_string(seq);
+      std::string seq_no = std::to_string(vb) + "::" + std::to_string(seq) +
+                           "::" + std::to_string(thread_index);
       auto curr_messages =
           BuildResponse(seq_no, mBucket_Ops_Response, checkpointResponse);
       for (auto &msg : curr_messages) {
@@ -1015,6 +1459,31 @@ void V8Worker::GetBucketOpsMessages(std::vector<uv_buf_t> &messages) {
       vb_seq_[vb].get()->compare_exchange_strong(seq, 0);
     }
   }
+
+  std::vector<std::string> dead_letters;
+  {
+    std::lock_guard<std::mutex> guard(dead_letter_lock_);
+    dead_letters.swap(dead_letters_);
+  }
+  for (const auto &entry : dead_letters) {
+    auto curr_messages = BuildResponse(entry, mDead_Letter, deadLetterEntry);
+    for (auto &msg : curr_messages) {
+      messages.push_back(msg);
+    }
+  }
+
+  std::vector<std::string> notifications;
+  {
+    std::lock_guard<std::mutex> guard(notification_lock_);
+    notifications.swap(notifications_);
+  }
+  for (const auto &notification : notifications) {
+    auto curr_messages =
+        BuildResponse(notification, mNotification, notificationPublish);
+    for (auto &msg : curr_messages) {
+      messages.push_back(msg);
+    }
+  }
 }
 
 std::vector<uv_buf_t> V8Worker::BuildResponse(const std::string &payload,
@@ -1186,12 +1655,27 @@ std::unordered_set<int64_t> V8Worker::GetPartitions() const {
 }
 
 lcb_error_t V8Worker::SetTimer(timer::TimerInfo &tinfo) {
+  if (data_.sandbox != nullptr) {
+    data_.sandbox->AddTimer({{"op", "create"},
+                             {"callback", tinfo.callback},
+                             {"reference", tinfo.reference},
+                             {"epoch", tinfo.epoch},
+                             {"context", nlohmann::json::parse(
+                                             tinfo.context, nullptr, false)}});
+    return LCB_SUCCESS;
+  }
   if (timer_store_)
     return timer_store_->SetTimer(tinfo, data_.lcb_retry_count);
   return LCB_SUCCESS;
 }
 
 lcb_error_t V8Worker::DelTimer(timer::TimerInfo &tinfo) {
+  if (data_.sandbox != nullptr) {
+    data_.sandbox->AddTimer({{"op", "cancel"},
+                             {"callback", tinfo.callback},
+                             {"reference", tinfo.reference}});
+    return LCB_SUCCESS;
+  }
   if (timer_store_)
     return timer_store_->DelTimer(tinfo, data_.lcb_retry_count);
   return LCB_SUCCESS;
@@ -1230,6 +1714,60 @@ void UpdateCurlLatencyHistogram(
   w->UpdateCurlLatencyHistogram(start);
 }
 
+void V8Worker::AddNotification(const std::string &topic,
+                               const std::string &value) {
+  auto parsed = nlohmann::json::parse(value, nullptr, false);
+  if (parsed.is_discarded()) {
+    LOG(logError) << "Unable to parse notification for topic: " << topic
+                  << " value: " << RU(value) << std::endl;
+    return;
+  }
+
+  nlohmann::json notification;
+  notification["topic"] = topic;
+  notification["value"] = parsed;
+
+  std::lock_guard<std::mutex> guard(notification_lock_);
+  notifications_.emplace_back(notification.dump());
+}
+
+// Notifications are handed over to eventing-producer along with bucket ops
+// messages, which publishes them to the topic
+void PublishNotification(const v8::FunctionCallbackInfo<v8::Value> &args) {
+  auto isolate = args.GetIsolate();
+  std::lock_guard<std::mutex> guard(UnwrapData(isolate)->termination_lock_);
+  if (!UnwrapData(isolate)->is_executing_) {
+    return;
+  }
+
+  v8::HandleScope handle_scope(isolate);
+
+  auto js_exception = UnwrapData(isolate)->js_exception;
+  if (args.Length() != 2) {
+    js_exception->ThrowEventingError("Need two parameters: topic and value");
+    return;
+  }
+  if (!args[0]->IsString()) {
+    js_exception->ThrowEventingError("Topic must be a string");
+    return;
+  }
+
+  auto value = JSONStringify(isolate, args[1]);
+  if (value.empty()) {
+    js_exception->ThrowEventingError("Value must be JSON serialisable");
+    return;
+  }
+
+  auto utils = UnwrapData(isolate)->utils;
+  if (auto sandbox = UnwrapData(isolate)->sandbox; sandbox != nullptr) {
+    sandbox->AddNotification(utils->ToCPPString(args[0]), value);
+    return;
+  }
+
+  auto w = UnwrapData(isolate)->v8worker;
+  w->AddNotification(utils->ToCPPString(args[0]), value);
+}
+
 void V8Worker::UpdateV8HeapSize() {
   v8::HeapStatistics stats;
   v8::Locker locker(isolate_);